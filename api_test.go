@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestDiffRootTransformedResources(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+namespace: prod
+commonLabels:
+  team: web
+resources:
+  - deployment.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      name: web
+      namespace: prod
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+		"/app/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := kdiff.Diff(fs, "/app", kdiff.Options{BuildFinal: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0}, result.Unmatched, "Root patches match resources before the root namespace is set")
+	replicas, err := result.Final.Resources()[0].GetFieldValue("spec.replicas")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, replicas, "Kustomize doesn't apply the patch either")
+
+	res, ok := result.Resources["Deployment.v1.apps/web.prod"]
+	if assert.True(t, ok, "Resources are known by their final key") {
+		assert.Equal(t, "", res.GetNamespace(), "Resources are kept as root patches see them")
+		assert.Empty(t, res.GetLabels())
+	}
+	_, stale := result.Resources["Deployment.v1.apps/web.[noNs]"]
+	assert.False(t, stale, "The key from before the namespace is dropped")
+
+	sources := make(map[string]string)
+	for _, change := range result.FieldSources {
+		assert.Equal(t, "Deployment.v1.apps/web.prod", change.Resource)
+		assert.Equal(t, "/app/kustomization.yaml", change.Source)
+		sources[strings.Join(change.Path, ".")] = change.SourceType
+	}
+	assert.Equal(t, map[string]string{
+		"metadata.namespace": "transformer:namespace",
+		"metadata.labels":    "transformer:commonLabels",
+		"spec.selector":      "transformer:commonLabels",
+		"spec.template":      "transformer:commonLabels",
+	}, sources, "Root transformer fields are attributed to the root kustomization")
+	assert.Empty(t, result.Unattributed)
+	assert.Equal(t, "namespace transformer (kustomization.yaml)", describeSource(kdiff.FieldSource{Source: "/app/kustomization.yaml", SourceType: "transformer:namespace"}))
+}
+
+func TestDiffUnattributedChanges(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - web.yaml
+patches:
+  - path: labels.yaml
+`,
+		"/app/web.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+    tier: frontend
+spec:
+  replicas: 1
+`,
+		"/app/labels.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    $patch: replace
+    app: shop
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	// Patch directives aren't modelled, so kustomize removing the label the
+	// replacing patch leaves out is a gap, and so is the directive we record
+	// as a label but kustomize doesn't keep
+	result, err := kdiff.Diff(fs, "/app", kdiff.Options{BuildFinal: true})
+	assert.NoError(t, err)
+	gaps := make(map[string][2]interface{})
+	for _, gap := range result.Unattributed {
+		assert.Equal(t, "Deployment.v1.apps/web.[noNs]", gap.Resource)
+		assert.Equal(t, "no tracked patch or transformer", describeSource(gap))
+		gaps[strings.Join(gap.Path, ".")] = [2]interface{}{gap.Original, gap.New}
+	}
+	assert.Equal(t, map[string][2]interface{}{
+		"metadata.labels.tier":   {"frontend", nil},
+		"metadata.labels.$patch": {"replace", nil},
+	}, gaps)
+
+	result, err = kdiff.Diff(fs, "/app", kdiff.Options{BuildFinal: true, IgnorePaths: []string{"metadata.labels"}})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Unattributed, "Ignored paths shouldn't be reported as gaps")
+
+	result, err = kdiff.Diff(fs, "/app", kdiff.Options{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Unattributed, "The check needs the final build")
+}
+
+func TestDiffMergeKeyOverride(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - gateway.yaml
+patches:
+  - path: patch.yaml
+    target:
+      kind: Gateway
+      name: edge
+`,
+		"/app/gateway.yaml": `
+apiVersion: example.com/v1
+kind: Gateway
+metadata:
+  name: edge
+spec:
+  routes:
+    - host: api.example.com
+      timeout: 10s
+    - host: www.example.com
+      timeout: 10s
+`,
+		"/app/patch.yaml": `
+apiVersion: example.com/v1
+kind: Gateway
+metadata:
+  name: edge
+spec:
+  routes:
+    - host: www.example.com
+      timeout: 30s
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := kdiff.Diff(fs, "/app", kdiff.Options{})
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(result.FieldSources)) {
+		assert.Equal(t, []string{"spec", "routes"}, result.FieldSources[0].Path, "Unknown lists are appended to")
+	}
+
+	mergeKeys, err := parseMergeKeys([]string{"spec.routes=host"})
+	assert.NoError(t, err)
+	result, err = kdiff.Diff(fs, "/app", kdiff.Options{MergeKeys: mergeKeys})
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(result.FieldSources)) {
+		change := result.FieldSources[0]
+		assert.Equal(t, []string{"spec", "routes", "1", "timeout"}, change.Path)
+		assert.Equal(t, "host=www.example.com", change.Element)
+		assert.Equal(t, "10s", change.Original)
+		assert.Equal(t, "30s", change.New)
+	}
+}
+
+func TestReportOmitsFullyIgnoredResources(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+  - config.yaml
+patches:
+  - path: annotations.yaml
+    target:
+      kind: ConfigMap
+      name: config
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/deployment.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 1\n",
+		"/app/config.yaml":     "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n",
+		"/app/annotations.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  annotations:
+    team: web
+`,
+		"/app/replicas.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 3\n",
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := kdiff.Diff(fs, "/app", kdiff.Options{IgnorePaths: []string{"metadata.annotations"}})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	writeFieldChanges(&buf, "Field Changes", result.FieldSources, textStyle{})
+	assert.Contains(t, buf.String(), "Resource: Deployment.v1.apps/web.[noNs]")
+	assert.NotContains(t, buf.String(), "ConfigMap/config", "A resource whose changes are all ignored shouldn't get a header")
+	assert.Equal(t, 1, strings.Count(buf.String(), "Changes:"), "No empty Changes: sections")
+}
+
+func TestDiffImplicitTransformations(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/base/kustomization.yaml": `
+commonLabels:
+  team: web
+resources:
+  - deployment.yaml
+`,
+		"/app/kustomization.yaml": `
+resources:
+  - base
+patches:
+  - path: patch.yaml
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+        - name: web
+          image: web:1
+`,
+		"/app/patch.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := kdiff.Diff(fs, "/app", kdiff.Options{BuildFinal: true})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Implicit, "Implicit changes are only reported on request")
+
+	result, err = kdiff.Diff(fs, "/app", kdiff.Options{BuildFinal: true, IncludeTransformerDefaults: true})
+	assert.NoError(t, err)
+	categories := make(map[string]string)
+	for _, change := range result.Implicit {
+		assert.Equal(t, "Deployment.v1.apps/web.[noNs]", change.Resource)
+		assert.Equal(t, kdiff.SourceTypeImplicit, change.SourceType)
+		categories[strings.Join(change.Path, ".")] = change.Source
+	}
+	assert.Equal(t, map[string]string{
+		"metadata.labels.team":               "common labels and annotations",
+		"spec.selector.matchLabels.team":     "label propagation into selectors and templates",
+		"spec.template.metadata.labels.team": "label propagation into selectors and templates",
+	}, categories, "The patched replicas are explained and left out")
+	assert.Equal(t, "implicit kustomize transformation (label propagation into selectors and templates)", describeSource(kdiff.FieldSource{SourceType: kdiff.SourceTypeImplicit, Source: "label propagation into selectors and templates"}))
+
+	// commonLabels of the root kustomization are explicit
+	assert.NoError(t, fs.WriteFile("/app/kustomization.yaml", []byte(`
+commonLabels:
+  owner: platform
+resources:
+  - base
+`)))
+	result, err = kdiff.Diff(fs, "/app", kdiff.Options{BuildFinal: true, IncludeTransformerDefaults: true})
+	assert.NoError(t, err)
+	for _, change := range result.Implicit {
+		assert.NotContains(t, strings.Join(change.Path, "."), "owner", "Root commonLabels aren't implicit")
+	}
+	var explicit []string
+	for _, change := range result.FieldSources {
+		if change.SourceType == kdiff.SourceTypeTransformer+"commonLabels" {
+			assert.Equal(t, "/app/kustomization.yaml", change.Source)
+			explicit = append(explicit, strings.Join(change.Path, "."))
+		}
+	}
+	assert.Contains(t, explicit, "spec.selector.matchLabels.owner", "Selector propagation is attributed to the root commonLabels")
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+// archiveExtensions are the bundle formats accepted in place of a
+// kustomization directory
+var archiveExtensions = []string{".tar", ".tar.gz", ".tgz", ".zip"}
+
+// isArchive reports whether path names a tar or zip bundle
+func isArchive(path string) bool {
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveEntryPath maps an archive entry name into the in-memory file
+// system. Cleaning it as an absolute path keeps ../ entries inside the root.
+func archiveEntryPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+// loadTar copies the directories and regular files of a tar stream into fs
+func loadTar(r io.Reader, fs filesys.FileSystem) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar: %w", err)
+		}
+		name := archiveEntryPath(header.Name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := fs.MkdirAll(name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("reading %s from tar: %w", header.Name, err)
+			}
+			if err := fs.WriteFile(name, data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// loadZip copies the directories and regular files of a zip archive into fs
+func loadZip(r *zip.Reader, fs filesys.FileSystem) error {
+	for _, file := range r.File {
+		name := archiveEntryPath(file.Name)
+		if file.FileInfo().IsDir() {
+			if err := fs.MkdirAll(name); err != nil {
+				return err
+			}
+			continue
+		}
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("reading %s from zip: %w", file.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s from zip: %w", file.Name, err)
+		}
+		if err := fs.WriteFile(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadArchive reads a .tar, .tar.gz, .tgz or .zip bundle into an in-memory
+// file system rooted at /
+func loadArchive(archivePath string) (filesys.FileSystem, error) {
+	fs := filesys.MakeFsInMemory()
+	if strings.HasSuffix(archivePath, ".zip") {
+		r, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return fs, loadZip(&r.Reader, fs)
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if !strings.HasSuffix(archivePath, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", archivePath, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return fs, loadTar(r, fs)
+}
+
+// archiveRoot returns the kustomization directory inside a loaded archive:
+// root if given, the archive's top level if it holds a kustomization file,
+// or else its single top-level directory
+func archiveRoot(fs filesys.FileSystem, root string) (string, error) {
+	if root != "" {
+		dir := archiveEntryPath(root)
+		if _, exists := kdiff.FindKustomizationFile(fs, dir); !exists {
+			return "", kdiff.MissingKustomizationError(fs, dir)
+		}
+		return dir, nil
+	}
+	if _, exists := kdiff.FindKustomizationFile(fs, "/"); exists {
+		return "/", nil
+	}
+
+	entries, err := fs.ReadDir("/")
+	if err != nil {
+		return "", err
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if fs.IsDir(path.Join("/", entry)) {
+			dirs = append(dirs, path.Join("/", entry))
+		}
+	}
+	if len(dirs) == 1 {
+		if _, exists := kdiff.FindKustomizationFile(fs, dirs[0]); exists {
+			return dirs[0], nil
+		}
+	}
+	return "", fmt.Errorf("no kustomization at the top of the archive or in a single top-level directory, use -root-in-archive")
+}
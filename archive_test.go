@@ -0,0 +1,141 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+// bundleFiles is a kustomization tree as packed by a build system, under a
+// single top-level directory
+var bundleFiles = []struct{ name, content string }{
+	{"app/kustomization.yaml", `
+resources:
+  - deployment.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      name: web
+`},
+	{"app/deployment.yaml", `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`},
+	{"app/replicas.yaml", `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+`},
+}
+
+func makeTar(t *testing.T) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "app/", Typeflag: tar.TypeDir, Mode: 0755}))
+	for _, file := range bundleFiles {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: file.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(file.content))}))
+		_, err := tw.Write([]byte(file.content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestLoadTar(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	assert.NoError(t, loadTar(bytes.NewReader(makeTar(t)), fs))
+
+	root, err := archiveRoot(fs, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "/app", root, "Should find the single top-level kustomization")
+
+	result, err := kdiff.Diff(fs, root, kdiff.Options{})
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(result.FieldSources)) {
+		assert.Equal(t, "Deployment.v1.apps/web.[noNs]", result.FieldSources[0].Resource)
+		assert.Equal(t, "/app/replicas.yaml", result.FieldSources[0].Source)
+	}
+
+	root, err = archiveRoot(fs, "app/")
+	assert.NoError(t, err)
+	assert.Equal(t, "/app", root)
+	_, err = archiveRoot(fs, "missing")
+	assert.Error(t, err)
+}
+
+func TestArchiveRootAmbiguous(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	assert.NoError(t, fs.WriteFile("/dev/kustomization.yaml", []byte("resources: []\n")))
+	assert.NoError(t, fs.WriteFile("/prod/kustomization.yaml", []byte("resources: []\n")))
+	_, err := archiveRoot(fs, "")
+	assert.ErrorContains(t, err, "-root-in-archive")
+
+	root, err := archiveRoot(fs, "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "/prod", root)
+}
+
+func TestArchiveEntryPath(t *testing.T) {
+	assert.Equal(t, "/app/kustomization.yaml", archiveEntryPath("app/kustomization.yaml"))
+	assert.Equal(t, "/app/kustomization.yaml", archiveEntryPath("./app/kustomization.yaml"))
+	assert.Equal(t, "/etc/passwd", archiveEntryPath("../../etc/passwd"), "Entries can't escape the root")
+}
+
+func TestLoadArchive(t *testing.T) {
+	// Create a temporary directory for the bundles
+	tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, err = gz.Write(makeTar(t))
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	for _, file := range bundleFiles {
+		w, err := zw.Create(file.name)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(file.content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+
+	bundles := map[string][]byte{
+		"bundle.tar":    makeTar(t),
+		"bundle.tar.gz": gzipped.Bytes(),
+		"bundle.zip":    zipped.Bytes(),
+	}
+	for name, data := range bundles {
+		path := filepath.Join(tmpDir, name)
+		assert.NoError(t, os.WriteFile(path, data, 0644))
+		assert.True(t, isArchive(path))
+
+		fs, err := loadArchive(path)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		data, err := fs.ReadFile("/app/replicas.yaml")
+		assert.NoError(t, err, name)
+		assert.Equal(t, bundleFiles[2].content, string(data), name)
+	}
+	assert.False(t, isArchive(tmpDir))
+}
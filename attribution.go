@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+// writeUnattributedFields lists each unattributed change for
+// -assert-attribution-complete, so handling can be added for what made it
+func writeUnattributedFields(w io.Writer, changes []kdiff.FieldSource) {
+	fmt.Fprintf(w, "\n=== Attribution Incomplete ===\n")
+	for _, change := range changes {
+		fmt.Fprintf(w, "  • %s: %s\n", change.Resource, strings.Join(change.Path, "."))
+		fmt.Fprintf(w, "    %v → %v\n", formatChainValue(change.Original), formatChainValue(change.New))
+	}
+	fmt.Fprintf(w, "\n%d changes in the final build aren't explained by any patch or transformer\n", len(changes))
+}
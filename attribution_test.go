@@ -0,0 +1,21 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteUnattributedFields(t *testing.T) {
+	var buf bytes.Buffer
+	writeUnattributedFields(&buf, []kdiff.FieldSource{
+		{Resource: "Deployment/b", Path: []string{"spec", "replicas"}, Original: int64(1), New: int64(3)},
+		{Resource: "Deployment/b", Path: []string{"spec", "paused"}, New: true},
+	})
+	assert.Contains(t, buf.String(), "=== Attribution Incomplete ===")
+	assert.Contains(t, buf.String(), "  • Deployment/b: spec.replicas\n    1 → 3\n")
+	assert.Contains(t, buf.String(), "  • Deployment/b: spec.paused\n    <none> → true\n")
+	assert.Contains(t, buf.String(), "2 changes in the final build")
+}
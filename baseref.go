@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+// formatBaseRefKeys returns result with its resources identified by format,
+// for reporting
+func formatBaseRefKeys(format string, result *kdiff.BaseRefResult) *kdiff.BaseRefResult {
+	formatted := &kdiff.BaseRefResult{FieldSources: applyResourceKeyFormat(format, result.FieldSources), Unchanged: result.Unchanged}
+	for _, key := range result.Added {
+		formatted.Added = append(formatted.Added, reportKey(format, key))
+	}
+	for _, key := range result.Removed {
+		formatted.Removed = append(formatted.Removed, reportKey(format, key))
+	}
+	return formatted
+}
+
+// printBaseRefDiff prints the differences between a base ref and an overlay
+func printBaseRefDiff(result *kdiff.BaseRefResult, style textStyle) {
+	printFieldChanges("Base Ref Diff", result.FieldSources, style)
+	for _, key := range result.Added {
+		fmt.Printf("\nResource: %s\n", key)
+		fmt.Printf("  Not in base ref\n")
+	}
+	for _, key := range result.Removed {
+		fmt.Printf("\nResource: %s\n", key)
+		fmt.Printf("  Only in base ref\n")
+	}
+	printUnchangedCount(result.Unchanged)
+}
+
+// printUnchangedCount reports how many identical resources a comparison
+// skipped
+func printUnchangedCount(unchanged int) {
+	if unchanged > 0 {
+		fmt.Printf("\n%d unchanged resources skipped\n", unchanged)
+	}
+}
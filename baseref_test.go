@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestDiffBaseRefOnlyChanged(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	shared := "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: web\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: web\n"
+	files := map[string]string{
+		"/before/kustomization.yaml": "resources:\n  - shared.yaml\n  - config.yaml\n",
+		"/before/shared.yaml":        shared,
+		"/before/config.yaml":        "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  mode: old\n",
+		"/after/kustomization.yaml":  "resources:\n  - shared.yaml\n  - config.yaml\n",
+		"/after/shared.yaml":         shared,
+		"/after/config.yaml":         "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  mode: new\n",
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := kdiff.DiffBaseRef(fs, "/before", "/after", kdiff.Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Unchanged, "Identical resources should be skipped")
+	if assert.Equal(t, 1, len(result.FieldSources)) {
+		assert.Equal(t, "ConfigMap.v1.[noGrp]/web.[noNs]", result.FieldSources[0].Resource)
+	}
+	assert.Equal(t, 2, formatBaseRefKeys(kdiff.DefaultResourceKeyFormat, result).Unchanged)
+
+	result, err = kdiff.DiffBaseRef(fs, "/before", "/after", kdiff.Options{CompareAll: true})
+	assert.NoError(t, err)
+	assert.Zero(t, result.Unchanged, "CompareAll should compare every resource")
+	assert.Equal(t, 1, len(result.FieldSources))
+}
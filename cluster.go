@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/kustomize/api/resource"
+)
+
+// clusterGetter fetches live objects with client, finding the resource of
+// each kind with mapper. Requests are cancelled when ctx is done.
+func clusterGetter(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper) kdiff.LiveGetter {
+	return func(res *resource.Resource) (map[string]interface{}, error) {
+		gvk := res.GetGvk()
+		mapping, err := mapper.RESTMapping(schema.GroupKind{Group: gvk.Group, Kind: gvk.Kind}, gvk.Version)
+		if err != nil {
+			return nil, fmt.Errorf("finding the API resource of %s: %w", gvk.Kind, err)
+		}
+		var resources dynamic.ResourceInterface = client.Resource(mapping.Resource)
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			namespace := res.GetNamespace()
+			if namespace == "" {
+				namespace = metav1.NamespaceDefault
+			}
+			resources = client.Resource(mapping.Resource).Namespace(namespace)
+		}
+
+		live, err := resources.Get(ctx, res.GetName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getting live %s/%s: %w", gvk.Kind, res.GetName(), err)
+		}
+		return live.Object, nil
+	}
+}
+
+// kubeconfigGetter fetches live objects from the cluster of the current
+// kubeconfig context
+func kubeconfigGetter(ctx context.Context) (kdiff.LiveGetter, error) {
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	return clusterGetter(ctx, client, mapper), nil
+}
+
+// printLiveDiff prints the differences between rendered and live objects
+func printLiveDiff(changes []kdiff.FieldSource, missing []string, style textStyle) {
+	printFieldChanges("Live Cluster Diff", changes, style)
+	for _, key := range missing {
+		fmt.Printf("\nResource: %s\n", key)
+		fmt.Printf("  Not found in cluster\n")
+	}
+}
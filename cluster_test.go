@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/kustomize/api/resource"
+)
+
+func TestClusterGetter(t *testing.T) {
+	deployments := schema.GroupVersion{Group: "apps", Version: "v1"}
+	namespaces := schema.GroupVersion{Version: "v1"}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{deployments, namespaces})
+	mapper.Add(deployments.WithKind("Deployment"), meta.RESTScopeNamespace)
+	mapper.Add(namespaces.WithKind("Namespace"), meta.RESTScopeRoot)
+
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "prod"},
+		"spec":       map[string]interface{}{"replicas": int64(2)},
+	}}
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), live)
+	get := clusterGetter(context.Background(), client, mapper)
+
+	factory := resource.NewFactory(nil)
+	deployment, err := factory.FromBytes([]byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+`))
+	assert.NoError(t, err)
+	object, err := get(deployment)
+	assert.NoError(t, err)
+	assert.Equal(t, live.Object, object, "Should get the object by its resource and namespace")
+
+	missing, err := factory.FromBytes([]byte(`
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: prod
+`))
+	assert.NoError(t, err)
+	object, err = get(missing)
+	assert.NoError(t, err, "Missing objects aren't an error")
+	assert.Nil(t, object)
+
+	unknown, err := factory.FromBytes([]byte(`
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: web
+`))
+	assert.NoError(t, err)
+	_, err = get(unknown)
+	assert.Error(t, err, "Kinds the cluster doesn't serve are an error")
+}
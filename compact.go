@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+// writeCompactReport writes one line per change, e.g.
+// Deployment/test spec.replicas 1 -> 3 (patch1.yaml)
+// for grep and terse CI logs
+func writeCompactReport(w io.Writer, sources []kdiff.FieldSource) error {
+	for _, resource := range reportResources(sources, nil, kdiff.Options{}) {
+		for _, change := range resource.Changes {
+			original, updated := compactValue(change.Original), compactValue(change.New)
+			if change.Original == nil {
+				original = "(none)"
+			}
+			if change.New == nil {
+				updated = "removed"
+			}
+			if _, err := fmt.Fprintf(w, "%s %s %s -> %s (%s)\n",
+				resource.Resource, change.DottedPath, original, updated, compactSource(change.Source)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compactValue formats a value on a single line, quoting strings spanning
+// several
+func compactValue(v interface{}) string {
+	s := fmt.Sprintf("%v", v)
+	if strings.Contains(s, "\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// compactSource returns the base name of a displayed source, e.g.
+// patch1.yaml for overlays/prod/patch1.yaml
+func compactSource(source string) string {
+	if source == "inline patch" || source == kdiff.UnattributedSource {
+		return source
+	}
+	return filepath.Base(source)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteCompactReport(t *testing.T) {
+	defer func(base string) { sourceBase = base }(sourceBase)
+	sourceBase = "/app"
+
+	sources := []kdiff.FieldSource{
+		{Resource: "Deployment/test", Path: []string{"spec", "replicas"}, Source: "/app/patches/patch1.yaml", SourceType: kdiff.SourceTypePatch, Original: float64(1), New: float64(3)},
+		{Resource: "Deployment/test", Path: []string{"spec", "paused"}, Source: "/app/patches/patch2.yaml", SourceType: kdiff.SourceTypePatch, Original: true},
+		{Resource: "ConfigMap/settings", Path: []string{"data", "script"}, SourceType: kdiff.SourceTypePatch, New: "a\nb"},
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, writeCompactReport(&out, sources))
+	assert.Equal(t, `ConfigMap/settings data.script (none) -> "a\nb" (inline patch)
+Deployment/test spec.replicas 1 -> 3 (patch1.yaml)
+Deployment/test spec.paused true -> removed (patch2.yaml)
+`, out.String())
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+// printCompareYAML prints the differences between two rendered YAML files
+func printCompareYAML(result *kdiff.BaseRefResult, before, after string, style textStyle) {
+	printFieldChanges("YAML Diff", result.FieldSources, style)
+	for _, key := range result.Added {
+		fmt.Printf("\nResource: %s\n", key)
+		fmt.Printf("  Only in %s\n", after)
+	}
+	for _, key := range result.Removed {
+		fmt.Printf("\nResource: %s\n", key)
+		fmt.Printf("  Only in %s\n", before)
+	}
+	printUnchangedCount(result.Unchanged)
+}
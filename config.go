@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/yaml"
+)
+
+// configFileName is the per-repo config file looked up in the kustomization
+// directory and then the working directory
+const configFileName = ".kdiff.yaml"
+
+// Config holds per-repo defaults for command line flags. Flags given on the
+// command line override values from the config file.
+type Config struct {
+	Output         string   `json:"output,omitempty"`
+	IgnorePaths    []string `json:"ignorePaths,omitempty"`
+	IncludePaths   []string `json:"includePaths,omitempty"`
+	ExpectNoChange []string `json:"expectNoChange,omitempty"`
+	FailIfFieldSet []string `json:"failIfFieldSet,omitempty"`
+	Color          *bool    `json:"color,omitempty"`
+	FailOnChange   *bool    `json:"failOnChange,omitempty"`
+}
+
+// findConfig returns the path of the first config file found in dirs, or ""
+func findConfig(fs filesys.FileSystem, dirs ...string) string {
+	for _, dir := range dirs {
+		path := filepath.Join(dir, configFileName)
+		if fs.Exists(path) && !fs.IsDir(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadConfig reads and parses a config file
+func loadConfig(fs filesys.FileSystem, path string) (*Config, error) {
+	data, err := fs.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// applyConfig sets the flags in fset that weren't given on the command line
+// from the config values
+func applyConfig(fset *flag.FlagSet, config *Config) error {
+	explicit := make(map[string]bool)
+	fset.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	set := func(name, value string) error {
+		if explicit[name] {
+			return nil
+		}
+		if err := fset.Set(name, value); err != nil {
+			return fmt.Errorf("config value for -%s: %w", name, err)
+		}
+		return nil
+	}
+	setList := func(name string, values []string) error {
+		for _, value := range values {
+			if err := set(name, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if config.Output != "" {
+		if err := set("o", config.Output); err != nil {
+			return err
+		}
+	}
+	if err := setList("ignore-path", config.IgnorePaths); err != nil {
+		return err
+	}
+	if err := setList("include-path", config.IncludePaths); err != nil {
+		return err
+	}
+	if err := setList("expect-no-change", config.ExpectNoChange); err != nil {
+		return err
+	}
+	if err := setList("fail-if-field-set", config.FailIfFieldSet); err != nil {
+		return err
+	}
+	if config.Color != nil {
+		if err := set("color", fmt.Sprint(*config.Color)); err != nil {
+			return err
+		}
+	}
+	if config.FailOnChange != nil {
+		if err := set("fail-on-change", fmt.Sprint(*config.FailOnChange)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestConfigFile(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	configContent := `
+output: junit
+ignorePaths:
+  - metadata.annotations
+color: true
+failOnChange: true
+`
+	err := fs.WriteFile("/repo/overlay/.kdiff.yaml", []byte(configContent))
+	assert.NoError(t, err)
+
+	// The kustomization directory is searched before the working directory
+	assert.Equal(t, "/repo/overlay/.kdiff.yaml", findConfig(fs, "/repo/overlay", "/repo"))
+	assert.Equal(t, "", findConfig(fs, "/repo"), "Should not find a config that doesn't exist")
+
+	config, err := loadConfig(fs, "/repo/overlay/.kdiff.yaml")
+	assert.NoError(t, err)
+
+	// Flags given on the command line win over config values
+	fset := flag.NewFlagSet("kdiff", flag.ContinueOnError)
+	output := fset.String("o", "text", "")
+	var ignorePaths, includePaths, expectNoChange stringList
+	fset.Var(&ignorePaths, "ignore-path", "")
+	fset.Var(&includePaths, "include-path", "")
+	fset.Var(&expectNoChange, "expect-no-change", "")
+	color := fset.Bool("color", false, "")
+	failOnChange := fset.Bool("fail-on-change", false, "")
+	err = fset.Parse([]string{"-o", "text", "overlay"})
+	assert.NoError(t, err)
+
+	err = applyConfig(fset, config)
+	assert.NoError(t, err)
+	assert.Equal(t, "text", *output, "Command line flag should override config")
+	assert.Equal(t, stringList{"metadata.annotations"}, ignorePaths)
+	assert.Empty(t, includePaths)
+	assert.True(t, *color)
+	assert.True(t, *failOnChange)
+}
+
+func TestConfigFileUnknownField(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	err := fs.WriteFile("/repo/.kdiff.yaml", []byte("outptu: junit\n"))
+	assert.NoError(t, err)
+
+	_, err = loadConfig(fs, "/repo/.kdiff.yaml")
+	assert.Error(t, err, "Should reject unknown config fields")
+}
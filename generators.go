@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+// printGeneratedResources prints how generator options affected each
+// generated resource
+func printGeneratedResources(generated []kdiff.GeneratedResource) {
+	if len(generated) == 0 {
+		return
+	}
+
+	fmt.Printf("\n=== Generated Resources ===\n")
+	for _, gen := range generated {
+		fmt.Printf("\nResource: %s\n", gen.Resource)
+		fmt.Printf("  Generated by: %s (%s)\n", gen.Generator, formatSource(gen.Source))
+		if gen.NameHashed {
+			fmt.Printf("  Name hash suffix: enabled\n")
+		} else {
+			fmt.Printf("  Name hash suffix: disabled (disableNameSuffixHash)\n")
+		}
+		if len(gen.Labels) > 0 {
+			fmt.Printf("  Labels from generator options: %s\n", formatStringMap(gen.Labels))
+		}
+		if len(gen.Annotations) > 0 {
+			fmt.Printf("  Annotations from generator options: %s\n", formatStringMap(gen.Annotations))
+		}
+	}
+}
+
+// formatStringMap formats a map as sorted key=value pairs
+func formatStringMap(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+// containerLists are the pod spec fields that hold containers
+var containerLists = map[string]bool{
+	"containers":          true,
+	"initContainers":      true,
+	"ephemeralContainers": true,
+}
+
+// ImageChange is a container whose image a source changed. Original is empty
+// for a container the source added, New for one it removed.
+type ImageChange struct {
+	Resource  string
+	Container string
+	Original  string
+	New       string
+	Source    string // The source as describeSource shows it
+}
+
+// appendPath returns path extended by key without sharing path's storage
+func appendPath(path []string, key string) []string {
+	return append(path[:len(path):len(path)], key)
+}
+
+// collectImages records the image of each container found in value, which is
+// found at path, by container name. A bare image string is named after
+// element, or its list index if the element has no name.
+func collectImages(value interface{}, path []string, element string, images map[string]string) {
+	n := len(path)
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if image, ok := value["image"].(string); ok && n >= 2 && containerLists[path[n-2]] {
+			name, _ := value["name"].(string)
+			if name == "" {
+				name = path[n-1]
+			}
+			images[name] = image
+			return
+		}
+		for key, child := range value {
+			collectImages(child, appendPath(path, key), element, images)
+		}
+	case []interface{}:
+		for i, child := range value {
+			collectImages(child, appendPath(path, fmt.Sprint(i)), element, images)
+		}
+	case string:
+		if n >= 3 && path[n-1] == "image" && containerLists[path[n-3]] {
+			name := strings.TrimPrefix(element, "name=")
+			if element == "" {
+				name = path[n-2]
+			}
+			images[name] = value
+		}
+	}
+}
+
+// findImageChanges picks the container image changes out of sources, whether
+// recorded per field or as a whole subtree, ordered by resource and container
+func findImageChanges(sources []kdiff.FieldSource) []ImageChange {
+	var changes []ImageChange
+	for _, source := range sources {
+		before := make(map[string]string)
+		after := make(map[string]string)
+		collectImages(source.Original, source.Path, source.Element, before)
+		collectImages(source.New, source.Path, source.Element, after)
+
+		names := make(map[string]bool)
+		for name := range before {
+			names[name] = true
+		}
+		for name := range after {
+			names[name] = true
+		}
+		for name := range names {
+			if before[name] == after[name] {
+				continue
+			}
+			changes = append(changes, ImageChange{
+				Resource:  source.Resource,
+				Container: name,
+				Original:  before[name],
+				New:       after[name],
+				Source:    describeSource(source),
+			})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Resource != changes[j].Resource {
+			return changes[i].Resource < changes[j].Resource
+		}
+		return changes[i].Container < changes[j].Container
+	})
+	return changes
+}
+
+// writeImageChanges writes one line per container image change
+func writeImageChanges(w io.Writer, changes []ImageChange) error {
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(w, "No image changes")
+		return err
+	}
+	for _, change := range changes {
+		original, updated := change.Original, change.New
+		if original == "" {
+			original = "(none)"
+		}
+		if updated == "" {
+			updated = "(removed)"
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s: %s → %s (%s)\n",
+			change.Resource, change.Container, original, updated, change.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestFindImageChanges(t *testing.T) {
+	sources := []kdiff.FieldSource{
+		{
+			// Strategic merge patches record whole subtrees
+			Resource: "Deployment/web",
+			Path:     []string{"spec"},
+			Source:   "patch.yaml",
+			Original: map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{"name": "web", "image": "web:1.0"}},
+			}}},
+			New: map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{"name": "web", "image": "web:1.1"}},
+			}}},
+		},
+		{
+			Resource:   "Deployment/web",
+			Path:       []string{"spec", "template", "spec", "initContainers", "0", "image"},
+			Source:     "kustomization.yaml",
+			Element:    "name=migrate",
+			SourceType: kdiff.SourceTypeTransformer + "images",
+			Original:   "migrate:1.0",
+			New:        "migrate:1.1",
+		},
+		{
+			Resource: "Deployment/web",
+			Path:     []string{"metadata", "labels", "version"},
+			Source:   "patch.yaml",
+			Original: "1.0",
+			New:      "1.1",
+		},
+		{
+			Resource:   "Deployment/api",
+			Path:       []string{"spec", "template", "spec", "containers", "1"},
+			Source:     "sidecar.yaml",
+			SourceType: kdiff.SourceTypeJSONPatch,
+			New:        map[string]interface{}{"name": "proxy", "image": "envoy:1.30"},
+		},
+	}
+
+	changes := findImageChanges(sources)
+	assert.Equal(t, []ImageChange{
+		{Resource: "Deployment/api", Container: "proxy", New: "envoy:1.30", Source: "JSON patch (sidecar.yaml)"},
+		{Resource: "Deployment/web", Container: "migrate", Original: "migrate:1.0", New: "migrate:1.1", Source: "images transformer (kustomization.yaml)"},
+		{Resource: "Deployment/web", Container: "web", Original: "web:1.0", New: "web:1.1", Source: "patch.yaml"},
+	}, changes)
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeImageChanges(&buf, changes))
+	assert.Equal(t, `Deployment/api: proxy: (none) → envoy:1.30 (JSON patch (sidecar.yaml))
+Deployment/web: migrate: migrate:1.0 → migrate:1.1 (images transformer (kustomization.yaml))
+Deployment/web: web: web:1.0 → web:1.1 (patch.yaml)
+`, buf.String())
+}
+
+func TestDiffImagesAttribution(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/base/kustomization.yaml": `
+resources:
+  - deployment.yaml
+images:
+  - name: web
+    newTag: "1.1"
+`,
+		"/app/base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: web:1.0
+`,
+		"/app/kustomization.yaml": `
+resources:
+  - base
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := kdiff.Diff(fs, "/app", kdiff.Options{})
+	assert.NoError(t, err)
+	changes := findImageChanges(result.FieldSources)
+	if assert.Equal(t, 1, len(changes)) {
+		assert.Equal(t, "web", changes[0].Container)
+		assert.Equal(t, "web:1.0", changes[0].Original)
+		assert.Equal(t, "web:1.1", changes[0].New)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitReport writes the recorded changes as JUnit XML: one testsuite per
+// resource and one testcase per change. The i-th change fails if failed(i)
+// returns a non-empty reason; failed may be nil.
+func writeJUnitReport(w io.Writer, sources []kdiff.FieldSource, failed func(int) string) error {
+	report := junitTestSuites{Name: "kustomize-diff"}
+	index := make(map[string]int)
+	for n, source := range sources {
+		i, exists := index[source.Resource]
+		if !exists {
+			i = len(report.Suites)
+			index[source.Resource] = i
+			report.Suites = append(report.Suites, junitTestSuite{Name: source.Resource})
+		}
+
+		testCase := junitTestCase{
+			Name:      strings.Join(source.Path, "."),
+			Classname: fmt.Sprintf("%s.%s", source.Resource, formatSource(source.Source)),
+		}
+		if failed != nil {
+			if reason := failed(n); reason != "" {
+				testCase.Failure = &junitFailure{
+					Message: fmt.Sprintf("%v → %v", source.Original, source.New),
+					Type:    reason,
+					Text:    fmt.Sprintf("%s changed by %s", testCase.Name, describeSource(source)),
+				}
+				report.Suites[i].Failures++
+				report.Failures++
+			}
+		}
+		report.Suites[i].Cases = append(report.Suites[i].Cases, testCase)
+		report.Suites[i].Tests++
+		report.Tests++
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
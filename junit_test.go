@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteJUnitReport(t *testing.T) {
+	sources := []kdiff.FieldSource{
+		{Resource: "Deployment/test", Path: []string{"spec", "replicas"}, Source: "/tmp/overlay/patches/patch1.yaml", Original: float64(1), New: float64(3)},
+		{Resource: "Deployment/test", Path: []string{"spec", "paused"}, Source: "", Original: nil, New: true},
+		{Resource: "Service/test", Path: []string{"spec", "type"}, Source: "/tmp/overlay/patches/patch2.yaml", Original: "ClusterIP", New: "NodePort"},
+	}
+	failed := func(i int) string {
+		if sources[i].Resource == "Service/test" {
+			return "expect-no-change"
+		}
+		return ""
+	}
+
+	var buf bytes.Buffer
+	err := writeJUnitReport(&buf, sources, failed)
+	assert.NoError(t, err)
+
+	var report junitTestSuites
+	err = xml.Unmarshal(buf.Bytes(), &report)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, report.Tests, "Should have one testcase per change")
+	assert.Equal(t, 1, report.Failures, "Should count the failing change")
+	assert.Equal(t, 2, len(report.Suites), "Should have one testsuite per resource")
+
+	deployment := report.Suites[0]
+	assert.Equal(t, "Deployment/test", deployment.Name)
+	assert.Equal(t, "spec.replicas", deployment.Cases[0].Name)
+	assert.Equal(t, "Deployment/test.patch1.yaml", deployment.Cases[0].Classname, "Classname should include the patch source")
+	assert.Nil(t, deployment.Cases[0].Failure)
+	assert.Equal(t, "Deployment/test.inline patch", deployment.Cases[1].Classname)
+
+	service := report.Suites[1]
+	assert.Equal(t, 1, service.Failures)
+	assert.NotNil(t, service.Cases[0].Failure)
+	assert.Equal(t, "ClusterIP → NodePort", service.Cases[0].Failure.Message, "Failure should show the old and new values")
+}
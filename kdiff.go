@@ -1,16 +1,19 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
-	"strconv"
+	"sort"
 	"strings"
+	"text/template"
+	"time"
 
-	"flag"
-
-	"github.com/r3labs/diff/v3"
+	"github.com/malc0lm/kustomize-diff/kdiff"
 	"sigs.k8s.io/kustomize/api/filesys"
 	"sigs.k8s.io/kustomize/api/krusty"
 	"sigs.k8s.io/kustomize/api/resource"
@@ -18,639 +21,1241 @@ import (
 	"sigs.k8s.io/yaml"
 )
 
-// FieldSource tracks where a field value came from
-type FieldSource struct {
-	Resource string   // The resource being modified
-	Path     []string // The field path that changed
-	Source   string   // The patch file that caused the change
-	Original interface{}
-	New      interface{}
-}
-
-var fieldSources []FieldSource
-
 func main() {
 	// Define command line flags
 	var showFinalOutput bool
+	var explainResource string
+	var dumpBaseKey string
+	var showChains bool
+	var compact bool
+	var transformerDefaults bool
+	var baseDriftCheck bool
+	var onlyResource string
+	var compareYAML bool
+	var baseOnlyReport bool
+	var namespace string
+	var includeClusterScoped bool
+	var outputFormat string
+	var expectNoChange stringList
+	var fieldPolicyFlags stringList
+	var ignorePaths stringList
+	var includePaths stringList
+	var useColor bool
+	var sideBySide bool
+	var failOnChange bool
+	var configPath string
+	var clusterMode bool
+	var strictNamespace bool
+	var watch bool
+	var runTimeout time.Duration
+	var outputDir string
+	var summaryJSON string
+	var summaryOnly bool
+	var loadRestrictor string
+	var enableHelmCharts bool
+	var helmCommand string
+	var execFunctions bool
+	var warningsAsErrors bool
+	var kindAllowlist stringList
+	var ignoreKinds stringList
+	var relativeTo string
+	var matrix bool
+	var showSecrets bool
+	var onlyChanged bool
+	var minVersion string
+	var followLinks bool
+	var includeStatus bool
+	var imageOnly bool
+	var depthLimit int
+	var treeDepthLimit int
+	var countByType bool
+	var keyFormat string
+	var failOnRemoval bool
+	var assertAttribution bool
+	var verboseOutput bool
+	var rootInArchive string
+	var contextLines int
+	var strictMergeKeyMissing bool
+	var mergeKeyFlags stringList
+	var replaceLists stringList
+	var baseRef string
+	var base64Decode bool
+	var verifyOriginAnnotations bool
+	var reorder string
+	var alphaPlugins bool
+	var listPatches bool
+	var ignoreGenerated bool
+	var jsonPatchStrict bool
+	var explainRemote bool
+	var dryApply bool
+	var diffLib string
+	var reportTemplatePath string
+	var fromRevision string
+	var toRevision string
+	var cpuProfile string
+	var memProfile string
 	flag.BoolVar(&showFinalOutput, "show-final", false, "Show the final kustomize output")
+	flag.BoolVar(&compareYAML, "compare-yaml", false, "Compare two rendered multi-document YAML files, e.g. kustomize build output, instead of building a kustomization; takes the before and after files as arguments")
+	flag.StringVar(&onlyResource, "resource", "", "Only apply patches to and report this resource, e.g. Deployment/test or Deployment/prod/test; everything is still built")
+	flag.BoolVar(&baseDriftCheck, "check-base-drift", false, "Also report how kustomize's build of the bases differs from the resources declared in their files, e.g. by a namePrefix")
+	flag.BoolVar(&transformerDefaults, "include-transformer-defaults", false, "Also report changes kustomize made implicitly, e.g. commonLabels in selectors, with a best-effort category")
+	flag.BoolVar(&compact, "compact", false, "Print one line per change: resource, dotted path, old -> new value and source file")
+	flag.BoolVar(&showChains, "chain", false, "Show each field's changes as an ordered chain across patches")
+	flag.BoolVar(&baseOnlyReport, "base-only-report", false, "List resources that no patch modified")
+	flag.StringVar(&namespace, "namespace", "", "Only process and report resources in this namespace")
+	flag.BoolVar(&includeClusterScoped, "include-cluster-scoped", false, "Keep cluster-scoped resources when -namespace is set")
+	flag.StringVar(&outputFormat, "o", "text", "Report format: text, junit or origin, i.e. kustomize-style origin and field-origins annotations per resource (json with -list-patches or -summary-only)")
+	flag.Var(&expectNoChange, "expect-no-change", "Fail if a change matches this dotted path glob, e.g. 'spec.securityContext.*' (repeatable)")
+	flag.Var(&fieldPolicyFlags, "fail-if-field-set", "Fail if a field of the final build is set, or set to a value with path=value, e.g. 'spec.template.spec.hostNetwork=true' (repeatable)")
+	flag.Var(&ignorePaths, "ignore-path", "Leave out changes at or below this dotted path glob (repeatable)")
+	flag.Var(&includePaths, "include-path", "Only report changes matching this dotted path glob (repeatable)")
+	flag.StringVar(&reportTemplatePath, "report-template", "", "Render the report through this Go text/template file instead of the text report (see examples/templates)")
+	flag.BoolVar(&useColor, "color", false, "Color original and new values in the text report")
+	flag.BoolVar(&sideBySide, "side-by-side", false, "Show original and new values in two columns (stacked when stdout isn't a terminal)")
+	flag.BoolVar(&failOnChange, "fail-on-change", false, "Exit nonzero if any change is reported")
+	flag.BoolVar(&failOnRemoval, "fail-on-removal", false, "Exit nonzero if any field is removed (removals under -ignore-path are exempt)")
+	flag.BoolVar(&assertAttribution, "assert-attribution-complete", false, "Exit nonzero if the final build differs from the base in a field no patch or transformer explains, listing each one")
+	flag.BoolVar(&strictNamespace, "strict-namespace", false, "Only match patch targets whose namespace equals the resource's (a target without namespace matches only cluster-scoped or unnamespaced resources)")
+	flag.BoolVar(&clusterMode, "cluster", false, "Diff each rendered resource against the live object in the current kubeconfig context")
+	flag.StringVar(&outputDir, "output-dir", "", "Write one report file per changed resource into this directory instead of printing the report")
+	flag.BoolVar(&summaryOnly, "summary-only", false, "Only print the summary line, e.g. '3 resources changed, 12 fields (5 add / 4 replace / 3 remove)', or with -o json the summary counts")
+	flag.StringVar(&summaryJSON, "summary-json", "", "Also write a JSON summary of change counts and unmatched or no-op patches to this file")
+	flag.StringVar(&loadRestrictor, "load-restrictor", "rootonly", "Which files kustomizations may load: rootonly (files under each kustomization's directory) or none")
+	flag.BoolVar(&enableHelmCharts, "enable-helm", false, "Inflate helmCharts: entries by running helm")
+	flag.StringVar(&helmCommand, "helm-command", kdiff.DefaultHelmCommand, "Helm binary to run with -enable-helm")
+	flag.StringVar(&reorder, "reorder", string(krusty.ReorderOptionNone), "Order of built resources: none (declaration order) or legacy (kustomize's kind order); a kustomization's sortOptions win")
+	flag.BoolVar(&alphaPlugins, "enable-alpha-plugins", false, "Load transformer and generator plugins from the plugin home (runs plugin code; only use on trusted overlays)")
+	flag.BoolVar(&execFunctions, "exec-annotations", false, "Run exec KRM functions declared in transformer/generator configs (runs local binaries named by the kustomization; only use on trusted overlays)")
+	flag.BoolVar(&warningsAsErrors, "warnings-as-errors", false, "Exit nonzero if any patch or transformer warning was raised")
+	flag.Var(&kindAllowlist, "kind-allowlist", "Only attribute patches to these kinds, e.g. 'Deployment,StatefulSet' (repeatable)")
+	flag.Var(&ignoreKinds, "ignore-kind", "Leave these kinds out of attribution and the report, e.g. 'Event,CustomResourceDefinition'; subtracts from -kind-allowlist (repeatable)")
+	flag.StringVar(&relativeTo, "relative-to", "", "Show source paths relative to this directory (default: the kustomization directory)")
+	flag.BoolVar(&matrix, "matrix", false, "Compare the rendered output of several overlays, printing each diverging field with a column per overlay; takes the overlay directories as arguments")
+	flag.BoolVar(&showSecrets, "show-secrets", false, "Show Secret data and stringData values instead of masking them")
+	flag.BoolVar(&onlyChanged, "only-changed-resources", true, "With -matrix, -base-ref or -compare-yaml, skip resources whose YAML is identical in every overlay")
+	flag.StringVar(&minVersion, "min-kustomization-version", kdiff.DefaultMinKustomizationVersion, "Warn about kustomization files declaring an apiVersion older than this")
+	flag.BoolVar(&followLinks, "follow-symlinks", true, "Resolve symlinked resource paths, processing a base reached through several links once")
+	flag.BoolVar(&includeStatus, "include-status", false, "With -cluster, -matrix, -base-ref or -compare-yaml, also compare status, which is usually populated by the server")
+	flag.BoolVar(&imageOnly, "image-only", false, "Only report container image changes, one line per container")
+	flag.IntVar(&treeDepthLimit, "max-tree-depth", 0, "Don't attribute patches of kustomizations nested more than this many levels below the root, only build them (0 for no limit)")
+	flag.IntVar(&depthLimit, "max-depth", kdiff.DefaultMaxDepth, "Fail on patch values or paths nested more deeply than this")
+	flag.BoolVar(&countByType, "count-by-type", false, "Count changes per path prefix, e.g. spec.template.spec.containers, in the text report and -summary-json")
+	flag.StringVar(&keyFormat, "resource-key-format", kdiff.DefaultResourceKeyFormat, "How reports identify resources, using {group}, {kind}, {namespace} and {name}")
+	flag.BoolVar(&listPatches, "list-patches", false, "Only list the collected patches with their resolved paths, types and targets (-o text or json)")
+	flag.StringVar(&diffLib, "diff-lib", kdiff.DiffLibR3labs, "Diff backend for computing changes: r3labs (compares lists ignoring order), or godiff (built in; compares lists index by index)")
+	flag.BoolVar(&dryApply, "dry-apply", false, "Print the target resource's YAML as each patch leaves it, under the patch's progress header")
+	flag.BoolVar(&verboseOutput, "verbose", false, "Log the kustomization configuration and collected patches before processing them")
+	flag.StringVar(&rootInArchive, "root-in-archive", "", "Kustomization directory inside a .tar, .tar.gz or .zip argument (default: auto-detected)")
+	flag.IntVar(&contextLines, "context-lines", defaultContextLines, "Unchanged lines shown around each change when diffing multi-line string values")
+	flag.BoolVar(&strictMergeKeyMissing, "strict-merge-key-missing", false, "Fail when a strategic merge meets a keyed list element, e.g. a container, without its merge key instead of appending it")
+	flag.BoolVar(&jsonPatchStrict, "json-patch-strict", false, "Fail on JSON patch operations RFC 6902 says must fail, e.g. removing a missing path or a failing test, instead of skipping them")
+	flag.Var(&replaceLists, "replace-list", "Replace the list of a CRD at this dotted path with the patch's list instead of appending to it, e.g. 'spec.hosts'; args, command, envFrom and tolerations are always replaced (repeatable)")
+	flag.Var(&mergeKeyFlags, "merge-key", "Merge the list at this dotted path by an element field, e.g. 'spec.ports=port' (repeatable)")
+	flag.BoolVar(&explainRemote, "explain-remote-bases", false, "Fetch remote bases with git into the user cache directory and attribute their patches like a local base's (needs network access)")
+	flag.StringVar(&fromRevision, "from-revision", "", "Only report how the attribution changed since this git revision: fields newly changed, no longer changed or changed differently")
+	flag.StringVar(&toRevision, "to-revision", "", "With -from-revision, the git revision to compare with (default: the working tree)")
+	flag.StringVar(&baseRef, "base-ref", "", "Compare the overlay's build with the build of this directory, e.g. a released base, instead of attributing patches")
+	flag.BoolVar(&ignoreGenerated, "ignore-generated", false, "Leave resources made by configMapGenerator and secretGenerator out of attribution and the report, as their hashed names change with content")
+	flag.BoolVar(&base64Decode, "base64-decode", false, "Show ConfigMap binaryData values, and Secret data values with -show-secrets, decoded from base64")
+	flag.BoolVar(&verifyOriginAnnotations, "verify-origins", false, "Exit nonzero if the file a resource is attributed to differs from kustomize's own origin annotation for it")
+	flag.DurationVar(&runTimeout, "timeout", 0, "Abort the run with an error if it takes longer than this, e.g. 2m (default no limit)")
+	flag.BoolVar(&watch, "watch", false, "Re-run and redraw the report whenever a file in the kustomization tree changes")
+	flag.StringVar(&configPath, "config", "", "Config file with flag defaults (default: "+configFileName+" in the kustomization or working directory)")
+	flag.StringVar(&dumpBaseKey, "dump-base", "", "Print the pre-patch base YAML of the given resource (Kind/Name or Kind/Namespace/Name), the reference all changes are attributed against")
+	flag.StringVar(&explainResource, "explain", "", "Trace the history of a single field of the given resource (Kind/Name or Kind/Namespace/Name); takes the field path as an extra argument")
+	flag.StringVar(&cpuProfile, "cpuprofile", "", "Write a CPU profile to this file")
+	flag.StringVar(&memProfile, "memprofile", "", "Write a memory profile to this file on exit")
+	flag.Usage = func() { printUsage(flag.CommandLine) }
 	flag.Parse()
 
 	// Check if we have the required kustomization directory argument
-	if flag.NArg() != 1 {
+	// (-explain takes the field path as an additional positional argument)
+	var explainField string
+	if explainResource != "" {
+		if flag.NArg() != 2 {
+			fmt.Fprintf(os.Stderr, "Usage: %s -explain <Kind/Name> <field.path> <kustomization-dir>\n", os.Args[0])
+			os.Exit(1)
+		}
+		explainField = flag.Arg(0)
+	} else if compareYAML {
+		if flag.NArg() != 2 {
+			fmt.Fprintf(os.Stderr, "Usage: %s -compare-yaml <before.yaml> <after.yaml>\n", os.Args[0])
+			os.Exit(1)
+		}
+	} else if matrix {
+		if flag.NArg() < 2 {
+			fmt.Fprintf(os.Stderr, "Usage: %s -matrix <overlay-dir> <overlay-dir>...\n", os.Args[0])
+			os.Exit(1)
+		}
+	} else if flag.NArg() != 1 {
 		fmt.Fprintf(os.Stderr, "Usage: %s [-show-final] <kustomization-dir>\n", os.Args[0])
 		os.Exit(1)
 	}
 
-	kustomizationDir := flag.Arg(0)
+	kustomizationDir := flag.Arg(flag.NArg() - 1)
 	fs := filesys.MakeFsOnDisk()
 
-	// 1. Build the final kustomization
-	opts := krusty.MakeDefaultOptions()
-	k := krusty.MakeKustomizer(opts)
-	finalResMap, err := k.Run(fs, kustomizationDir)
+	// Fill in flags not given on the command line from the config file
+	if configPath == "" {
+		configPath = findConfig(fs, kustomizationDir, ".")
+	}
+	if configPath != "" {
+		config, err := loadConfig(fs, configPath)
+		if err != nil {
+			logFatal("Failed loading config: %v", err)
+		}
+		if err := applyConfig(flag.CommandLine, config); err != nil {
+			logFatal("Invalid config %s: %v", configPath, err)
+		}
+	}
+
+	// Read a bundled kustomization tree into memory
+	if !matrix && !compareYAML && isArchive(kustomizationDir) {
+		if watch {
+			logFatal("-watch can't be used with an archive")
+		}
+		if explainRemote {
+			logFatal("-explain-remote-bases can't be used with an archive")
+		}
+		archiveFs, err := loadArchive(kustomizationDir)
+		if err != nil {
+			logFatal("Failed loading archive %s: %v", kustomizationDir, err)
+		}
+		root, err := archiveRoot(archiveFs, rootInArchive)
+		if err != nil {
+			logFatal("%s: %v", kustomizationDir, err)
+		}
+		fs, kustomizationDir = archiveFs, root
+	}
+
+	// Show sources relative to -relative-to, or the kustomization directory
+	if relativeTo == "" {
+		relativeTo = kustomizationDir
+		if compareYAML {
+			relativeTo = filepath.Dir(kustomizationDir)
+		}
+	}
+	base, err := filepath.Abs(relativeTo)
 	if err != nil {
-		logFatal("Kustomize build failed: %v", err)
+		logFatal("Invalid -relative-to %s: %v", relativeTo, err)
 	}
+	sourceBase = base
 
-	// 2. Load kustomization.yaml
-	kustData, err := fs.ReadFile(filepath.Join(kustomizationDir, "kustomization.yaml"))
+	restrictions, err := parseLoadRestrictor(loadRestrictor)
+	if err != nil {
+		logFatal("%v", err)
+	}
+	if err := kdiff.ValidateResourceKeyFormat(keyFormat); err != nil {
+		logFatal("%v", err)
+	}
+	if onlyResource != "" && !strings.Contains(onlyResource, "/") {
+		logFatal("-resource takes a Kind/Name or Kind/Namespace/Name key, e.g. Deployment/test")
+	}
+	mergeKeys, err := parseMergeKeys(mergeKeyFlags)
+	if err != nil {
+		logFatal("%v", err)
+	}
+	fieldPolicies, err := parseFieldPolicies(fieldPolicyFlags)
 	if err != nil {
-		logFatal("Failed reading kustomization.yaml: %v", err)
+		logFatal("%v", err)
+	}
+	changeDiffer, err := kdiff.NewDiffer(diffLib)
+	if err != nil {
+		logFatal("%v", err)
+	}
+
+	// Options of every kustomize build, shared by all modes
+	buildOpts := kdiff.Options{
+		LoadRestrictions:   restrictions,
+		EnableHelm:         enableHelmCharts,
+		HelmCommand:        helmCommand,
+		EnableExec:         execFunctions,
+		Reorder:            krusty.ReorderOption(reorder),
+		EnableAlphaPlugins: alphaPlugins,
+	}
+	if err := kdiff.ValidateBuildOptions(buildOpts); err != nil {
+		logFatal("%v", err)
 	}
 
-	var kust types.Kustomization
-	if err := yaml.Unmarshal(kustData, &kust); err != nil {
-		logFatal("Failed parsing kustomization.yaml: %v", err)
+	// Abort the whole run, in any mode, at the -timeout deadline
+	ctx := context.Background()
+	if runTimeout > 0 {
+		if watch {
+			logFatal("-timeout can't be used with -watch")
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = withTimeout(runTimeout)
+		defer cancel()
+		buildOpts.Context = ctx
 	}
 
-	// Debug kustomization content
-	fmt.Printf("\n=== Kustomization Configuration ===\n")
-	fmt.Printf("Base Resources:\n")
-	for _, res := range kust.Resources {
-		fmt.Printf("  - %s\n", res)
+	switch outputFormat {
+	case "text":
+	case "junit", "origin":
+		// Keep stdout for the report only
+		logOut = os.Stderr
+	case "json":
+		if !listPatches && !summaryOnly {
+			logFatal("-o json is only supported with -list-patches or -summary-only")
+		}
+	default:
+		logFatal("Unknown output format %q (expected text, junit or origin)", outputFormat)
+	}
+	if listPatches && outputFormat != "text" && outputFormat != "json" {
+		logFatal("-list-patches supports -o text or json")
 	}
-	if len(kust.Components) > 0 {
-		fmt.Printf("Components:\n")
-		for _, comp := range kust.Components {
-			fmt.Printf("  - %s\n", comp)
+	if outputFormat == "origin" && outputDir != "" {
+		logFatal("-o origin can't be used with -output-dir")
+	}
+	if dumpBaseKey != "" {
+		if !strings.Contains(dumpBaseKey, "/") {
+			logFatal("-dump-base takes a Kind/Name or Kind/Namespace/Name key, e.g. Deployment/test")
+		}
+		// Keep stdout for the YAML only
+		logOut = os.Stderr
+	}
+	if summaryOnly {
+		if outputFormat != "text" && outputFormat != "json" {
+			logFatal("-summary-only supports -o text or json")
 		}
+		// Keep stdout for the summary only
+		logOut = os.Stderr
 	}
 
-	// 3. Recursively collect all patches and resources
-	allPatches := make([]types.Patch, 0)
-	allResources := make(map[string]*resource.Resource)
-	baseK := krusty.MakeKustomizer(opts)
+	// Fail on a broken report template before doing any work
+	var reportTmpl *template.Template
+	if reportTemplatePath != "" {
+		if reportTmpl, err = loadReportTemplate(reportTemplatePath); err != nil {
+			logFatal("%v", err)
+		}
+	}
 
-	// Process each base resource directory
-	for _, baseDir := range kust.Resources {
-		absBaseDir := filepath.Join(kustomizationDir, baseDir)
-		processResourceOrKustomization(fs, baseK, absBaseDir, &allPatches, allResources)
+	// Profile the run with the hidden -cpuprofile and -memprofile flags
+	if watch && (cpuProfile != "" || memProfile != "") {
+		logFatal("-cpuprofile and -memprofile can't be used with -watch")
+	}
+	stopProfiling, err := startProfiling(cpuProfile, memProfile)
+	if err != nil {
+		logFatal("%v", err)
 	}
+	stopProfile := func() {
+		if err := stopProfiling(); err != nil {
+			logError("%v", err)
+		}
+	}
+	beforeExit = stopProfile
 
-	// Process each component directory
-	for _, compDir := range kust.Components {
-		absCompDir := filepath.Join(kustomizationDir, compDir)
-		processResourceOrKustomization(fs, baseK, absCompDir, &allPatches, allResources)
+	// Check remote bases out into the cache to attribute their patches
+	var fetchRemote kdiff.RemoteFetcher
+	if explainRemote {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			logFatal("-explain-remote-bases needs a cache directory: %v", err)
+		}
+		fetchRemote = kdiff.GitFetcher(filepath.Join(cacheDir, "kustomize-diff", "remote-bases"))
 	}
 
-	// Add inline patches from the root kustomization
-	for _, patch := range kust.Patches {
-		if patch.Path != "" {
-			// Make path relative to root kustomization
-			patch.Path = filepath.Join(kustomizationDir, string(patch.Path))
+	// List the collected patches without applying them
+	if listPatches {
+		logOut = os.Stderr
+		opts := buildOpts
+		opts.NoFollowSymlinks = !followLinks
+		opts.MinKustomizationVersion = minVersion
+		opts.Verbose = verboseOutput
+		opts.FetchRemote = fetchRemote
+		opts.Log = logOut
+		patches, err := kdiff.ListPatches(fs, kustomizationDir, opts)
+		if err != nil {
+			logFatal("%v", err)
 		}
-		allPatches = append(allPatches, patch)
+		if err := writePatchList(os.Stdout, outputFormat, patches); err != nil {
+			logFatal("Failed to write patch list: %v", err)
+		}
+		stopProfile()
+		return
 	}
 
-	// Add JSON patches from the root kustomization
-	for _, patch := range kust.PatchesJson6902 {
-		if patch.Path != "" {
-			// Make path relative to root kustomization
-			patch.Path = filepath.Join(kustomizationDir, string(patch.Path))
+	// Compare overlays side by side instead of attributing changes
+	if matrix {
+		opts := buildOpts
+		opts.CompareAll = !onlyChanged
+		opts.IncludeStatus = includeStatus
+		opts.ShowSecrets = showSecrets
+		opts.Log = logOut
+		result, err := kdiff.Matrix(fs, flag.Args(), opts)
+		if err != nil {
+			logFatal("%v", err)
+		}
+		if err := writeMatrix(os.Stdout, flag.Args(), formatMatrixKeys(keyFormat, result)); err != nil {
+			logFatal("Failed to write matrix: %v", err)
 		}
-		allPatches = append(allPatches, types.Patch{
-			Target: patch.Target,
-			Patch:  string(patch.Patch),
-		})
+		stopProfile()
+		return
 	}
 
-	fmt.Printf("\nPatches:\n")
-	for i, patch := range allPatches {
-		if patch.Path != "" {
-			fmt.Printf("  %d. File: %s\n", i+1, patch.Path)
-		} else {
-			fmt.Printf("  %d. Inline Patch\n", i+1)
+	// Compare two rendered YAML files without building
+	if compareYAML {
+		opts := buildOpts
+		opts.IgnorePaths = ignorePaths
+		opts.IncludePaths = includePaths
+		opts.ShowSecrets = showSecrets
+		opts.IncludeStatus = includeStatus
+		opts.Differ = changeDiffer
+		opts.CompareAll = !onlyChanged
+		opts.Log = logOut
+		before := flag.Arg(0)
+		result, err := kdiff.CompareYAML(fs, before, kustomizationDir, opts)
+		if err != nil {
+			logFatal("%v", err)
+		}
+		printCompareYAML(formatBaseRefKeys(keyFormat, result), before, kustomizationDir, textStyle{Color: useColor, Context: contextLines})
+		stopProfile()
+		if failOnChange && len(result.FieldSources)+len(result.Added)+len(result.Removed) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Compare against another baseline instead of attributing changes
+	if baseRef != "" {
+		opts := buildOpts
+		opts.IgnorePaths = ignorePaths
+		opts.IncludePaths = includePaths
+		opts.ShowSecrets = showSecrets
+		opts.IncludeStatus = includeStatus
+		opts.Differ = changeDiffer
+		opts.CompareAll = !onlyChanged
+		opts.Log = logOut
+		result, err := kdiff.DiffBaseRef(fs, baseRef, kustomizationDir, opts)
+		if err != nil {
+			logFatal("%v", err)
 		}
-		fmt.Printf("     Target: %s/%s\n", patch.Target.Kind, patch.Target.Name)
+		printBaseRefDiff(formatBaseRefKeys(keyFormat, result), textStyle{Color: useColor, Context: contextLines})
+		stopProfile()
+		if failOnChange && len(result.FieldSources)+len(result.Added)+len(result.Removed) > 0 {
+			os.Exit(1)
+		}
+		return
 	}
 
-	fmt.Printf("\n=== Processing Patches ===\n")
-	fmt.Printf("Found %d base resources\n", len(allResources))
+	var processors []kdiff.FieldSourceProcessor
+	if base64Decode {
+		processors = append(processors, kdiff.Base64Decoder(showSecrets))
+	}
 
-	// 4. Process all collected patches
-	fmt.Printf("Found %d patches to apply\n", len(allPatches))
-	for i, patch := range allPatches {
-		fmt.Printf("\n--- Processing Patch %d/%d ---\n", i+1, len(allPatches))
-		if patch.Path != "" {
-			fmt.Printf("Patch File: %s\n", patch.Path)
-		} else {
-			fmt.Printf("Inline Patch\n")
-		}
-		fmt.Printf("Target: %s/%s\n", patch.Target.Kind, patch.Target.Name)
-
-		// Find target resource
-		targetKey := fmt.Sprintf("%s/%s", patch.Target.Kind, patch.Target.Name)
-		var targetRes *resource.Resource
-		var exists bool
-		if patch.Target.Name == "" {
-			// If no name specified, find first resource of this kind
-			for key, res := range allResources {
-				if strings.HasPrefix(key, patch.Target.Kind+"/") {
-					targetRes = res
-					exists = true
+	// Compare the attribution at two git revisions
+	if toRevision != "" && fromRevision == "" {
+		logFatal("-to-revision needs -from-revision")
+	}
+	if fromRevision != "" {
+		opts := buildOpts
+		opts.Processors = processors
+		opts.IgnorePaths = ignorePaths
+		opts.IncludePaths = includePaths
+		opts.Kinds = kindAllowlist
+		opts.IgnoreKinds = ignoreKinds
+		opts.ShowSecrets = showSecrets
+		opts.MergeKeys = mergeKeys
+		opts.ReplaceLists = replaceLists
+		opts.Differ = changeDiffer
+		logOut = os.Stderr
+		opts.Log = logOut
+		deltas, err := kdiff.DiffRevisions(kustomizationDir, fromRevision, toRevision, opts)
+		if err != nil {
+			logFatal("%v", err)
+		}
+		writeAttributionDeltas(os.Stdout, fromRevision, toRevision, deltas)
+		stopProfile()
+		if failOnChange && len(deltas) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Run the attribution and print the report, returning the exit code
+	run := func() int {
+		opts := buildOpts
+		opts.Processors = processors
+		opts.Namespace = namespace
+		opts.IncludeClusterScoped = includeClusterScoped
+		opts.StrictNamespace = strictNamespace
+		opts.IgnorePaths = ignorePaths
+		opts.IncludePaths = includePaths
+		opts.Kinds = kindAllowlist
+		opts.IgnoreKinds = ignoreKinds
+		opts.ShowSecrets = showSecrets
+		opts.MinKustomizationVersion = minVersion
+		opts.NoFollowSymlinks = !followLinks
+		opts.BuildFinal = showFinalOutput || clusterMode || assertAttribution || transformerDefaults || len(fieldPolicies) > 0 || outputFormat == "text"
+		opts.MaxDepth = depthLimit
+		opts.MaxTreeDepth = treeDepthLimit
+		opts.Verbose = verboseOutput
+		opts.StrictMergeKeys = strictMergeKeyMissing
+		opts.VerifyOrigins = verifyOriginAnnotations
+		opts.MergeKeys = mergeKeys
+		opts.ReplaceLists = replaceLists
+		opts.IgnoreGenerated = ignoreGenerated
+		opts.StrictJSONPatch = jsonPatchStrict
+		opts.FetchRemote = fetchRemote
+		opts.DryApply = dryApply
+		opts.IncludeTransformerDefaults = transformerDefaults
+		opts.CheckBaseDrift = baseDriftCheck
+		opts.Resource = onlyResource
+		opts.Differ = changeDiffer
+		opts.Log = logOut
+		result, err := kdiff.Diff(fs, kustomizationDir, opts)
+		if err != nil {
+			logError("%v", err)
+			return 1
+		}
+		finalResMap := result.Final
+		allResources := result.Resources
+
+		fieldSources := result.FieldSources
+
+		// Trace a single field instead of printing the full report
+		if explainResource != "" {
+			printExplain(os.Stdout, explainResource, explainField, allResources, fieldSources, showSecrets)
+			return 0
+		}
+
+		// Print the base a resource's changes are attributed against instead
+		if dumpBaseKey != "" {
+			if err := dumpBase(os.Stdout, dumpBaseKey, allResources, showSecrets); err != nil {
+				logError("%v", err)
+				return 1
+			}
+			return 0
+		}
+
+		// Report resources with -resource-key-format keys from here on
+		var unmodified []string
+		for _, key := range unmodifiedResources(allResources, fieldSources) {
+			unmodified = append(unmodified, reportKey(keyFormat, key))
+		}
+		fieldSources = applyResourceKeyFormat(keyFormat, fieldSources)
+		unattributed := applyResourceKeyFormat(keyFormat, result.Unattributed)
+		implicit := applyResourceKeyFormat(keyFormat, result.Implicit)
+		drift := applyResourceKeyFormat(keyFormat, result.BaseDrift)
+
+		// Check policy assertions now that all changes are recorded
+		violations := make(map[int]string)
+		for i, change := range fieldSources {
+			for _, pattern := range expectNoChange {
+				if kdiff.MatchesPathGlob(pattern, change) {
+					violations[i] = pattern
 					break
 				}
 			}
-		} else {
-			targetRes, exists = allResources[targetKey]
-		}
-		if !exists {
-			fmt.Printf("Warning: No matching resource found for patch target\n")
-			continue
 		}
 
-		// Get state before patch
-		var beforeMap map[string]interface{}
-		if err := yaml.Unmarshal([]byte(targetRes.MustYaml()), &beforeMap); err != nil {
-			logFatal("Failed to unmarshal before state: %v", err)
+		objects, err := afterStates(keyFormat, finalResMap)
+		if err != nil {
+			logError("%v", err)
+			return 1
+		}
+		style := textStyle{Color: useColor, Context: contextLines, Objects: objects, Options: opts}
+		if sideBySide && isTerminal(os.Stdout) {
+			style.SideBySide = true
+			style.Width = terminalWidth()
 		}
 
-		// Create a copy of the base resource for patching
-		patchedRes := targetRes.DeepCopy()
+		failed := func(i int) string {
+			if _, violated := violations[i]; violated {
+				return "expect-no-change"
+			}
+			return ""
+		}
 
-		// Apply patch
-		var patchData []byte
-		if patch.Path != "" {
-			// File-based patch
-			var err error
-			patchData, err = fs.ReadFile(patch.Path)
+		if summaryOnly {
+			if err := writeSummaryOnly(os.Stdout, outputFormat, buildSummary(result, fieldSources)); err != nil {
+				logError("Failed to write summary: %v", err)
+				return 1
+			}
+		} else if outputDir != "" {
+			if err := writeResourceReports(outputDir, outputFormat, fieldSources, style, failed); err != nil {
+				logError("Failed to write reports: %v", err)
+				return 1
+			}
+		} else if outputFormat == "junit" {
+			if err := writeJUnitReport(os.Stdout, fieldSources, failed); err != nil {
+				logError("Failed to write JUnit report: %v", err)
+				return 1
+			}
+		} else if outputFormat == "origin" {
+			origins := make(map[string]string)
+			for key, path := range result.Origins {
+				origins[reportKey(keyFormat, key)] = path
+			}
+			generated := make([]kdiff.GeneratedResource, len(result.Generated))
+			for i, gen := range result.Generated {
+				gen.Resource = reportKey(keyFormat, gen.Resource)
+				generated[i] = gen
+			}
+			provenance, err := buildProvenance(fieldSources, origins, generated)
+			if err == nil {
+				err = writeProvenance(os.Stdout, provenance)
+			}
 			if err != nil {
-				fmt.Printf("Warning: Reading patch %s failed: %v\n", patch.Path, err)
-				continue
+				logError("Failed to write origins: %v", err)
+				return 1
+			}
+		} else if reportTmpl != nil {
+			if err := writeTemplateReport(os.Stdout, reportTmpl, fieldSources, unattributed, objects, opts); err != nil {
+				logError("Failed to render report template: %v", err)
+				return 1
+			}
+		} else if compact {
+			if err := writeCompactReport(os.Stdout, fieldSources); err != nil {
+				logError("Failed to write compact report: %v", err)
+				return 1
 			}
+		} else if imageOnly {
+			if err := writeImageChanges(os.Stdout, findImageChanges(fieldSources)); err != nil {
+				logError("Failed to write image changes: %v", err)
+				return 1
+			}
+		} else if showChains {
+			printChains(buildFieldChains(fieldSources))
 		} else {
-			// Inline patch
-			patchData = []byte(patch.Patch)
+			printFieldChanges("Field Changes", fieldSources, style)
 		}
 
-		// Parse the patch data
-		var patchContent interface{}
-		if err := yaml.Unmarshal(patchData, &patchContent); err != nil {
-			fmt.Printf("Warning: Failed to parse patch content: %v\n", err)
-			continue
+		if outputFormat == "text" && !summaryOnly && !imageOnly && !compact && reportTmpl == nil {
+			if len(unattributed) > 0 {
+				printFieldChanges("Unattributed Changes", unattributed, style)
+			}
+			if len(implicit) > 0 {
+				printFieldChanges("Implicit Kustomize Transformations", implicit, style)
+			}
+			if len(drift) > 0 {
+				printFieldChanges("Base Drift", drift, style)
+			}
+			if churned := churnedFields(buildFieldChains(fieldSources)); len(churned) > 0 {
+				printChurnedFields(churned)
+			}
+			printGeneratedResources(result.Generated)
+			if countByType {
+				if err := writePathHistogram(os.Stdout, countByPathPrefix(fieldSources)); err != nil {
+					logError("Failed to write path histogram: %v", err)
+					return 1
+				}
+			}
 		}
 
-		// Convert the resource to a map for patching
-		var resourceMap map[string]interface{}
-		if err := yaml.Unmarshal([]byte(patchedRes.MustYaml()), &resourceMap); err != nil {
-			logFatal("Failed to unmarshal resource: %v", err)
+		if summaryJSON != "" {
+			summary := buildSummary(result, fieldSources)
+			if countByType {
+				summary.PathPrefixes = countByPathPrefix(fieldSources)
+			}
+			if err := writeSummaryJSON(summaryJSON, summary); err != nil {
+				logError("Failed to write summary: %v", err)
+				return 1
+			}
 		}
 
-		// Apply the patch based on its type
-		switch patchContent := patchContent.(type) {
-		case []interface{}:
-			// JSON patch format
-			for _, op := range patchContent {
-				opMap, ok := op.(map[string]interface{})
-				if !ok {
-					logFatal("Invalid patch operation format")
-				}
-				opType, ok := opMap["op"].(string)
-				if !ok {
-					logFatal("Missing or invalid operation type")
+		// Compare what we render with what's deployed
+		if clusterMode {
+			get, err := kubeconfigGetter(ctx)
+			if err != nil {
+				logError("Live cluster diff failed: %v", err)
+				return 1
+			}
+			liveChanges, missing, err := kdiff.DiffLive(finalResMap.Resources(), get, kdiff.Options{IncludeStatus: includeStatus, Differ: changeDiffer})
+			if err != nil {
+				logError("Live cluster diff failed: %v", err)
+				return 1
+			}
+			liveChanges = kdiff.FilterFieldSources(liveChanges, includePaths, ignorePaths)
+			if !showSecrets {
+				liveChanges = kdiff.RedactSecrets(liveChanges)
+			}
+			liveChanges = applyResourceKeyFormat(keyFormat, liveChanges)
+			for i, key := range missing {
+				missing[i] = reportKey(keyFormat, key)
+			}
+			printLiveDiff(liveChanges, missing, style)
+		}
+
+		if baseOnlyReport {
+			printUnmodifiedResources(unmodified)
+		}
+
+		// Only show final output if flag is set
+		if showFinalOutput {
+			shown := finalResMap
+			if !showSecrets {
+				if shown, err = kdiff.RedactSecretResources(finalResMap); err != nil {
+					logError("Masking secrets failed: %v", err)
+					return 1
 				}
-				path, ok := opMap["path"].(string)
-				if !ok {
-					logFatal("Missing or invalid path")
+			}
+			yml, err := shown.AsYaml()
+			if err != nil {
+				logError("Marshal final output failed: %v", err)
+				return 1
+			}
+			if len(result.Ordering) > 0 {
+				ordering := make([]kdiff.OrderChange, len(result.Ordering))
+				for i, change := range result.Ordering {
+					change.Resource = reportKey(keyFormat, change.Resource)
+					ordering[i] = change
 				}
-				value := opMap["value"]
-
-				// Convert path to array of keys
-				pathKeys := parsePath(path)
-
-				// Get original value before change
-				originalValue := getValueAtPath(resourceMap, pathKeys)
-
-				// Apply the operation
-				switch opType {
-				case "add":
-					applyAdd(resourceMap, pathKeys, value)
-					// Record the change
-					fieldSources = append(fieldSources, FieldSource{
-						Resource: fmt.Sprintf("%s/%s", targetRes.GetKind(), targetRes.GetName()),
-						Path:     pathKeys,
-						Source:   patch.Path,
-						Original: originalValue,
-						New:      value,
-					})
-				case "replace":
-					applyReplace(resourceMap, pathKeys, value)
-					// Record the change
-					fieldSources = append(fieldSources, FieldSource{
-						Resource: fmt.Sprintf("%s/%s", targetRes.GetKind(), targetRes.GetName()),
-						Path:     pathKeys,
-						Source:   patch.Path,
-						Original: originalValue,
-						New:      value,
-					})
-				case "remove":
-					applyRemove(resourceMap, pathKeys)
-					// Record the removal
-					fieldSources = append(fieldSources, FieldSource{
-						Resource: fmt.Sprintf("%s/%s", targetRes.GetKind(), targetRes.GetName()),
-						Path:     pathKeys,
-						Source:   patch.Path,
-						Original: originalValue,
-						New:      nil,
-					})
+				if err := writeOrderChanges(os.Stdout, ordering); err != nil {
+					logError("Failed to write resource order: %v", err)
+					return 1
 				}
 			}
-		case map[string]interface{}:
-			// Strategic merge patch format
-			// Get original state before merge
-			originalState := make(map[string]interface{})
-			for k, v := range resourceMap {
-				originalState[k] = deepCopyValue(v)
-			}
-
-			// Apply the merge
-			mergeMap(resourceMap, patchContent)
-
-			// Compare and record changes
-			for k, newVal := range resourceMap {
-				oldVal, exists := originalState[k]
-				if !exists || !reflect.DeepEqual(oldVal, newVal) {
-					fieldSources = append(fieldSources, FieldSource{
-						Resource: fmt.Sprintf("%s/%s", targetRes.GetKind(), targetRes.GetName()),
-						Path:     []string{k},
-						Source:   patch.Path,
-						Original: oldVal,
-						New:      newVal,
-					})
+			fmt.Printf("\n=== Final Output ===\n")
+			fmt.Println(string(yml))
+		}
+
+		if len(violations) > 0 {
+			fmt.Fprintf(os.Stderr, "\n=== Policy Violations ===\n")
+			for i, change := range fieldSources {
+				pattern, violated := violations[i]
+				if !violated {
+					continue
 				}
+				fmt.Fprintf(os.Stderr, "  • %s: %s changed by %s (expect-no-change %s)\n",
+					change.Resource, strings.Join(change.Path, "."), describeSource(change), pattern)
+				fmt.Fprintf(os.Stderr, "    %v → %v\n", change.Original, change.New)
+			}
+			return 1
+		}
+
+		if len(fieldPolicies) > 0 {
+			policyViolations, err := checkFieldPolicies(finalResMap, fieldPolicies)
+			if err != nil {
+				logError("Checking field policies failed: %v", err)
+				return 1
 			}
-			// Check for removed fields
-			for k, oldVal := range originalState {
-				if _, exists := resourceMap[k]; !exists {
-					fieldSources = append(fieldSources, FieldSource{
-						Resource: fmt.Sprintf("%s/%s", targetRes.GetKind(), targetRes.GetName()),
-						Path:     []string{k},
-						Source:   patch.Path,
-						Original: oldVal,
-						New:      nil,
-					})
+			if len(policyViolations) > 0 {
+				if !showSecrets {
+					policyViolations = redactViolations(policyViolations)
 				}
+				for i, violation := range policyViolations {
+					policyViolations[i].Resource = reportKey(keyFormat, violation.Resource)
+				}
+				writePolicyViolations(os.Stderr, policyViolations)
+				return 1
 			}
 		}
 
-		// Convert back to YAML
-		patchedYaml, err := yaml.Marshal(resourceMap)
-		if err != nil {
-			logFatal("Failed to marshal patched resource: %v", err)
+		if warningsAsErrors && len(result.Warnings) > 0 {
+			fmt.Fprintf(os.Stderr, "\n=== Warnings ===\n")
+			for _, w := range result.Warnings {
+				fmt.Fprintf(os.Stderr, "  • %s (%s): %s\n", w.Patch, w.Category, w.Reason)
+			}
+			return 1
 		}
 
-		// Create new resource from patched YAML
-		patchedRes, err = resource.NewFactory(nil).FromBytes(patchedYaml)
-		if err != nil {
-			logFatal("Failed to create patched resource: %v", err)
+		if removed := removedFields(fieldSources); failOnRemoval && len(removed) > 0 {
+			fmt.Fprintf(os.Stderr, "\n=== Removed Fields ===\n")
+			for _, change := range removed {
+				fmt.Fprintf(os.Stderr, "  • %s: %s removed by %s\n",
+					change.Resource, strings.Join(change.Path, "."), describeSource(change))
+				fmt.Fprintf(os.Stderr, "    was %v\n", change.Original)
+			}
+			return 1
 		}
 
-		// Get state after patch
-		var afterMap map[string]interface{}
-		if err := yaml.Unmarshal([]byte(patchedRes.MustYaml()), &afterMap); err != nil {
-			logFatal("Failed to unmarshal after state: %v", err)
+		if len(result.OriginMismatches) > 0 {
+			fmt.Fprintf(os.Stderr, "\n=== Origin Mismatches ===\n")
+			for _, mismatch := range result.OriginMismatches {
+				fmt.Fprintf(os.Stderr, "  • %s: attributed to %s, kustomize says %s\n",
+					reportKey(keyFormat, mismatch.Resource), formatSource(mismatch.Ours), formatSource(mismatch.Kustomize))
+			}
+			return 1
 		}
 
-		// Track changes
-		changelog, err := diff.Diff(beforeMap, afterMap)
-		if err != nil {
-			logFatal("Failed to diff states: %v", err)
+		if assertAttribution && len(unattributed) > 0 {
+			writeUnattributedFields(os.Stderr, unattributed)
+			return 1
+		}
+
+		if failOnChange && len(fieldSources) > 0 {
+			fmt.Fprintf(os.Stderr, "\n%d changes detected\n", len(fieldSources))
+			return 1
 		}
 
-		fmt.Printf("Changes detected: %d\n", len(changelog))
+		return 0
 	}
 
-	// 5. Output results
-	yml, err := finalResMap.AsYaml()
-	if err != nil {
-		logFatal("Marshal final output failed: %v", err)
+	if watch {
+		if err := watchTree(fs, kustomizationDir, watchDebounce, func() {
+			clearScreen()
+			run()
+		}); err != nil {
+			logFatal("Watch failed: %v", err)
+		}
+		return
+	}
+	code := run()
+	stopProfile()
+	os.Exit(code)
+}
+
+// ANSI color codes for the text report
+const (
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorReset = "\033[0m"
+)
+
+// textStyle controls how values are laid out in the text report
+type textStyle struct {
+	Color      bool // Color original and new values
+	SideBySide bool // Show original and new values in two columns
+	Width      int  // Terminal width for the side-by-side layout
+	Context    int  // Unchanged lines around changes in multi-line value diffs
+
+	// Objects holds the after-state of each resource by report key, to name
+	// list elements in paths, and Options the run's merge keys of the lists
+	Objects map[string]interface{}
+	Options kdiff.Options
+}
+
+// colorize wraps s in the given color if enabled
+func colorize(s, color string, enabled bool) string {
+	if !enabled {
+		return s
 	}
+	return color + s + colorReset
+}
 
-	// Print field sources
-	fmt.Printf("\n=== Field Changes ===\n")
+// printFieldChanges prints every recorded change grouped by resource under
+// the given section title
+func printFieldChanges(title string, sources []kdiff.FieldSource, style textStyle) {
+	writeFieldChanges(os.Stdout, title, sources, style)
+}
+
+// writeFieldChanges writes the text report of the changes to w
+func writeFieldChanges(w io.Writer, title string, sources []kdiff.FieldSource, style textStyle) {
+	fmt.Fprintf(w, "\n=== %s ===\n", title)
 
 	// Group changes by resource
-	resourceChanges := make(map[string][]FieldSource)
-	for _, source := range fieldSources {
+	resourceChanges := make(map[string][]kdiff.FieldSource)
+	for _, source := range sources {
 		resourceChanges[source.Resource] = append(resourceChanges[source.Resource], source)
 	}
 
 	// Print changes grouped by resource
 	for resource, changes := range resourceChanges {
-		fmt.Printf("\nResource: %s\n", resource)
-		fmt.Printf("Changes:\n")
+		fmt.Fprintf(w, "\nResource: %s\n", resource)
+		fmt.Fprintf(w, "Changes:\n")
 		for _, change := range changes {
 			// Format the path in a more readable way
-			pathStr := strings.Join(change.Path, " → ")
+			pathStr := formatPath(change, style.Objects[resource], style.Options)
 
-			// Format the source file name only (without full path)
-			sourceFile := change.Source
-			if sourceFile != "" {
-				sourceFile = filepath.Base(sourceFile)
-			} else {
-				sourceFile = "inline patch"
+			fmt.Fprintf(w, "  • Field: %s\n", pathStr)
+			if change.Element != "" {
+				fmt.Fprintf(w, "    Element: %s\n", change.Element)
+			}
+			fmt.Fprintf(w, "    Modified by: %s\n", describeSource(change))
+
+			// Multi-line strings are easier to review as a line diff
+			if before, after, ok := multilineStrings(change.Original, change.New); ok {
+				fmt.Fprintf(w, "    Diff:\n")
+				for _, line := range unifiedDiff(before, after, style.Context) {
+					switch line[0] {
+					case '-':
+						line = colorize(line, colorRed, style.Color)
+					case '+':
+						line = colorize(line, colorGreen, style.Color)
+					}
+					fmt.Fprintf(w, "      %s\n", line)
+				}
+				continue
 			}
 
-			fmt.Printf("  • Field: %s\n", pathStr)
-			fmt.Printf("    Modified by: %s\n", sourceFile)
+			if style.SideBySide {
+				for _, line := range renderSideBySide(change.Original, change.New, style.Width-4) {
+					fmt.Fprintf(w, "    %s\n", line)
+				}
+				continue
+			}
 
 			// Format the values in a more readable way
 			if change.Original != nil {
-				fmt.Printf("    Original: %v\n", change.Original)
+				fmt.Fprintf(w, "    Original: %s\n", colorize(fmt.Sprintf("%v", change.Original), colorRed, style.Color))
 			}
 			if change.New != nil {
-				fmt.Printf("    New: %v\n", change.New)
+				fmt.Fprintf(w, "    New: %s\n", colorize(fmt.Sprintf("%v", change.New), colorGreen, style.Color))
 			} else {
-				fmt.Printf("    Removed\n")
+				fmt.Fprintf(w, "    %s\n", colorize("Removed", colorRed, style.Color))
 			}
 		}
 	}
+}
 
-	// Only show final output if flag is set
-	if showFinalOutput {
-		fmt.Printf("\n=== Final Output ===\n")
-		fmt.Println(string(yml))
+// removedFields returns the changes that removed a field
+func removedFields(sources []kdiff.FieldSource) []kdiff.FieldSource {
+	var removed []kdiff.FieldSource
+	for _, change := range sources {
+		if changeType(change) == "removed" {
+			removed = append(removed, change)
+		}
 	}
+	return removed
 }
 
-func processResourceOrKustomization(fs filesys.FileSystem, k *krusty.Kustomizer, path string, allPatches *[]types.Patch, allResources map[string]*resource.Resource) {
-	// Check if it's a kustomization directory
-	kustPath := filepath.Join(path, "kustomization.yaml")
-	if _, err := fs.ReadFile(kustPath); err == nil {
-		// It's a kustomization directory
-		processKustomization(fs, k, path, allPatches, allResources)
-		return
+// unmodifiedResources returns the sorted keys of resources with no recorded
+// changes
+func unmodifiedResources(allResources map[string]*resource.Resource, sources []kdiff.FieldSource) []string {
+	modified := make(map[string]bool)
+	for _, source := range sources {
+		modified[source.Resource] = true
 	}
 
-	// Try to load as a resource file
-	if data, err := fs.ReadFile(path); err == nil {
-		// Load the resource
-		res, err := resource.NewFactory(nil).FromBytes(data)
-		if err != nil {
-			logFatal("Failed to load resource %s: %v", path, err)
+	var keys []string
+	for key := range allResources {
+		if !modified[key] {
+			keys = append(keys, key)
 		}
-
-		// Add to resources map
-		key := fmt.Sprintf("%s/%s", res.GetKind(), res.GetName())
-		allResources[key] = res
-	} else {
-		logFatal("Path %s is neither a kustomization directory nor a resource file: %v", path, err)
 	}
+	sort.Strings(keys)
+	return keys
 }
 
-func processKustomization(fs filesys.FileSystem, k *krusty.Kustomizer, dir string, allPatches *[]types.Patch, allResources map[string]*resource.Resource) {
-	// Load kustomization.yaml
-	kustPath := filepath.Join(dir, "kustomization.yaml")
-	kustData, err := fs.ReadFile(kustPath)
-	if err != nil {
-		logFatal("Failed reading kustomization.yaml at %s: %v", dir, err)
+// printUnmodifiedResources prints the resources that passed through untouched
+func printUnmodifiedResources(keys []string) {
+	fmt.Printf("\n=== Unmodified Resources ===\n")
+	if len(keys) == 0 {
+		fmt.Printf("None\n")
+		return
 	}
-
-	var kust types.Kustomization
-	if err := yaml.Unmarshal(kustData, &kust); err != nil {
-		logFatal("Failed parsing kustomization.yaml at %s: %v", dir, err)
+	for _, key := range keys {
+		fmt.Printf("  - %s\n", key)
 	}
+}
 
-	// Add patches from this kustomization, with paths relative to this kustomization
-	for _, patch := range kust.Patches {
-		if patch.Path != "" {
-			// Make path relative to this kustomization
-			patch.Path = filepath.Join(dir, string(patch.Path))
+// FieldChain links the changes recorded for the same field of a resource, in
+// the order the patches were applied
+type FieldChain struct {
+	Resource string
+	Path     []string
+	Changes  []kdiff.FieldSource
+}
+
+// Original returns the field's value before the first patch in the chain
+func (c FieldChain) Original() interface{} {
+	return c.Changes[0].Original
+}
+
+// Final returns the field's value after the last patch in the chain
+func (c FieldChain) Final() interface{} {
+	return c.Changes[len(c.Changes)-1].New
+}
+
+// buildFieldChains groups records sharing resource and path into ordered
+// chains. Chains are returned in the order their first change was recorded.
+func buildFieldChains(sources []kdiff.FieldSource) []FieldChain {
+	var chains []FieldChain
+	index := make(map[string]int)
+	for _, source := range sources {
+		key := source.Resource + "\x00" + strings.Join(source.Path, "\x00")
+		i, exists := index[key]
+		if !exists {
+			i = len(chains)
+			index[key] = i
+			chains = append(chains, FieldChain{
+				Resource: source.Resource,
+				Path:     source.Path,
+			})
 		}
-		*allPatches = append(*allPatches, patch)
+		chains[i].Changes = append(chains[i].Changes, source)
 	}
+	return chains
+}
+
+// printChains prints each field's provenance trail as
+// base → [patchA] → value → [patchB] → final, grouped by resource
+func printChains(chains []FieldChain) {
+	fmt.Printf("\n=== Field Chains ===\n")
 
-	// Add JSON patches from this kustomization
-	for _, patch := range kust.PatchesJson6902 {
-		if patch.Path != "" {
-			// Make path relative to this kustomization
-			patch.Path = filepath.Join(dir, string(patch.Path))
+	lastResource := ""
+	for _, chain := range chains {
+		if chain.Resource != lastResource {
+			fmt.Printf("\nResource: %s\n", chain.Resource)
+			lastResource = chain.Resource
 		}
-		*allPatches = append(*allPatches, types.Patch{
-			Target: patch.Target,
-			Patch:  string(patch.Patch),
-		})
-	}
 
-	// Process resources
-	for _, baseDir := range kust.Resources {
-		absBaseDir := filepath.Join(dir, baseDir)
-		processResourceOrKustomization(fs, k, absBaseDir, allPatches, allResources)
+		fmt.Printf("  • %s: %s\n", strings.Join(chain.Path, " → "), formatChain(chain))
 	}
+}
 
-	// Process components
-	for _, compDir := range kust.Components {
-		absCompDir := filepath.Join(dir, compDir)
-		processResourceOrKustomization(fs, k, absCompDir, allPatches, allResources)
+// formatChain formats the values of a chain and the sources between them
+func formatChain(chain FieldChain) string {
+	steps := []string{formatChainValue(chain.Original())}
+	for _, change := range chain.Changes {
+		steps = append(steps, "["+formatSource(change.Source)+"]", formatChainValue(change.New))
 	}
+	return strings.Join(steps, " → ")
+}
 
-	// Build resources from this kustomization last
-	resMap, err := k.Run(fs, dir)
-	if err != nil {
-		logFatal("Base build failed for %s: %v", dir, err)
+// churnedFields returns the chains of fields changed more than once that end
+// at their base value, e.g. a field one patch adds and a later patch removes.
+// These usually point at patches working against each other.
+func churnedFields(chains []FieldChain) []FieldChain {
+	var churned []FieldChain
+	for _, chain := range chains {
+		if len(chain.Changes) > 1 && reflect.DeepEqual(kdiff.NormalizeScalars(chain.Original()), kdiff.NormalizeScalars(chain.Final())) {
+			churned = append(churned, chain)
+		}
 	}
+	return churned
+}
 
-	// Add resources to our map
-	for _, res := range resMap.Resources() {
-		key := fmt.Sprintf("%s/%s", res.GetKind(), res.GetName())
-		allResources[key] = res
+// printChurnedFields prints the fields whose net effect is no change despite
+// the patches changing them, with their chains
+func printChurnedFields(chains []FieldChain) {
+	fmt.Printf("\n=== Churned But Unchanged ===\n")
+	lastResource := ""
+	for _, chain := range chains {
+		if chain.Resource != lastResource {
+			fmt.Printf("\nResource: %s\n", chain.Resource)
+			lastResource = chain.Resource
+		}
+		fmt.Printf("  • %s: %s\n", strings.Join(chain.Path, " → "), formatChain(chain))
 	}
 }
 
-func parsePath(path string) []string {
-	// Remove leading slash and split by slashes
-	if len(path) > 0 && path[0] == '/' {
-		path = path[1:]
+// formatChainValue formats a value in a chain, marking absent values
+func formatChainValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
 	}
-	return strings.Split(path, "/")
+	return fmt.Sprintf("%v", v)
 }
 
-func getValueAtPath(m interface{}, path []string) interface{} {
-	if len(path) == 0 {
-		return m
-	}
+// sourceBase is the directory displayed sources are relative to. When empty
+// only their file names are shown.
+var sourceBase string
 
-	key := path[0]
-	switch m := m.(type) {
-	case map[string]interface{}:
-		if val, exists := m[key]; exists {
-			return getValueAtPath(val, path[1:])
-		}
-	case []interface{}:
-		if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
-			return getValueAtPath(m[idx], path[1:])
+// formatSource returns a patch source for display, relative to sourceBase
+func formatSource(source string) string {
+	if source == "" {
+		return "inline patch"
+	}
+	if sourceBase != "" {
+		if abs, err := filepath.Abs(source); err == nil {
+			if rel, err := filepath.Rel(sourceBase, abs); err == nil {
+				return rel
+			}
 		}
 	}
-	return nil
+	return filepath.Base(source)
 }
 
-func setValueAtPath(m interface{}, path []string, value interface{}) {
-	if len(path) == 0 {
-		return
+// explainFieldValues returns the values a recorded change gave to the field at
+// path. Strategic merge records are kept at their top-level key, so when the
+// record covers a parent of path the field's values are extracted from it.
+func explainFieldValues(change kdiff.FieldSource, path []string) (interface{}, interface{}, bool) {
+	if len(change.Path) > len(path) {
+		return nil, nil, false
 	}
-
-	key := path[0]
-	if len(path) == 1 {
-		switch m := m.(type) {
-		case map[string]interface{}:
-			m[key] = value
-		case []interface{}:
-			if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
-				m[idx] = value
-			}
+	for i, key := range change.Path {
+		if path[i] != key {
+			return nil, nil, false
 		}
-		return
 	}
 
-	switch m := m.(type) {
-	case map[string]interface{}:
-		if _, exists := m[key]; !exists {
-			m[key] = make(map[string]interface{})
-		}
-		setValueAtPath(m[key], path[1:], value)
-	case []interface{}:
-		if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
-			setValueAtPath(m[idx], path[1:], value)
-		}
+	rest := path[len(change.Path):]
+	original := kdiff.GetValueAtPath(change.Original, rest)
+	newValue := kdiff.GetValueAtPath(change.New, rest)
+	if len(rest) > 0 && reflect.DeepEqual(kdiff.NormalizeScalars(original), kdiff.NormalizeScalars(newValue)) {
+		// The parent changed but this field did not
+		return nil, nil, false
 	}
+	return original, newValue, true
 }
 
-func applyAdd(m interface{}, path []string, value interface{}) {
-	if len(path) == 0 {
-		return
-	}
+// printExplain writes every recorded change that touched a single field, in
+// application order, as a chain from the base value to the final value.
+// Secret values are masked unless showSecrets.
+func printExplain(w io.Writer, name, field string, allResources map[string]*resource.Resource, sources []kdiff.FieldSource, showSecrets bool) {
+	path := strings.Split(field, ".")
 
-	key := path[0]
-	if len(path) == 1 {
-		switch m := m.(type) {
-		case map[string]interface{}:
-			m[key] = value
-		case []interface{}:
-			if idx, err := strconv.Atoi(key); err == nil {
-				if idx == -1 {
-					m = append(m, value)
-				} else if idx >= 0 && idx <= len(m) {
-					m = append(m[:idx], append([]interface{}{value}, m[idx:]...)...)
-				}
-			}
+	fmt.Fprintf(w, "\n=== Explain %s %s ===\n", name, field)
+
+	var current interface{}
+	key, err := resolveResourceKey(allResources, name)
+	if err == nil {
+		var baseMap map[string]interface{}
+		if err := yaml.Unmarshal([]byte(allResources[key].MustYaml()), &baseMap); err != nil {
+			logFatal("Failed to unmarshal base state: %v", err)
 		}
-		return
+		current = kdiff.GetValueAtPath(baseMap, path)
+		if !showSecrets {
+			current = kdiff.RedactSecrets([]kdiff.FieldSource{{Resource: key, Path: path, New: current}})[0].New
+		}
+	} else {
+		fmt.Fprintf(w, "Warning: %v\n", err)
 	}
+	fmt.Fprintf(w, "Base: %v\n", current)
 
-	switch m := m.(type) {
-	case map[string]interface{}:
-		if _, exists := m[key]; !exists {
-			m[key] = make(map[string]interface{})
+	step := 0
+	for _, change := range sources {
+		if change.Resource != key {
+			continue
 		}
-		applyAdd(m[key], path[1:], value)
-	case []interface{}:
-		if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
-			applyAdd(m[idx], path[1:], value)
+		original, newValue, ok := explainFieldValues(change, path)
+		if !ok {
+			continue
 		}
+		step++
+		fmt.Fprintf(w, "  %d. %v → %v (%s)\n", step, original, newValue, describeSource(change))
+		current = newValue
 	}
-}
 
-func applyReplace(m interface{}, path []string, value interface{}) {
-	if len(path) == 0 {
-		return
+	if step == 0 {
+		fmt.Fprintf(w, "No patch modified this field\n")
 	}
+	fmt.Fprintf(w, "Final: %v\n", current)
+}
 
-	key := path[0]
-	if len(path) == 1 {
-		switch m := m.(type) {
-		case map[string]interface{}:
-			m[key] = value
-		case []interface{}:
-			if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
-				m[idx] = value
-			}
+// resolveResourceKey returns the key of the resource a user named as
+// Kind/Name or Kind/Namespace/Name, resolving kind aliases. A name shared by
+// resources in several namespaces must include the namespace.
+func resolveResourceKey(allResources map[string]*resource.Resource, name string) (string, error) {
+	kind, rest, _ := strings.Cut(name, "/")
+	kind, _ = kdiff.CanonicalKind(kind)
+	name = kind + "/" + rest
+
+	// Resources are listed the way they can be named
+	display := func(key string) string {
+		if id, ok := kdiff.ParseResourceKey(key); ok && id.Namespace != "" {
+			return kdiff.FormatResourceKey("{kind}/{namespace}/{name}", id)
 		}
-		return
+		return reportKey(kdiff.DefaultResourceKeyFormat, key)
 	}
-
-	switch m := m.(type) {
-	case map[string]interface{}:
-		if _, exists := m[key]; !exists {
-			m[key] = make(map[string]interface{})
-		}
-		applyReplace(m[key], path[1:], value)
-	case []interface{}:
-		if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
-			applyReplace(m[idx], path[1:], value)
+	var matches, known []string
+	for key := range allResources {
+		if kdiff.MatchesResource(key, name) {
+			matches = append(matches, key)
 		}
+		known = append(known, display(key))
 	}
+	sort.Strings(matches)
+	sort.Strings(known)
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("resource %s not found in base resources (known: %s)", name, strings.Join(known, ", "))
+	case 1:
+		return matches[0], nil
+	}
+	for i, key := range matches {
+		matches[i] = display(key)
+	}
+	return "", fmt.Errorf("resource %s is ambiguous, name one of %s", name, strings.Join(matches, ", "))
 }
 
-func applyRemove(m interface{}, path []string) {
-	if len(path) == 0 {
-		return
+// dumpBase writes the base of the resource named key, as loaded before any
+// patch is applied, for -dump-base. Secret values are masked unless
+// showSecrets.
+func dumpBase(w io.Writer, key string, allResources map[string]*resource.Resource, showSecrets bool) error {
+	key, err := resolveResourceKey(allResources, key)
+	if err != nil {
+		return err
 	}
-
-	key := path[0]
-	if len(path) == 1 {
-		switch m := m.(type) {
-		case map[string]interface{}:
-			delete(m, key)
-		case []interface{}:
-			if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
-				m = append(m[:idx], m[idx+1:]...)
-			}
+	res := allResources[key]
+	if !showSecrets {
+		if res, err = kdiff.RedactSecretResource(res); err != nil {
+			return fmt.Errorf("masking secrets failed: %w", err)
 		}
-		return
 	}
+	_, err = io.WriteString(w, res.MustYaml())
+	return err
+}
 
-	switch m := m.(type) {
-	case map[string]interface{}:
-		if _, exists := m[key]; exists {
-			applyRemove(m[key], path[1:])
-		}
-	case []interface{}:
-		if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
-			applyRemove(m[idx], path[1:])
-		}
-	}
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
 }
 
-func mergeMap(dst, src map[string]interface{}) {
-	for key, srcVal := range src {
-		if dstVal, exists := dst[key]; exists {
-			switch srcVal := srcVal.(type) {
-			case map[string]interface{}:
-				if dstVal, ok := dstVal.(map[string]interface{}); ok {
-					mergeMap(dstVal, srcVal)
-					continue
-				}
-			case []interface{}:
-				if dstVal, ok := dstVal.([]interface{}); ok {
-					dst[key] = append(dstVal, srcVal...)
-					continue
-				}
-			}
-		}
-		dst[key] = srcVal
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseLoadRestrictor maps a -load-restrictor value to kustomize's load
+// restrictions, accepting both the short and kustomize's own spellings
+func parseLoadRestrictor(value string) (types.LoadRestrictions, error) {
+	switch value {
+	case "rootonly", "LoadRestrictionsRootOnly":
+		return types.LoadRestrictionsRootOnly, nil
+	case "none", "LoadRestrictionsNone":
+		return types.LoadRestrictionsNone, nil
 	}
+	return types.LoadRestrictionsUnknown, fmt.Errorf("unknown load restrictor %q (expected rootonly or none)", value)
 }
 
-func deepCopyValue(v interface{}) interface{} {
-	switch v := v.(type) {
-	case map[string]interface{}:
-		newMap := make(map[string]interface{})
-		for k, val := range v {
-			newMap[k] = deepCopyValue(val)
-		}
-		return newMap
-	case []interface{}:
-		newSlice := make([]interface{}, len(v))
-		for i, val := range v {
-			newSlice[i] = deepCopyValue(val)
+// parseMergeKeys parses -merge-key values of the form path=key
+func parseMergeKeys(values []string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, value := range values {
+		path, key, found := strings.Cut(value, "=")
+		if !found || path == "" || key == "" {
+			return nil, fmt.Errorf("invalid merge key %q (expected path=key, e.g. spec.ports=port)", value)
 		}
-		return newSlice
-	default:
-		return v
+		keys[path] = key
 	}
+	return keys, nil
 }
 
-func logFatal(format string, v ...interface{}) {
+// logOut receives progress output, and is the Options.Log of every run.
+// Structured reports send it to stderr so stdout only carries the report.
+var logOut io.Writer = os.Stdout
+
+func logf(format string, v ...interface{}) {
+	fmt.Fprintf(logOut, format, v...)
+}
+
+func logError(format string, v ...interface{}) {
 	fmt.Fprintf(os.Stderr, format+"\n", v...)
+}
+
+// beforeExit runs before logFatal exits, to write the profiles main started
+var beforeExit = func() {}
+
+func logFatal(format string, v ...interface{}) {
+	logError(format, v...)
+	beforeExit()
 	os.Exit(1)
 }
+
+// describeSource names the source of a change for display, with its type
+// unless it's a plain patch
+func describeSource(change kdiff.FieldSource) string {
+	switch {
+	case change.SourceType == kdiff.SourceTypeJSONPatch:
+		return fmt.Sprintf("JSON patch (%s)", formatSource(change.Source))
+	case strings.HasPrefix(change.SourceType, kdiff.SourceTypeTransformer):
+		kind := strings.TrimPrefix(change.SourceType, kdiff.SourceTypeTransformer)
+		if kdiff.IsBuiltinTransformerField(kind) {
+			return fmt.Sprintf("%s transformer (%s)", kind, formatSource(change.Source))
+		}
+		return fmt.Sprintf("transformers entry %s (%s)", kind, formatSource(change.Source))
+	case strings.HasPrefix(change.SourceType, kdiff.SourceTypeGenerator):
+		kind := strings.TrimPrefix(change.SourceType, kdiff.SourceTypeGenerator)
+		return fmt.Sprintf("generators entry %s (%s)", kind, formatSource(change.Source))
+	case change.SourceType == kdiff.SourceTypeLive:
+		return change.Source
+	case change.SourceType == kdiff.SourceTypeUnattributed:
+		return "no tracked patch or transformer"
+	case change.SourceType == kdiff.SourceTypeGeneratorMerge:
+		return fmt.Sprintf("generator merge (%s)", formatSource(change.Source))
+	case change.SourceType == kdiff.SourceTypeImplicit:
+		return fmt.Sprintf("implicit kustomize transformation (%s)", change.Source)
+	case change.SourceType == kdiff.SourceTypeBaseDrift:
+		return fmt.Sprintf("kustomize build of %s", formatSource(change.Source))
+	case change.SourceType == kdiff.SourceTypeCompareYAML:
+		return fmt.Sprintf("compared with %s", formatSource(change.Source))
+	case change.SourceType == kdiff.SourceTypeBaseRef:
+		return fmt.Sprintf("overlay, compared with base ref %s", formatSource(change.Source))
+	}
+	return formatSource(change.Source)
+}
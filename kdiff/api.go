@@ -0,0 +1,906 @@
+// Package kdiff attributes the field changes of a kustomize build to the
+// patches, components and transformers that made them. Every call runs with
+// its own state, so calls may run concurrently.
+package kdiff
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/r3labs/diff/v3"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/yaml"
+)
+
+// Options configures an attribution run
+type Options struct {
+	Namespace                  string                 // Only process resources in this namespace
+	IncludeClusterScoped       bool                   // Keep cluster-scoped resources when Namespace is set
+	StrictNamespace            bool                   // Require patch target namespaces to match exactly
+	IgnorePaths                []string               // Drop changes at or below these dotted path globs
+	IncludePaths               []string               // Only keep changes matching these dotted path globs
+	Kinds                      []string               // Only attribute changes to these kinds (entries may be comma-separated)
+	IgnoreKinds                []string               // Leave these kinds out, even if in Kinds (entries may be comma-separated)
+	Processors                 []FieldSourceProcessor // Rewrite changes before they are returned, in order
+	ShowSecrets                bool                   // Keep Secret data and stringData values instead of masking them
+	CompareAll                 bool                   // Matrix, DiffBaseRef and CompareYAML: also compare resources whose YAML is identical in every variant
+	IncludeStatus              bool                   // Matrix: compare status subtrees too
+	MinKustomizationVersion    string                 // Warn on kustomization apiVersions older than this (default v1beta1)
+	NoFollowSymlinks           bool                   // Treat symlinked resource paths as distinct from their targets
+	LoadRestrictions           types.LoadRestrictions // Files kustomizations may load (default root-only)
+	EnableHelm                 bool                   // Inflate helmCharts: with the helm binary
+	HelmCommand                string                 // Helm binary to run (default "helm")
+	EnableExec                 bool                   // Run exec KRM functions; only for trusted overlays
+	BuildFinal                 bool                   // Build the final kustomization into Result.Final
+	MaxDepth                   int                    // Nesting limit for patch values and paths (default 100)
+	MaxTreeDepth               int                    // Don't descend into kustomizations nested deeper than this, 0 for no limit
+	Verbose                    bool                   // Log the kustomization configuration and collected patches
+	StrictMergeKeys            bool                   // Fail on keyed list elements without their merge key instead of appending them
+	MergeKeys                  map[string]string      // Merge keys of lists by dotted path without indexes, e.g. spec.ports: port
+	ReplaceLists               []string               // CRD lists patches replace instead of appending to, by dotted path without indexes
+	VerifyOrigins              bool                   // Compare resource origins with kustomize's origin annotations into Result.OriginMismatches
+	Reorder                    krusty.ReorderOption   // Resource output order of builds (default none, i.e. declaration order)
+	EnableAlphaPlugins         bool                   // Load transformer and generator plugins; only for trusted overlays
+	IgnoreGenerated            bool                   // Leave ConfigMap and Secret generator output out of attribution and the result
+	StrictJSONPatch            bool                   // Fail JSON patch operations where RFC 6902 says they fail instead of skipping them
+	FetchRemote                RemoteFetcher          // Fetch remote bases with this to attribute their patches too; nil leaves them opaque
+	DryApply                   bool                   // Log each patched resource's YAML after its patch
+	IncludeTransformerDefaults bool                   // With BuildFinal, also report changes kustomize made implicitly
+	CheckBaseDrift             bool                   // Compare the built bases with the resources declared in their files into Result.BaseDrift
+	Resource                   string                 // Only apply patches to and report this resource, by Kind/Name or Kind/Namespace/Name
+	Differ                     Differ                 // Diff backend for changelogs (default r3labs/diff)
+	Context                    context.Context        // Aborts the run when done, e.g. at a -timeout deadline (default never)
+	Log                        io.Writer              // Receives progress, warnings and with Verbose debug output (default discarded)
+}
+
+// Result holds the outcome of an attribution run
+type Result struct {
+	FieldSources     []FieldSource                 // Attributed changes, deduplicated and filtered
+	Generated        []GeneratedResource           // Resources produced by generators
+	Resources        map[string]*resource.Resource // Base resources patches were matched against
+	Patches          []types.Patch                 // Collected patches, in application order
+	Changelogs       []diff.Changelog              // Changes per patch, indexed like Patches (nil if skipped)
+	Warnings         []Warning                     // Problems that left patches or transformers unattributed
+	Unmatched        []int                         // Indices into Patches of patches whose target matched no resource
+	NoOp             []int                         // Indices into Patches of patches that applied but changed nothing
+	Final            resmap.ResMap                 // Final build, if Options.BuildFinal is set
+	Unattributed     []FieldSource                 // Final changes no recorded change explains, if Options.BuildFinal is set
+	Implicit         []FieldSource                 // Final changes to declared resources kustomize made implicitly, with Options.IncludeTransformerDefaults
+	BaseDrift        []FieldSource                 // Differences of the built bases from their declared resources, with Options.CheckBaseDrift
+	Ordering         []OrderChange                 // Resources sortOptions moved from declaration order, if Options.BuildFinal is set
+	OriginMismatches []OriginMismatch              // Resources kustomize's origin annotations disagree on, if Options.VerifyOrigins is set
+	Origins          map[string]string             // File each resource was loaded from, by ResourceKey
+}
+
+// krustyOptions returns the kustomize build options for opts. Every build of
+// a run must use them, so resources are in the same state in each build.
+func krustyOptions(opts Options) *krusty.Options {
+	krustyOpts := krusty.MakeDefaultOptions()
+	if opts.LoadRestrictions != types.LoadRestrictionsUnknown {
+		krustyOpts.LoadRestrictions = opts.LoadRestrictions
+	}
+	if opts.Reorder != "" {
+		krustyOpts.Reorder = opts.Reorder
+	}
+	if opts.EnableAlphaPlugins {
+		krustyOpts.PluginConfig.PluginRestrictions = types.PluginRestrictionsNone
+	}
+	if opts.EnableHelm {
+		enableHelm(krustyOpts, opts.HelmCommand)
+	}
+	if opts.EnableExec {
+		enableExecFunctions(krustyOpts)
+	}
+	return krustyOpts
+}
+
+// ValidateBuildOptions rejects build options that are invalid or can't be
+// used together
+func ValidateBuildOptions(opts Options) error {
+	switch opts.Reorder {
+	case "", krusty.ReorderOptionLegacy, krusty.ReorderOptionNone:
+	default:
+		return fmt.Errorf("unknown reorder option %q (expected legacy or none)", opts.Reorder)
+	}
+	if !opts.EnableHelm && opts.HelmCommand != "" && opts.HelmCommand != DefaultHelmCommand {
+		return fmt.Errorf("a helm command is only used with helm chart inflation enabled")
+	}
+	return nil
+}
+
+// run is the state of one call of Diff or another entry point: its options,
+// with defaults filled in, and what patch collection and processing
+// accumulate. Every call makes its own, so calls don't share state.
+type run struct {
+	opts         Options
+	replaceLists map[string]bool // opts.ReplaceLists
+
+	fieldSources       []FieldSource
+	generatedResources []GeneratedResource
+	warnings           []Warning
+
+	// loadedPaths holds the resource and kustomization paths already
+	// processed, so a path reached twice (e.g. through a symlink) is only
+	// processed once
+	loadedPaths map[string]bool
+
+	// kustomizationStack holds the canonical paths of the kustomizations
+	// being processed, from the root down, to detect reference cycles
+	kustomizationStack []string
+
+	// unpatchedKustomizations maps the kustomization files processed for
+	// attribution to their content without patches and components. Override
+	// builds read these in place of the nested files, so kustomize doesn't
+	// apply patches that are attributed separately.
+	unpatchedKustomizations map[string][]byte
+
+	// patchScopes are the scopes of the nested kustomizations with patches.
+	// The patches of the root, and of kustomizations without a scope, see the
+	// resources as the run holds them.
+	patchScopes []patchScope
+
+	// resourceOrigins maps each resource loaded from a file, by ResourceKey,
+	// to that file
+	resourceOrigins map[string]string
+
+	// declaredResources holds each resource as declared in a file, by
+	// ResourceKey, before any kustomize build transforms it
+	declaredResources map[string]*resource.Resource
+}
+
+// newRun returns the state of a run with opts
+func newRun(opts Options) *run {
+	if opts.MinKustomizationVersion == "" {
+		opts.MinKustomizationVersion = DefaultMinKustomizationVersion
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultMaxDepth
+	}
+	if opts.Differ == nil {
+		opts.Differ = r3labsDiffer{}
+	}
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	if opts.Log == nil {
+		opts.Log = io.Discard
+	}
+	r := &run{opts: opts, replaceLists: make(map[string]bool)}
+	for _, path := range opts.ReplaceLists {
+		r.replaceLists[path] = true
+	}
+	return r
+}
+
+// Diff builds the kustomization in dir and attributes each field change to the
+// patch or transformer that made it. Progress is logged to opts.Log. When
+// opts.Context is done, the run stops at its next file access and Diff
+// returns the context's cause.
+func Diff(fs filesys.FileSystem, dir string, opts Options) (*Result, error) {
+	r := newRun(opts)
+	result, err := r.diffTree(r.contextFs(fs), dir)
+	// Errors of a cancelled run are mostly kustomize's failing file reads
+	if abortErr := aborted(r.opts.Context); abortErr != nil {
+		return nil, abortErr
+	}
+	return result, err
+}
+
+// diffTree is Diff on a filesystem that stops when the run is aborted
+func (r *run) diffTree(fs filesys.FileSystem, dir string) (*Result, error) {
+
+	// Check the kustomization file first so a wrong path gets a clearer
+	// message than kustomize's own
+	kustPath, kustData, err := readKustomizationFile(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var kust types.Kustomization
+	if err := yaml.Unmarshal(kustData, &kust); err != nil {
+		return nil, fmt.Errorf("failed parsing kustomization.yaml: %w", err)
+	}
+
+	if err := r.checkReferenceCycles(fs, dir, make(map[string]bool)); err != nil {
+		return nil, err
+	}
+	if !r.opts.EnableHelm {
+		if helmPath := r.helmChartsKustomization(fs, dir, make(map[string]bool)); helmPath != "" {
+			return nil, fmt.Errorf("%s inflates helm charts; rerun with -enable-helm", helmPath)
+		}
+	}
+
+	// One kustomizer runs every build below, the final one and the nested
+	// and partial builds used for attribution, so they all see resources in
+	// the same state
+	k := krusty.MakeKustomizer(krustyOptions(r.opts))
+
+	// 1. Build the final kustomization, only when an output needs it. Base
+	// resources for attribution come from the recursive builds below.
+	var finalResMap resmap.ResMap
+	if r.opts.BuildFinal {
+		finalResMap, err = k.Run(fs, dir)
+		if err != nil {
+			return nil, fmt.Errorf("kustomize build failed: %w", err)
+		}
+	}
+
+	// 2. Validate kustomization.yaml
+	if err := validatePatches(&kust, dir); err != nil {
+		return nil, fmt.Errorf("invalid kustomization.yaml: %w", err)
+	}
+
+	// Show the kustomization content with -verbose
+	r.debugf("\n=== Kustomization Configuration ===\n")
+	if kust.APIVersion != "" || kust.Kind != "" {
+		r.debugf("API Version: %s\n", kust.APIVersion)
+		r.debugf("Kind: %s\n", kust.Kind)
+	}
+	r.checkKustomizationVersion(kustPath, &kust)
+	r.debugf("Base Resources:\n")
+	for _, res := range kust.Resources {
+		r.debugf("  - %s\n", res)
+	}
+	if len(kust.Components) > 0 {
+		r.debugf("Components:\n")
+		for _, comp := range kust.Components {
+			r.debugf("  - %s\n", comp)
+		}
+	}
+	r.printPlugins(fs, dir, &kust)
+
+	// 3. Recursively collect all patches and resources
+	leave, err := r.enterKustomization(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+	allPatches := make([]types.Patch, 0)
+	allResources := make(map[string]*resource.Resource)
+	mark := r.markKustomization(allResources)
+
+	// Process each base resource directory
+	for i, baseDir := range kust.Resources {
+		absBaseDir, err := r.resolveResource(dir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		if kust.Resources[i], err = r.localizeEntry(dir, baseDir, absBaseDir); err != nil {
+			return nil, err
+		}
+		if err := r.processResourceOrKustomization(fs, k, absBaseDir, r.opts.LoadRestrictions, &allPatches, allResources); err != nil {
+			return nil, err
+		}
+	}
+
+	// Process each component directory
+	for i, compDir := range kust.Components {
+		absCompDir, err := r.resolveResource(dir, compDir)
+		if err != nil {
+			return nil, err
+		}
+		if kust.Components[i], err = r.localizeEntry(dir, compDir, absCompDir); err != nil {
+			return nil, err
+		}
+		if err := r.processResourceOrKustomization(fs, k, absCompDir, r.opts.LoadRestrictions, &allPatches, allResources); err != nil {
+			return nil, err
+		}
+	}
+	loaded := mark.loaded(allResources)
+
+	// Build the root kustomization once, without its own patches (they're
+	// attributed below), and let its resources replace the locally loaded
+	// ones as processKustomization does for nested directories. This brings
+	// in helm charts, generators, remote bases and what components generate
+	// and transform; components are read without their patches. Root patches
+	// match resources before the root transformers, so the resources are kept
+	// as they are before them, by the keys they end up with.
+	unpatched := withoutPatches(kust)
+	rootResMap, err := r.buildDeclarationOrder(fs, k, dir, kustPath, &unpatched)
+	var untransformed resmap.ResMap
+	if err == nil {
+		untransformed, err = r.buildUntransformed(fs, k, dir, kustPath, &unpatched, rootResMap)
+	}
+	if err == nil {
+		base, built := unpatched, rootResMap
+		if untransformed != nil {
+			base, _ = withoutTransformers(unpatched, 0)
+			built = untransformed
+		}
+		var generatorChanges, compChanges []FieldSource
+		if generatorChanges, err = r.attributeGenerators(fs, k, dir, kustPath, &base); err != nil {
+			return nil, fmt.Errorf("generator attribution failed: %w", err)
+		}
+		r.fieldSources = append(r.fieldSources, generatorChanges...)
+		var compGenerated []GeneratedResource
+		if compChanges, compGenerated, err = r.attributeComponents(fs, k, dir, kustPath, &base, built); err != nil {
+			return nil, fmt.Errorf("component attribution failed: %w", err)
+		}
+		r.fieldSources = append(r.fieldSources, compChanges...)
+		r.generatedResources = append(r.generatedResources, compGenerated...)
+	}
+	// Without the final build this is the only build of the root, so its
+	// errors are kustomize's errors for the overlay
+	if err != nil && finalResMap == nil {
+		return nil, fmt.Errorf("kustomize build failed: %w", err)
+	}
+	if err != nil {
+		r.warn(kustPath, WarningRootBuildFailed, "Building %s without its patches failed, only local resources can be patched: %v", dir, err)
+		rootResMap = nil
+	} else {
+		merges := attributeGeneratorMerges(&kust, kustPath, r.generatedResources, allResources, rootResMap)
+		resources := rootResMap.Resources()
+		if untransformed != nil {
+			r.rekey(mark, renamedKeys(untransformed, rootResMap))
+			resources = untransformed.Resources()
+		}
+		r.fieldSources = append(r.fieldSources, merges...)
+		replaceLoaded(allResources, loaded, rootResMap, resources)
+	}
+
+	// Compare the bases as kustomize builds them with the resources as
+	// declared in their files
+	var drift []FieldSource
+	if r.opts.CheckBaseDrift {
+		if drift, err = r.checkBaseDrift(fs, k, dir, kustPath, &unpatched, r.declaredResources); err != nil {
+			return nil, fmt.Errorf("base drift check failed: %w", err)
+		}
+	}
+
+	// Compare the final order with declaration order when sortOptions may
+	// have changed it
+	var ordering []OrderChange
+	if finalResMap != nil && kust.SortOptions != nil && kust.SortOptions.Order != types.FIFOSortOrder {
+		fifo := kust
+		fifo.SortOptions = &types.SortOptions{Order: types.FIFOSortOrder}
+		declared, err := r.buildOverride(fs, k, dir, kustPath, &fifo)
+		if err != nil {
+			return nil, fmt.Errorf("build in declaration order failed: %w", err)
+		}
+		ordering = orderChanges(declared, finalResMap)
+	}
+
+	// Root generators only show up in a build of the root kustomization
+	if rootResMap != nil {
+		r.generatedResources = append(r.generatedResources, collectGenerated(&kust, kustPath, rootResMap)...)
+	}
+
+	// Check our resource origins against kustomize's own
+	var originMismatches []OriginMismatch
+	if r.opts.VerifyOrigins {
+		if originMismatches, err = r.verifyOrigins(fs, k, dir, kustPath, &kust, r.generatedResources); err != nil {
+			return nil, fmt.Errorf("origin verification failed: %w", err)
+		}
+	}
+
+	// Add patches from the root kustomization
+	if err := collectPatches(dir, &kust, r.opts.LoadRestrictions, &allPatches); err != nil {
+		return nil, err
+	}
+
+	r.debugf("\nPatches:\n")
+	for i, patch := range allPatches {
+		if patch.Path != "" {
+			r.debugf("  %d. File: %s\n", i+1, patch.Path)
+		} else {
+			r.debugf("  %d. Inline Patch\n", i+1)
+		}
+		r.debugf("     Target: %s\n", DescribeTarget(patch.Target))
+	}
+
+	// A -resource matching nothing would leave an empty report that looks
+	// like nothing changed it
+	if r.opts.Resource != "" {
+		keys := make([]string, 0, len(allResources))
+		for key := range allResources {
+			keys = append(keys, key)
+		}
+		if finalResMap != nil {
+			keys = append(keys, resourceKeys(finalResMap)...)
+		}
+		found := false
+		for _, key := range keys {
+			if MatchesResource(key, r.opts.Resource) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no resource matches %s (expected Kind/Name or Kind/Namespace/Name)", r.opts.Resource)
+		}
+	}
+
+	// Scope the run to a single namespace. Transformer and image
+	// records of the resources left out are dropped with the rest below.
+	var outsideNamespace map[string]bool
+	if r.opts.Namespace != "" {
+		inNamespace := filterByNamespace(allResources, r.opts.Namespace, r.opts.IncludeClusterScoped)
+		outsideNamespace = make(map[string]bool)
+		for key := range allResources {
+			if _, kept := inNamespace[key]; !kept {
+				outsideNamespace[key] = true
+			}
+		}
+		allResources = inNamespace
+	}
+
+	// Skip patch work for kinds outside the allowlist or ignored
+	var kinds, ignoredKinds map[string]bool
+	if len(r.opts.Kinds) > 0 {
+		kinds = kindSet(r.opts.Kinds)
+	}
+	if len(r.opts.IgnoreKinds) > 0 {
+		ignoredKinds = kindSet(r.opts.IgnoreKinds)
+	}
+	kindIncluded := func(kind string) bool {
+		return (kinds == nil || kinds[kind]) && !ignoredKinds[kind]
+	}
+	filterKinds := kinds != nil || ignoredKinds != nil
+	if filterKinds {
+		allResources = filterByKind(allResources, kindIncluded)
+	}
+
+	// Leave generator output out, as its hashed names change with content
+	var ignored map[string]bool
+	if r.opts.IgnoreGenerated {
+		ignored = make(map[string]bool)
+		for _, gen := range r.generatedResources {
+			ignored[gen.Resource] = true
+		}
+	}
+
+	r.logf("\n=== Processing Patches ===\n")
+	r.logf("Found %d base resources\n", len(allResources))
+
+	// 4. Process all collected patches. As in kustomize, each patch applies
+	// on top of the earlier patches to its resource, so patched holds the
+	// state so far, while allResources keeps the unpatched bases.
+	patched := make(map[string]*resource.Resource)
+	changelogs := make([]diff.Changelog, len(allPatches))
+	var unmatched, noOp []int
+	r.logf("Found %d patches to apply\n", len(allPatches))
+	for i, patch := range allPatches {
+		if err := aborted(r.opts.Context); err != nil {
+			return nil, err
+		}
+		r.debugf("\n--- Processing Patch %d/%d ---\n", i+1, len(allPatches))
+		if patch.Path != "" {
+			r.debugf("Patch File: %s\n", patch.Path)
+		} else {
+			r.debugf("Inline Patch\n")
+		}
+
+		// As in kustomize, a patch without a target patches the resource its
+		// own document names
+		var patchData []byte
+		if patch.Target == nil {
+			if patchData, err = readPatchData(fs, patch); err != nil {
+				r.warn(DescribePatch(patch), WarningReadFailed, "Reading patch %s failed: %v", patch.Path, err)
+				continue
+			}
+			if patch.Target = patchDocumentTarget(patchData); patch.Target == nil {
+				r.warn(DescribePatch(patch), WarningUnmatchedTarget, "Patch has no target, and its document doesn't name the resource it patches")
+				unmatched = append(unmatched, i)
+				continue
+			}
+		}
+		r.debugf("Target: %s/%s\n", patch.Target.Kind, patch.Target.Name)
+
+		if kind, alias := CanonicalKind(patch.Target.Kind); alias {
+			r.warn(DescribePatch(patch), WarningKindAlias, "Patch target kind %q is an alias, use %q instead", patch.Target.Kind, kind)
+		}
+
+		if filterKinds && patch.Target != nil && patch.Target.Kind != "" {
+			kind, _ := CanonicalKind(patch.Target.Kind)
+			if ignoredKinds[kind] {
+				r.debugf("Skipping patch for ignored kind %s\n", kind)
+				continue
+			}
+			if !kindIncluded(kind) {
+				r.debugf("Skipping patch for kind %s outside the kind allowlist\n", kind)
+				continue
+			}
+		}
+
+		// Find the target resource, as the patch sees it after the earlier
+		// patches
+		candidates, err := patchCandidates(allResources, patched, r.scopeOf(i))
+		if err != nil {
+			return nil, err
+		}
+		targetKeys := findPatchTarget(candidates, patch.Target, r.opts.StrictNamespace)
+		if len(targetKeys) == 0 {
+			if target, generated := generatedTarget(r.generatedResources, candidates, patch.Target); generated {
+				targetKeys = findPatchTarget(candidates, target, r.opts.StrictNamespace)
+			}
+		}
+		if len(targetKeys) == 0 {
+			r.warn(DescribePatch(patch), WarningUnmatchedTarget, "No matching resource found for patch target")
+			unmatched = append(unmatched, i)
+			continue
+		}
+
+		if patchData == nil {
+			if patchData, err = readPatchData(fs, patch); err != nil {
+				r.warn(DescribePatch(patch), WarningReadFailed, "Reading patch %s failed: %v", patch.Path, err)
+				continue
+			}
+		}
+
+		// Parse the patch data. The decoded value is deep-copied for each
+		// target, so nodes shared through YAML anchors/aliases can't be
+		// mutated together.
+		var parsedPatch interface{}
+		if err := yaml.Unmarshal(patchData, &parsedPatch); err != nil {
+			r.warn(DescribePatch(patch), WarningParseFailed, "Failed to parse patch content: %v", err)
+			continue
+		}
+		switch parsedPatch.(type) {
+		case []interface{}, map[string]interface{}:
+		case nil:
+			r.warn(DescribePatch(patch), WarningParseFailed, "Patch is empty")
+			continue
+		default:
+			// A scalar body, e.g. a pasted base64 blob or an unrendered
+			// template, is neither kind of patch
+			r.warn(DescribePatch(patch), WarningParseFailed, "Patch content is a %T, not a strategic merge patch or a JSON patch list; is it base64 encoded or an unrendered template?", parsedPatch)
+			continue
+		}
+
+		// As in kustomize, the patch applies to every resource it selects
+		applied := false
+		for _, targetKey := range targetKeys {
+			targetRes := allResources[targetKey]
+			if ignored[targetKey] {
+				r.debugf("Skipping patch for generated resource %s\n", targetKey)
+				continue
+			} else if r.opts.Resource != "" && !MatchesResource(targetKey, r.opts.Resource) {
+				r.debugf("Skipping patch for %s, only processing %s\n", targetKey, r.opts.Resource)
+				continue
+			}
+			currentRes := targetRes
+			if state, exists := patched[targetKey]; exists {
+				currentRes = state
+			}
+
+			// Get state before patch
+			var beforeMap map[string]interface{}
+			if err := yaml.Unmarshal([]byte(currentRes.MustYaml()), &beforeMap); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal before state: %w", err)
+			}
+
+			// Create a copy of the resource as patched so far for patching
+			patchedRes := currentRes.DeepCopy()
+
+			// Apply patch
+			patchContent, err := r.deepCopyValue(parsedPatch)
+			if err != nil {
+				return nil, fmt.Errorf("patch %s: %w", DescribePatch(patch), err)
+			}
+
+			// Convert the resource to a map for patching
+			var resourceMap map[string]interface{}
+			if err := yaml.Unmarshal([]byte(patchedRes.MustYaml()), &resourceMap); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal resource: %w", err)
+			}
+
+			// Apply the patch based on its type
+			switch patchContent := patchContent.(type) {
+			case []interface{}:
+				// JSON patch format
+				for j, op := range patchContent {
+					opMap, ok := op.(map[string]interface{})
+					if !ok {
+						return nil, fmt.Errorf("invalid patch operation format")
+					}
+					opType, ok := opMap["op"].(string)
+					if !ok {
+						return nil, fmt.Errorf("missing or invalid operation type")
+					}
+					path, ok := opMap["path"].(string)
+					if !ok {
+						return nil, fmt.Errorf("missing or invalid path")
+					}
+					value := opMap["value"]
+
+					// Convert path to array of keys
+					pathKeys := parsePath(path)
+					if len(pathKeys) > r.opts.MaxDepth {
+						return nil, fmt.Errorf("patch %s: path %s is %w", DescribePatch(patch), path, r.errTooDeep())
+					}
+					if r.opts.StrictJSONPatch {
+						if err := checkJSONPatchOp(resourceMap, opMap, opType, pathKeys); err != nil {
+							return nil, fmt.Errorf("patch %s: op %d (%s %s): %w", DescribePatch(patch), j+1, opType, path, err)
+						}
+					}
+
+					// Get original value before change
+					originalValue := GetValueAtPath(resourceMap, pathKeys)
+					element := elementIdentity(resourceMap, pathKeys, opType, value)
+					if opType == "add" && len(pathKeys) > 0 {
+						// Adding to a list inserts, so nothing was there before
+						if _, isList := GetValueAtPath(resourceMap, pathKeys[:len(pathKeys)-1]).([]interface{}); isList {
+							originalValue = nil
+						}
+					}
+
+					// Values differing only in representation aren't changes
+					unchanged := reflect.DeepEqual(NormalizeScalars(originalValue), NormalizeScalars(value))
+					originalValue = NormalizeNumbers(originalValue)
+
+					// Apply the operation
+					switch opType {
+					case "add":
+						applyAdd(resourceMap, pathKeys, value)
+						if unchanged {
+							continue
+						}
+						// Record the change
+						r.fieldSources = append(r.fieldSources, FieldSource{
+							Resource:   targetKey,
+							Path:       pathKeys,
+							Source:     patch.Path,
+							Element:    element,
+							SourceType: SourceTypeJSONPatch,
+							Original:   originalValue,
+							New:        NormalizeNumbers(value),
+						})
+					case "replace":
+						// RFC 6902 requires the replaced value to exist
+						if !hasPath(resourceMap, pathKeys) {
+							r.warn(DescribePatch(patch), WarningMissingPath, "Replace of %s skipped, the path does not exist", path)
+							continue
+						}
+						applyReplace(resourceMap, pathKeys, value)
+						if unchanged {
+							continue
+						}
+						// Record the change
+						r.fieldSources = append(r.fieldSources, FieldSource{
+							Resource:   targetKey,
+							Path:       pathKeys,
+							Source:     patch.Path,
+							Element:    element,
+							SourceType: SourceTypeJSONPatch,
+							Original:   originalValue,
+							New:        NormalizeNumbers(value),
+						})
+					case "remove":
+						applyRemove(resourceMap, pathKeys)
+						// Record the removal
+						r.fieldSources = append(r.fieldSources, FieldSource{
+							Resource:   targetKey,
+							Path:       pathKeys,
+							Source:     patch.Path,
+							Element:    element,
+							SourceType: SourceTypeJSONPatch,
+							Original:   originalValue,
+							New:        nil,
+						})
+					}
+				}
+			case map[string]interface{}:
+				// Strategic merge patch format
+				// Get original state before merge
+				originalState := make(map[string]interface{})
+				for k, v := range resourceMap {
+					if originalState[k], err = r.deepCopyValue(v); err != nil {
+						return nil, fmt.Errorf("resource %s: %w", targetKey, err)
+					}
+				}
+
+				// As in kustomize, the patch's name and kind only identify the
+				// target unless the patch allows changing them
+				if metadata, ok := patchContent["metadata"].(map[string]interface{}); ok && !patch.Options["allowNameChange"] {
+					if _, named := metadata["name"]; named {
+						metadata["name"] = targetRes.GetName()
+					}
+				}
+				if _, kinded := patchContent["kind"]; kinded && !patch.Options["allowKindChange"] {
+					patchContent["kind"] = targetRes.GetKind()
+				}
+
+				// Apply the merge
+				if err := r.mergeMap(resourceMap, patchContent); err != nil {
+					return nil, fmt.Errorf("patch %s: %w", DescribePatch(patch), err)
+				}
+
+				// Compare and record changes, ignoring differences in scalar
+				// representation
+				r.recordMergeChanges(originalState, resourceMap, nil, "", func(path []string, element string, oldVal, newVal interface{}) {
+					r.fieldSources = append(r.fieldSources, FieldSource{
+						Resource:   targetKey,
+						Path:       path,
+						Source:     patch.Path,
+						Element:    element,
+						SourceType: SourceTypePatch,
+						Original:   NormalizeNumbers(oldVal),
+						New:        NormalizeNumbers(newVal),
+					})
+				})
+			}
+
+			// Convert back to YAML
+			patchedYaml, err := yaml.Marshal(resourceMap)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal patched resource: %w", err)
+			}
+
+			// Create new resource from patched YAML
+			patchedRes, err = resource.NewFactory(nil).FromBytes(patchedYaml)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create patched resource: %w", err)
+			}
+			if r.opts.DryApply {
+				shown := patchedRes
+				if !r.opts.ShowSecrets {
+					if shown, err = RedactSecretResource(patchedRes); err != nil {
+						return nil, fmt.Errorf("masking secrets failed: %w", err)
+					}
+				}
+				r.logf("--- %s/%s after %s ---\n%s", patchedRes.GetKind(), patchedRes.GetName(), DescribePatch(patch), shown.MustYaml())
+			}
+
+			// Later patches and the final build know a renamed resource by its
+			// new identity
+			patchedKey := targetKey
+			if ResourceKey(patchedRes) != ResourceKey(currentRes) {
+				if patchedKey, err = r.renameResource(allResources, targetKey, patchedRes); err != nil {
+					return nil, fmt.Errorf("patch %s: %w", DescribePatch(patch), err)
+				}
+				r.debugf("Patch renames %s to %s\n", targetKey, patchedKey)
+				delete(patched, targetKey)
+			}
+			patched[patchedKey] = patchedRes
+
+			// Get state after patch
+			var afterMap map[string]interface{}
+			if err := yaml.Unmarshal([]byte(patchedRes.MustYaml()), &afterMap); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal after state: %w", err)
+			}
+
+			// Track changes
+			normalizeObject(beforeMap, true)
+			normalizeObject(afterMap, true)
+			changelog, err := r.diffObjects(beforeMap, afterMap)
+			if err != nil {
+				return nil, fmt.Errorf("failed to diff states: %w", err)
+			}
+
+			r.debugf("Changes detected: %d\n", len(changelog))
+			if !r.opts.ShowSecrets {
+				changelog = redactChangelog(patchedKey, changelog)
+			}
+			changelogs[i] = append(changelogs[i], changelog...)
+			applied = true
+		}
+		if applied && len(changelogs[i]) == 0 {
+			noOp = append(noOp, i)
+		}
+	}
+
+	// Root transformers only show up in builds of the root kustomization.
+	// Their changes are recorded under the keys of the final build, after
+	// the patches, as kustomize runs them after the root patches.
+	if _, transformed := withoutTransformers(kust, 0); transformed {
+		declared, err := r.buildDeclarationOrder(fs, k, dir, kustPath, &kust)
+		if err != nil {
+			return nil, fmt.Errorf("build in declaration order failed: %w", err)
+		}
+		keys := resourceKeys(declared)
+		builtinChanges, err := r.attributeBuiltins(fs, k, dir, &kust, keys)
+		if err != nil {
+			return nil, fmt.Errorf("transformer attribution failed: %w", err)
+		}
+		r.fieldSources = append(r.fieldSources, builtinChanges...)
+
+		transformerChanges, err := r.attributeTransformers(fs, k, dir, &kust, keys)
+		if err != nil {
+			return nil, fmt.Errorf("transformer attribution failed: %w", err)
+		}
+		r.fieldSources = append(r.fieldSources, transformerChanges...)
+	}
+
+	// Drop records repeated by overlapping comparisons or duplicate patches
+	sources := dedupeFieldSources(r.fieldSources)
+
+	generated := r.generatedResources
+	if ignored != nil {
+		for key := range ignored {
+			delete(allResources, key)
+		}
+		generated = nil
+	}
+
+	// Cross-check the final build against every recorded change, before
+	// filtering leaves some out
+	var unattributed []FieldSource
+	if finalResMap != nil {
+		if unattributed, err = r.unattributedChanges(allResources, finalResMap, sources); err != nil {
+			return nil, fmt.Errorf("attribution check failed: %w", err)
+		}
+	}
+
+	// What's left of the differences between the declared resources and
+	// the final build was done by kustomize without being configured as a
+	// patch or transformer, e.g. commonLabels in selectors
+	var implicit []FieldSource
+	if finalResMap != nil && r.opts.IncludeTransformerDefaults {
+		if implicit, err = r.implicitChanges(r.declaredResources, finalResMap, append(append([]FieldSource{}, sources...), unattributed...)); err != nil {
+			return nil, fmt.Errorf("implicit change attribution failed: %w", err)
+		}
+	}
+
+	// Filter and mask them all the same way
+	reported := func(sources []FieldSource) []FieldSource {
+		sources = FilterFieldSources(sources, r.opts.IncludePaths, r.opts.IgnorePaths)
+		if ignored != nil {
+			var kept []FieldSource
+			for _, source := range sources {
+				if !ignored[source.Resource] {
+					kept = append(kept, source)
+				}
+			}
+			sources = kept
+		}
+		if outsideNamespace != nil {
+			var kept []FieldSource
+			for _, source := range sources {
+				if !outsideNamespace[source.Resource] {
+					kept = append(kept, source)
+				}
+			}
+			sources = kept
+		}
+		if r.opts.Resource != "" {
+			var kept []FieldSource
+			for _, source := range sources {
+				if MatchesResource(source.Resource, r.opts.Resource) {
+					kept = append(kept, source)
+				}
+			}
+			sources = kept
+		}
+		if filterKinds {
+			var kept []FieldSource
+			for _, source := range sources {
+				if kindIncluded(keyKind(source.Resource)) {
+					kept = append(kept, source)
+				}
+			}
+			sources = kept
+		}
+		if !r.opts.ShowSecrets {
+			sources = RedactSecrets(sources)
+		}
+		return sources
+	}
+	sources = applyProcessors(r.opts.Processors, reported(sources))
+	unattributed = reported(unattributed)
+	implicit = reported(implicit)
+	drift = reported(drift)
+
+	return &Result{
+		FieldSources:     sources,
+		Generated:        generated,
+		Resources:        allResources,
+		Patches:          allPatches,
+		Changelogs:       changelogs,
+		Warnings:         r.warnings,
+		Unmatched:        unmatched,
+		NoOp:             noOp,
+		Final:            finalResMap,
+		Unattributed:     unattributed,
+		Implicit:         implicit,
+		BaseDrift:        drift,
+		Ordering:         ordering,
+		OriginMismatches: originMismatches,
+		Origins:          r.resourceOrigins,
+	}, nil
+}
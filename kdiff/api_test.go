@@ -0,0 +1,2543 @@
+package kdiff
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+)
+
+func TestDiff(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/overlay/kustomization.yaml": `
+resources:
+  - ../base
+patches:
+  - path: patch.yaml
+    target:
+      kind: Deployment
+      name: test
+`,
+		"/app/overlay/patch.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 3
+`,
+		"/app/base/kustomization.yaml": `
+resources:
+  - deployment.yaml
+`,
+		"/app/base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app/overlay", Options{BuildFinal: true})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(result.Patches), "Should collect the overlay patch")
+	assert.Equal(t, "/app/overlay/patch.yaml", result.Patches[0].Path)
+	assert.Equal(t, 1, len(result.Changelogs), "Should keep one changelog per patch")
+	assert.NotEmpty(t, result.Changelogs[0], "Changelog should record the patch's changes")
+	assert.NotNil(t, result.Final, "Should build the final output when asked")
+	_, exists := result.Resources["Deployment.v1.apps/test.[noNs]"]
+	assert.True(t, exists, "Should collect the base Deployment")
+
+	assert.Equal(t, 1, len(result.FieldSources), "Should attribute the changed field")
+	change := result.FieldSources[0]
+	assert.Equal(t, "Deployment.v1.apps/test.[noNs]", change.Resource)
+	assert.Equal(t, []string{"spec", "replicas"}, change.Path)
+	assert.Equal(t, "/app/overlay/patch.yaml", change.Source)
+	assert.Equal(t, int64(3), change.New)
+
+	// Ignored paths are dropped from the result
+	result, err = Diff(fs, "/app/overlay", Options{IgnorePaths: []string{"spec"}})
+	assert.NoError(t, err)
+	assert.Empty(t, result.FieldSources)
+	assert.Nil(t, result.Final, "Should skip the final build unless asked")
+}
+
+func TestDiffMissingKustomization(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	_, err := Diff(fs, "/missing", Options{})
+	assert.Error(t, err, "Should return an error instead of exiting")
+}
+
+func TestDiffDuplicateResource(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/overlay/kustomization.yaml": `
+resources:
+  - ../base
+  - configmap.yaml
+`,
+		"/app/overlay/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  LOG_LEVEL: info
+`,
+		"/app/base/kustomization.yaml": `
+resources:
+  - configmap.yaml
+`,
+		"/app/base/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  LOG_LEVEL: debug
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	_, err := Diff(fs, "/app/overlay", Options{})
+	assert.ErrorContains(t, err, "already declared in /app/base/configmap.yaml", "Should reject a redefined resource, as kustomize does")
+
+	// The same name in another namespace is a different resource
+	assert.NoError(t, fs.WriteFile("/app/overlay/configmap.yaml", []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: staging
+data:
+  LOG_LEVEL: info
+`)))
+	result, err := Diff(fs, "/app/overlay", Options{})
+	assert.NoError(t, err)
+	assert.Contains(t, result.Resources, "ConfigMap.v1.[noGrp]/settings.[noNs]")
+	assert.Contains(t, result.Resources, "ConfigMap.v1.[noGrp]/settings.staging")
+}
+
+func TestDiffKustomizationFile(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/yml/kustomization.yml": `
+resources:
+  - deployment.yaml
+`,
+		"/app/yml/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+`,
+		"/app/empty/kustomization.yaml": "\n",
+		"/app/plain/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app/yml", Options{})
+	assert.NoError(t, err, "Should accept kustomization.yml")
+	_, exists := result.Resources["Deployment.v1.apps/test.[noNs]"]
+	assert.True(t, exists, "Should load resources listed in kustomization.yml")
+
+	_, err = Diff(fs, "/app/empty", Options{})
+	assert.ErrorContains(t, err, "is empty")
+
+	_, err = Diff(fs, "/app/plain", Options{})
+	assert.ErrorContains(t, err, "plain resource directory")
+	assert.ErrorContains(t, err, "deployment.yaml")
+
+	_, err = Diff(fs, "/app/missing", Options{})
+	assert.ErrorContains(t, err, "does not exist")
+}
+
+func TestDiffLoadRestrictions(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/overlay/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: ../patches/replicas.yaml
+    target:
+      kind: Deployment
+      name: test
+`,
+		"/app/overlay/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+`,
+		"/app/patches/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 3
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	// Root-only is the default
+	_, err := Diff(fs, "/app/overlay", Options{})
+	assert.ErrorContains(t, err, "outside the kustomization root")
+
+	result, err := Diff(fs, "/app/overlay", Options{LoadRestrictions: types.LoadRestrictionsNone})
+	assert.NoError(t, err)
+	assert.Equal(t, "/app/patches/replicas.yaml", result.Patches[0].Path)
+	assert.Equal(t, 1, len(result.FieldSources), "Should read the patch outside the root")
+
+	// The restrictions of one run don't carry over to the next
+	_, err = ListPatches(fs, "/app/overlay", Options{})
+	assert.ErrorContains(t, err, "outside the kustomization root")
+}
+
+func TestKrustyOptions(t *testing.T) {
+	defaults := krustyOptions(Options{})
+	assert.Equal(t, krusty.MakeDefaultOptions().Reorder, defaults.Reorder)
+	assert.Equal(t, types.PluginRestrictionsBuiltinsOnly, defaults.PluginConfig.PluginRestrictions)
+
+	opts := krustyOptions(Options{
+		LoadRestrictions:   types.LoadRestrictionsNone,
+		Reorder:            krusty.ReorderOptionLegacy,
+		EnableAlphaPlugins: true,
+	})
+	assert.Equal(t, types.LoadRestrictionsNone, opts.LoadRestrictions)
+	assert.Equal(t, krusty.ReorderOptionLegacy, opts.Reorder)
+	assert.Equal(t, types.PluginRestrictionsNone, opts.PluginConfig.PluginRestrictions)
+}
+
+func TestValidateBuildOptions(t *testing.T) {
+	assert.NoError(t, ValidateBuildOptions(Options{}))
+	assert.NoError(t, ValidateBuildOptions(Options{Reorder: krusty.ReorderOptionLegacy, HelmCommand: DefaultHelmCommand}))
+	assert.NoError(t, ValidateBuildOptions(Options{EnableHelm: true, HelmCommand: "helm3"}))
+	assert.ErrorContains(t, ValidateBuildOptions(Options{Reorder: "fifo"}), "unknown reorder option")
+	assert.Error(t, ValidateBuildOptions(Options{HelmCommand: "helm3"}), "A helm command needs helm enabled")
+}
+
+func TestDiffWarnings(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: missing.yaml
+    target:
+      kind: Deployment
+      name: test
+  - path: broken.yaml
+    target:
+      kind: deploy
+      name: test
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+`,
+		"/app/broken.yaml": "spec: [",
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+
+	var categories []string
+	for _, w := range result.Warnings {
+		categories = append(categories, w.Category)
+	}
+	assert.Equal(t, []string{WarningReadFailed, WarningKindAlias, WarningParseFailed}, categories)
+	assert.Equal(t, "/app/missing.yaml", result.Warnings[0].Patch)
+	assert.Equal(t, "/app/broken.yaml", result.Warnings[2].Patch)
+}
+
+func TestDiffKindAllowlist(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+  - service.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: deploy
+      name: test
+  - path: type.yaml
+    target:
+      kind: Service
+      name: test
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+`,
+		"/app/service.yaml": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: test
+spec:
+  type: ClusterIP
+`,
+		"/app/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 3
+`,
+		"/app/type.yaml": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: test
+spec:
+  type: NodePort
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{Kinds: []string{"deploy,StatefulSet"}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(result.FieldSources), "Should only attribute the Deployment patch")
+	assert.Equal(t, "Deployment.v1.apps/test.[noNs]", result.FieldSources[0].Resource)
+	_, exists := result.Resources["Service.v1.[noGrp]/test.[noNs]"]
+	assert.False(t, exists, "Should drop resources of excluded kinds")
+	assert.Nil(t, result.Changelogs[1], "Should skip the excluded-kind patch")
+	assert.Empty(t, result.Unmatched, "Skipped patches aren't unmatched")
+}
+
+func TestDiffIgnoreKind(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+  - service.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      name: test
+  - path: type.yaml
+    target:
+      kind: Service
+      name: test
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+`,
+		"/app/service.yaml": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: test
+spec:
+  type: ClusterIP
+`,
+		"/app/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 3
+`,
+		"/app/type.yaml": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: test
+spec:
+  type: NodePort
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	for _, opts := range []Options{
+		{IgnoreKinds: []string{"svc"}, BuildFinal: true},
+		{Kinds: []string{"Deployment,Service"}, IgnoreKinds: []string{"Service"}},
+	} {
+		result, err := Diff(fs, "/app", opts)
+		assert.NoError(t, err)
+
+		for _, change := range result.FieldSources {
+			assert.Equal(t, "Deployment.v1.apps/test.[noNs]", change.Resource, "Should leave out the ignored kind's changes")
+		}
+		assert.Len(t, result.FieldSources, 1)
+		_, exists := result.Resources["Service.v1.[noGrp]/test.[noNs]"]
+		assert.False(t, exists, "Should drop resources of ignored kinds")
+		assert.Nil(t, result.Changelogs[1], "Should skip the ignored kind's patch")
+		assert.Empty(t, result.Unmatched, "Skipped patches aren't unmatched")
+		assert.Empty(t, result.Unattributed)
+	}
+}
+
+func TestDiffListElementIdentity(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: containers.yaml
+    target:
+      kind: Deployment
+      name: test
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: web:1.0
+        - name: sidecar
+          image: sidecar:1.0
+        - name: metrics
+          image: metrics:1.0
+`,
+		"/app/containers.yaml": `
+- op: remove
+  path: /spec/template/spec/containers/1
+- op: replace
+  path: /spec/template/spec/containers/1/image
+  value: metrics:2.0
+- op: add
+  path: /spec/template/spec/containers/-
+  value:
+    name: proxy
+    image: proxy:1.0
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, len(result.FieldSources))
+	removal := result.FieldSources[0]
+	assert.Equal(t, "name=sidecar", removal.Element, "Removal should name the removed container")
+	assert.Nil(t, removal.New)
+
+	replacement := result.FieldSources[1]
+	assert.Equal(t, []string{"spec", "template", "spec", "containers", "1", "image"}, replacement.Path, "Should keep the patch-declared index")
+	assert.Equal(t, "name=metrics", replacement.Element, "Index 1 refers to metrics after the removal")
+	assert.Equal(t, "metrics:1.0", replacement.Original)
+
+	addition := result.FieldSources[2]
+	assert.Equal(t, "name=proxy", addition.Element)
+	assert.Nil(t, addition.Original, "Appending has no original value")
+}
+
+func TestDiffReplaceRequiresPath(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: ops.yaml
+    target:
+      kind: Deployment
+      name: test
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+`,
+		"/app/ops.yaml": `
+- op: replace
+  path: /spec/strategy/type
+  value: Recreate
+- op: add
+  path: /spec/paused
+  value: true
+- op: replace
+  path: /spec/replicas
+  value: 3
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+
+	var paths []string
+	for _, change := range result.FieldSources {
+		paths = append(paths, strings.Join(change.Path, "."))
+	}
+	assert.Equal(t, []string{"spec.paused", "spec.replicas"}, paths, "Add should create, replace should require an existing path")
+
+	assert.Equal(t, 1, len(result.Warnings))
+	assert.Equal(t, WarningMissingPath, result.Warnings[0].Category)
+	assert.Contains(t, result.Warnings[0].Reason, "/spec/strategy/type")
+	assert.Equal(t, 2, len(result.Changelogs[0]), "The skipped replace shouldn't create spec.strategy")
+}
+
+func TestDiffGenerateNameResource(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+  - job.yaml
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`,
+		"/app/job.yaml": `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  generateName: migrate-
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	_, err := Diff(fs, "/app", Options{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `/app/job.yaml has metadata.generateName "migrate-" but no metadata.name`)
+	}
+}
+
+func TestDiffSymlinkedBase(t *testing.T) {
+	// Create a temporary directory for test files
+	tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"overlay/kustomization.yaml": `
+resources:
+  - ../base
+  - ../prefixed
+`,
+		// The prefix keeps the second copy of the base from clashing
+		"prefixed/kustomization.yaml": `
+namePrefix: other-
+resources:
+  - ../shared
+`,
+		"base/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      name: test
+`,
+		"base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+`,
+		"base/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 3
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	if err := os.Symlink(filepath.Join(tmpDir, "base"), filepath.Join(tmpDir, "shared")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	fs := filesys.MakeFsOnDisk()
+	result, err := Diff(fs, filepath.Join(tmpDir, "overlay"), Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result.Patches), "Should load the symlinked base once")
+
+	result, err = Diff(fs, filepath.Join(tmpDir, "overlay"), Options{NoFollowSymlinks: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(result.Patches), "Should treat the link as a separate base")
+}
+
+func TestDiffRootBuildResources(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+generatorOptions:
+  disableNameSuffixHash: true
+configMapGenerator:
+  - name: settings
+    literals:
+      - LOG_LEVEL=debug
+patches:
+  - path: settings.yaml
+    target:
+      kind: ConfigMap
+      name: settings
+`,
+		"/app/settings.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  LOG_LEVEL: info
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Unmatched, "Root patches should match resources only the root build has")
+	assert.Equal(t, 1, len(result.FieldSources))
+	assert.Equal(t, "ConfigMap.v1.[noGrp]/settings.[noNs]", result.FieldSources[0].Resource)
+	assert.Equal(t, "debug", result.FieldSources[0].Original, "Should patch the unpatched root build")
+}
+
+func TestDiffRootBuildError(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		// Only kustomize reads generator sources
+		"/app/kustomization.yaml": "resources:\n  - web.yaml\nconfigMapGenerator:\n  - name: web\n    files:\n      - missing.properties\n",
+		"/app/web.yaml":           "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n",
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	// Without the final build the root build is the only one to report it
+	_, err := Diff(fs, "/app", Options{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "kustomize build failed")
+		assert.Contains(t, err.Error(), "missing.properties")
+	}
+}
+
+func TestDiffPatchGeneratedByDeclaredName(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+configMapGenerator:
+  - name: settings
+    literals:
+      - LOG_LEVEL=debug
+patches:
+  - path: settings.yaml
+    target:
+      kind: ConfigMap
+      name: settings
+`,
+		"/app/settings.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  LOG_LEVEL: info
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Unmatched, "Should resolve the declared name to the hashed resource")
+	if assert.Equal(t, 1, len(result.FieldSources)) {
+		assert.Regexp(t, `^ConfigMap\.v1\.\[noGrp\]/settings-[a-z0-9]+\.\[noNs\]$`, result.FieldSources[0].Resource)
+		assert.Equal(t, []string{"data", "LOG_LEVEL"}, result.FieldSources[0].Path)
+		assert.Equal(t, "debug", result.FieldSources[0].Original)
+		assert.Equal(t, "info", result.FieldSources[0].New)
+	}
+}
+
+func TestDiffIgnoreGenerated(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+configMapGenerator:
+  - name: settings
+    literals:
+      - LOG_LEVEL=debug
+patches:
+  - path: settings.yaml
+    target:
+      kind: ConfigMap
+      name: settings
+  - patch: |-
+      - op: replace
+        path: /spec/replicas
+        value: 3
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+		"/app/settings.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  LOG_LEVEL: info
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{BuildFinal: true, IgnoreGenerated: true})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, result.FieldSources, "Should still attribute changes to other resources")
+	for _, change := range result.FieldSources {
+		assert.Equal(t, "Deployment.v1.apps/web.[noNs]", change.Resource)
+	}
+	assert.Empty(t, result.Unattributed)
+	assert.Empty(t, result.Generated)
+	assert.Empty(t, result.Unmatched, "Patches of generated resources aren't unmatched")
+	assert.Equal(t, 1, len(result.Resources))
+
+	result, err = Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result.Generated))
+	assert.Contains(t, resourcesOf(result.FieldSources), result.Generated[0].Resource)
+}
+
+// resourcesOf returns the resources changes were recorded for
+func resourcesOf(sources []FieldSource) []string {
+	var resources []string
+	for _, source := range sources {
+		resources = append(resources, source.Resource)
+	}
+	return resources
+}
+
+func TestDiffRelativeDir(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: patch.yaml
+    target:
+      kind: Deployment
+      name: web
+`,
+		"app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+		"app/patch.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+`,
+	}
+	assert.NoError(t, os.Mkdir(filepath.Join(tmpDir, "app"), 0755))
+	for path, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, path), []byte(content), 0644))
+	}
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(wd)
+	assert.NoError(t, os.Chdir(tmpDir))
+
+	result, err := Diff(filesys.MakeFsOnDisk(), "app", Options{BuildFinal: true})
+	assert.NoError(t, err)
+	assert.Empty(t, result.NoOp, "The root build should leave the patch out when given a relative path")
+	assert.Equal(t, 1, len(result.FieldSources))
+}
+
+func TestDiffNestedTransformedResources(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/base/kustomization.yaml": `
+resources:
+  - deployment.yaml
+`,
+		"/app/base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+		"/app/mid/kustomization.yaml": `
+namePrefix: mid-
+resources:
+  - ../base
+patches:
+  - patch: |-
+      - op: replace
+        path: /spec/replicas
+        value: 2
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/kustomization.yaml": `
+namePrefix: prod-
+resources:
+  - mid
+patches:
+  - patch: |-
+      - op: replace
+        path: /spec/replicas
+        value: 3
+    target:
+      kind: Deployment
+      name: mid-web
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{BuildFinal: true})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Unmatched, "Each patch matches the name its kustomization sees")
+	var keys []string
+	for key := range result.Resources {
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"Deployment.v1.apps/prod-mid-web.[noNs]"}, keys, "Keys from before the prefixes are dropped")
+	assert.Equal(t, "/app/base/deployment.yaml", result.Origins["Deployment.v1.apps/prod-mid-web.[noNs]"])
+
+	var replicas []interface{}
+	for _, change := range result.FieldSources {
+		assert.Equal(t, "Deployment.v1.apps/prod-mid-web.[noNs]", change.Resource)
+		if strings.Join(change.Path, ".") == "spec.replicas" {
+			replicas = append(replicas, change.New)
+		}
+	}
+	assert.Equal(t, []interface{}{int64(2), int64(3)}, replicas)
+	assert.Empty(t, result.Unattributed)
+}
+
+func TestDiffComponentWithResources(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - base
+components:
+  - ha
+`,
+		"/app/base/kustomization.yaml": `
+resources:
+  - deployment.yaml
+`,
+		"/app/base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+		"/app/ha/kustomization.yaml": `
+apiVersion: kustomize.config.k8s.io/v1alpha1
+kind: Component
+resources:
+  - pdb.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/ha/pdb.yaml": `
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: web
+spec:
+  minAvailable: 1
+`,
+		"/app/ha/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err, "A component with resources shouldn't fail the build")
+	assert.Contains(t, result.Resources, "PodDisruptionBudget.v1.policy/web.[noNs]")
+	assert.Empty(t, result.Unmatched)
+	if assert.NotEmpty(t, result.FieldSources) {
+		assert.Equal(t, "/app/ha/replicas.yaml", result.FieldSources[0].Source)
+	}
+}
+
+func TestDiffComponentGeneratorsAndTransformers(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/base/kustomization.yaml": `
+resources:
+  - deployment.yaml
+`,
+		"/app/base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+		"/app/team/kustomization.yaml": `
+apiVersion: kustomize.config.k8s.io/v1alpha1
+kind: Component
+configMapGenerator:
+  - name: team
+    literals:
+      - owner=web
+transformers:
+  - labeler.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+`,
+		"/app/team/labeler.yaml": `
+apiVersion: builtin
+kind: LabelTransformer
+metadata:
+  name: labeler
+labels:
+  team: web
+fieldSpecs:
+  - path: metadata/labels
+    create: true
+`,
+		"/app/team/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+`,
+		// The component included by the root
+		"/app/direct/kustomization.yaml": `
+resources:
+  - ../base
+components:
+  - ../team
+`,
+		// The component included by a nested kustomization
+		"/app/with-team/kustomization.yaml": `
+resources:
+  - ../base
+components:
+  - ../team
+`,
+		"/app/nested/kustomization.yaml": `
+resources:
+  - ../with-team
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	for _, dir := range []string{"/app/direct", "/app/nested"} {
+		result, err := Diff(fs, dir, Options{BuildFinal: true})
+		if !assert.NoError(t, err, dir) {
+			continue
+		}
+		if assert.Equal(t, 1, len(result.Generated), dir) {
+			assert.Equal(t, "team", result.Generated[0].Name)
+			assert.Equal(t, "/app/team/kustomization.yaml", result.Generated[0].Source, "The component's generator should be found")
+		}
+
+		sources := make(map[string]FieldSource)
+		for _, change := range result.FieldSources {
+			sources[keyKind(change.Resource)+":"+strings.Join(change.Path, ".")] = change
+		}
+		label := sources["Deployment:metadata.labels"]
+		assert.Equal(t, "/app/team/labeler.yaml", label.Source, "%s: the component's transformer should be attributed", dir)
+		assert.Equal(t, SourceTypeTransformer+"LabelTransformer", label.SourceType)
+		assert.Equal(t, map[string]interface{}{"team": "web"}, label.New)
+		assert.Equal(t, "/app/team/replicas.yaml", sources["Deployment:spec.replicas"].Source, "The component's patch should still be attributed")
+		assert.Equal(t, int64(2), sources["Deployment:spec.replicas"].New)
+		assert.Empty(t, result.Unattributed, dir)
+	}
+}
+
+func TestDiffScalarRepresentation(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: quoted.yaml
+    target:
+      kind: Deployment
+      name: web
+  - patch: |-
+      - op: replace
+        path: /spec/paused
+        value: "false"
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  paused: false
+  replicas: 1
+  minReadySeconds: 10
+`,
+		"/app/quoted.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: "1"
+  minReadySeconds: 10.0
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.FieldSources, "Quoting or reformatting a value isn't a change")
+	assert.Equal(t, []int{0, 1}, result.NoOp)
+}
+
+func TestDiffMaxDepth(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - config.yaml
+patches:
+  - path: patch.yaml
+    target:
+      kind: ConfigMap
+      name: config
+`,
+		"/app/config.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: value
+`,
+		"/app/patch.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  annotations:
+    nested: {a: {b: {c: {d: {e: {f: value}}}}}}
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	_, err := Diff(fs, "/app", Options{MaxDepth: 4})
+	assert.ErrorContains(t, err, "more than 4 levels deep")
+
+	_, err = Diff(fs, "/app", Options{})
+	assert.NoError(t, err, "The default limit should allow ordinary nesting")
+}
+
+func TestDiffVerbose(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - config.yaml
+patches:
+  - path: patch.yaml
+    target:
+      kind: ConfigMap
+      name: config
+`,
+		"/app/config.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: value
+`,
+		"/app/patch.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: other
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	var log bytes.Buffer
+
+	_, err := Diff(fs, "/app", Options{Log: &log})
+	assert.NoError(t, err)
+	assert.NotContains(t, log.String(), "=== Kustomization Configuration ===", "Configuration should only be shown with -verbose")
+	assert.NotContains(t, log.String(), "1. File: /app/patch.yaml")
+	assert.NotContains(t, log.String(), "--- Processing Patch 1/1 ---", "Per-patch progress should only be shown with -verbose")
+	assert.NotContains(t, log.String(), "Changes detected")
+	assert.Contains(t, log.String(), "Found 1 patches to apply")
+
+	log.Reset()
+	_, err = Diff(fs, "/app", Options{Log: &log, Verbose: true})
+	assert.NoError(t, err)
+	assert.Contains(t, log.String(), "=== Kustomization Configuration ===")
+	assert.Contains(t, log.String(), "1. File: /app/patch.yaml")
+	assert.Contains(t, log.String(), "--- Processing Patch 1/1 ---")
+	assert.Contains(t, log.String(), "Changes detected: 1")
+	assert.Contains(t, log.String(), "Found 1 patches to apply")
+}
+
+func TestDiffDryApply(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - config.yaml
+patches:
+  - path: patch.yaml
+    target:
+      kind: ConfigMap
+      name: config
+`,
+		"/app/config.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: value
+`,
+		"/app/patch.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: other
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	var log bytes.Buffer
+
+	_, err := Diff(fs, "/app", Options{Log: &log})
+	assert.NoError(t, err)
+	assert.NotContains(t, log.String(), "--- ConfigMap/config after")
+
+	log.Reset()
+	_, err = Diff(fs, "/app", Options{Log: &log, DryApply: true})
+	assert.NoError(t, err)
+	assert.Contains(t, log.String(), "--- ConfigMap/config after /app/patch.yaml ---\napiVersion: v1\n", "Dry apply output doesn't need -verbose")
+
+	log.Reset()
+	_, err = Diff(fs, "/app", Options{Log: &log, DryApply: true, Verbose: true})
+	assert.NoError(t, err)
+	assert.Contains(t, log.String(), `--- Processing Patch 1/1 ---
+Patch File: /app/patch.yaml
+Target: ConfigMap/config
+--- ConfigMap/config after /app/patch.yaml ---
+apiVersion: v1
+data:
+  key: other
+kind: ConfigMap
+metadata:
+  name: config
+`)
+
+	// Secret values are masked unless shown on request
+	assert.NoError(t, fs.WriteFile("/app/kustomization.yaml", []byte(`
+resources:
+  - secret.yaml
+patches:
+  - path: secret-patch.yaml
+    target:
+      kind: Secret
+      name: db
+`)))
+	assert.NoError(t, fs.WriteFile("/app/secret.yaml", []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: db\ndata:\n  password: aHVudGVyMg==\n")))
+	assert.NoError(t, fs.WriteFile("/app/secret-patch.yaml", []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: db\ndata:\n  password: c3VwZXJzZWNyZXQ=\n")))
+
+	log.Reset()
+	_, err = Diff(fs, "/app", Options{Log: &log, DryApply: true})
+	assert.NoError(t, err)
+	assert.Contains(t, log.String(), "--- Secret/db after /app/secret-patch.yaml ---")
+	assert.NotContains(t, log.String(), "c3VwZXJzZWNyZXQ=")
+
+	log.Reset()
+	_, err = Diff(fs, "/app", Options{Log: &log, DryApply: true, ShowSecrets: true})
+	assert.NoError(t, err)
+	assert.Contains(t, log.String(), "password: c3VwZXJzZWNyZXQ=")
+}
+
+func TestDiffEnvMergeByName(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: env.yaml
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: web:1.0
+          env:
+            - name: LOG_LEVEL
+              value: info
+            - name: FOO
+              value: one
+            - name: BAR
+              value: two
+`,
+		"/app/env.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          env:
+            - name: FOO
+              value: changed
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{BuildFinal: true})
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(result.FieldSources), "Only the updated env var should change") {
+		change := result.FieldSources[0]
+		assert.Equal(t, []string{"spec", "template", "spec", "containers", "0", "env", "1", "value"}, change.Path)
+		assert.Equal(t, "name=FOO", change.Element)
+		assert.Equal(t, "one", change.Original)
+		assert.Equal(t, "changed", change.New)
+	}
+}
+
+func TestDiffStrictMergeKeys(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: patch.yaml
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: web:1.0
+`,
+		"/app/patch.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - image: web:2.0
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	_, err := Diff(fs, "/app", Options{StrictMergeKeys: true})
+	assert.ErrorContains(t, err, "element 0 of containers has no merge key name")
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err, "Lenient merging should append the unkeyed container")
+	if assert.Equal(t, 1, len(result.FieldSources)) {
+		assert.Equal(t, []string{"spec", "template", "spec", "containers", "1"}, result.FieldSources[0].Path)
+	}
+}
+
+func TestDiffPatchTargetsEveryMatch(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - a.yaml
+  - b.yaml
+  - b-staging.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+  - path: release.yaml
+    target:
+      kind: Deployment
+      name: b
+`,
+		"/app/a.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: a
+spec:
+  replicas: 1
+`,
+		"/app/b.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: b
+spec:
+  replicas: 1
+`,
+		"/app/b-staging.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: b
+  namespace: staging
+spec:
+  replicas: 1
+`,
+		"/app/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: any
+spec:
+  replicas: 3
+`,
+		"/app/release.yaml": `
+- op: add
+  path: /metadata/annotations
+  value:
+    release: canary
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{BuildFinal: true})
+	assert.NoError(t, err)
+	patched := make(map[string][]string)
+	for _, change := range result.FieldSources {
+		patched[change.Source] = append(patched[change.Source], change.Resource)
+	}
+	assert.Equal(t, []string{
+		"Deployment.v1.apps/a.[noNs]",
+		"Deployment.v1.apps/b.[noNs]",
+		"Deployment.v1.apps/b.staging",
+	}, patched["/app/replicas.yaml"], "A target without a name patches every resource of its kind")
+	assert.Equal(t, []string{
+		"Deployment.v1.apps/b.[noNs]",
+		"Deployment.v1.apps/b.staging",
+	}, patched["/app/release.yaml"], "A target without a namespace patches the name in every namespace")
+	assert.Empty(t, result.Unattributed, "Every change kustomize makes is attributed")
+	assert.Empty(t, result.NoOp)
+}
+
+func TestDiffReplaceList(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+  - route.yaml
+patches:
+  - path: patch.yaml
+    target:
+      kind: Deployment
+      name: web
+  - path: hosts.yaml
+    target:
+      kind: Route
+      name: web
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: app:1.0
+          args: ["--port=8080", "--verbose"]
+`,
+		"/app/patch.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          args: ["--port=9090"]
+`,
+		"/app/route.yaml": `
+apiVersion: example.com/v1
+kind: Route
+metadata:
+  name: web
+spec:
+  hosts: ["web.example.com"]
+`,
+		"/app/hosts.yaml": `
+apiVersion: example.com/v1
+kind: Route
+metadata:
+  name: web
+spec:
+  hosts: ["shop.example.com"]
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	byKind := func(result *Result) map[string]FieldSource {
+		changes := make(map[string]FieldSource)
+		for _, change := range result.FieldSources {
+			changes[keyKind(change.Resource)] = change
+		}
+		return changes
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+	changes := byKind(result)
+	if assert.Equal(t, 2, len(result.FieldSources), "Should record each list change once") {
+		args := changes["Deployment"]
+		assert.Equal(t, []string{"spec", "template", "spec", "containers", "0", "args"}, args.Path)
+		assert.Equal(t, "name=app", args.Element)
+		assert.Equal(t, []interface{}{"--port=8080", "--verbose"}, args.Original)
+		assert.Equal(t, []interface{}{"--port=9090"}, args.New, "The old args should be gone")
+		assert.Equal(t, []interface{}{"web.example.com", "shop.example.com"}, changes["Route"].New, "Unknown CRD lists are appended to")
+	}
+
+	result, err = Diff(fs, "/app", Options{ReplaceLists: []string{"spec.hosts"}})
+	assert.NoError(t, err)
+	changes = byKind(result)
+	assert.Equal(t, []interface{}{"shop.example.com"}, changes["Route"].New, "CRD lists can be replaced on request")
+	assert.Equal(t, []interface{}{"--port=9090"}, changes["Deployment"].New)
+}
+
+func TestDiffTargetNamespaceAndSelector(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	deployment := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: %s
+  namespace: %s
+  labels:
+    app: %s
+spec:
+  replicas: 1
+`
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - a-staging.yaml
+  - b-api.yaml
+  - c-web.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      namespace: prod
+      labelSelector: app=web
+`,
+		// Each decoy satisfies two of the three conditions
+		"/app/a-staging.yaml": fmt.Sprintf(deployment, "a-staging", "staging", "web"),
+		"/app/b-api.yaml":     fmt.Sprintf(deployment, "b-api", "prod", "api"),
+		"/app/c-web.yaml":     fmt.Sprintf(deployment, "c-web", "prod", "web"),
+		"/app/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: c-web
+spec:
+  replicas: 3
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(result.FieldSources)) {
+		assert.Equal(t, "Deployment.v1.apps/c-web.prod", result.FieldSources[0].Resource)
+		assert.Equal(t, []string{"spec", "replicas"}, result.FieldSources[0].Path)
+	}
+
+	// The same name in two namespaces is two resources
+	assert.NoError(t, fs.WriteFile("/app/kustomization.yaml", []byte(`
+resources:
+  - web-staging.yaml
+  - web-prod.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      namespace: prod
+      labelSelector: app=web
+`)))
+	assert.NoError(t, fs.WriteFile("/app/web-staging.yaml", []byte(fmt.Sprintf(deployment, "web", "staging", "web"))))
+	assert.NoError(t, fs.WriteFile("/app/web-prod.yaml", []byte(fmt.Sprintf(deployment, "web", "prod", "web"))))
+	assert.NoError(t, fs.WriteFile("/app/replicas.yaml", []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 3\n")))
+	result, err = Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+	assert.Len(t, result.Resources, 2)
+	if assert.Equal(t, 1, len(result.FieldSources)) {
+		assert.Equal(t, "Deployment.v1.apps/web.prod", result.FieldSources[0].Resource)
+		assert.Equal(t, int64(3), result.FieldSources[0].New)
+	}
+
+	assert.NoError(t, fs.WriteFile("/app/kustomization.yaml", []byte(`
+resources:
+  - c-web.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      labelSelector: "app in (web"
+`)))
+	_, err = Diff(fs, "/app", Options{})
+	assert.ErrorContains(t, err, "invalid labelSelector")
+}
+
+func TestDiffPatchWithoutTarget(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+  - service.yaml
+patches:
+  - path: replicas.yaml
+  - patch: |
+      apiVersion: v1
+      kind: Service
+      metadata:
+        name: web
+      spec:
+        type: NodePort
+  - patch: |
+      - op: replace
+        path: /spec/replicas
+        value: 5
+`,
+		"/app/deployment.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 1\n",
+		"/app/service.yaml":    "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\nspec:\n  type: ClusterIP\n",
+		"/app/replicas.yaml":   "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 3\n",
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	// Strategic merge patches target the resource they name; a JSON patch
+	// names none
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+	changes := make(map[string]interface{})
+	for _, source := range result.FieldSources {
+		changes[source.Resource+" "+strings.Join(source.Path, ".")] = source.New
+	}
+	assert.Equal(t, map[string]interface{}{
+		"Deployment.v1.apps/web.[noNs] spec.replicas": int64(3),
+		"Service.v1.[noGrp]/web.[noNs] spec.type":     "NodePort",
+	}, changes)
+	assert.Equal(t, []int{2}, result.Unmatched)
+}
+
+func TestDiffNamespaceFiltersTransformations(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	deployment := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: %s
+  namespace: %s
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1.0
+`
+	files := map[string]string{
+		"/app/overlay/kustomization.yaml": `
+resources:
+  - ../base
+images:
+  - name: app
+    newTag: "2.0"
+transformers:
+  - annotations.yaml
+`,
+		"/app/overlay/annotations.yaml": `
+apiVersion: builtin
+kind: AnnotationsTransformer
+metadata:
+  name: owner
+annotations:
+  owner: platform
+fieldSpecs:
+  - path: metadata/annotations
+    create: true
+`,
+		"/app/base/kustomization.yaml": `
+resources:
+  - web-a.yaml
+  - web-b.yaml
+  - configmap.yaml
+`,
+		"/app/base/web-a.yaml": fmt.Sprintf(deployment, "web-a", "a"),
+		"/app/base/web-b.yaml": fmt.Sprintf(deployment, "web-b", "b"),
+		"/app/base/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: b
+data:
+  LOG_LEVEL: debug
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	sourceTypes := func(dir string, opts Options) map[string][]string {
+		result, err := Diff(fs, dir, opts)
+		assert.NoError(t, err)
+		if result == nil {
+			return nil
+		}
+		byResource := make(map[string][]string)
+		for _, source := range result.FieldSources {
+			byResource[source.Resource] = append(byResource[source.Resource], source.SourceType)
+		}
+		return byResource
+	}
+
+	// Image and transformer records of namespace b are left out like its
+	// resources
+	all := sourceTypes("/app/overlay", Options{})
+	assert.Contains(t, all, "Deployment.v1.apps/web-b.b")
+	assert.Len(t, all["Deployment.v1.apps/web-a.a"], 2, "Should record the image and annotation of web-a")
+	assert.Equal(t, map[string][]string{
+		"Deployment.v1.apps/web-a.a": all["Deployment.v1.apps/web-a.a"],
+	}, sourceTypes("/app/overlay", Options{Namespace: "a"}))
+}
+
+func TestDiffBuildOptionsReachEveryBuild(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		// The nested base loads a file outside its root
+		"/app/base/kustomization.yaml": "resources:\n  - deployment.yaml\n  - ../shared/namespace.yaml\n",
+		"/app/base/deployment.yaml":    "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: web\n",
+		"/app/shared/namespace.yaml":   "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: web\n",
+		"/app/prod/kustomization.yaml": "resources:\n  - ../base\n",
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	_, err := Diff(fs, "/app/prod", Options{})
+	assert.Error(t, err, "Root-only loading should reject the shared file")
+
+	result, err := Diff(fs, "/app/prod", Options{
+		BuildFinal:       true,
+		LoadRestrictions: types.LoadRestrictionsNone,
+		Reorder:          krusty.ReorderOptionLegacy,
+	})
+	assert.NoError(t, err, "The nested base build should use the configured load restrictions")
+	assert.Contains(t, result.Resources, "Namespace.v1.[noGrp]/web.[noNs]")
+	var order []string
+	for _, res := range result.Final.Resources() {
+		order = append(order, res.GetKind())
+	}
+	assert.Equal(t, []string{"Namespace", "Deployment"}, order, "The final build should use the configured order")
+	assert.Empty(t, result.Unattributed, "Builds with the same options should agree")
+
+	result, err = Diff(fs, "/app/prod", Options{BuildFinal: true, LoadRestrictions: types.LoadRestrictionsNone})
+	assert.NoError(t, err)
+	assert.Equal(t, "Deployment", result.Final.Resources()[0].GetKind(), "The default keeps declaration order")
+}
+
+func TestDiffCircularReference(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/overlay/kustomization.yaml": `
+resources:
+  - ../base
+`,
+		"/app/base/kustomization.yaml": `
+resources:
+  - config.yaml
+  - ../overlay
+`,
+		"/app/base/config.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	_, err := Diff(fs, "/app/overlay", Options{BuildFinal: true})
+	assert.EqualError(t, err, "circular reference: /app/overlay → /app/base → /app/overlay")
+
+	_, err = ListPatches(fs, "/app/base", Options{})
+	assert.EqualError(t, err, "circular reference: /app/base → /app/overlay → /app/base")
+}
+
+func TestDiffNestedOverlayPatches(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - overlay
+`,
+		"/app/overlay/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/overlay/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+		"/app/overlay/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	// The root build mustn't apply the nested overlay's patch itself
+	result, err := Diff(fs, "/app", Options{BuildFinal: true})
+	assert.NoError(t, err)
+	assert.Empty(t, result.NoOp)
+	if assert.Equal(t, 1, len(result.FieldSources)) {
+		assert.Equal(t, "/app/overlay/replicas.yaml", result.FieldSources[0].Source)
+		assert.Equal(t, []string{"spec", "replicas"}, result.FieldSources[0].Path)
+		assert.Equal(t, int64(1), result.FieldSources[0].Original)
+		assert.Equal(t, int64(3), result.FieldSources[0].New)
+	}
+	assert.Empty(t, result.Unattributed)
+}
+
+func TestDiffMaxTreeDepth(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	patch := func(key string) string {
+		return `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  ` + key + `: patched
+`
+	}
+	kustomization := func(resource string) string {
+		return `
+resources:
+  - ` + resource + `
+patches:
+  - path: patch.yaml
+    target:
+      kind: ConfigMap
+      name: config
+`
+	}
+	files := map[string]string{
+		"/app/kustomization.yaml":          kustomization("mid"),
+		"/app/patch.yaml":                  patch("root"),
+		"/app/mid/kustomization.yaml":      kustomization("leaf"),
+		"/app/mid/patch.yaml":              patch("mid"),
+		"/app/mid/leaf/kustomization.yaml": kustomization("config.yaml"),
+		"/app/mid/leaf/patch.yaml":         patch("leaf"),
+		"/app/mid/leaf/config.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  base: value
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	fields := func(result *Result) []string {
+		var keys []string
+		for _, change := range result.FieldSources {
+			keys = append(keys, strings.Join(change.Path, "."))
+		}
+		return keys
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"data.root", "data.mid", "data.leaf"}, fields(result))
+	assert.Empty(t, result.Warnings)
+
+	result, err = Diff(fs, "/app", Options{MaxTreeDepth: 1, BuildFinal: true})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"data.root", "data.mid"}, fields(result))
+	if assert.Equal(t, 1, len(result.Warnings)) {
+		assert.Equal(t, WarningTreeTruncated, result.Warnings[0].Category)
+		assert.Equal(t, "/app/mid/leaf", result.Warnings[0].Patch)
+	}
+	leaf, err := result.Final.Resources()[0].GetString("data.leaf")
+	assert.NoError(t, err)
+	assert.Equal(t, "patched", leaf, "The leaf patch still applies through the build")
+}
+
+func TestDiffNameChangingPatch(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: rename.yaml
+    target:
+      kind: Deployment
+      name: web
+    options:
+      allowNameChange: true
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      name: web-v2
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+		"/app/rename.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web-v2
+`,
+		"/app/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web-v2
+spec:
+  replicas: 3
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{BuildFinal: true})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Unmatched, "The second patch should find the resource by its new name")
+	assert.Empty(t, result.Unattributed)
+	assert.Contains(t, result.Resources, "Deployment.v1.apps/web-v2.[noNs]")
+	assert.NotContains(t, result.Resources, "Deployment.v1.apps/web.[noNs]")
+	if assert.Equal(t, 2, len(result.FieldSources)) {
+		assert.Equal(t, FieldSource{
+			Resource:   "Deployment.v1.apps/web-v2.[noNs]",
+			Path:       []string{"metadata", "name"},
+			Source:     "/app/rename.yaml",
+			SourceType: SourceTypePatch,
+			Original:   "web",
+			New:        "web-v2",
+		}, result.FieldSources[0])
+		assert.Equal(t, "Deployment.v1.apps/web-v2.[noNs]", result.FieldSources[1].Resource)
+		assert.Equal(t, []string{"spec", "replicas"}, result.FieldSources[1].Path)
+	}
+}
+
+func TestDiffScalarPatch(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - patch: YXBpVmVyc2lvbjogYXBwcy92MQpraW5kOiBEZXBsb3ltZW50Cg==
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.FieldSources)
+	if assert.Equal(t, 1, len(result.Warnings)) {
+		assert.Equal(t, "inline patch (Deployment/web)", result.Warnings[0].Patch)
+		assert.Equal(t, WarningParseFailed, result.Warnings[0].Category)
+		assert.Contains(t, result.Warnings[0].Reason, "Patch content is a string")
+	}
+}
+
+func TestDiffSingleResource(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+  - service.yaml
+patches:
+  - path: deployment-patch.yaml
+    target:
+      kind: Deployment
+      name: test
+  - path: service-patch.yaml
+    target:
+      kind: Service
+      name: test
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+`,
+		"/app/service.yaml": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: test
+spec:
+  type: ClusterIP
+`,
+		"/app/deployment-patch.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 3
+`,
+		"/app/service-patch.yaml": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: test
+spec:
+  type: NodePort
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{BuildFinal: true, Resource: "Deployment/test"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Final.Size(), "Everything is still built")
+	assert.NotEmpty(t, result.Changelogs[0])
+	assert.Nil(t, result.Changelogs[1], "The Service patch shouldn't be applied")
+	if assert.Equal(t, 1, len(result.FieldSources)) {
+		assert.Equal(t, "Deployment.v1.apps/test.[noNs]", result.FieldSources[0].Resource)
+		assert.Equal(t, []string{"spec", "replicas"}, result.FieldSources[0].Path)
+	}
+	assert.Empty(t, result.Unattributed, "The unpatched Service shouldn't show up as unattributed")
+
+	_, err = Diff(fs, "/app", Options{Resource: "Deployment/missing"})
+	assert.ErrorContains(t, err, "no resource matches Deployment/missing")
+}
+
+func TestDiffCRLFPatch(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	crlf := func(s string) string {
+		return strings.ReplaceAll(s, "\n", "\r\n")
+	}
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - config.yaml
+patches:
+  - path: patch.yaml
+    target:
+      kind: ConfigMap
+      name: config
+`,
+		"/app/config.yaml": crlf(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  mode: slow
+  script: |
+    echo one
+`),
+		"/app/patch.yaml": crlf(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  mode: fast
+  script: |
+    echo one
+    echo two
+`),
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{BuildFinal: true})
+	assert.NoError(t, err)
+	values := make(map[string][2]interface{})
+	for _, change := range result.FieldSources {
+		values[strings.Join(change.Path, ".")] = [2]interface{}{change.Original, change.New}
+	}
+	assert.Equal(t, map[string][2]interface{}{
+		"data.mode":   {"slow", "fast"},
+		"data.script": {"echo one\n", "echo one\necho two\n"},
+	}, values)
+	assert.Empty(t, result.Unattributed)
+}
+
+func TestDiffPatchOnPatchedElement(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: add-sidecar.yaml
+    target:
+      kind: Deployment
+      name: web
+  - path: bump-sidecar.yaml
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1.0
+`,
+		"/app/add-sidecar.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        image: proxy:1.0
+        imagePullPolicy: IfNotPresent
+`,
+		"/app/bump-sidecar.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        image: proxy:2.0
+        imagePullPolicy: Always
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+
+	// The second patch merges into the sidecar the first one added
+	bumped := make(map[string][2]interface{})
+	for _, change := range result.FieldSources {
+		if change.Source == "/app/bump-sidecar.yaml" {
+			assert.Equal(t, "name=sidecar", change.Element)
+			bumped[strings.Join(change.Path, ".")] = [2]interface{}{change.Original, change.New}
+		}
+	}
+	assert.Equal(t, map[string][2]interface{}{
+		"spec.template.spec.containers.1.image":           {"proxy:1.0", "proxy:2.0"},
+		"spec.template.spec.containers.1.imagePullPolicy": {"IfNotPresent", "Always"},
+	}, bumped)
+	assert.Nil(t, result.NoOp)
+	assert.NotContains(t, result.Resources["Deployment.v1.apps/web.[noNs]"].MustYaml(), "sidecar", "Base resources should stay unpatched")
+}
+
+func TestDiffPatchTargetsPatchedLabels(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - patch: |-
+      - op: add
+        path: /metadata/labels
+        value:
+          track: canary
+    target:
+      kind: Deployment
+      name: web
+  - patch: |-
+      - op: replace
+        path: /spec/replicas
+        value: 5
+    target:
+      kind: Deployment
+      labelSelector: track=canary
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{BuildFinal: true})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Unmatched, "The second patch selects the label the first one added")
+	replicas, err := result.Final.Resources()[0].GetFieldValue("spec.replicas")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, replicas, "Kustomize applies the second patch too")
+	assert.Empty(t, result.Unattributed)
+}
+
+func TestDiffSequentialPatches(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: labels.yaml
+    target:
+      kind: Deployment
+      name: web
+  - path: relabel.yaml
+    target:
+      kind: Deployment
+      name: web
+  - path: resume.yaml
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+spec:
+  replicas: 1
+`,
+		"/app/labels.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    tier: frontend
+    team: web
+`,
+		// Replacing and removing labels only the strategic merge patch above
+		// added, which fails unless it applies on top of it
+		"/app/relabel.yaml": `
+- op: replace
+  path: /metadata/labels/tier
+  value: backend
+- op: remove
+  path: /metadata/labels/team
+- op: add
+  path: /spec/paused
+  value: true
+`,
+		"/app/resume.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  paused: false
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{BuildFinal: true})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Warnings, "The JSON patch's paths should exist")
+
+	// A JSON patch stacks on a strategic merge patch, and the other way round
+	changes := make(map[string][2]interface{})
+	for _, change := range result.FieldSources {
+		if change.Source != "/app/labels.yaml" {
+			changes[change.Source+" "+strings.Join(change.Path, ".")] = [2]interface{}{change.Original, change.New}
+		}
+	}
+	assert.Equal(t, map[string][2]interface{}{
+		"/app/relabel.yaml metadata.labels.tier": {"frontend", "backend"},
+		"/app/relabel.yaml metadata.labels.team": {"web", nil},
+		"/app/relabel.yaml spec.paused":          {nil, true},
+		"/app/resume.yaml spec.paused":           {true, false},
+	}, changes)
+	assert.Empty(t, result.Unattributed, "The stacked changes should explain the final build")
+}
+
+func TestDiffBaseDrift(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - base
+`,
+		"/app/base/kustomization.yaml": `
+namePrefix: prod-
+resources:
+  - deployment.yaml
+  - service.yaml
+`,
+		"/app/base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+		"/app/base/service.yaml": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  annotations:
+    team: web
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.BaseDrift, "Drift is only checked on request")
+
+	result, err = Diff(fs, "/app", Options{CheckBaseDrift: true})
+	assert.NoError(t, err)
+	drift := make(map[string][]interface{})
+	for _, change := range result.BaseDrift {
+		assert.Equal(t, SourceTypeBaseDrift, change.SourceType)
+		drift[change.Resource+" "+strings.Join(change.Path, ".")] = []interface{}{change.Source, change.Original, change.New}
+	}
+	assert.Equal(t, map[string][]interface{}{
+		"Deployment.v1.apps/prod-web.[noNs] metadata.name": {"/app/base/deployment.yaml", "web", "prod-web"},
+		"Service.v1.[noGrp]/prod-web.[noNs] metadata.name": {"/app/base/service.yaml", "web", "prod-web"},
+	}, drift, "Only the prefix should differ, not the origin annotations the check builds with")
+}
+
+func TestDiffKeepsQuotedScalars(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - config.yaml
+patches:
+  - path: patch.yaml
+    target:
+      kind: ConfigMap
+      name: config
+`,
+		"/app/config.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\ndata:\n  port: \"80\"\n  debug: \"false\"\n  retries: \"3\"\n",
+		"/app/patch.yaml":  "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\ndata:\n  port: \"8080\"\n  debug: \"true\"\n  retries: 3\n",
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{BuildFinal: true})
+	assert.NoError(t, err)
+	changes := make(map[string][2]interface{})
+	for _, source := range result.FieldSources {
+		changes[strings.Join(source.Path, ".")] = [2]interface{}{source.Original, source.New}
+	}
+	assert.Equal(t, map[string][2]interface{}{
+		"data.port":  {"80", "8080"},
+		"data.debug": {"false", "true"},
+	}, changes, "Quoted values should be recorded as strings, and retries only changed quoting")
+	assert.Empty(t, result.Unattributed)
+}
+
+func TestDiffConcurrent(t *testing.T) {
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - config.yaml
+patches:
+  - path: patch.yaml
+    target:
+      kind: ConfigMap
+      name: config
+`,
+		"/app/config.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: value
+  level: info
+`,
+		"/app/patch.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: other
+  level: debug
+`,
+	}
+
+	// Runs with different options mustn't see each other's state
+	optionSets := []Options{{}, {IgnorePaths: []string{"data.level"}}, {Verbose: true}}
+	results := make([]*Result, len(optionSets))
+	logs := make([]bytes.Buffer, len(optionSets))
+	errs := make([]error, len(optionSets))
+	var wg sync.WaitGroup
+	for i, opts := range optionSets {
+		fs := filesys.MakeFsInMemory()
+		for path, content := range files {
+			assert.NoError(t, fs.WriteFile(path, []byte(content)))
+		}
+		opts.Log = &logs[i]
+		wg.Add(1)
+		go func(i int, opts Options) {
+			defer wg.Done()
+			results[i], errs[i] = Diff(fs, "/app", opts)
+		}(i, opts)
+	}
+	wg.Wait()
+
+	for i := range optionSets {
+		assert.NoError(t, errs[i])
+	}
+	assert.Len(t, results[0].FieldSources, 2)
+	assert.Len(t, results[1].FieldSources, 1, "Ignored paths should only apply to their own run")
+	assert.Len(t, results[2].FieldSources, 2)
+	assert.NotContains(t, logs[0].String(), "=== Kustomization Configuration ===")
+	assert.Contains(t, logs[2].String(), "=== Kustomization Configuration ===", "Verbose output should only go to its own run's log")
+}
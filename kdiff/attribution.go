@@ -0,0 +1,254 @@
+package kdiff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/r3labs/diff/v3"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// UnattributedSource is the Source recorded for final changes no tracked
+// patch or transformer explains
+const UnattributedSource = "unattributed"
+
+// unattributedChanges compares each resource of the final build with the
+// resource patches were matched against, and returns the differences no
+// recorded change explains. A change explains a difference at, above or
+// below its path. The last change recorded at a path must also leave the
+// value the final build has, or the final value is returned as well. These
+// are gaps in the attribution, e.g. kustomize behaviors that aren't
+// modelled yet. Resources that only exist on one side, like generated or
+// renamed ones, aren't compared.
+func (r *run) unattributedChanges(resources map[string]*resource.Resource, final resmap.ResMap, sources []FieldSource) ([]FieldSource, error) {
+	explained := make(map[string][][]string)
+	recorded := make(map[string][]FieldSource)
+	for _, source := range sources {
+		explained[source.Resource] = append(explained[source.Resource], source.Path)
+		recorded[source.Resource] = append(recorded[source.Resource], source)
+	}
+
+	var changes []FieldSource
+	for _, res := range final.Resources() {
+		key := ResourceKey(res)
+		base, exists := resources[key]
+		if !exists {
+			continue
+		}
+		changelog, err := r.diffFinal(key, base, res)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, change := range changelog {
+			if pathExplained(change.Path, explained[key]) {
+				continue
+			}
+			changes = append(changes, FieldSource{
+				Resource:   key,
+				Path:       change.Path,
+				Source:     UnattributedSource,
+				SourceType: SourceTypeUnattributed,
+				Original:   change.From,
+				New:        change.To,
+			})
+		}
+
+		var finalMap map[string]interface{}
+		if err := yaml.Unmarshal([]byte(res.MustYaml()), &finalMap); err != nil {
+			return nil, fmt.Errorf("unmarshal final %s: %w", key, err)
+		}
+		for _, last := range lastChanges(recorded[key]) {
+			value := GetValueAtPath(finalMap, last.Path)
+			if reflect.DeepEqual(NormalizeScalars(value), NormalizeScalars(last.New)) {
+				continue
+			}
+			changes = append(changes, FieldSource{
+				Resource:   key,
+				Path:       last.Path,
+				Source:     UnattributedSource,
+				SourceType: SourceTypeUnattributed,
+				Original:   last.New,
+				New:        NormalizeNumbers(value),
+			})
+		}
+	}
+	return changes, nil
+}
+
+// lastChanges returns the changes no later change is recorded at, above or
+// below the path of. Removals of list elements are left out, as the elements
+// after them move up to their index.
+func lastChanges(changes []FieldSource) []FieldSource {
+	var last []FieldSource
+	for i, change := range changes {
+		superseded := false
+		for _, later := range changes[i+1:] {
+			if pathExplained(change.Path, [][]string{later.Path}) {
+				superseded = true
+				break
+			}
+		}
+		if superseded {
+			continue
+		}
+		if len(change.Path) > 0 && change.New == nil {
+			if _, err := strconv.Atoi(change.Path[len(change.Path)-1]); err == nil {
+				continue
+			}
+		}
+		last = append(last, change)
+	}
+	return last
+}
+
+// diffFinal compares a resource with its counterpart in the final build
+func (r *run) diffFinal(key string, base, final *resource.Resource) (diff.Changelog, error) {
+	var baseMap, finalMap map[string]interface{}
+	if err := yaml.Unmarshal([]byte(base.MustYaml()), &baseMap); err != nil {
+		return nil, fmt.Errorf("unmarshal base %s: %w", key, err)
+	}
+	if err := yaml.Unmarshal([]byte(final.MustYaml()), &finalMap); err != nil {
+		return nil, fmt.Errorf("unmarshal final %s: %w", key, err)
+	}
+	normalizeObject(baseMap, true)
+	normalizeObject(finalMap, true)
+	changelog, err := r.diffObjects(baseMap, finalMap)
+	if err != nil {
+		return nil, fmt.Errorf("diff %s: %w", key, err)
+	}
+	return changelog, nil
+}
+
+// implicitChanges compares the resources as declared in their files with the
+// final build and returns the differences no recorded change explains,
+// labelled with a best-effort category of the kustomize behavior behind them,
+// e.g. commonLabels propagating into selectors. Resources renamed by the
+// build are matched by their declared name where kustomize kept it.
+func (r *run) implicitChanges(declared map[string]*resource.Resource, final resmap.ResMap, explaining []FieldSource) ([]FieldSource, error) {
+	explained := make(map[string][][]string)
+	for _, source := range explaining {
+		explained[source.Resource] = append(explained[source.Resource], source.Path)
+	}
+
+	var changes []FieldSource
+	for _, res := range final.Resources() {
+		key := ResourceKey(res)
+		base, exists := declared[key]
+		if !exists {
+			if base, exists = declared[res.OrgId().String()]; !exists {
+				continue
+			}
+		}
+		changelog, err := r.diffFinal(key, base, res)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, change := range mapLeafChanges(changelog) {
+			if pathExplained(change.Path, explained[key]) {
+				continue
+			}
+			changes = append(changes, FieldSource{
+				Resource:   key,
+				Path:       change.Path,
+				Source:     implicitCategory(change.Path),
+				SourceType: SourceTypeImplicit,
+				Original:   change.From,
+				New:        change.To,
+			})
+		}
+	}
+	return changes, nil
+}
+
+// mapLeafChanges splits each change adding or removing a whole map into a
+// change per leaf, so e.g. labels added to a resource without any are
+// categorized and explained one by one
+func mapLeafChanges(changelog diff.Changelog) diff.Changelog {
+	var leaves diff.Changelog
+	var split func(change diff.Change)
+	split = func(change diff.Change) {
+		var value map[string]interface{}
+		switch {
+		case change.From == nil:
+			value, _ = change.To.(map[string]interface{})
+		case change.To == nil:
+			value, _ = change.From.(map[string]interface{})
+		}
+		if len(value) == 0 {
+			leaves = append(leaves, change)
+			return
+		}
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			leaf := diff.Change{Type: change.Type, Path: appendPath(change.Path, key)}
+			if change.From == nil {
+				leaf.To = value[key]
+			} else {
+				leaf.From = value[key]
+			}
+			split(leaf)
+		}
+	}
+	for _, change := range changelog {
+		split(change)
+	}
+	return leaves
+}
+
+// implicitCategory guesses the kustomize behavior behind an implicit change
+// from its path
+func implicitCategory(path []string) string {
+	under := func(prefix ...string) bool {
+		return len(path) >= len(prefix) && strings.Join(path[:len(prefix)], "\x00") == strings.Join(prefix, "\x00")
+	}
+	switch {
+	case under("metadata", "labels", "app.kubernetes.io/managed-by"):
+		return "managed-by label"
+	case under("spec", "selector"), under("spec", "template", "metadata"),
+		under("spec", "jobTemplate", "spec", "template", "metadata"), under("spec", "jobTemplate", "metadata"),
+		under("spec", "volumeClaimTemplates"):
+		return "label propagation into selectors and templates"
+	case under("metadata", "labels"), under("metadata", "annotations"):
+		return "common labels and annotations"
+	case under("metadata", "namespace"):
+		return "namespace"
+	case under("metadata", "name"):
+		return "name prefix, suffix or hash"
+	case len(path) > 0 && strings.HasSuffix(strings.ToLower(path[len(path)-1]), "name"):
+		return "name reference update"
+	}
+	return "other"
+}
+
+// pathExplained reports whether one of paths is path or a prefix of it, or
+// has path as its prefix
+func pathExplained(path []string, paths [][]string) bool {
+	for _, explaining := range paths {
+		n := len(path)
+		if len(explaining) < n {
+			n = len(explaining)
+		}
+		matches := true
+		for i := 0; i < n; i++ {
+			if path[i] != explaining[i] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
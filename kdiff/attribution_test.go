@@ -0,0 +1,31 @@
+package kdiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathExplained(t *testing.T) {
+	explaining := [][]string{
+		{"spec", "replicas"},
+		{"metadata", "labels", "app"},
+	}
+	assert.True(t, pathExplained([]string{"spec", "replicas"}, explaining))
+	assert.True(t, pathExplained([]string{"metadata", "labels"}, explaining), "A change below the path explains it")
+	assert.True(t, pathExplained([]string{"metadata", "labels", "app", "x"}, explaining), "A change above the path explains it")
+	assert.False(t, pathExplained([]string{"spec", "paused"}, explaining))
+	assert.False(t, pathExplained([]string{"metadata", "annotations"}, explaining))
+	assert.False(t, pathExplained([]string{"spec"}, nil))
+}
+
+func TestLastChanges(t *testing.T) {
+	changes := []FieldSource{
+		{Path: []string{"spec", "replicas"}, New: int64(2)},
+		{Path: []string{"metadata", "labels", "app"}, New: "web"},
+		{Path: []string{"spec", "replicas"}, New: int64(3)},
+		{Path: []string{"metadata", "labels"}, New: map[string]interface{}{"app": "shop"}},
+		{Path: []string{"spec", "template", "spec", "containers", "1"}},
+	}
+	assert.Equal(t, []FieldSource{changes[2], changes[3]}, lastChanges(changes), "Only the last change at a path, and no list removals, are checked")
+}
@@ -0,0 +1,90 @@
+package kdiff
+
+import (
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+)
+
+// BaseRefResult holds the differences between the build of a base ref and
+// the build of an overlay
+type BaseRefResult struct {
+	FieldSources []FieldSource // Differences of resources in both builds, with the base ref's value as Original
+	Added        []string      // Keys of resources only the overlay has
+	Removed      []string      // Keys of resources only the base ref has
+	Unchanged    int           // Resources skipped because their YAML is identical in both, unless Options.CompareAll is set
+}
+
+// DiffBaseRef builds baseDir as the before state and dir as the after state,
+// and compares them resource by resource. Unlike Diff, the baseline is
+// whatever baseDir renders, not the overlay's own resources, e.g. a released
+// base checked out elsewhere. Changes aren't attributed to patches.
+func DiffBaseRef(fs filesys.FileSystem, baseDir, dir string, opts Options) (*BaseRefResult, error) {
+	r := newRun(opts)
+	fs = r.contextFs(fs)
+	k := krusty.MakeKustomizer(krustyOptions(opts))
+	before, err := buildVariant(fs, k, baseDir, opts.IncludeStatus)
+	if err != nil {
+		return nil, err
+	}
+	after, err := buildVariant(fs, k, dir, opts.IncludeStatus)
+	if err != nil {
+		return nil, err
+	}
+	return r.diffVariants(before, after, baseDir, SourceTypeBaseRef)
+}
+
+// diffVariants compares two variants resource by resource, recording each
+// difference with source as its Source, and filters and masks the changes as
+// the run's options ask
+func (r *run) diffVariants(before, after map[string]variantResource, source, sourceType string) (*BaseRefResult, error) {
+	// Resources are aligned by their keys, as in the matrix
+	keys := make([]string, 0, len(after))
+	for key := range after {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := &BaseRefResult{}
+	var changes []FieldSource
+	for _, key := range keys {
+		base, exists := before[key]
+		if !exists {
+			result.Added = append(result.Added, key)
+			continue
+		}
+		if !r.opts.CompareAll && base.Hash == after[key].Hash {
+			result.Unchanged++
+			continue
+		}
+		changelog, err := r.diffObjects(base.Object, after[key].Object)
+		if err != nil {
+			return nil, fmt.Errorf("diff %s: %w", key, err)
+		}
+		for _, change := range changelog {
+			changes = append(changes, FieldSource{
+				Resource:   key,
+				Path:       change.Path,
+				Source:     source,
+				SourceType: sourceType,
+				Original:   change.From,
+				New:        change.To,
+			})
+		}
+	}
+	for key := range before {
+		if _, exists := after[key]; !exists {
+			result.Removed = append(result.Removed, key)
+		}
+	}
+	sort.Strings(result.Removed)
+
+	changes = FilterFieldSources(changes, r.opts.IncludePaths, r.opts.IgnorePaths)
+	if !r.opts.ShowSecrets {
+		changes = RedactSecrets(changes)
+	}
+	result.FieldSources = changes
+	return result, nil
+}
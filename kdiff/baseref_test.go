@@ -0,0 +1,75 @@
+package kdiff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestDiffBaseRef(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	deployment := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: web
+          image: web:%s
+`
+	files := map[string]string{
+		// The released base the overlay is compared with
+		"/release/base/kustomization.yaml": "resources:\n  - deployment.yaml\n  - config.yaml\n",
+		"/release/base/deployment.yaml":    strings.Replace(deployment, "%s", "1.0", 1),
+		"/release/base/config.yaml":        "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: legacy\n",
+		// The overlay declares the current base as its resources
+		"/app/base/kustomization.yaml": "resources:\n  - deployment.yaml\n  - service.yaml\n",
+		"/app/base/deployment.yaml":    strings.Replace(deployment, "%s", "2.0", 1),
+		"/app/base/service.yaml":       "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n",
+		"/app/prod/kustomization.yaml": `
+resources:
+  - ../base
+patches:
+  - patch: |-
+      - op: replace
+        path: /spec/replicas
+        value: 3
+    target:
+      kind: Deployment
+      name: web
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := DiffBaseRef(fs, "/release/base", "/app/prod", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Service.v1.[noGrp]/web.[noNs]"}, result.Added)
+	assert.Equal(t, []string{"ConfigMap.v1.[noGrp]/legacy.[noNs]"}, result.Removed)
+
+	changes := make(map[string]FieldSource)
+	for _, change := range result.FieldSources {
+		assert.Equal(t, "Deployment.v1.apps/web.[noNs]", change.Resource)
+		assert.Equal(t, SourceTypeBaseRef, change.SourceType)
+		changes[strings.Join(change.Path, ".")] = change
+	}
+	if assert.Contains(t, changes, "spec.replicas") {
+		assert.Equal(t, int64(1), changes["spec.replicas"].Original, "Original should come from the base ref")
+		assert.Equal(t, int64(3), changes["spec.replicas"].New)
+	}
+	if assert.Contains(t, changes, "spec.template.spec.containers.0.image") {
+		assert.Equal(t, "web:1.0", changes["spec.template.spec.containers.0.image"].Original)
+		assert.Equal(t, "web:2.0", changes["spec.template.spec.containers.0.image"].New)
+	}
+
+	result, err = DiffBaseRef(fs, "/release/base", "/app/prod", Options{IgnorePaths: []string{"spec.template"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result.FieldSources), "Ignored paths should be left out")
+}
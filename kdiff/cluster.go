@@ -0,0 +1,60 @@
+package kdiff
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// LiveSource is the Source recorded for differences against the cluster
+const LiveSource = "live cluster"
+
+// LiveGetter fetches the live object for a resource. It returns nil without an
+// error if the object doesn't exist in the cluster.
+type LiveGetter func(res *resource.Resource) (map[string]interface{}, error)
+
+// DiffLive compares each rendered resource with its live object. Differences
+// are recorded with the live value as Original and the rendered value as New.
+// Resources that don't exist in the cluster are returned separately. The
+// status of both sides is only compared with Options.IncludeStatus.
+func DiffLive(resources []*resource.Resource, get LiveGetter, opts Options) ([]FieldSource, []string, error) {
+	r := newRun(opts)
+	var changes []FieldSource
+	var missing []string
+	for _, res := range resources {
+		key := ResourceKey(res)
+
+		live, err := get(res)
+		if err != nil {
+			return nil, nil, err
+		}
+		if live == nil {
+			missing = append(missing, key)
+			continue
+		}
+
+		var rendered map[string]interface{}
+		if err := yaml.Unmarshal([]byte(res.MustYaml()), &rendered); err != nil {
+			return nil, nil, fmt.Errorf("unmarshal rendered %s: %w", key, err)
+		}
+		normalizeObject(live, opts.IncludeStatus)
+		normalizeObject(rendered, opts.IncludeStatus)
+
+		changelog, err := r.diffObjects(live, rendered)
+		if err != nil {
+			return nil, nil, fmt.Errorf("diff %s: %w", key, err)
+		}
+		for _, change := range changelog {
+			changes = append(changes, FieldSource{
+				Resource:   key,
+				Path:       change.Path,
+				Source:     LiveSource,
+				SourceType: SourceTypeLive,
+				Original:   change.From,
+				New:        change.To,
+			})
+		}
+	}
+	return changes, missing, nil
+}
@@ -0,0 +1,104 @@
+package kdiff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/resource"
+)
+
+func TestDiffLive(t *testing.T) {
+	factory := resource.NewFactory(nil)
+	deployment, err := factory.FromBytes([]byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 3
+`))
+	assert.NoError(t, err)
+	service, err := factory.FromBytes([]byte(`
+apiVersion: v1
+kind: Service
+metadata:
+  name: test
+`))
+	assert.NoError(t, err)
+
+	get := func(res *resource.Resource) (map[string]interface{}, error) {
+		if res.GetKind() != "Deployment" {
+			return nil, nil
+		}
+		return map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "test"},
+			"spec":       map[string]interface{}{"replicas": float64(1)},
+			"status":     map[string]interface{}{"readyReplicas": float64(1)},
+		}, nil
+	}
+
+	changes, missing, err := DiffLive([]*resource.Resource{deployment, service}, get, Options{IncludeStatus: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Service.v1.[noGrp]/test.[noNs]"}, missing, "Should report objects missing from the cluster")
+
+	foundReplicas := false
+	foundStatus := false
+	for _, change := range changes {
+		assert.Equal(t, LiveSource, change.Source)
+		switch strings.Join(change.Path, ".") {
+		case "spec.replicas":
+			foundReplicas = true
+			assert.Equal(t, int64(1), change.Original, "Original should be the live value")
+			assert.Equal(t, int64(3), change.New, "New should be the rendered value")
+		case "status":
+			// A block only the live object has is one change
+			foundStatus = true
+			assert.Contains(t, change.Original, "readyReplicas")
+			assert.Nil(t, change.New)
+		}
+	}
+	assert.True(t, foundReplicas, "Should report the replicas difference")
+	assert.True(t, foundStatus, "Should report live-only fields")
+
+	// Live-only fields can be ignored with the ignore-path mechanism
+	for _, change := range FilterFieldSources(changes, nil, []string{"status"}) {
+		assert.NotEqual(t, "status", change.Path[0], "Ignored status should be filtered out")
+	}
+}
+
+func TestDiffLiveStatus(t *testing.T) {
+	deployment, err := resource.NewFactory(nil).FromBytes([]byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 3
+status:
+  replicas: 0
+`))
+	assert.NoError(t, err)
+	get := func(res *resource.Resource) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "test"},
+			"spec":       map[string]interface{}{"replicas": float64(3)},
+			"status":     map[string]interface{}{"replicas": float64(3), "readyReplicas": float64(3)},
+		}, nil
+	}
+
+	changes, _, err := DiffLive([]*resource.Resource{deployment}, get, Options{})
+	assert.NoError(t, err)
+	assert.Empty(t, changes, "Status should be stripped from both sides")
+
+	changes, _, err = DiffLive([]*resource.Resource{deployment}, get, Options{IncludeStatus: true})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, changes, "Status should be compared with includeStatus")
+	for _, change := range changes {
+		assert.Equal(t, "status", change.Path[0])
+	}
+}
@@ -0,0 +1,40 @@
+package kdiff
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/resource"
+)
+
+// CompareYAML compares two rendered multi-document YAML files, e.g. the
+// output of kustomize build at two points, resource by resource without
+// building anything. Resources are matched by ResourceKey; Added and Removed
+// list those only in after or before.
+func CompareYAML(fs filesys.FileSystem, before, after string, opts Options) (*BaseRefResult, error) {
+	r := newRun(opts)
+	fs = r.contextFs(fs)
+	beforeVariant, err := loadRenderedVariant(fs, before, opts.IncludeStatus)
+	if err != nil {
+		return nil, err
+	}
+	afterVariant, err := loadRenderedVariant(fs, after, opts.IncludeStatus)
+	if err != nil {
+		return nil, err
+	}
+	return r.diffVariants(beforeVariant, afterVariant, before, SourceTypeCompareYAML)
+}
+
+// loadRenderedVariant reads the resources of a rendered YAML file, keyed like
+// built variants
+func loadRenderedVariant(fs filesys.FileSystem, path string, includeStatus bool) (map[string]variantResource, error) {
+	data, err := fs.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	resources, err := resource.NewFactory(nil).SliceFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load resources from %s: %w", path, err)
+	}
+	return makeVariant(resources, includeStatus)
+}
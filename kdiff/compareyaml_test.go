@@ -0,0 +1,83 @@
+package kdiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestCompareYAML(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/out/before.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+spec:
+  replicas: 1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: staging
+spec:
+  replicas: 1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: old
+data:
+  key: value
+`,
+		"/out/after.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: new
+data:
+  key: value
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: staging
+spec:
+  replicas: 1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+spec:
+  replicas: 3
+status:
+  readyReplicas: 3
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := CompareYAML(fs, "/out/before.yaml", "/out/after.yaml", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []FieldSource{{
+		Resource:   "Deployment.v1.apps/web.prod",
+		Path:       []string{"spec", "replicas"},
+		Source:     "/out/before.yaml",
+		SourceType: SourceTypeCompareYAML,
+		Original:   int64(1),
+		New:        int64(3),
+	}}, result.FieldSources, "Resources are matched by namespace too, and status is left out")
+	assert.Equal(t, []string{"ConfigMap.v1.[noGrp]/new.[noNs]"}, result.Added)
+	assert.Equal(t, []string{"ConfigMap.v1.[noGrp]/old.[noNs]"}, result.Removed)
+
+	_, err = CompareYAML(fs, "/out/before.yaml", "/out/missing.yaml", Options{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package kdiff
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/yaml"
+)
+
+// component is a kustomization of kind Component, as builds of the
+// kustomizations including it read it: without its patches
+type component struct {
+	dir, kustPath string
+	kust          types.Kustomization
+}
+
+// withoutPatches returns kust without its patches, which are applied and
+// attributed separately
+func withoutPatches(kust types.Kustomization) types.Kustomization {
+	kust.Patches = nil
+	kust.PatchesJson6902 = nil
+	kust.PatchesStrategicMerge = nil
+	// kustomize rejects empty kustomizations, e.g. a component that only
+	// patches, and empty metadata keeps it from being empty
+	if kust.CheckEmpty() != nil {
+		kust.MetaData = &types.ObjectMeta{}
+	}
+	return kust
+}
+
+// includedComponents reads the local components kust, the kustomization in
+// dir, includes, and the components they include in turn, in the order
+// kustomize applies them
+func includedComponents(fs filesys.FileSystem, dir string, kust *types.Kustomization) ([]component, error) {
+	var components []component
+	for _, entry := range kust.Components {
+		if isRemoteResource(entry) {
+			continue
+		}
+		compDir := filepath.Join(dir, entry)
+		kustPath, data, err := readKustomizationFile(fs, compDir)
+		if err != nil {
+			return nil, err
+		}
+		var compKust types.Kustomization
+		if err := yaml.Unmarshal(data, &compKust); err != nil {
+			return nil, fmt.Errorf("failed parsing kustomization.yaml at %s: %w", compDir, err)
+		}
+		nested, err := includedComponents(fs, compDir, &compKust)
+		if err != nil {
+			return nil, err
+		}
+		components = append(components, nested...)
+		components = append(components, component{dir: compDir, kustPath: kustPath, kust: withoutPatches(compKust)})
+	}
+	return components, nil
+}
+
+// attributeComponents records the generators and transformers of the
+// components included by kust, the kustomization at kustPath in dir.
+// Components only build as part of the kustomization including them, so
+// each transformer's changes are the difference between builds of dir with
+// the component's transformers up to it. built is the build of kust, which
+// the records are keyed by.
+func (r *run) attributeComponents(fs filesys.FileSystem, k *krusty.Kustomizer, dir, kustPath string, kust *types.Kustomization, built resmap.ResMap) ([]FieldSource, []GeneratedResource, error) {
+	components, err := includedComponents(fs, dir, kust)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var changes []FieldSource
+	var generated []GeneratedResource
+	keys := resourceKeys(built)
+	for _, comp := range components {
+		generated = append(generated, collectGenerated(&comp.kust, comp.kustPath, built)...)
+		if len(comp.kust.Transformers) == 0 {
+			continue
+		}
+
+		// Builds read the component's kustomization from the override
+		// registry, so it's swapped for the partial one during each
+		registered, wasRegistered := r.unpatchedKustomizations[overridePath(comp.kustPath)]
+		build := func(n int) (resmap.ResMap, error) {
+			partial := comp.kust
+			partial.Transformers = comp.kust.Transformers[:n]
+			if err := r.registerUnpatched(comp.kustPath, &partial); err != nil {
+				return nil, err
+			}
+			return r.buildDeclarationOrder(fs, k, dir, kustPath, kust)
+		}
+		compChanges, err := r.diffTransformerBuilds(fs, comp.dir, comp.kust.Transformers, keys, build)
+		if wasRegistered {
+			r.unpatchedKustomizations[overridePath(comp.kustPath)] = registered
+		} else {
+			delete(r.unpatchedKustomizations, overridePath(comp.kustPath))
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("component %s: %w", comp.dir, err)
+		}
+		changes = append(changes, compChanges...)
+	}
+	return changes, generated, nil
+}
@@ -0,0 +1,108 @@
+package kdiff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/r3labs/diff/v3"
+)
+
+// Differ computes the changes between two decoded objects, e.g. a resource
+// before and after a patch
+type Differ interface {
+	Diff(a, b interface{}) (diff.Changelog, error)
+}
+
+// Diff backends selectable with -diff-lib
+const (
+	DiffLibR3labs = "r3labs" // github.com/r3labs/diff, the default
+	DiffLibGodiff = "godiff" // mapDiffer
+)
+
+// NewDiffer returns the diff backend named lib
+func NewDiffer(lib string) (Differ, error) {
+	switch lib {
+	case "", DiffLibR3labs:
+		return r3labsDiffer{}, nil
+	case DiffLibGodiff:
+		return mapDiffer{}, nil
+	}
+	return nil, fmt.Errorf("unknown diff library %q (expected %s or %s)", lib, DiffLibR3labs, DiffLibGodiff)
+}
+
+// r3labsDiffer diffs with r3labs/diff, which compares lists as unordered:
+// reordering a list isn't a change, and a changed element is removed at its
+// old index and created at its new one
+type r3labsDiffer struct{}
+
+func (r3labsDiffer) Diff(a, b interface{}) (diff.Changelog, error) {
+	return diff.Diff(a, b)
+}
+
+// mapDiffer recursively diffs decoded YAML. Maps are compared key by key in
+// sorted order and lists index by index, so a reordered list changes at each
+// index that moved; an added or removed key or element is one change holding
+// its whole value.
+type mapDiffer struct{}
+
+func (mapDiffer) Diff(a, b interface{}) (diff.Changelog, error) {
+	var changelog diff.Changelog
+	diffValues(nil, a, b, &changelog)
+	return changelog, nil
+}
+
+// diffValues appends the changes from a to b at path to changelog
+func diffValues(path []string, a, b interface{}, changelog *diff.Changelog) {
+	at := func(segment string) []string {
+		return append(append([]string{}, path...), segment)
+	}
+
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(a)+len(b))
+			for key := range a {
+				keys = append(keys, key)
+			}
+			for key := range b {
+				if _, exists := a[key]; !exists {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				before, inA := a[key]
+				after, inB := b[key]
+				switch {
+				case !inA:
+					*changelog = append(*changelog, diff.Change{Type: diff.CREATE, Path: at(key), To: after})
+				case !inB:
+					*changelog = append(*changelog, diff.Change{Type: diff.DELETE, Path: at(key), From: before})
+				default:
+					diffValues(at(key), before, after, changelog)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok {
+			for i := 0; i < len(a) || i < len(b); i++ {
+				switch {
+				case i >= len(a):
+					*changelog = append(*changelog, diff.Change{Type: diff.CREATE, Path: at(strconv.Itoa(i)), To: b[i]})
+				case i >= len(b):
+					*changelog = append(*changelog, diff.Change{Type: diff.DELETE, Path: at(strconv.Itoa(i)), From: a[i]})
+				default:
+					diffValues(at(strconv.Itoa(i)), a[i], b[i], changelog)
+				}
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*changelog = append(*changelog, diff.Change{Type: diff.UPDATE, Path: path, From: a, To: b})
+	}
+}
@@ -0,0 +1,132 @@
+package kdiff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/r3labs/diff/v3"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestDiffers(t *testing.T) {
+	before := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": float64(1),
+			"paused":   true,
+			"args":     []interface{}{"a", "b"},
+			"old":      map[string]interface{}{"x": "y"},
+		},
+	}
+	after := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": float64(3),
+			"args":     []interface{}{"a", "c", "d"},
+			"new":      map[string]interface{}{"p": "q", "r": "s"},
+		},
+	}
+
+	changes := func(lib string) map[string]diff.Change {
+		d, err := NewDiffer(lib)
+		assert.NoError(t, err)
+		changelog, err := d.Diff(before, after)
+		assert.NoError(t, err)
+		byPath := make(map[string]diff.Change)
+		for _, change := range changelog {
+			byPath[strings.Join(change.Path, ".")] = change
+		}
+		return byPath
+	}
+
+	// Both backends agree on scalars, list elements, and added and removed
+	// maps, which are one change holding the whole map
+	for _, lib := range []string{DiffLibR3labs, DiffLibGodiff} {
+		byPath := changes(lib)
+		assert.Equal(t, 6, len(byPath), lib)
+		assert.Equal(t, diff.Change{Type: diff.UPDATE, Path: []string{"spec", "replicas"}, From: float64(1), To: float64(3)}, byPath["spec.replicas"], lib)
+		assert.Equal(t, diff.Change{Type: diff.DELETE, Path: []string{"spec", "paused"}, From: true}, byPath["spec.paused"], lib)
+		assert.Equal(t, diff.Change{Type: diff.UPDATE, Path: []string{"spec", "args", "1"}, From: "b", To: "c"}, byPath["spec.args.1"], lib)
+		assert.Equal(t, diff.Change{Type: diff.CREATE, Path: []string{"spec", "args", "2"}, To: "d"}, byPath["spec.args.2"], lib)
+		assert.Equal(t, map[string]interface{}{"p": "q", "r": "s"}, byPath["spec.new"].To, lib)
+		assert.Equal(t, map[string]interface{}{"x": "y"}, byPath["spec.old"].From, lib)
+	}
+
+	// r3labs compares lists ignoring order, godiff index by index
+	reordered := map[string]interface{}{"ports": []interface{}{int64(80), int64(443)}}
+	swapped := map[string]interface{}{"ports": []interface{}{int64(443), int64(80)}}
+	d, err := NewDiffer(DiffLibR3labs)
+	assert.NoError(t, err)
+	changelog, err := d.Diff(reordered, swapped)
+	assert.NoError(t, err)
+	assert.Empty(t, changelog)
+
+	d, err = NewDiffer(DiffLibGodiff)
+	assert.NoError(t, err)
+	changelog, err = d.Diff(reordered, swapped)
+	assert.NoError(t, err)
+	assert.Equal(t, diff.Changelog{
+		{Type: diff.UPDATE, Path: []string{"ports", "0"}, From: int64(80), To: int64(443)},
+		{Type: diff.UPDATE, Path: []string{"ports", "1"}, From: int64(443), To: int64(80)},
+	}, changelog)
+
+	_, err = NewDiffer("jsondiff")
+	assert.Error(t, err)
+}
+
+func TestDiffWithGodiff(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - patch: |-
+      - op: replace
+        path: /spec/replicas
+        value: 2
+      - op: replace
+        path: /spec/template/spec/containers/0/args
+        value: ["--verbose", "--port=80"]
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1.0
+        args: ["--port=80", "--verbose"]
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	// Reordering the args is no change to r3labs, but one at each index to
+	// godiff
+	paths := make(map[string][]string)
+	for _, lib := range []string{DiffLibR3labs, DiffLibGodiff} {
+		d, err := NewDiffer(lib)
+		assert.NoError(t, err)
+		result, err := Diff(fs, "/app", Options{Differ: d, BuildFinal: true})
+		assert.NoError(t, err, lib)
+		assert.Empty(t, result.Unattributed, lib)
+		for _, change := range result.Changelogs[0] {
+			paths[lib] = append(paths[lib], strings.Join(change.Path, "."))
+		}
+	}
+	assert.Equal(t, []string{"spec.replicas"}, paths[DiffLibR3labs])
+	assert.Equal(t, []string{
+		"spec.replicas",
+		"spec.template.spec.containers.0.args.0",
+		"spec.template.spec.containers.0.args.1",
+	}, paths[DiffLibGodiff])
+}
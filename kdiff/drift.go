@@ -0,0 +1,95 @@
+package kdiff
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// checkBaseDrift builds dir, as given by kust without patches, with origin
+// annotations and compares each resource with the one declared in the file
+// kustomize says it came from. The differences are what kustomize did to the
+// base that loading the files doesn't see, e.g. a namePrefix. Generated and
+// remote resources, and files declaring several resources of a kind, aren't
+// compared.
+func (r *run) checkBaseDrift(fs filesys.FileSystem, k *krusty.Kustomizer, dir, kustPath string, kust *types.Kustomization, declared map[string]*resource.Resource) ([]FieldSource, error) {
+	annotated := *kust
+	annotated.BuildMetadata = []string{types.OriginAnnotations}
+	for _, option := range kust.BuildMetadata {
+		if option != types.OriginAnnotations {
+			annotated.BuildMetadata = append(annotated.BuildMetadata, option)
+		}
+	}
+	resMap, err := r.buildOverride(fs, k, dir, kustPath, &annotated)
+	if err != nil {
+		return nil, fmt.Errorf("build with origin annotations: %w", err)
+	}
+
+	// Declared resources by file and kind
+	byFile := make(map[string][]string)
+	for key, path := range r.resourceOrigins {
+		if _, exists := declared[key]; exists {
+			byFile[filepath.Clean(path)] = append(byFile[filepath.Clean(path)], key)
+		}
+	}
+
+	var changes []FieldSource
+	for _, res := range resMap.Resources() {
+		key := ResourceKey(res)
+		data, exists := res.GetAnnotations()[OriginAnnotation]
+		if !exists {
+			continue
+		}
+		var origin ResourceOrigin
+		if err := yaml.Unmarshal([]byte(data), &origin); err != nil {
+			return nil, fmt.Errorf("parsing origin of %s: %w", key, err)
+		}
+		if origin.Path == "" || origin.Repo != "" {
+			continue
+		}
+		file := filepath.Join(dir, origin.Path)
+
+		var base *resource.Resource
+		for _, declaredKey := range byFile[file] {
+			if candidate := declared[declaredKey]; candidate.GetKind() == res.GetKind() {
+				if base != nil {
+					base = nil
+					break
+				}
+				base = candidate
+			}
+		}
+		if base == nil {
+			continue
+		}
+
+		built := res.DeepCopy()
+		if err := built.PipeE(kyaml.ClearAnnotation(OriginAnnotation)); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if err := kyaml.ClearEmptyAnnotations(&built.RNode); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		changelog, err := r.diffFinal(key, base, built)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range changelog {
+			changes = append(changes, FieldSource{
+				Resource:   key,
+				Path:       change.Path,
+				Source:     file,
+				SourceType: SourceTypeBaseDrift,
+				Original:   change.From,
+				New:        change.To,
+			})
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,32 @@
+package kdiff
+
+// FieldSource tracks where a field value came from
+type FieldSource struct {
+	Resource   string   // The resource being modified, by ResourceKey
+	Path       []string // The field path that changed
+	Source     string   // The patch file that caused the change
+	Element    string   // Identity of the list element Path indexes before the change, e.g. name=web
+	SourceType string   // What kind of source made the change, one of the SourceType* values
+	Original   interface{}
+	New        interface{}
+}
+
+// Source types recorded in FieldSource.SourceType. Transformer changes use
+// SourceTypeTransformer followed by the kustomization field configuring the
+// transformer, e.g. transformer:images or transformer:namespace, or for
+// transformers: entries the plugin config's kind, e.g.
+// transformer:PrefixSuffixTransformer. The fields of resources generated by
+// generators: entries use SourceTypeGenerator followed by the config's kind.
+const (
+	SourceTypePatch          = "patch"
+	SourceTypeJSONPatch      = "jsonPatch"
+	SourceTypeTransformer    = "transformer:"
+	SourceTypeGenerator      = "generator:"
+	SourceTypeLive           = "live"
+	SourceTypeUnattributed   = "unattributed"
+	SourceTypeBaseRef        = "baseRef"
+	SourceTypeGeneratorMerge = "generatorMerge"
+	SourceTypeImplicit       = "implicit"
+	SourceTypeCompareYAML    = "compareYAML"
+	SourceTypeBaseDrift      = "baseDrift"
+)
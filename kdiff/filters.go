@@ -0,0 +1,143 @@
+package kdiff
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/resource"
+)
+
+// dedupeFieldSources removes identical records, keeping the first occurrence
+func dedupeFieldSources(sources []FieldSource) []FieldSource {
+	seen := make(map[string]bool)
+	deduped := make([]FieldSource, 0, len(sources))
+	for _, source := range sources {
+		// %#v prints map keys sorted, so equal values give equal keys
+		key := fmt.Sprintf("%s\x00%#v\x00%s\x00%s\x00%#v\x00%#v",
+			source.Resource, source.Path, source.Source, source.Element, source.Original, source.New)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		deduped = append(deduped, source)
+	}
+	return deduped
+}
+
+// MatchesPathGlob reports whether a change touches a field matching a dotted
+// path glob, where each segment may use path.Match wildcards. Strategic merge
+// records are kept at their top-level key, so a record on a parent of the
+// pattern matches if the value under the pattern's literal prefix changed.
+func MatchesPathGlob(pattern string, change FieldSource) bool {
+	segments := strings.Split(pattern, ".")
+	for i, key := range change.Path {
+		if i >= len(segments) {
+			// The change is below the pattern, e.g. spec.* vs spec.a.b
+			return false
+		}
+		if ok, _ := path.Match(segments[i], key); !ok {
+			return false
+		}
+	}
+	if len(change.Path) == len(segments) {
+		return true
+	}
+
+	// The change is on a parent of the pattern; compare the values under the
+	// pattern's literal prefix
+	var literal []string
+	for _, segment := range segments[len(change.Path):] {
+		if strings.ContainsAny(segment, "*?[\\") {
+			break
+		}
+		literal = append(literal, segment)
+	}
+	return !reflect.DeepEqual(NormalizeScalars(GetValueAtPath(change.Original, literal)), NormalizeScalars(GetValueAtPath(change.New, literal)))
+}
+
+// coversPathGlob reports whether a change is at or below a field matching a
+// dotted path glob
+func coversPathGlob(pattern string, change FieldSource) bool {
+	segments := strings.Split(pattern, ".")
+	if len(change.Path) < len(segments) {
+		return false
+	}
+	for i, segment := range segments {
+		if ok, _ := path.Match(segment, change.Path[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterFieldSources keeps the changes matching one of the include globs (all
+// changes if there are none) and drops those covered by an ignore glob
+func FilterFieldSources(sources []FieldSource, includes, ignores []string) []FieldSource {
+	var filtered []FieldSource
+	for _, source := range sources {
+		included := len(includes) == 0
+		for _, pattern := range includes {
+			if MatchesPathGlob(pattern, source) || coversPathGlob(pattern, source) {
+				included = true
+				break
+			}
+		}
+		for _, pattern := range ignores {
+			if coversPathGlob(pattern, source) {
+				included = false
+				break
+			}
+		}
+		if included {
+			filtered = append(filtered, source)
+		}
+	}
+	return filtered
+}
+
+// kindSet returns the canonical kinds named by -kind-allowlist or -ignore-kind
+// entries, each of which may hold a comma-separated list
+func kindSet(entries []string) map[string]bool {
+	kinds := make(map[string]bool)
+	for _, entry := range entries {
+		for _, kind := range strings.Split(entry, ",") {
+			if kind = strings.TrimSpace(kind); kind != "" {
+				kind, _ = CanonicalKind(kind)
+				kinds[kind] = true
+			}
+		}
+	}
+	return kinds
+}
+
+// filterByKind returns the resources whose kind is included
+func filterByKind(allResources map[string]*resource.Resource, included func(kind string) bool) map[string]*resource.Resource {
+	filtered := make(map[string]*resource.Resource)
+	for key, res := range allResources {
+		if included(res.GetKind()) {
+			filtered[key] = res
+		}
+	}
+	return filtered
+}
+
+// filterByNamespace returns the resources in the given namespace. Cluster-scoped
+// resources are only kept if includeClusterScoped is set.
+func filterByNamespace(allResources map[string]*resource.Resource, namespace string, includeClusterScoped bool) map[string]*resource.Resource {
+	filtered := make(map[string]*resource.Resource)
+	for key, res := range allResources {
+		if res.GetGvk().IsClusterScoped() {
+			if includeClusterScoped {
+				filtered[key] = res
+			}
+			continue
+		}
+		// Keys hold the namespace resources end up in
+		if id, ok := ParseResourceKey(key); ok && id.Namespace == namespace {
+			filtered[key] = res
+		}
+	}
+	return filtered
+}
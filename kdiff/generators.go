@@ -0,0 +1,169 @@
+package kdiff
+
+import (
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+)
+
+// GeneratedResource describes a ConfigMap or Secret produced by a generator
+// and the generator options that shaped it
+type GeneratedResource struct {
+	Resource    string            // The key of the generated resource as built
+	Name        string            // The name the generator declares, without prefix, suffix or hash
+	Generator   string            // configMapGenerator or secretGenerator
+	Source      string            // The kustomization.yaml declaring the generator
+	NameHashed  bool              // Whether a content hash suffix was added to the name
+	Labels      map[string]string // Labels injected by generator options
+	Annotations map[string]string // Annotations injected by generator options
+}
+
+// collectGenerated matches the generators declared in the kustomization file
+// at kustPath to the resources they produced in resMap
+func collectGenerated(kust *types.Kustomization, kustPath string, resMap resmap.ResMap) []GeneratedResource {
+	var generated []GeneratedResource
+	collect := func(generator, kind string, args types.GeneratorArgs) {
+		opts := generatorOptions(kust.GeneratorOptions, args.Options)
+		baseName := kust.NamePrefix + args.Name + kust.NameSuffix
+		for _, res := range resMap.Resources() {
+			if res.GetKind() != kind {
+				continue
+			}
+			name := res.GetName()
+			if name != baseName && !strings.HasPrefix(name, baseName+"-") {
+				continue
+			}
+			// A hashed name is only expected when hashing is enabled
+			if (name == baseName) == !opts.DisableNameSuffixHash {
+				continue
+			}
+			generated = append(generated, GeneratedResource{
+				Resource:    ResourceKey(res),
+				Name:        args.Name,
+				Generator:   generator,
+				Source:      kustPath,
+				NameHashed:  !opts.DisableNameSuffixHash,
+				Labels:      opts.Labels,
+				Annotations: opts.Annotations,
+			})
+			return
+		}
+	}
+
+	for _, args := range kust.ConfigMapGenerator {
+		collect("configMapGenerator", "ConfigMap", args.GeneratorArgs)
+	}
+	for _, args := range kust.SecretGenerator {
+		collect("secretGenerator", "Secret", args.GeneratorArgs)
+	}
+	return generated
+}
+
+// attributeGeneratorMerges records the labels and annotations that the
+// behavior: merge generators of kust, declared in kustPath, add to or
+// override on the resources generated by a base. base holds the resources
+// before built, the build of kust, replaced them.
+func attributeGeneratorMerges(kust *types.Kustomization, kustPath string, baseGenerated []GeneratedResource, base map[string]*resource.Resource, built resmap.ResMap) []FieldSource {
+	merged := collectGenerated(kust, kustPath, built)
+
+	var changes []FieldSource
+	attribute := func(kind string, args types.GeneratorArgs) {
+		if args.Behavior != "merge" {
+			return
+		}
+		// The resource the closest base generated under this name
+		var original *resource.Resource
+		for _, gen := range baseGenerated {
+			if keyKind(gen.Resource) == kind && gen.Name == args.Name && base[gen.Resource] != nil {
+				original = base[gen.Resource]
+			}
+		}
+		var key string
+		for _, gen := range merged {
+			if keyKind(gen.Resource) == kind && gen.Name == args.Name {
+				key = gen.Resource
+			}
+		}
+		if original == nil || key == "" {
+			return
+		}
+
+		opts := generatorOptions(kust.GeneratorOptions, args.Options)
+		record := func(field string, before, after map[string]string) {
+			for _, name := range sortedKeys(after) {
+				previous, existed := before[name]
+				if existed && previous == after[name] {
+					continue
+				}
+				change := FieldSource{
+					Resource:   key,
+					Path:       []string{"metadata", field, name},
+					Source:     kustPath,
+					SourceType: SourceTypeGeneratorMerge,
+					New:        after[name],
+				}
+				if existed {
+					change.Original = previous
+				}
+				changes = append(changes, change)
+			}
+		}
+		record("labels", original.GetLabels(), opts.Labels)
+		record("annotations", original.GetAnnotations(), opts.Annotations)
+	}
+
+	for _, args := range kust.ConfigMapGenerator {
+		attribute("ConfigMap", args.GeneratorArgs)
+	}
+	for _, args := range kust.SecretGenerator {
+		attribute("Secret", args.GeneratorArgs)
+	}
+	return changes
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// generatedTarget resolves a patch target naming a generated resource by its
+// declared name, as kustomize matches patches before adding the hash suffix,
+// to a copy selecting the resource as built, e.g. ConfigMap/settings to
+// ConfigMap/settings-5f8k2h9b, by its name among resources. It returns false
+// if no generator declares the name.
+func generatedTarget(generated []GeneratedResource, resources map[string]*resource.Resource, target *types.Selector) (*types.Selector, bool) {
+	if target == nil || target.Name == "" {
+		return nil, false
+	}
+	kind, _ := CanonicalKind(target.Kind)
+	for _, gen := range generated {
+		res, exists := resources[gen.Resource]
+		if !exists || gen.Name != target.Name || (target.Kind != "" && res.GetKind() != kind) {
+			continue
+		}
+		resolved := *target
+		resolved.Name = res.GetName()
+		return &resolved, true
+	}
+	return nil, false
+}
+
+// generatorOptions merges a generator's own options with the kustomization's
+// generatorOptions the way kustomize does, without modifying either
+func generatorOptions(global, local *types.GeneratorOptions) *types.GeneratorOptions {
+	merged := &types.GeneratorOptions{}
+	if local != nil {
+		*merged = *local
+		merged.Labels = types.CopyMap(local.Labels)
+		merged.Annotations = types.CopyMap(local.Annotations)
+	}
+	return types.MergeGlobalOptionsIntoLocal(merged, global)
+}
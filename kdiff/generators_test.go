@@ -0,0 +1,115 @@
+package kdiff
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+)
+
+func TestGeneratorOptionsNameHash(t *testing.T) {
+	r := newRun(Options{})
+
+	for _, disableHash := range []bool{true, false} {
+		// Create a temporary directory for test files
+		tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
+		assert.NoError(t, err)
+		defer os.RemoveAll(tmpDir)
+
+		kustContent := `
+configMapGenerator:
+  - name: app-config
+    literals:
+      - LOG_LEVEL=debug
+generatorOptions:
+  labels:
+    generated: "true"
+`
+		if disableHash {
+			kustContent += "  disableNameSuffixHash: true\n"
+		}
+		err = os.WriteFile(filepath.Join(tmpDir, "kustomization.yaml"), []byte(kustContent), 0644)
+		assert.NoError(t, err)
+
+		r.generatedResources = nil
+		fs := filesys.MakeFsOnDisk()
+		k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+		allPatches := make([]types.Patch, 0)
+		allResources := make(map[string]*resource.Resource)
+
+		r.processKustomization(fs, k, tmpDir, types.LoadRestrictionsRootOnly, &allPatches, allResources)
+
+		assert.Equal(t, 1, len(r.generatedResources), "Should attribute the generated ConfigMap")
+		gen := r.generatedResources[0]
+		assert.Equal(t, "configMapGenerator", gen.Generator)
+		assert.Equal(t, filepath.Join(tmpDir, "kustomization.yaml"), gen.Source)
+		assert.Equal(t, map[string]string{"generated": "true"}, gen.Labels, "Should report labels from generator options")
+		if disableHash {
+			assert.False(t, gen.NameHashed)
+			assert.Equal(t, "ConfigMap.v1.[noGrp]/app-config.[noNs]", gen.Resource, "Name should have no hash suffix")
+		} else {
+			assert.True(t, gen.NameHashed)
+			assert.True(t, strings.HasPrefix(gen.Resource, "ConfigMap.v1.[noGrp]/app-config-"), "Name should have a hash suffix")
+		}
+	}
+}
+
+func TestDiffGeneratorMergeLabels(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/base/kustomization.yaml": `
+configMapGenerator:
+  - name: settings
+    literals:
+      - LOG_LEVEL=debug
+    options:
+      labels:
+        tier: frontend
+`,
+		"/app/overlay/kustomization.yaml": `
+resources:
+  - ../base
+configMapGenerator:
+  - name: settings
+    behavior: merge
+    literals:
+      - LOG_LEVEL=info
+    options:
+      labels:
+        tier: backend
+        team: web
+      annotations:
+        owner: platform
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app/overlay", Options{})
+	assert.NoError(t, err)
+	var merges []FieldSource
+	for _, change := range result.FieldSources {
+		if change.SourceType == SourceTypeGeneratorMerge {
+			merges = append(merges, change)
+		}
+	}
+	if assert.Equal(t, 3, len(merges)) {
+		assert.True(t, strings.HasPrefix(merges[0].Resource, "ConfigMap.v1.[noGrp]/settings-"), "Should record changes on the merged resource")
+		assert.Equal(t, "/app/overlay/kustomization.yaml", merges[0].Source)
+		assert.Equal(t, []string{"metadata", "labels", "team"}, merges[0].Path)
+		assert.Nil(t, merges[0].Original, "Should record added labels")
+		assert.Equal(t, "web", merges[0].New)
+		assert.Equal(t, []string{"metadata", "labels", "tier"}, merges[1].Path)
+		assert.Equal(t, "frontend", merges[1].Original, "Should record overridden labels")
+		assert.Equal(t, "backend", merges[1].New)
+		assert.Equal(t, []string{"metadata", "annotations", "owner"}, merges[2].Path)
+		assert.Equal(t, "platform", merges[2].New)
+	}
+}
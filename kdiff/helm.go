@@ -0,0 +1,60 @@
+package kdiff
+
+import (
+	"path/filepath"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultHelmCommand is the helm binary used when -helm-command isn't set
+const DefaultHelmCommand = "helm"
+
+// enableHelm turns on Helm chart inflation in the krusty options
+func enableHelm(opts *krusty.Options, command string) {
+	if command == "" {
+		command = DefaultHelmCommand
+	}
+	opts.PluginConfig.HelmConfig.Enabled = true
+	opts.PluginConfig.HelmConfig.Command = command
+}
+
+// helmChartsKustomization returns the path of the first kustomization file
+// that inflates helm charts, among the one in dir and the local
+// kustomizations it references through resources and components, or "" if
+// none does. checked holds the directories already walked.
+func (r *run) helmChartsKustomization(fs filesys.FileSystem, dir string, checked map[string]bool) string {
+	canonical := r.canonicalPath(fs, dir)
+	if checked[canonical] {
+		return ""
+	}
+	checked[canonical] = true
+
+	// Unreadable kustomizations are reported by the build
+	kustPath, kustData, err := readKustomizationFile(fs, dir)
+	if err != nil {
+		return ""
+	}
+	var kust types.Kustomization
+	if err := yaml.Unmarshal(kustData, &kust); err != nil {
+		return ""
+	}
+	if len(kust.HelmCharts) > 0 {
+		return kustPath
+	}
+	for _, entry := range append(append([]string{}, kust.Resources...), kust.Components...) {
+		if isRemoteResource(entry) {
+			continue
+		}
+		path := filepath.Join(dir, entry)
+		if _, exists := FindKustomizationFile(fs, path); !exists {
+			continue
+		}
+		if found := r.helmChartsKustomization(fs, path, checked); found != "" {
+			return found
+		}
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package kdiff
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestDiffHelmCharts(t *testing.T) {
+	if _, err := exec.LookPath(DefaultHelmCommand); err != nil {
+		t.Skip("helm not installed")
+	}
+
+	// Create a temporary directory for test files
+	tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"kustomization.yaml": `
+helmCharts:
+  - name: app
+    releaseName: test
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      name: test
+`,
+		"charts/app/Chart.yaml": `
+apiVersion: v2
+name: app
+version: 0.1.0
+`,
+		"charts/app/templates/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  replicas: 1
+`,
+		"replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 3
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	fs := filesys.MakeFsOnDisk()
+	_, err = Diff(fs, tmpDir, Options{})
+	assert.ErrorContains(t, err, "-enable-helm", "Should ask for -enable-helm")
+
+	result, err := Diff(fs, tmpDir, Options{EnableHelm: true})
+	assert.NoError(t, err)
+	_, exists := result.Resources["Deployment.v1.apps/test.[noNs]"]
+	assert.True(t, exists, "Should collect the chart's Deployment")
+	assert.Equal(t, 1, len(result.FieldSources), "Should attribute the patch to the chart's Deployment")
+}
+
+func TestDiffNestedHelmCharts(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/base/kustomization.yaml": "helmCharts:\n  - name: app\n    releaseName: test\n",
+		"/app/prod/kustomization.yaml": "resources:\n  - ../base\n",
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	_, err := Diff(fs, "/app/prod", Options{})
+	assert.ErrorContains(t, err, "/app/base/kustomization.yaml inflates helm charts; rerun with -enable-helm", "Should name the base inflating the charts")
+}
@@ -0,0 +1,265 @@
+package kdiff
+
+import (
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+)
+
+// Kustomize matches the patches of a kustomization against its resources
+// before its own transformers run, e.g. before its namespace or namePrefix,
+// while the resources are known by their transformed keys from there on. The
+// helpers here line up the two.
+
+// builtinTransformerFields are the kustomization fields configuring builtin
+// transformers, in the order kustomize runs them after patches. clear removes
+// the field from a kustomization and reports whether it was set.
+var builtinTransformerFields = []struct {
+	name  string
+	clear func(kust *types.Kustomization) bool
+}{
+	{"namespace", func(kust *types.Kustomization) bool {
+		set := kust.Namespace != ""
+		kust.Namespace = ""
+		return set
+	}},
+	{"namePrefix", func(kust *types.Kustomization) bool {
+		set := kust.NamePrefix != ""
+		kust.NamePrefix = ""
+		return set
+	}},
+	{"nameSuffix", func(kust *types.Kustomization) bool {
+		set := kust.NameSuffix != ""
+		kust.NameSuffix = ""
+		return set
+	}},
+	{"commonLabels", func(kust *types.Kustomization) bool {
+		set := len(kust.CommonLabels) > 0
+		kust.CommonLabels = nil
+		return set
+	}},
+	{"labels", func(kust *types.Kustomization) bool {
+		set := len(kust.Labels) > 0
+		kust.Labels = nil
+		return set
+	}},
+	{"commonAnnotations", func(kust *types.Kustomization) bool {
+		set := len(kust.CommonAnnotations) > 0
+		kust.CommonAnnotations = nil
+		return set
+	}},
+	{"replicas", func(kust *types.Kustomization) bool {
+		set := len(kust.Replicas) > 0
+		kust.Replicas = nil
+		return set
+	}},
+	{imagesField, func(kust *types.Kustomization) bool {
+		set := len(kust.Images) > 0
+		kust.Images = nil
+		return set
+	}},
+	{"replacements", func(kust *types.Kustomization) bool {
+		set := len(kust.Replacements) > 0
+		kust.Replacements = nil
+		return set
+	}},
+}
+
+// IsBuiltinTransformerField reports whether name is one of
+// builtinTransformerFields
+func IsBuiltinTransformerField(name string) bool {
+	for _, field := range builtinTransformerFields {
+		if field.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutTransformers returns kust without the builtin transformer fields
+// from the i-th on and without its transformers: entries, and whether any of
+// them was set
+func withoutTransformers(kust types.Kustomization, from int) (types.Kustomization, bool) {
+	set := len(kust.Transformers) > 0
+	kust.Transformers = nil
+	for _, field := range builtinTransformerFields[from:] {
+		if field.clear(&kust) {
+			set = true
+		}
+	}
+	return kust, set
+}
+
+// buildDeclarationOrder is buildOverride keeping resources in declaration
+// order, so builds of a kustomization with different transformers line up by
+// position
+func (r *run) buildDeclarationOrder(fs filesys.FileSystem, k *krusty.Kustomizer, dir, kustPath string, kust *types.Kustomization) (resmap.ResMap, error) {
+	fifo := *kust
+	fifo.SortOptions = &types.SortOptions{Order: types.FIFOSortOrder}
+	return r.buildOverride(fs, k, dir, kustPath, &fifo)
+}
+
+// buildUntransformed builds kust, as built in declaration order into
+// transformed, without its transformers. The result lines up with
+// transformed, or is nil if the transformers add or remove resources.
+func (r *run) buildUntransformed(fs filesys.FileSystem, k *krusty.Kustomizer, dir, kustPath string, kust *types.Kustomization, transformed resmap.ResMap) (resmap.ResMap, error) {
+	untransformed, set := withoutTransformers(*kust, 0)
+	if !set {
+		return transformed, nil
+	}
+	resMap, err := r.buildDeclarationOrder(fs, k, dir, kustPath, &untransformed)
+	if err != nil {
+		return nil, err
+	}
+	if resMap.Size() != transformed.Size() {
+		r.warn(kustPath, WarningTransformerSkipped, "Transformers of %s change the number of resources, its patches are matched against the transformed resources", dir)
+		return nil, nil
+	}
+	return resMap, nil
+}
+
+// renamedKeys maps the keys of the resources of untransformed that
+// transformed knows by another key to that key
+func renamedKeys(untransformed, transformed resmap.ResMap) map[string]string {
+	renamed := make(map[string]string)
+	after := transformed.Resources()
+	for j, res := range untransformed.Resources() {
+		if before, key := ResourceKey(res), ResourceKey(after[j]); before != key {
+			renamed[before] = key
+		}
+	}
+	return renamed
+}
+
+// patchScope holds the resources of a nested kustomization as its patches,
+// from the collected patch from up to to, see them: before the
+// transformers of the kustomization, by their key in the run
+type patchScope struct {
+	from, to  int
+	resources map[string]*resource.Resource
+}
+
+// scopeOf returns the resources patch i of the run sees, or nil if it sees
+// them all as they are
+func (r *run) scopeOf(i int) map[string]*resource.Resource {
+	for _, scope := range r.patchScopes {
+		if i >= scope.from && i < scope.to {
+			return scope.resources
+		}
+	}
+	return nil
+}
+
+// kustomizationMark records the run state when the processing of a
+// kustomization starts, so what its resources add can be rekeyed once its
+// transformers rename them
+type kustomizationMark struct {
+	sources, generated, scopes int
+	origins, resources         map[string]bool // Keys of resourceOrigins, which declaredResources shares, and of the run's resources
+}
+
+// markKustomization records the run state before processing a kustomization
+// with the resources of the run so far
+func (r *run) markKustomization(allResources map[string]*resource.Resource) kustomizationMark {
+	mark := kustomizationMark{
+		sources:   len(r.fieldSources),
+		generated: len(r.generatedResources),
+		scopes:    len(r.patchScopes),
+		origins:   make(map[string]bool),
+		resources: make(map[string]bool),
+	}
+	for key := range r.resourceOrigins {
+		mark.origins[key] = true
+	}
+	for key := range allResources {
+		mark.resources[key] = true
+	}
+	return mark
+}
+
+// loaded returns the keys of the resources added to allResources since the
+// mark
+func (m kustomizationMark) loaded(allResources map[string]*resource.Resource) map[string]bool {
+	keys := make(map[string]bool)
+	for key := range allResources {
+		if !m.resources[key] {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// rekey moves the records, origins, declared resources and patch scopes added
+// since mark from the keys in renamed to the new ones
+func (r *run) rekey(m kustomizationMark, renamed map[string]string) {
+	if len(renamed) == 0 {
+		return
+	}
+	for i := m.sources; i < len(r.fieldSources); i++ {
+		if key, ok := renamed[r.fieldSources[i].Resource]; ok {
+			r.fieldSources[i].Resource = key
+		}
+	}
+	for i := m.generated; i < len(r.generatedResources); i++ {
+		if key, ok := renamed[r.generatedResources[i].Resource]; ok {
+			r.generatedResources[i].Resource = key
+		}
+	}
+	origins := make(map[string]string)
+	declared := make(map[string]*resource.Resource)
+	for key, origin := range r.resourceOrigins {
+		if newKey, ok := renamed[key]; ok && !m.origins[key] {
+			origins[newKey] = origin
+			delete(r.resourceOrigins, key)
+			if res, exists := r.declaredResources[key]; exists {
+				declared[newKey] = res
+				delete(r.declaredResources, key)
+			}
+		}
+	}
+	for key, origin := range origins {
+		r.resourceOrigins[key] = origin
+	}
+	for key, res := range declared {
+		r.declaredResources[key] = res
+	}
+	for i := m.scopes; i < len(r.patchScopes); i++ {
+		resources := make(map[string]*resource.Resource)
+		for key, res := range r.patchScopes[i].resources {
+			if newKey, ok := renamed[key]; ok {
+				key = newKey
+			}
+			resources[key] = res
+		}
+		r.patchScopes[i].resources = resources
+	}
+}
+
+// replaceLoaded replaces the loaded resources with the build of the
+// kustomization loading them, keyed by their transformed key, dropping the
+// keys the build renamed. resources holds what to store for each resource of
+// transformed, by position, e.g. the resources before the transformers.
+func replaceLoaded(allResources map[string]*resource.Resource, loaded map[string]bool, transformed resmap.ResMap, resources []*resource.Resource) {
+	keys := make(map[string]bool)
+	for j, res := range transformed.Resources() {
+		key := ResourceKey(res)
+		keys[key] = true
+		allResources[key] = resources[j]
+	}
+	for key := range loaded {
+		if !keys[key] {
+			delete(allResources, key)
+		}
+	}
+}
+
+// resourceKeys returns the keys of the resources of resMap, in order
+func resourceKeys(resMap resmap.ResMap) []string {
+	keys := make([]string, 0, resMap.Size())
+	for _, res := range resMap.Resources() {
+		keys = append(keys, ResourceKey(res))
+	}
+	return keys
+}
@@ -0,0 +1,78 @@
+package kdiff
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// checkJSONPatchOp returns why RFC 6902 requires the operation op, with its
+// path parsed into pathKeys, to fail against object, or nil if it applies.
+// Operations are checked against the object as earlier operations of the
+// patch left it.
+func checkJSONPatchOp(object interface{}, op map[string]interface{}, opType string, pathKeys []string) error {
+	switch opType {
+	case "add", "replace", "test":
+		if _, exists := op["value"]; !exists {
+			return fmt.Errorf("missing value")
+		}
+	case "remove":
+	case "move", "copy":
+		from, ok := op["from"].(string)
+		if !ok {
+			return fmt.Errorf("missing or invalid from")
+		}
+		fromKeys := parsePath(from)
+		if !hasPath(object, fromKeys) {
+			return fmt.Errorf("from %s does not exist", from)
+		}
+		if opType == "move" && len(fromKeys) < len(pathKeys) && reflect.DeepEqual(fromKeys, pathKeys[:len(fromKeys)]) {
+			return fmt.Errorf("can't move %s into one of its children", from)
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", opType)
+	}
+
+	switch opType {
+	case "remove", "replace":
+		if !hasPath(object, pathKeys) {
+			return fmt.Errorf("path does not exist")
+		}
+	case "test":
+		if !hasPath(object, pathKeys) {
+			return fmt.Errorf("path does not exist")
+		}
+		if !reflect.DeepEqual(NormalizeScalars(GetValueAtPath(object, pathKeys)), NormalizeScalars(op["value"])) {
+			return fmt.Errorf("value differs")
+		}
+	case "add", "move", "copy":
+		return checkAddTarget(object, pathKeys)
+	}
+	return nil
+}
+
+// checkAddTarget checks that a value can be added at path: its parent must
+// exist, and an index into a list must be "-" or at most the list's length
+func checkAddTarget(object interface{}, path []string) error {
+	if len(path) == 0 {
+		return nil
+	}
+	parentPath, key := path[:len(path)-1], path[len(path)-1]
+	if !hasPath(object, parentPath) {
+		return fmt.Errorf("parent /%s does not exist", strings.Join(parentPath, "/"))
+	}
+	switch parent := GetValueAtPath(object, parentPath).(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+		return nil
+	case []interface{}:
+		if key == "-" {
+			return nil
+		}
+		if idx, err := strconv.Atoi(key); err != nil || idx < 0 || idx > len(parent) {
+			return fmt.Errorf("index %s is out of bounds for a list of %d", key, len(parent))
+		}
+		return nil
+	}
+	return fmt.Errorf("parent /%s is not an object or list", strings.Join(parentPath, "/"))
+}
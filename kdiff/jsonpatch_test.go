@@ -0,0 +1,93 @@
+package kdiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestCheckJSONPatchOp(t *testing.T) {
+	object := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": float64(1),
+			"ports":    []interface{}{map[string]interface{}{"port": float64(80)}},
+		},
+	}
+
+	tests := []struct {
+		op     map[string]interface{}
+		reason string // Empty if the op applies
+	}{
+		{map[string]interface{}{"op": "add", "path": "/spec/paused", "value": true}, ""},
+		{map[string]interface{}{"op": "add", "path": "/spec/ports/1", "value": nil}, ""},
+		{map[string]interface{}{"op": "add", "path": "/spec/ports/-", "value": nil}, ""},
+		{map[string]interface{}{"op": "add", "path": "/spec/ports/2", "value": nil}, "index 2 is out of bounds for a list of 1"},
+		{map[string]interface{}{"op": "add", "path": "/spec/strategy/type", "value": "Recreate"}, "parent /spec/strategy does not exist"},
+		{map[string]interface{}{"op": "add", "path": "/spec/replicas/x", "value": 1}, "parent /spec/replicas is not an object or list"},
+		{map[string]interface{}{"op": "add", "path": "/spec/paused"}, "missing value"},
+		{map[string]interface{}{"op": "remove", "path": "/spec/paused"}, "path does not exist"},
+		{map[string]interface{}{"op": "remove", "path": "/spec/ports/1"}, "path does not exist"},
+		{map[string]interface{}{"op": "replace", "path": "/spec/paused", "value": true}, "path does not exist"},
+		{map[string]interface{}{"op": "test", "path": "/spec/replicas", "value": 1}, ""},
+		{map[string]interface{}{"op": "test", "path": "/spec/replicas", "value": 2}, "value differs"},
+		{map[string]interface{}{"op": "test", "path": "/spec/paused", "value": nil}, "path does not exist"},
+		{map[string]interface{}{"op": "copy", "from": "/spec/replicas", "path": "/spec/minReadySeconds"}, ""},
+		{map[string]interface{}{"op": "copy", "from": "/spec/paused", "path": "/spec/minReadySeconds"}, "from /spec/paused does not exist"},
+		{map[string]interface{}{"op": "move", "from": "/spec/paused", "path": "/spec/minReadySeconds"}, "from /spec/paused does not exist"},
+		{map[string]interface{}{"op": "move", "from": "/spec", "path": "/spec/nested"}, "can't move /spec into one of its children"},
+		{map[string]interface{}{"op": "move", "path": "/spec/minReadySeconds"}, "missing or invalid from"},
+		{map[string]interface{}{"op": "merge", "path": "/spec"}, `unknown operation "merge"`},
+	}
+	for _, test := range tests {
+		path := test.op["path"].(string)
+		err := checkJSONPatchOp(object, test.op, test.op["op"].(string), parsePath(path))
+		if test.reason == "" {
+			assert.NoError(t, err, "%s %s", test.op["op"], path)
+		} else if assert.Error(t, err, "%s %s", test.op["op"], path) {
+			assert.Equal(t, test.reason, err.Error())
+		}
+	}
+}
+
+func TestDiffStrictJSONPatch(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: ops.yaml
+    target:
+      kind: Deployment
+      name: test
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+`,
+		"/app/ops.yaml": `
+- op: replace
+  path: /spec/replicas
+  value: 3
+- op: remove
+  path: /spec/paused
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	_, err := Diff(fs, "/app", Options{StrictJSONPatch: true})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "op 2 (remove /spec/paused): path does not exist")
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err, "Should stay lenient by default")
+	assert.NotEmpty(t, result.FieldSources)
+}
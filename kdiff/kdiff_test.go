@@ -0,0 +1,866 @@
+package kdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/yaml"
+)
+
+func TestProcessKustomization(t *testing.T) {
+	r := newRun(Options{})
+
+	// Create a temporary directory for test files
+	tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Create test kustomization structure
+	testDir := filepath.Join(tmpDir, "test")
+	err = os.MkdirAll(testDir, 0755)
+	assert.NoError(t, err)
+
+	// Create a test kustomization.yaml
+	kustContent := `
+resources:
+  - base
+patches:
+  - path: patches/patch1.yaml
+    target:
+      kind: Deployment
+      name: test
+  - patch: |-
+      apiVersion: apps/v1
+      kind: Deployment
+      metadata:
+        name: test
+    target:
+      kind: Deployment
+      name: test
+`
+	err = os.WriteFile(filepath.Join(testDir, "kustomization.yaml"), []byte(kustContent), 0644)
+	assert.NoError(t, err)
+
+	// Create base directory and resource
+	baseDir := filepath.Join(testDir, "base")
+	err = os.MkdirAll(baseDir, 0755)
+	assert.NoError(t, err)
+
+	// Create base kustomization.yaml
+	baseKustContent := `
+resources:
+  - deployment.yaml
+`
+	err = os.WriteFile(filepath.Join(baseDir, "kustomization.yaml"), []byte(baseKustContent), 0644)
+	assert.NoError(t, err)
+
+	baseContent := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+`
+	err = os.WriteFile(filepath.Join(baseDir, "deployment.yaml"), []byte(baseContent), 0644)
+	assert.NoError(t, err)
+
+	// Create patches directory and patch file
+	patchesDir := filepath.Join(testDir, "patches")
+	err = os.MkdirAll(patchesDir, 0755)
+	assert.NoError(t, err)
+
+	patchContent := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 3
+`
+	err = os.WriteFile(filepath.Join(patchesDir, "patch1.yaml"), []byte(patchContent), 0644)
+	assert.NoError(t, err)
+
+	// Test processKustomization
+	fs := filesys.MakeFsOnDisk()
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	allPatches := make([]types.Patch, 0)
+	allResources := make(map[string]*resource.Resource)
+
+	r.processKustomization(fs, k, testDir, types.LoadRestrictionsRootOnly, &allPatches, allResources)
+
+	// Verify patches were collected
+	assert.Equal(t, 2, len(allPatches), "Should collect both patches")
+	assert.Equal(t, filepath.Join("patches", "patch1.yaml"), allPatches[0].Path, "First patch should be file-based")
+	assert.Equal(t, "", allPatches[1].Path, "Second patch should be inline")
+
+	// Verify resources were collected
+	assert.Equal(t, 1, len(allResources), "Should collect one resource")
+	_, exists := allResources["Deployment.v1.apps/test.[noNs]"]
+	assert.True(t, exists, "Should find Deployment/test resource")
+}
+
+// writeFieldSourceFixture writes an overlay patching the replicas and image
+// of its base's Deployment and returns its directory
+func writeFieldSourceFixture(t *testing.T) string {
+	t.Helper()
+	// Create a temporary directory for test files
+	tmpDir := t.TempDir()
+
+	// Create test kustomization structure
+	testDir := filepath.Join(tmpDir, "test")
+	err := os.MkdirAll(testDir, 0755)
+	assert.NoError(t, err)
+
+	// Create a test kustomization.yaml with strategic merge patch
+	kustContent := `
+resources:
+  - base
+patches:
+  - path: patches/patch1.yaml
+    target:
+      kind: Deployment
+      name: test
+`
+	err = os.WriteFile(filepath.Join(testDir, "kustomization.yaml"), []byte(kustContent), 0644)
+	assert.NoError(t, err)
+
+	// Create base resource
+	baseDir := filepath.Join(testDir, "base")
+	err = os.MkdirAll(baseDir, 0755)
+	assert.NoError(t, err)
+
+	// Create base kustomization.yaml
+	baseKustContent := `
+resources:
+  - deployment.yaml
+`
+	err = os.WriteFile(filepath.Join(baseDir, "kustomization.yaml"), []byte(baseKustContent), 0644)
+	assert.NoError(t, err)
+
+	baseContent := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: test
+        image: test:1.0
+`
+	err = os.WriteFile(filepath.Join(baseDir, "deployment.yaml"), []byte(baseContent), 0644)
+	assert.NoError(t, err)
+
+	// Create patch file
+	patchesDir := filepath.Join(testDir, "patches")
+	err = os.MkdirAll(patchesDir, 0755)
+	assert.NoError(t, err)
+
+	patchContent := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: test
+        image: test:2.0
+`
+	err = os.WriteFile(filepath.Join(patchesDir, "patch1.yaml"), []byte(patchContent), 0644)
+	assert.NoError(t, err)
+	return testDir
+}
+
+func TestFieldSourceTracking(t *testing.T) {
+	testDir := writeFieldSourceFixture(t)
+	result, err := Diff(filesys.MakeFsOnDisk(), testDir, Options{})
+	assert.NoError(t, err)
+
+	// Verify field changes were tracked
+	assert.Greater(t, len(result.FieldSources), 0, "Should track field changes")
+
+	// Check for specific changes
+	foundReplicasChange := false
+	foundImageChange := false
+	for _, source := range result.FieldSources {
+		assert.Equal(t, "Deployment.v1.apps/test.[noNs]", source.Resource)
+		assert.Equal(t, filepath.Join(testDir, "patches", "patch1.yaml"), source.Source)
+		if strings.Join(source.Path, " → ") == "spec → replicas" {
+			foundReplicasChange = true
+			assert.Equal(t, int64(1), source.Original, "Original replicas should be 1")
+			assert.Equal(t, int64(3), source.New, "New replicas should be 3")
+		}
+		if strings.Join(source.Path, " → ") == "spec → template → spec → containers → 0 → image" {
+			foundImageChange = true
+			assert.Equal(t, "test:1.0", source.Original, "Original image should be test:1.0")
+			assert.Equal(t, "test:2.0", source.New, "New image should be test:2.0")
+		}
+	}
+	assert.True(t, foundReplicasChange, "Should track replicas change")
+	assert.True(t, foundImageChange, "Should track image change")
+}
+
+func TestRecordPatchChanges(t *testing.T) {
+	r := newRun(Options{})
+	testDir := writeFieldSourceFixture(t)
+
+	// Run the main processing
+	fs := filesys.MakeFsOnDisk()
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	allPatches := make([]types.Patch, 0)
+	allResources := make(map[string]*resource.Resource)
+
+	r.processKustomization(fs, k, testDir, types.LoadRestrictionsRootOnly, &allPatches, allResources)
+
+	// Process patches and track changes
+	var changes []FieldSource
+	for _, patch := range allPatches {
+		targetKeys := findPatchTarget(allResources, patch.Target, false)
+		assert.Len(t, targetKeys, 1, "Target resource should exist")
+		targetRes := allResources[targetKeys[0]]
+
+		// Get state before patch
+		var beforeMap map[string]interface{}
+		err := yaml.Unmarshal([]byte(targetRes.MustYaml()), &beforeMap)
+		assert.NoError(t, err)
+
+		// Apply patch
+		var patchData []byte
+		if patch.Path != "" {
+			patchData, err = fs.ReadFile(patch.Path)
+			assert.NoError(t, err)
+		} else {
+			patchData = []byte(patch.Patch)
+		}
+
+		// Parse and apply patch
+		var patchContent interface{}
+		err = yaml.Unmarshal(patchData, &patchContent)
+		assert.NoError(t, err)
+
+		// Convert resource to map
+		var resourceMap map[string]interface{}
+		err = yaml.Unmarshal([]byte(targetRes.MustYaml()), &resourceMap)
+		assert.NoError(t, err)
+
+		// Apply strategic merge patch and record its changes, as Diff does
+		assert.NoError(t, r.mergeMap(resourceMap, patchContent.(map[string]interface{})))
+		r.recordMergeChanges(beforeMap, resourceMap, nil, "", func(path []string, element string, oldVal, newVal interface{}) {
+			changes = append(changes, FieldSource{
+				Resource: ResourceKey(targetRes),
+				Path:     path,
+				Source:   patch.Path,
+				Element:  element,
+				Original: NormalizeNumbers(oldVal),
+				New:      NormalizeNumbers(newVal),
+			})
+		})
+	}
+
+	// Verify field changes were tracked
+	assert.Greater(t, len(changes), 0, "Should track field changes")
+
+	// Check for specific changes
+	foundReplicasChange := false
+	foundImageChange := false
+	for _, source := range changes {
+		if strings.Join(source.Path, " → ") == "spec → replicas" {
+			foundReplicasChange = true
+			assert.Equal(t, int64(1), source.Original, "Original replicas should be 1")
+			assert.Equal(t, int64(3), source.New, "New replicas should be 3")
+		}
+		if strings.Join(source.Path, " → ") == "spec → template → spec → containers → 0 → image" {
+			foundImageChange = true
+			assert.Equal(t, "test:1.0", source.Original, "Original image should be test:1.0")
+			assert.Equal(t, "test:2.0", source.New, "New image should be test:2.0")
+		}
+	}
+	assert.True(t, foundReplicasChange, "Should track replicas change")
+	assert.True(t, foundImageChange, "Should track image change")
+}
+
+func TestPathResolution(t *testing.T) {
+	r := newRun(Options{})
+
+	// Create a temporary directory for test files
+	tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Create test kustomization structure with nested kustomizations
+	rootDir := filepath.Join(tmpDir, "root")
+	err = os.MkdirAll(rootDir, 0755)
+	assert.NoError(t, err)
+
+	// Create root kustomization.yaml
+	rootKustContent := `
+resources:
+  - base
+components:
+  - component
+`
+	err = os.WriteFile(filepath.Join(rootDir, "kustomization.yaml"), []byte(rootKustContent), 0644)
+	assert.NoError(t, err)
+
+	// Create base kustomization
+	baseDir := filepath.Join(rootDir, "base")
+	err = os.MkdirAll(baseDir, 0755)
+	assert.NoError(t, err)
+
+	baseKustContent := `
+resources:
+  - resource.yaml
+patches:
+  - path: patches/patch1.yaml
+    target:
+      kind: Deployment
+      name: test
+`
+	err = os.WriteFile(filepath.Join(baseDir, "kustomization.yaml"), []byte(baseKustContent), 0644)
+	assert.NoError(t, err)
+
+	// Create component kustomization
+	compDir := filepath.Join(rootDir, "component")
+	err = os.MkdirAll(compDir, 0755)
+	assert.NoError(t, err)
+
+	// Create component kustomization.yaml with kind: Component
+	compKustContent := `
+kind: Component
+patches:
+  - path: patches/patch2.yaml
+    target:
+      kind: Deployment
+      name: test
+`
+	err = os.WriteFile(filepath.Join(compDir, "kustomization.yaml"), []byte(compKustContent), 0644)
+	assert.NoError(t, err)
+
+	// Create test resources and patches
+	resourceContent := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+`
+	err = os.WriteFile(filepath.Join(baseDir, "resource.yaml"), []byte(resourceContent), 0644)
+	assert.NoError(t, err)
+
+	// Create patches
+	basePatchDir := filepath.Join(baseDir, "patches")
+	err = os.MkdirAll(basePatchDir, 0755)
+	assert.NoError(t, err)
+
+	compPatchDir := filepath.Join(compDir, "patches")
+	err = os.MkdirAll(compPatchDir, 0755)
+	assert.NoError(t, err)
+
+	patch1Content := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 2
+`
+	err = os.WriteFile(filepath.Join(basePatchDir, "patch1.yaml"), []byte(patch1Content), 0644)
+	assert.NoError(t, err)
+
+	patch2Content := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 3
+`
+	err = os.WriteFile(filepath.Join(compPatchDir, "patch2.yaml"), []byte(patch2Content), 0644)
+	assert.NoError(t, err)
+
+	// Test path resolution
+	fs := filesys.MakeFsOnDisk()
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	allPatches := make([]types.Patch, 0)
+	allResources := make(map[string]*resource.Resource)
+
+	err = r.processKustomization(fs, k, rootDir, types.LoadRestrictionsRootOnly, &allPatches, allResources)
+	assert.NoError(t, err, "Component directories shouldn't be built on their own")
+
+	// Verify patches were collected with correct paths
+	assert.Equal(t, 2, len(allPatches), "Should collect both patches")
+
+	// Verify base patch path
+	basePatchPath := filepath.Join(baseDir, "patches", "patch1.yaml")
+	assert.Equal(t, basePatchPath, allPatches[0].Path, "Base patch path should be resolved correctly")
+
+	// Verify component patch path
+	compPatchPath := filepath.Join(compDir, "patches", "patch2.yaml")
+	assert.Equal(t, compPatchPath, allPatches[1].Path, "Component patch path should be resolved correctly")
+}
+
+func TestComponentResources(t *testing.T) {
+	r := newRun(Options{})
+
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+components:
+  - monitoring
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+		"/app/monitoring/kustomization.yaml": `
+apiVersion: kustomize.config.k8s.io/v1alpha1
+kind: Component
+resources:
+  - service-monitor.yaml
+patches:
+  - path: annotations.yaml
+`,
+		"/app/monitoring/service-monitor.yaml": `
+apiVersion: monitoring.coreos.com/v1
+kind: ServiceMonitor
+metadata:
+  name: web
+`,
+		"/app/monitoring/annotations.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  annotations:
+    prometheus.io/scrape: "true"
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	allPatches := make([]types.Patch, 0)
+	allResources := make(map[string]*resource.Resource)
+	err := r.processKustomization(fs, k, "/app", types.LoadRestrictionsRootOnly, &allPatches, allResources)
+	assert.NoError(t, err, "Components shouldn't be built on their own")
+
+	assert.Contains(t, allResources, "ServiceMonitor.v1.monitoring.coreos.com/web.[noNs]", "Component resources should be collected")
+	assert.Contains(t, allResources, "Deployment.v1.apps/web.[noNs]")
+	if assert.Equal(t, 1, len(allPatches)) {
+		assert.Equal(t, "/app/monitoring/annotations.yaml", allPatches[0].Path)
+	}
+}
+
+func TestProcessKustomizationUnpatched(t *testing.T) {
+	r := newRun(Options{})
+
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/base/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+		"/app/base/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	allPatches := make([]types.Patch, 0)
+	allResources := make(map[string]*resource.Resource)
+	assert.NoError(t, r.processKustomization(fs, k, "/app/base", types.LoadRestrictionsRootOnly, &allPatches, allResources))
+
+	if assert.Equal(t, 1, len(allPatches)) {
+		assert.Equal(t, "/app/base/replicas.yaml", allPatches[0].Path)
+	}
+	replicas, err := allResources["Deployment.v1.apps/web.[noNs]"].GetFieldValue("spec.replicas")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, replicas, "The collected patch shouldn't be applied to the base already")
+}
+
+func TestMergeMapWithAnchors(t *testing.T) {
+	r := newRun(Options{})
+	baseContent := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+`
+	// Patch reusing an anchored env block across two containers
+	patchContent := `
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        env: &env
+        - name: LOG_LEVEL
+          value: debug
+      - name: sidecar
+        env: *env
+`
+	var resourceMap map[string]interface{}
+	err := yaml.Unmarshal([]byte(baseContent), &resourceMap)
+	assert.NoError(t, err)
+
+	var patch map[string]interface{}
+	err = yaml.Unmarshal([]byte(patchContent), &patch)
+	assert.NoError(t, err)
+
+	r.mergeMap(resourceMap, patch)
+
+	appEnv := []string{"spec", "template", "spec", "containers", "0", "env", "0", "value"}
+	sidecarEnv := []string{"spec", "template", "spec", "containers", "1", "env", "0", "value"}
+	assert.Equal(t, "debug", GetValueAtPath(resourceMap, appEnv), "App container should get the anchored env")
+	assert.Equal(t, "debug", GetValueAtPath(resourceMap, sidecarEnv), "Sidecar container should get the aliased env")
+
+	// Mutating one container must not affect the other or the patch
+	setValueAtPath(resourceMap, appEnv, "info")
+	assert.Equal(t, "info", GetValueAtPath(resourceMap, appEnv))
+	assert.Equal(t, "debug", GetValueAtPath(resourceMap, sidecarEnv), "Aliased env should not be shared after merge")
+	assert.Equal(t, "debug", GetValueAtPath(patch, appEnv), "Patch should not be mutated by the merge")
+}
+
+func TestValidatePatchesPathAndInline(t *testing.T) {
+	kustContent := `
+resources:
+  - base
+patches:
+  - path: patches/patch1.yaml
+    target:
+      kind: Deployment
+      name: test
+  - path: patches/patch2.yaml
+    patch: |-
+      apiVersion: apps/v1
+      kind: Deployment
+      metadata:
+        name: test
+    target:
+      kind: Deployment
+      name: test
+`
+	var kust types.Kustomization
+	err := yaml.Unmarshal([]byte(kustContent), &kust)
+	assert.NoError(t, err)
+
+	err = validatePatches(&kust, "overlay")
+	assert.Error(t, err, "Should reject a patch with both path and inline patch")
+	assert.Contains(t, err.Error(), "patches[1]", "Error should identify the offending entry")
+	assert.Contains(t, err.Error(), "patches/patch2.yaml", "Error should include the patch path")
+
+	// A single-source patch list is valid
+	kust.Patches = kust.Patches[:1]
+	assert.NoError(t, validatePatches(&kust, "overlay"))
+}
+
+func TestFilterByNamespace(t *testing.T) {
+	factory := resource.NewFactory(nil)
+	newResource := func(content string) *resource.Resource {
+		res, err := factory.FromBytes([]byte(content))
+		assert.NoError(t, err)
+		return res
+	}
+
+	allResources := make(map[string]*resource.Resource)
+	for _, content := range []string{
+		"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: frontend\n  namespace: web\n",
+		"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: worker\n  namespace: jobs\n",
+		"apiVersion: v1\nkind: Namespace\nmetadata:\n  name: web\n",
+	} {
+		res := newResource(content)
+		allResources[ResourceKey(res)] = res
+	}
+
+	filtered := filterByNamespace(allResources, "web", false)
+	assert.Equal(t, 1, len(filtered), "Should keep only resources in the namespace")
+	_, exists := filtered["Deployment.v1.apps/frontend.web"]
+	assert.True(t, exists, "Should keep Deployment/frontend")
+
+	filtered = filterByNamespace(allResources, "web", true)
+	assert.Equal(t, 2, len(filtered), "Should also keep cluster-scoped resources")
+	_, exists = filtered["Namespace.v1.[noGrp]/web.[noNs]"]
+	assert.True(t, exists, "Should keep Namespace/web")
+}
+
+func TestMatchesPathGlob(t *testing.T) {
+	jsonPatchChange := FieldSource{
+		Resource: "Deployment/test",
+		Path:     []string{"spec", "securityContext", "runAsUser"},
+		Original: float64(1000),
+		New:      float64(0),
+	}
+	assert.True(t, MatchesPathGlob("spec.securityContext.*", jsonPatchChange), "Wildcard should match a child field")
+	assert.True(t, MatchesPathGlob("spec.securityContext.runAsUser", jsonPatchChange), "Exact path should match")
+	assert.False(t, MatchesPathGlob("spec.replicas", jsonPatchChange), "Unrelated path should not match")
+	assert.False(t, MatchesPathGlob("spec.*", jsonPatchChange), "Wildcard should only match one segment")
+
+	// Strategic merge records are kept at the top-level key
+	mergeChange := FieldSource{
+		Resource: "Deployment/test",
+		Path:     []string{"spec"},
+		Original: map[string]interface{}{"replicas": float64(1), "securityContext": map[string]interface{}{"runAsUser": float64(1000)}},
+		New:      map[string]interface{}{"replicas": float64(3), "securityContext": map[string]interface{}{"runAsUser": float64(1000)}},
+	}
+	assert.False(t, MatchesPathGlob("spec.securityContext.*", mergeChange), "Unchanged subtree should not match")
+	assert.True(t, MatchesPathGlob("spec.replicas", mergeChange), "Changed subtree should match")
+}
+
+func TestDedupeFieldSources(t *testing.T) {
+	change := FieldSource{
+		Resource: "Deployment/test",
+		Path:     []string{"spec"},
+		Source:   "patch1.yaml",
+		Original: map[string]interface{}{"replicas": float64(1)},
+		New:      map[string]interface{}{"replicas": float64(3)},
+	}
+	sameChangeOtherPatch := change
+	sameChangeOtherPatch.Source = "patch2.yaml"
+	stringValue := FieldSource{Resource: "Deployment/test", Path: []string{"spec", "replicas"}, Source: "patch1.yaml", New: "3"}
+	numberValue := FieldSource{Resource: "Deployment/test", Path: []string{"spec", "replicas"}, Source: "patch1.yaml", New: float64(3)}
+
+	deduped := dedupeFieldSources([]FieldSource{change, change, sameChangeOtherPatch, stringValue, numberValue, stringValue})
+
+	assert.Equal(t, []FieldSource{change, sameChangeOtherPatch, stringValue, numberValue}, deduped,
+		"Should drop only identical records and keep order")
+}
+
+func TestNonStringMapKeys(t *testing.T) {
+	r := newRun(Options{})
+	// Structure as produced by decoders that keep non-string YAML keys
+	data := map[string]interface{}{
+		"data": map[interface{}]interface{}{
+			8080: map[interface{}]interface{}{"protocol": "TCP"},
+			true: "enabled",
+		},
+	}
+
+	assert.Equal(t, "TCP", GetValueAtPath(data, []string{"data", "8080", "protocol"}), "Should find values under numeric keys")
+	assert.Equal(t, "enabled", GetValueAtPath(data, []string{"data", "true"}), "Should find values under boolean keys")
+
+	setValueAtPath(data, []string{"data", "8080", "protocol"}, "UDP")
+	assert.Equal(t, "UDP", GetValueAtPath(data, []string{"data", "8080", "protocol"}), "Should update values under numeric keys")
+	assert.Equal(t, 2, len(data["data"].(map[interface{}]interface{})), "Should reuse the existing numeric key")
+
+	// Copies are normalized to string-keyed maps
+	copied, err := r.deepCopyValue(data)
+	assert.NoError(t, err)
+	normalized := copied.(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"8080": map[string]interface{}{"protocol": "UDP"},
+		"true": "enabled",
+	}, normalized["data"])
+	number, err := r.deepCopyValue(json.Number("3"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(3), number, "Should normalize json.Number")
+}
+
+func TestNestingLimits(t *testing.T) {
+	r := newRun(Options{})
+	// nest wraps a leaf in n single-key maps
+	nest := func(n int) map[string]interface{} {
+		value := map[string]interface{}{"leaf": "value"}
+		for i := 0; i < n; i++ {
+			value = map[string]interface{}{"nested": value}
+		}
+		return value
+	}
+
+	_, err := r.deepCopyValue(nest(r.opts.MaxDepth / 2))
+	assert.NoError(t, err)
+	_, err = r.deepCopyValue(nest(100000))
+	assert.ErrorContains(t, err, "levels deep", "Very deep values should fail cleanly")
+
+	dst := nest(0)
+	assert.NoError(t, r.mergeMap(dst, nest(r.opts.MaxDepth/2)))
+	assert.ErrorContains(t, r.mergeMap(nest(100000), nest(100000)), "levels deep")
+
+	// A map containing itself can't come from YAML, but mustn't hang
+	cyclic := map[string]interface{}{}
+	cyclic["self"] = []interface{}{cyclic}
+	_, err = r.deepCopyValue(cyclic)
+	assert.ErrorContains(t, err, "contains itself")
+
+	// Aliased nodes are shared, not cyclic
+	shared := map[string]interface{}{"env": "debug"}
+	copied, err := r.deepCopyValue(map[string]interface{}{"a": shared, "b": shared})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": shared, "b": shared}, copied)
+}
+
+func TestMergeMapKeyedLists(t *testing.T) {
+	r := newRun(Options{})
+	dst := map[string]interface{}{
+		"containers": []interface{}{
+			map[string]interface{}{
+				"name":         "web",
+				"ports":        []interface{}{map[string]interface{}{"containerPort": float64(8080), "protocol": "TCP"}},
+				"volumeMounts": []interface{}{map[string]interface{}{"mountPath": "/data", "name": "data"}},
+				"envFrom":      []interface{}{map[string]interface{}{"configMapRef": map[string]interface{}{"name": "old"}}},
+			},
+		},
+	}
+	src := map[string]interface{}{
+		"containers": []interface{}{
+			map[string]interface{}{
+				"name":         "web",
+				"ports":        []interface{}{map[string]interface{}{"containerPort": float64(8080), "name": "http"}},
+				"volumeMounts": []interface{}{map[string]interface{}{"mountPath": "/data", "readOnly": true}},
+				"envFrom":      []interface{}{map[string]interface{}{"configMapRef": map[string]interface{}{"name": "new"}}},
+			},
+			map[string]interface{}{"name": "sidecar"},
+		},
+	}
+	assert.NoError(t, r.mergeMap(dst, src))
+
+	containers := dst["containers"].([]interface{})
+	assert.Equal(t, 2, len(containers), "Containers should merge by name")
+	web := containers[0].(map[string]interface{})
+	assert.Equal(t, []interface{}{map[string]interface{}{"containerPort": float64(8080), "protocol": "TCP", "name": "http"}}, web["ports"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"mountPath": "/data", "name": "data", "readOnly": true}}, web["volumeMounts"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"configMapRef": map[string]interface{}{"name": "new"}}}, web["envFrom"], "envFrom has no merge key and is replaced")
+}
+
+func TestRecordMergeChanges(t *testing.T) {
+	r := newRun(Options{})
+	before := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": float64(1),
+			"env": []interface{}{
+				map[string]interface{}{"name": "A", "value": "1"},
+				map[string]interface{}{"name": "B", "value": "2"},
+			},
+			"args": []interface{}{"--a"},
+		},
+	}
+	after := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": "1",
+			"env": []interface{}{
+				map[string]interface{}{"name": "A", "value": "1"},
+				map[string]interface{}{"name": "B", "value": "3"},
+				map[string]interface{}{"name": "C", "value": "4"},
+			},
+			"args":   []interface{}{"--b"},
+			"paused": true,
+		},
+	}
+
+	var changes []FieldSource
+	r.recordMergeChanges(before, after, nil, "", func(path []string, element string, original, updated interface{}) {
+		changes = append(changes, FieldSource{Path: path, Element: element, Original: original, New: updated})
+	})
+	assert.Equal(t, []FieldSource{
+		{Path: []string{"spec", "args"}, Original: []interface{}{"--a"}, New: []interface{}{"--b"}},
+		{Path: []string{"spec", "env", "1", "value"}, Element: "name=B", Original: "2", New: "3"},
+		{Path: []string{"spec", "env", "2"}, Element: "name=C", New: map[string]interface{}{"name": "C", "value": "4"}},
+		{Path: []string{"spec", "paused"}, New: true},
+	}, changes, "Quoting replicas isn't a change")
+}
+
+func TestFilterFieldSources(t *testing.T) {
+	replicas := FieldSource{Resource: "Deployment/test", Path: []string{"spec", "replicas"}}
+	annotation := FieldSource{Resource: "Deployment/test", Path: []string{"metadata", "annotations", "owner"}}
+	labels := FieldSource{Resource: "Deployment/test", Path: []string{"metadata", "labels"}}
+	sources := []FieldSource{replicas, annotation, labels}
+
+	assert.Equal(t, sources, FilterFieldSources(sources, nil, nil), "Should keep everything without globs")
+	assert.Equal(t, []FieldSource{replicas, labels}, FilterFieldSources(sources, nil, []string{"metadata.annotations"}),
+		"Should drop changes below an ignored path")
+	assert.Equal(t, []FieldSource{annotation, labels}, FilterFieldSources(sources, []string{"metadata.*"}, nil),
+		"Should keep only included paths")
+	assert.Equal(t, []FieldSource{labels}, FilterFieldSources(sources, []string{"metadata.*"}, []string{"metadata.annotations"}),
+		"Ignore globs should win over include globs")
+}
+
+func TestFindPatchTargetNamespace(t *testing.T) {
+	factory := resource.NewFactory(nil)
+	res, err := factory.FromBytes([]byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: test\n  namespace: web\n"))
+	assert.NoError(t, err)
+	allResources := map[string]*resource.Resource{"Deployment/test": res}
+
+	anyNamespace := &types.Selector{ResId: resid.ResId{Gvk: resid.Gvk{Kind: "Deployment"}, Name: "test"}}
+	sameNamespace := &types.Selector{ResId: resid.ResId{Gvk: resid.Gvk{Kind: "Deployment"}, Name: "test", Namespace: "web"}}
+	otherNamespace := &types.Selector{ResId: resid.ResId{Gvk: resid.Gvk{Kind: "Deployment"}, Name: "test", Namespace: "jobs"}}
+
+	// A target without namespace matches any namespace by default
+	assert.NotEmpty(t, findPatchTarget(allResources, anyNamespace, false), "Target without namespace should match any namespace")
+	assert.NotEmpty(t, findPatchTarget(allResources, sameNamespace, false), "Target with the resource's namespace should match")
+	assert.Empty(t, findPatchTarget(allResources, otherNamespace, false), "Target with another namespace should not match")
+
+	// Strict mode requires explicit namespace matches
+	assert.Empty(t, findPatchTarget(allResources, anyNamespace, true), "Target without namespace should not match in strict mode")
+	assert.NotEmpty(t, findPatchTarget(allResources, sameNamespace, true), "Target with the resource's namespace should match in strict mode")
+}
+
+func TestFindPatchTargetKindAlias(t *testing.T) {
+	factory := resource.NewFactory(nil)
+	allResources := make(map[string]*resource.Resource)
+	for _, kind := range []string{"Deployment", "Service", "ConfigMap"} {
+		res, err := factory.FromBytes([]byte(fmt.Sprintf("apiVersion: v1\nkind: %s\nmetadata:\n  name: test\n", kind)))
+		assert.NoError(t, err)
+		allResources[kind+"/test"] = res
+	}
+
+	for alias, kind := range map[string]string{"deploy": "Deployment", "svc": "Service", "cm": "ConfigMap"} {
+		canonical, isAlias := CanonicalKind(alias)
+		assert.True(t, isAlias, "%s should be an alias", alias)
+		assert.Equal(t, kind, canonical)
+
+		target := &types.Selector{ResId: resid.ResId{Gvk: resid.Gvk{Kind: alias}, Name: "test"}}
+		keys := findPatchTarget(allResources, target, false)
+		if assert.Len(t, keys, 1, "%s should match %s", alias, kind) {
+			assert.Equal(t, kind, allResources[keys[0]].GetKind())
+		}
+	}
+
+	_, isAlias := CanonicalKind("Deployment")
+	assert.False(t, isAlias, "Canonical kinds are not aliases")
+}
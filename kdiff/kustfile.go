@@ -0,0 +1,137 @@
+package kdiff
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/types"
+)
+
+// kustomizationFileNames are the kustomization file names kustomize
+// recognizes, in lookup order
+var kustomizationFileNames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// FindKustomizationFile returns the path of the kustomization file in dir
+func FindKustomizationFile(fs filesys.FileSystem, dir string) (string, bool) {
+	for _, name := range kustomizationFileNames {
+		path := filepath.Join(dir, name)
+		if fs.Exists(path) && !fs.IsDir(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// MissingKustomizationError explains why dir can't be used as a kustomization
+// root and what the user might have meant
+func MissingKustomizationError(fs filesys.FileSystem, dir string) error {
+	if !fs.Exists(dir) {
+		return fmt.Errorf("%s does not exist; check the kustomization directory path", dir)
+	}
+	if !fs.IsDir(dir) {
+		return fmt.Errorf("%s is a file; pass the directory containing kustomization.yaml", dir)
+	}
+
+	// Loose resource files suggest a plain resource directory
+	var resourceFiles []string
+	for _, pattern := range []string{"*.yaml", "*.yml", "*.json"} {
+		matches, err := fs.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			continue
+		}
+		for _, match := range matches {
+			resourceFiles = append(resourceFiles, filepath.Base(match))
+		}
+	}
+	if len(resourceFiles) > 0 {
+		return fmt.Errorf("no kustomization file (%s) in %s; it looks like a plain resource directory (%s), "+
+			"create a kustomization.yaml listing them under resources: or pass the overlay directory instead",
+			strings.Join(kustomizationFileNames, ", "), dir, strings.Join(resourceFiles, ", "))
+	}
+	return fmt.Errorf("no kustomization file (%s) in %s; is this the right directory?",
+		strings.Join(kustomizationFileNames, ", "), dir)
+}
+
+// readKustomizationFile locates and reads the kustomization file in dir,
+// rejecting a missing or empty one with a message saying what to fix
+func readKustomizationFile(fs filesys.FileSystem, dir string) (string, []byte, error) {
+	kustPath, exists := FindKustomizationFile(fs, dir)
+	if !exists {
+		return "", nil, MissingKustomizationError(fs, dir)
+	}
+	data, err := fs.ReadFile(kustPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed reading %s: %w", kustPath, err)
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return "", nil, fmt.Errorf("%s is empty; list at least one entry under resources:", kustPath)
+	}
+	return kustPath, data, nil
+}
+
+// kustomizationGroup is the API group of kustomization files
+const kustomizationGroup = "kustomize.config.k8s.io"
+
+// DefaultMinKustomizationVersion is the oldest kustomization apiVersion
+// accepted without a warning
+const DefaultMinKustomizationVersion = "v1beta1"
+
+// kubeVersionPattern matches Kubernetes API versions such as v1, v1beta1
+var kubeVersionPattern = regexp.MustCompile(`^v(\d+)(?:(alpha|beta)(\d+))?$`)
+
+// compareKubeVersions orders Kubernetes API versions, where v1alpha1 <
+// v1beta1 < v1 < v2alpha1. It returns false if either version is malformed.
+func compareKubeVersions(a, b string) (int, bool) {
+	rank := func(version string) ([3]int, bool) {
+		match := kubeVersionPattern.FindStringSubmatch(version)
+		if match == nil {
+			return [3]int{}, false
+		}
+		major, _ := strconv.Atoi(match[1])
+		stability := map[string]int{"alpha": 0, "beta": 1, "": 2}[match[2]]
+		minor, _ := strconv.Atoi(match[3])
+		return [3]int{major, stability, minor}, true
+	}
+	ra, okA := rank(a)
+	rb, okB := rank(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	for i := range ra {
+		if ra[i] != rb[i] {
+			if ra[i] < rb[i] {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+// checkKustomizationVersion warns when the kustomization file at kustPath
+// declares an apiVersion kustomize may treat differently: a foreign group, a
+// malformed version, or one older than minKustomizationVersion. Components
+// only exist as v1alpha1 and are not checked against the floor.
+func (r *run) checkKustomizationVersion(kustPath string, kust *types.Kustomization) {
+	if kust.APIVersion == "" {
+		return
+	}
+	group, version, found := strings.Cut(kust.APIVersion, "/")
+	if !found || group != kustomizationGroup {
+		r.warn(kustPath, WarningKustomizationVersion, "Unsupported kustomization apiVersion %s", kust.APIVersion)
+		return
+	}
+	if kust.Kind == types.ComponentKind {
+		return
+	}
+	cmp, ok := compareKubeVersions(version, r.opts.MinKustomizationVersion)
+	if !ok {
+		r.warn(kustPath, WarningKustomizationVersion, "Unrecognized kustomization apiVersion %s", kust.APIVersion)
+	} else if cmp < 0 {
+		r.warn(kustPath, WarningKustomizationVersion, "Kustomization apiVersion %s is older than %s and may behave differently", kust.APIVersion, r.opts.MinKustomizationVersion)
+	}
+}
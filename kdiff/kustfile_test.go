@@ -0,0 +1,84 @@
+package kdiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/types"
+)
+
+func TestCompareKubeVersions(t *testing.T) {
+	ordered := []string{"v1alpha1", "v1alpha2", "v1beta1", "v1", "v2alpha1", "v2"}
+	for i := range ordered {
+		for j := range ordered {
+			cmp, ok := compareKubeVersions(ordered[i], ordered[j])
+			assert.True(t, ok)
+			switch {
+			case i < j:
+				assert.Equal(t, -1, cmp, "%s < %s", ordered[i], ordered[j])
+			case i > j:
+				assert.Equal(t, 1, cmp, "%s > %s", ordered[i], ordered[j])
+			default:
+				assert.Equal(t, 0, cmp)
+			}
+		}
+	}
+
+	_, ok := compareKubeVersions("beta", "v1")
+	assert.False(t, ok, "Should reject malformed versions")
+}
+
+func TestCheckKustomizationVersion(t *testing.T) {
+	r := newRun(Options{})
+
+	check := func(apiVersion, kind string) []Warning {
+		r.warnings = nil
+		kust := types.Kustomization{TypeMeta: types.TypeMeta{APIVersion: apiVersion, Kind: kind}}
+		r.checkKustomizationVersion("/app/kustomization.yaml", &kust)
+		return r.warnings
+	}
+
+	assert.Empty(t, check("", ""), "Should accept a kustomization without apiVersion")
+	assert.Empty(t, check("kustomize.config.k8s.io/v1beta1", "Kustomization"))
+	assert.Empty(t, check("kustomize.config.k8s.io/v1alpha1", "Component"), "Components are always v1alpha1")
+
+	old := check("kustomize.config.k8s.io/v1alpha1", "Kustomization")
+	assert.Equal(t, 1, len(old))
+	assert.Equal(t, WarningKustomizationVersion, old[0].Category)
+	assert.Equal(t, "/app/kustomization.yaml", old[0].Patch)
+	assert.Contains(t, old[0].Reason, "older than v1beta1")
+
+	assert.Contains(t, check("example.com/v1", "Kustomization")[0].Reason, "Unsupported")
+	assert.Contains(t, check("kustomize.config.k8s.io/latest", "Kustomization")[0].Reason, "Unrecognized")
+}
+
+func TestDiffKustomizationVersion(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+  - deployment.yaml
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Warnings)
+
+	result, err = Diff(fs, "/app", Options{MinKustomizationVersion: "v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result.Warnings), "Should honor a raised floor")
+	assert.Equal(t, WarningKustomizationVersion, result.Warnings[0].Category)
+}
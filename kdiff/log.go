@@ -0,0 +1,17 @@
+package kdiff
+
+import (
+	"fmt"
+)
+
+func (r *run) logf(format string, v ...interface{}) {
+	fmt.Fprintf(r.opts.Log, format, v...)
+}
+
+// debugf logs detail only wanted with -verbose, like the kustomization
+// configuration
+func (r *run) debugf(format string, v ...interface{}) {
+	if r.opts.Verbose {
+		r.logf(format, v...)
+	}
+}
@@ -0,0 +1,216 @@
+package kdiff
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// ResourceField is the matrix row label of a resource that is missing from
+// some variants
+const ResourceField = "(resource)"
+
+// MatrixRow is a field whose value differs between overlay variants. Values
+// are indexed like the variants; Present is false where a variant lacks the
+// field.
+type MatrixRow struct {
+	Resource string
+	Field    string
+	Values   []interface{}
+	Present  []bool
+}
+
+// flattenFields records every leaf of value under its dotted path. Empty maps
+// and lists are leaves too.
+func flattenFields(value interface{}, path []string, fields map[string]interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if len(value) > 0 {
+			for key, child := range value {
+				flattenFields(child, appendPath(path, key), fields)
+			}
+			return
+		}
+	case []interface{}:
+		if len(value) > 0 {
+			for i, child := range value {
+				flattenFields(child, appendPath(path, strconv.Itoa(i)), fields)
+			}
+			return
+		}
+	}
+	fields[strings.Join(path, ".")] = value
+}
+
+// appendPath returns path extended by key without sharing path's storage
+func appendPath(path []string, key string) []string {
+	return append(path[:len(path):len(path)], key)
+}
+
+// variantResource is a resource built for one variant. Hash lets identical
+// resources be skipped without comparing their fields.
+type variantResource struct {
+	Hash   [sha256.Size]byte
+	Object map[string]interface{}
+}
+
+// buildVariant builds the overlay in dir, keying its resources by
+// ResourceKey. Status is dropped unless includeStatus is set.
+func buildVariant(fs filesys.FileSystem, k *krusty.Kustomizer, dir string, includeStatus bool) (map[string]variantResource, error) {
+	resMap, err := k.Run(fs, dir)
+	if err != nil {
+		return nil, fmt.Errorf("kustomize build failed for %s: %w", dir, err)
+	}
+	return makeVariant(resMap.Resources(), includeStatus)
+}
+
+// makeVariant keys resources by ResourceKey, so variants align resources the
+// way Diff tracks them. Status is dropped unless includeStatus is set.
+func makeVariant(resources []*resource.Resource, includeStatus bool) (map[string]variantResource, error) {
+	variant := make(map[string]variantResource)
+	for _, res := range resources {
+		var object map[string]interface{}
+		if err := yaml.Unmarshal([]byte(res.MustYaml()), &object); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s/%s: %w", res.GetKind(), res.GetName(), err)
+		}
+		normalizeObject(object, includeStatus)
+		data, err := yaml.Marshal(NormalizeScalars(object))
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s/%s: %w", res.GetKind(), res.GetName(), err)
+		}
+		variant[ResourceKey(res)] = variantResource{Hash: sha256.Sum256(data), Object: object}
+	}
+	return variant, nil
+}
+
+// unchangedResource reports whether every variant has the resource at key
+// with identical YAML
+func unchangedResource(variants []map[string]variantResource, key string) bool {
+	first, exists := variants[0][key]
+	if !exists {
+		return false
+	}
+	for _, variant := range variants[1:] {
+		res, exists := variant[key]
+		if !exists || res.Hash != first.Hash {
+			return false
+		}
+	}
+	return true
+}
+
+// MatrixResult holds the fields that diverge between overlay variants
+type MatrixResult struct {
+	Rows      []MatrixRow
+	Unchanged int // Resources skipped because they're identical in every variant
+}
+
+// buildMatrix aligns the variants' resources and returns a row per field that
+// doesn't have the same value in every variant, sorted by resource and field.
+// With onlyChanged, resources with identical YAML everywhere are counted
+// instead of compared field by field.
+func buildMatrix(variants []map[string]variantResource, onlyChanged bool) *MatrixResult {
+	keys := make(map[string]bool)
+	for _, variant := range variants {
+		for key := range variant {
+			keys[key] = true
+		}
+	}
+
+	result := &MatrixResult{}
+	for key := range keys {
+		if onlyChanged && unchangedResource(variants, key) {
+			result.Unchanged++
+			continue
+		}
+
+		// A resource some variants lack gets a single row
+		row := MatrixRow{Resource: key, Field: ResourceField}
+		missing := false
+		for _, variant := range variants {
+			_, exists := variant[key]
+			row.Values = append(row.Values, nil)
+			row.Present = append(row.Present, exists)
+			missing = missing || !exists
+		}
+		if missing {
+			result.Rows = append(result.Rows, row)
+			continue
+		}
+
+		fieldsByVariant := make([]map[string]interface{}, len(variants))
+		fields := make(map[string]bool)
+		for i, variant := range variants {
+			fieldsByVariant[i] = make(map[string]interface{})
+			flattenFields(variant[key].Object, nil, fieldsByVariant[i])
+			for field := range fieldsByVariant[i] {
+				fields[field] = true
+			}
+		}
+		for field := range fields {
+			row := MatrixRow{Resource: key, Field: field}
+			diverges := false
+			for i := range variants {
+				value, exists := fieldsByVariant[i][field]
+				row.Values = append(row.Values, value)
+				row.Present = append(row.Present, exists)
+				if i > 0 && (exists != row.Present[0] || !reflect.DeepEqual(NormalizeScalars(value), NormalizeScalars(row.Values[0]))) {
+					diverges = true
+				}
+			}
+			if diverges {
+				result.Rows = append(result.Rows, row)
+			}
+		}
+	}
+
+	sort.Slice(result.Rows, func(i, j int) bool {
+		rows := result.Rows
+		if rows[i].Resource != rows[j].Resource {
+			return rows[i].Resource < rows[j].Resource
+		}
+		return rows[i].Field < rows[j].Field
+	})
+	return result
+}
+
+// Matrix builds each overlay in dirs and returns the fields whose values
+// diverge between them
+func Matrix(fs filesys.FileSystem, dirs []string, opts Options) (*MatrixResult, error) {
+	fs = newRun(opts).contextFs(fs)
+	k := krusty.MakeKustomizer(krustyOptions(opts))
+	var variants []map[string]variantResource
+	for _, dir := range dirs {
+		variant, err := buildVariant(fs, k, dir, opts.IncludeStatus)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	result := buildMatrix(variants, !opts.CompareAll)
+	if !opts.ShowSecrets {
+		for i, row := range result.Rows {
+			if keyKind(row.Resource) != "Secret" {
+				continue
+			}
+			encoded := strings.HasPrefix(row.Field, "data.")
+			if !encoded && !strings.HasPrefix(row.Field, "stringData.") {
+				continue
+			}
+			for j, value := range row.Values {
+				if row.Present[j] {
+					result.Rows[i].Values[j] = redactValue(value, encoded)
+				}
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package kdiff
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestMatrixIncludeStatus(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	deployment := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 2
+status:
+  readyReplicas: %d
+`
+	for dir, ready := range map[string]int{"/app/dev": 1, "/app/prod": 2} {
+		assert.NoError(t, fs.WriteFile(dir+"/kustomization.yaml", []byte("resources:\n  - deployment.yaml\n")))
+		assert.NoError(t, fs.WriteFile(dir+"/deployment.yaml", []byte(fmt.Sprintf(deployment, ready))))
+	}
+	dirs := []string{"/app/dev", "/app/prod"}
+
+	result, err := Matrix(fs, dirs, Options{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Rows, "Status should be left out by default")
+	assert.Equal(t, 1, result.Unchanged)
+
+	result, err = Matrix(fs, dirs, Options{IncludeStatus: true})
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(result.Rows)) {
+		assert.Equal(t, "status.readyReplicas", result.Rows[0].Field)
+	}
+}
+
+func TestFlattenFields(t *testing.T) {
+	fields := make(map[string]interface{})
+	flattenFields(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"ports": []interface{}{
+				map[string]interface{}{"port": 80, "name": "http"},
+				map[string]interface{}{"port": 443, "name": "https"},
+			},
+			"selector": map[string]interface{}{},
+		},
+	}, nil, fields)
+
+	assert.Equal(t, map[string]interface{}{
+		"spec.ports.0.port": 80,
+		"spec.ports.0.name": "http",
+		"spec.ports.1.port": 443,
+		"spec.ports.1.name": "https",
+		"spec.selector":     map[string]interface{}{},
+	}, fields)
+}
@@ -0,0 +1,569 @@
+package kdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func parsePath(path string) []string {
+	// Remove leading slash and split by slashes
+	if len(path) > 0 && path[0] == '/' {
+		path = path[1:]
+	}
+	return strings.Split(path, "/")
+}
+
+func GetValueAtPath(m interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return m
+	}
+
+	key := path[0]
+	switch m := m.(type) {
+	case map[string]interface{}:
+		if val, exists := m[key]; exists {
+			return GetValueAtPath(val, path[1:])
+		}
+	case map[interface{}]interface{}:
+		if k, exists := findMapKey(m, key); exists {
+			return GetValueAtPath(m[k], path[1:])
+		}
+	case []interface{}:
+		if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
+			return GetValueAtPath(m[idx], path[1:])
+		}
+	}
+	return nil
+}
+
+// hasPath reports whether a value (possibly null) exists at path
+func hasPath(m interface{}, path []string) bool {
+	if len(path) == 0 {
+		return true
+	}
+
+	key := path[0]
+	switch m := m.(type) {
+	case map[string]interface{}:
+		if val, exists := m[key]; exists {
+			return hasPath(val, path[1:])
+		}
+	case map[interface{}]interface{}:
+		if k, exists := findMapKey(m, key); exists {
+			return hasPath(m[k], path[1:])
+		}
+	case []interface{}:
+		if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
+			return hasPath(m[idx], path[1:])
+		}
+	}
+	return false
+}
+
+// findMapKey returns the key of a map with non-string keys (as produced by
+// some YAML decoders) whose string form matches key
+func findMapKey(m map[interface{}]interface{}, key string) (interface{}, bool) {
+	if _, exists := m[key]; exists {
+		return key, true
+	}
+	for k := range m {
+		if fmt.Sprint(k) == key {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+func setValueAtPath(m interface{}, path []string, value interface{}) {
+	if len(path) == 0 {
+		return
+	}
+
+	key := path[0]
+	if len(path) == 1 {
+		switch m := m.(type) {
+		case map[string]interface{}:
+			m[key] = value
+		case map[interface{}]interface{}:
+			if k, exists := findMapKey(m, key); exists {
+				m[k] = value
+			} else {
+				m[key] = value
+			}
+		case []interface{}:
+			if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
+				m[idx] = value
+			}
+		}
+		return
+	}
+
+	switch m := m.(type) {
+	case map[string]interface{}:
+		if _, exists := m[key]; !exists {
+			m[key] = make(map[string]interface{})
+		}
+		setValueAtPath(m[key], path[1:], value)
+	case map[interface{}]interface{}:
+		k, exists := findMapKey(m, key)
+		if !exists {
+			k = key
+			m[k] = make(map[string]interface{})
+		}
+		setValueAtPath(m[k], path[1:], value)
+	case []interface{}:
+		if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
+			setValueAtPath(m[idx], path[1:], value)
+		}
+	}
+}
+
+// applyAdd adds value at path and returns m. Inserting into a list returns a
+// new slice, so parents store the result to keep the shifted list.
+func applyAdd(m interface{}, path []string, value interface{}) interface{} {
+	if len(path) == 0 {
+		return m
+	}
+
+	key := path[0]
+	if len(path) == 1 {
+		switch m := m.(type) {
+		case map[string]interface{}:
+			m[key] = value
+		case []interface{}:
+			if key == "-" {
+				return append(m, value)
+			}
+			if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx <= len(m) {
+				inserted := make([]interface{}, 0, len(m)+1)
+				inserted = append(inserted, m[:idx]...)
+				inserted = append(inserted, value)
+				return append(inserted, m[idx:]...)
+			}
+		}
+		return m
+	}
+
+	switch m := m.(type) {
+	case map[string]interface{}:
+		if _, exists := m[key]; !exists {
+			m[key] = make(map[string]interface{})
+		}
+		m[key] = applyAdd(m[key], path[1:], value)
+	case []interface{}:
+		if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
+			m[idx] = applyAdd(m[idx], path[1:], value)
+		}
+	}
+	return m
+}
+
+// applyReplace replaces the value at path. Like RFC 6902 it never creates
+// missing parents.
+func applyReplace(m interface{}, path []string, value interface{}) {
+	if len(path) == 0 {
+		return
+	}
+
+	key := path[0]
+	if len(path) == 1 {
+		switch m := m.(type) {
+		case map[string]interface{}:
+			m[key] = value
+		case []interface{}:
+			if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
+				m[idx] = value
+			}
+		}
+		return
+	}
+
+	switch m := m.(type) {
+	case map[string]interface{}:
+		if _, exists := m[key]; exists {
+			applyReplace(m[key], path[1:], value)
+		}
+	case []interface{}:
+		if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
+			applyReplace(m[idx], path[1:], value)
+		}
+	}
+}
+
+// applyRemove removes the value at path and returns m. Removing a list
+// element returns a new slice, so parents store the result to keep the
+// shifted list.
+func applyRemove(m interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return m
+	}
+
+	key := path[0]
+	if len(path) == 1 {
+		switch m := m.(type) {
+		case map[string]interface{}:
+			delete(m, key)
+		case []interface{}:
+			if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
+				removed := make([]interface{}, 0, len(m)-1)
+				removed = append(removed, m[:idx]...)
+				return append(removed, m[idx+1:]...)
+			}
+		}
+		return m
+	}
+
+	switch m := m.(type) {
+	case map[string]interface{}:
+		if _, exists := m[key]; exists {
+			m[key] = applyRemove(m[key], path[1:])
+		}
+	case []interface{}:
+		if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(m) {
+			m[idx] = applyRemove(m[idx], path[1:])
+		}
+	}
+	return m
+}
+
+// elementIdentity names the innermost list element that path indexes by its
+// name field, e.g. name=web, so a recorded index stays unambiguous once
+// earlier ops have shifted the list. It must be called before the op is
+// applied; for an add of a whole element the added value is named.
+func elementIdentity(m interface{}, path []string, opType string, value interface{}) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		if _, isList := GetValueAtPath(m, path[:i]).([]interface{}); !isList {
+			continue
+		}
+		element := GetValueAtPath(m, path[:i+1])
+		if opType == "add" && i == len(path)-1 {
+			element = value
+		}
+		if fields, ok := element.(map[string]interface{}); ok {
+			if name, ok := fields["name"].(string); ok {
+				return "name=" + name
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// DefaultMaxDepth is the default nesting limit for patch values and paths
+const DefaultMaxDepth = 100
+
+// errTooDeep reports a value or path nested beyond maxDepth
+func (r *run) errTooDeep() error {
+	return fmt.Errorf("nested more than %d levels deep (see -max-depth)", r.opts.MaxDepth)
+}
+
+// listMergeKeys are the fields identifying the elements of keyed lists in pod
+// specs, per the patchMergeKey of the Kubernetes schema. Ports are keyed by
+// containerPort in containers and by port in Services.
+var listMergeKeys = map[string][]string{
+	"containers":          {"name"},
+	"initContainers":      {"name"},
+	"ephemeralContainers": {"name"},
+	"env":                 {"name"},
+	"ports":               {"containerPort", "port"},
+	"volumeMounts":        {"mountPath"},
+	"volumes":             {"name"},
+	"imagePullSecrets":    {"name"},
+}
+
+// atomicLists are replaced by a patch rather than appended to, as they have
+// no merge key in the Kubernetes schema
+var atomicLists = map[string]bool{
+	"args":        true,
+	"command":     true,
+	"envFrom":     true,
+	"tolerations": true,
+}
+
+// listKeys returns the merge keys of the list at path, which may contain
+// list indexes, or nil if its elements aren't keyed or it's replaced whole
+func (r *run) listKeys(path []string) []string {
+	if len(path) == 0 || r.replacedList(path) {
+		return nil
+	}
+	if key, exists := r.opts.MergeKeys[listPath(path)]; exists {
+		return []string{key}
+	}
+	return listMergeKeys[path[len(path)-1]]
+}
+
+// replacedList reports whether patches replace the list at path, which may
+// contain list indexes, rather than merging into it
+func (r *run) replacedList(path []string) bool {
+	return len(path) > 0 && (atomicLists[path[len(path)-1]] || r.replaceLists[listPath(path)])
+}
+
+// listPath is the dotted form of path without list indexes, as lists are
+// named in mergeKeyOverrides and replaceListOverrides
+func listPath(path []string) string {
+	var fields []string
+	for _, segment := range path {
+		if _, err := strconv.Atoi(segment); err != nil {
+			fields = append(fields, segment)
+		}
+	}
+	return strings.Join(fields, ".")
+}
+
+// mergeKey returns the merge key field of element and its value
+func mergeKey(element interface{}, keys []string) (string, interface{}, bool) {
+	fields, ok := element.(map[string]interface{})
+	if !ok {
+		return "", nil, false
+	}
+	for _, key := range keys {
+		if value, exists := fields[key]; exists {
+			return key, value, true
+		}
+	}
+	return "", nil, false
+}
+
+// findKeyedElement returns the index of the element of list whose key field
+// has value, or -1
+func findKeyedElement(list []interface{}, key string, value interface{}) int {
+	for i, element := range list {
+		if fields, ok := element.(map[string]interface{}); ok {
+			if existing, exists := fields[key]; exists && reflect.DeepEqual(NormalizeScalars(existing), NormalizeScalars(value)) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// mergeKeyedList merges the elements of src into the elements of dst with
+// the same merge key, appending the others. With strictMergeKeys, elements of
+// either list without a merge key are an error.
+func (r *run) mergeKeyedList(path []string, dst, src []interface{}, keys []string, depth int) ([]interface{}, error) {
+	if r.opts.StrictMergeKeys {
+		for _, list := range [][]interface{}{dst, src} {
+			for i, element := range list {
+				if _, _, ok := mergeKey(element, keys); !ok {
+					return nil, fmt.Errorf("element %d of %s has no merge key %s", i, path[len(path)-1], strings.Join(keys, " or "))
+				}
+			}
+		}
+	}
+	for _, srcElem := range src {
+		copied, err := r.copyValue(srcElem, depth+1, make(map[uintptr]bool))
+		if err != nil {
+			return nil, err
+		}
+		if key, value, ok := mergeKey(srcElem, keys); ok {
+			if i := findKeyedElement(dst, key, value); i >= 0 {
+				if dstElem, ok := dst[i].(map[string]interface{}); ok {
+					if err := r.mergeMapDepth(dstElem, copied.(map[string]interface{}), path, depth+1); err != nil {
+						return nil, err
+					}
+					continue
+				}
+			}
+		}
+		dst = append(dst, copied)
+	}
+	return dst, nil
+}
+
+// recordMergeChanges reports each difference between the states before and
+// after a strategic merge through record: per field within maps, and per
+// element within keyed lists, with element naming the innermost keyed list
+// element, e.g. name=FOO. Other values are compared whole. Differences in
+// scalar representation are ignored.
+func (r *run) recordMergeChanges(before, after interface{}, path []string, element string, record func(path []string, element string, before, after interface{})) {
+	switch after := after.(type) {
+	case map[string]interface{}:
+		if before, ok := before.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(after)+len(before))
+			for key := range after {
+				keys = append(keys, key)
+			}
+			for key := range before {
+				if _, exists := after[key]; !exists {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				beforeVal, inBefore := before[key]
+				afterVal, inAfter := after[key]
+				if inBefore != inAfter {
+					record(appendPath(path, key), element, beforeVal, afterVal)
+					continue
+				}
+				r.recordMergeChanges(beforeVal, afterVal, appendPath(path, key), element, record)
+			}
+			return
+		}
+	case []interface{}:
+		keys := r.listKeys(path)
+		if before, ok := before.([]interface{}); ok && keys != nil {
+			for i, afterElem := range after {
+				key, value, ok := mergeKey(afterElem, keys)
+				if !ok {
+					if i >= len(before) || !reflect.DeepEqual(NormalizeScalars(before[i]), NormalizeScalars(afterElem)) {
+						record(appendPath(path, strconv.Itoa(i)), element, nil, afterElem)
+					}
+					continue
+				}
+				identity := fmt.Sprintf("%s=%v", key, value)
+				if j := findKeyedElement(before, key, value); j >= 0 {
+					r.recordMergeChanges(before[j], afterElem, appendPath(path, strconv.Itoa(i)), identity, record)
+				} else {
+					record(appendPath(path, strconv.Itoa(i)), identity, nil, afterElem)
+				}
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(NormalizeScalars(before), NormalizeScalars(after)) {
+		record(path, element, before, after)
+	}
+}
+
+// mergeMap merges src into dst. Values taken from src are deep-copied so dst
+// never shares nodes with src (or with itself, when src reuses aliased nodes).
+// Lists in mergeKeyOverrides or listMergeKeys are merged element by element,
+// atomicLists and replaceListOverrides are replaced and other lists are
+// appended to.
+func (r *run) mergeMap(dst, src map[string]interface{}) error {
+	return r.mergeMapDepth(dst, src, nil, 0)
+}
+
+// mergeMapDepth merges src into dst at path, which leaves out list indexes
+func (r *run) mergeMapDepth(dst, src map[string]interface{}, path []string, depth int) error {
+	if depth > r.opts.MaxDepth {
+		return r.errTooDeep()
+	}
+	for key, srcVal := range src {
+		if dstVal, exists := dst[key]; exists {
+			switch srcVal := srcVal.(type) {
+			case map[string]interface{}:
+				if dstVal, ok := dstVal.(map[string]interface{}); ok {
+					if err := r.mergeMapDepth(dstVal, srcVal, appendPath(path, key), depth+1); err != nil {
+						return err
+					}
+					continue
+				}
+			case []interface{}:
+				keys := r.listKeys(appendPath(path, key))
+				if dstVal, ok := dstVal.([]interface{}); ok && keys != nil {
+					merged, err := r.mergeKeyedList(appendPath(path, key), dstVal, srcVal, keys, depth)
+					if err != nil {
+						return err
+					}
+					dst[key] = merged
+					continue
+				}
+				if dstVal, ok := dstVal.([]interface{}); ok && !r.replacedList(appendPath(path, key)) {
+					copied, err := r.copyValue(srcVal, depth+1, make(map[uintptr]bool))
+					if err != nil {
+						return err
+					}
+					dst[key] = append(dstVal, copied.([]interface{})...)
+					continue
+				}
+			}
+		}
+		copied, err := r.copyValue(srcVal, depth+1, make(map[uintptr]bool))
+		if err != nil {
+			return err
+		}
+		dst[key] = copied
+	}
+	return nil
+}
+
+// deepCopyValue copies decoded YAML content. Maps with non-string keys are
+// normalized to string-keyed maps and json.Number values to float64, matching
+// what sigs.k8s.io/yaml produces for resources. Values nested beyond maxDepth
+// or containing themselves are an error.
+func (r *run) deepCopyValue(v interface{}) (interface{}, error) {
+	return r.copyValue(v, 0, make(map[uintptr]bool))
+}
+
+// copyValue copies v at the given depth. ancestors holds the maps and lists
+// enclosing v; nodes shared between siblings through YAML aliases are fine.
+func (r *run) copyValue(v interface{}, depth int, ancestors map[uintptr]bool) (interface{}, error) {
+	if depth > r.opts.MaxDepth {
+		return nil, r.errTooDeep()
+	}
+	switch v.(type) {
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		if ptr := reflect.ValueOf(v).Pointer(); ptr != 0 {
+			if ancestors[ptr] {
+				return nil, fmt.Errorf("value contains itself")
+			}
+			ancestors[ptr] = true
+			defer delete(ancestors, ptr)
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		newMap := make(map[string]interface{})
+		for k, val := range v {
+			copied, err := r.copyValue(val, depth+1, ancestors)
+			if err != nil {
+				return nil, err
+			}
+			newMap[k] = copied
+		}
+		return newMap, nil
+	case map[interface{}]interface{}:
+		newMap := make(map[string]interface{})
+		for k, val := range v {
+			copied, err := r.copyValue(val, depth+1, ancestors)
+			if err != nil {
+				return nil, err
+			}
+			newMap[fmt.Sprint(k)] = copied
+		}
+		return newMap, nil
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f, nil
+		}
+		return v.String(), nil
+	case []interface{}:
+		newSlice := make([]interface{}, len(v))
+		for i, val := range v {
+			copied, err := r.copyValue(val, depth+1, ancestors)
+			if err != nil {
+				return nil, err
+			}
+			newSlice[i] = copied
+		}
+		return newSlice, nil
+	default:
+		return v, nil
+	}
+}
+
+// ListElementName names the list element at path in object by its merge key,
+// e.g. name=web, or returns "" if it isn't a keyed element of a list. Lists
+// are keyed as in a run with opts, i.e. by opts.MergeKeys and
+// opts.ReplaceLists.
+func ListElementName(object interface{}, path []string, opts Options) string {
+	if _, isList := GetValueAtPath(object, path[:len(path)-1]).([]interface{}); !isList {
+		return ""
+	}
+	keys := newRun(opts).listKeys(path[:len(path)-1])
+	if keys == nil {
+		keys = []string{"name"}
+	}
+	key, value, ok := mergeKey(GetValueAtPath(object, path), keys)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%s=%v", key, value)
+}
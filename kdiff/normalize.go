@@ -0,0 +1,129 @@
+package kdiff
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+
+	"github.com/r3labs/diff/v3"
+)
+
+// decimalNumber matches the strings NormalizeScalars treats as numbers. Forms
+// like 0x10, 1e3 or 010 are left as strings, as they rarely mean a number.
+var decimalNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+
+// NormalizeScalars returns a copy of value with equivalent scalars in one
+// representation, so values that only differ in YAML quoting or number
+// formatting compare equal: "true" becomes true, and "8080", 8080 and 8080.0
+// all become int64 8080. It's for comparing values only; recorded values go
+// through NormalizeNumbers instead.
+func NormalizeScalars(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(value))
+		for key, child := range value {
+			normalized[key] = NormalizeScalars(child)
+		}
+		return normalized
+	case []interface{}:
+		normalized := make([]interface{}, len(value))
+		for i, child := range value {
+			normalized[i] = NormalizeScalars(child)
+		}
+		return normalized
+	case string:
+		switch {
+		case value == "true":
+			return true
+		case value == "false":
+			return false
+		case decimalNumber.MatchString(value):
+			if number, err := strconv.ParseFloat(value, 64); err == nil {
+				return normalizeNumber(number)
+			}
+		}
+		return value
+	case int:
+		return int64(value)
+	case int32:
+		return int64(value)
+	case float32:
+		return normalizeNumber(float64(value))
+	case float64:
+		return normalizeNumber(value)
+	default:
+		return value
+	}
+}
+
+// normalizeNumber returns a whole number as int64 and anything else, including
+// numbers beyond the int64 range, as float64
+func normalizeNumber(number float64) interface{} {
+	if number == math.Trunc(number) && math.Abs(number) < 1<<63 {
+		return int64(number)
+	}
+	return number
+}
+
+// NormalizeNumbers returns a copy of value with whole numbers as int64 rather
+// than the float64 the YAML to JSON round trip makes of them. Other scalars,
+// including quoted numbers and booleans, keep the type they were written
+// with.
+func NormalizeNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(value))
+		for key, child := range value {
+			normalized[key] = NormalizeNumbers(child)
+		}
+		return normalized
+	case []interface{}:
+		normalized := make([]interface{}, len(value))
+		for i, child := range value {
+			normalized[i] = NormalizeNumbers(child)
+		}
+		return normalized
+	case int:
+		return int64(value)
+	case int32:
+		return int64(value)
+	case float32:
+		return normalizeNumber(float64(value))
+	case float64:
+		return normalizeNumber(value)
+	default:
+		return value
+	}
+}
+
+// normalizeObject prepares a rendered or live object for recording changes
+// to, normalizing its numbers in place. Unless includeStatus is set, the
+// status subtree is dropped, as the server populates it and a kustomization
+// rarely sets it.
+func normalizeObject(object map[string]interface{}, includeStatus bool) {
+	if !includeStatus {
+		delete(object, "status")
+	}
+	for key, value := range object {
+		object[key] = NormalizeNumbers(value)
+	}
+}
+
+// diffObjects returns the changes from before to after. Scalars are compared
+// normalized, so a change of representation alone isn't one, but each change
+// records the values as written, with only their numbers normalized.
+func (r *run) diffObjects(before, after interface{}) (diff.Changelog, error) {
+	changelog, err := r.opts.Differ.Diff(NormalizeScalars(before), NormalizeScalars(after))
+	if err != nil {
+		return nil, err
+	}
+	for i, change := range changelog {
+		if change.From != nil && hasPath(before, change.Path) {
+			changelog[i].From = NormalizeNumbers(GetValueAtPath(before, change.Path))
+		}
+		if change.To != nil && hasPath(after, change.Path) {
+			changelog[i].To = NormalizeNumbers(GetValueAtPath(after, change.Path))
+		}
+	}
+	return changelog, nil
+}
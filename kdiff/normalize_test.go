@@ -0,0 +1,103 @@
+package kdiff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeScalars(t *testing.T) {
+	cases := []struct {
+		value    interface{}
+		expected interface{}
+	}{
+		{"true", true},
+		{"false", false},
+		{"8080", int64(8080)},
+		{"-1.5", -1.5},
+		{"2.0", int64(2)},
+		{8080, int64(8080)},
+		{int64(3), int64(3)},
+		{float64(1.0), int64(1)},
+		{0.5, 0.5},
+		{1e20, 1e20},
+		{"010", "010"},
+		{"0x10", "0x10"},
+		{"1e3", "1e3"},
+		{"True", "True"},
+		{"web", "web"},
+		{nil, nil},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, NormalizeScalars(c.value), "normalizing %#v", c.value)
+	}
+
+	nested := map[string]interface{}{
+		"ports": []interface{}{map[string]interface{}{"containerPort": "8080"}},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"ports": []interface{}{map[string]interface{}{"containerPort": int64(8080)}},
+	}, NormalizeScalars(nested))
+	assert.Equal(t, "8080", nested["ports"].([]interface{})[0].(map[string]interface{})["containerPort"], "Should not modify its argument")
+}
+
+func TestNormalizeNumbers(t *testing.T) {
+	cases := []struct {
+		value    interface{}
+		expected interface{}
+	}{
+		{float64(3), int64(3)},
+		{8080, int64(8080)},
+		{0.5, 0.5},
+		{"8080", "8080"},
+		{"true", "true"},
+		{true, true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, NormalizeNumbers(c.value), "normalizing %#v", c.value)
+	}
+}
+
+func TestNormalizeObject(t *testing.T) {
+	object := map[string]interface{}{
+		"spec":   map[string]interface{}{"paused": "true", "replicas": float64(2)},
+		"status": map[string]interface{}{"replicas": 1},
+	}
+	normalizeObject(object, true)
+	assert.Equal(t, map[string]interface{}{
+		"spec":   map[string]interface{}{"paused": "true", "replicas": int64(2)},
+		"status": map[string]interface{}{"replicas": int64(1)},
+	}, object, "Only numbers should be normalized")
+
+	normalizeObject(object, false)
+	assert.NotContains(t, object, "status")
+}
+
+func TestDiffObjects(t *testing.T) {
+	r := newRun(Options{})
+	before := map[string]interface{}{
+		"port":    "8080",
+		"enabled": "true",
+		"image":   "app:1.0",
+		"limits":  map[string]interface{}{"cpu": float64(1)},
+	}
+	after := map[string]interface{}{
+		"port":    float64(8080),
+		"enabled": true,
+		"image":   "app:2.0",
+		"limits":  map[string]interface{}{"cpu": float64(2)},
+		"paused":  "false",
+	}
+	changelog, err := r.diffObjects(before, after)
+	assert.NoError(t, err)
+	byPath := make(map[string][2]interface{})
+	for _, change := range changelog {
+		byPath[strings.Join(change.Path, ".")] = [2]interface{}{change.From, change.To}
+	}
+	assert.Equal(t, map[string][2]interface{}{
+		"image":      {"app:1.0", "app:2.0"},
+		"limits.cpu": {int64(1), int64(2)},
+		"paused":     {nil, "false"},
+	}, byPath, "Quoting changes aren't changes, and values keep their written type")
+}
@@ -0,0 +1,36 @@
+package kdiff
+
+import (
+	"sigs.k8s.io/kustomize/api/resmap"
+)
+
+// OrderChange is a resource that sortOptions moved: its position in the final
+// output differs from its position in declaration order
+type OrderChange struct {
+	Resource string `json:"resource"`
+	From     int    `json:"from"` // Position in declaration order, from 1
+	To       int    `json:"to"`   // Position in the final output, from 1
+}
+
+// orderChanges returns the resources whose position in final differs from
+// their position in declared, in final order
+func orderChanges(declared, final resmap.ResMap) []OrderChange {
+	positions := make(map[string]int)
+	for i, res := range declared.Resources() {
+		positions[res.CurId().String()] = i + 1
+	}
+
+	var changes []OrderChange
+	for i, res := range final.Resources() {
+		from, exists := positions[res.CurId().String()]
+		if !exists || from == i+1 {
+			continue
+		}
+		changes = append(changes, OrderChange{
+			Resource: ResourceKey(res),
+			From:     from,
+			To:       i + 1,
+		})
+	}
+	return changes
+}
@@ -0,0 +1,86 @@
+package kdiff
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/yaml"
+)
+
+// OriginAnnotation is set by kustomize on each resource when buildMetadata
+// includes originAnnotations
+const OriginAnnotation = "config.kubernetes.io/origin"
+
+// OriginMismatch is a resource whose origin, as we attribute it, differs from
+// the origin kustomize records
+type OriginMismatch struct {
+	Resource  string // ResourceKey in the final build
+	Ours      string // File or kustomization we attribute the resource to
+	Kustomize string // File or kustomization of kustomize's origin annotation
+}
+
+// ResourceOrigin is the content of an origin annotation. Path is set for
+// resources loaded from files, ConfiguredIn for generated ones; both are
+// relative to the root kustomization. Repo is set for remote resources.
+type ResourceOrigin struct {
+	Path         string `json:"path,omitempty"`
+	Repo         string `json:"repo,omitempty"`
+	ConfiguredIn string `json:"configuredIn,omitempty"`
+}
+
+// verifyOrigins builds dir with origin annotations and compares kustomize's
+// origin of each resource with the file we loaded it from, or the
+// kustomization we attribute its generator to. Resources we don't attribute,
+// e.g. ones renamed by a prefix, and remote resources aren't compared.
+func (r *run) verifyOrigins(fs filesys.FileSystem, k *krusty.Kustomizer, dir, kustPath string, kust *types.Kustomization, generated []GeneratedResource) ([]OriginMismatch, error) {
+	annotated := *kust
+	annotated.BuildMetadata = []string{types.OriginAnnotations}
+	for _, option := range kust.BuildMetadata {
+		if option != types.OriginAnnotations {
+			annotated.BuildMetadata = append(annotated.BuildMetadata, option)
+		}
+	}
+	resMap, err := r.buildOverride(fs, k, dir, kustPath, &annotated)
+	if err != nil {
+		return nil, fmt.Errorf("build with origin annotations: %w", err)
+	}
+
+	generators := make(map[string]string)
+	for _, gen := range generated {
+		generators[gen.Resource] = gen.Source
+	}
+
+	var mismatches []OriginMismatch
+	for _, res := range resMap.Resources() {
+		key := ResourceKey(res)
+		data, exists := res.GetAnnotations()[OriginAnnotation]
+		if !exists {
+			continue
+		}
+		var origin ResourceOrigin
+		if err := yaml.Unmarshal([]byte(data), &origin); err != nil {
+			return nil, fmt.Errorf("parsing origin of %s: %w", key, err)
+		}
+
+		var ours, theirs string
+		switch {
+		case origin.Repo != "":
+			continue
+		case origin.ConfiguredIn != "":
+			ours, theirs = generators[key], origin.ConfiguredIn
+		default:
+			ours, theirs = r.resourceOrigins[key], origin.Path
+		}
+		if ours == "" || theirs == "" {
+			continue
+		}
+		theirs = filepath.Join(dir, theirs)
+		if filepath.Clean(ours) != theirs {
+			mismatches = append(mismatches, OriginMismatch{Resource: key, Ours: ours, Kustomize: theirs})
+		}
+	}
+	return mismatches, nil
+}
@@ -0,0 +1,52 @@
+package kdiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestDiffVerifyOrigins(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/base/kustomization.yaml": "resources:\n  - deployment.yaml\n",
+		"/app/base/deployment.yaml":    "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n",
+		"/app/prod/kustomization.yaml": `
+buildMetadata: [originAnnotations]
+resources:
+  - ../base
+  - service.yaml
+configMapGenerator:
+  - name: settings
+    literals:
+      - mode=prod
+`,
+		"/app/prod/service.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n",
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app/prod", Options{VerifyOrigins: true})
+	assert.NoError(t, err)
+	assert.Empty(t, result.OriginMismatches, "Files and generators should be attributed like kustomize does")
+
+	// Resources are tracked by resid, so the same name in two namespaces
+	// keeps the file each was loaded from
+	files = map[string]string{
+		"/app/multi/kustomization.yaml": "resources:\n  - a.yaml\n  - b.yaml\n",
+		"/app/multi/a.yaml":             "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: a\n",
+		"/app/multi/b.yaml":             "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: b\n",
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+	result, err = Diff(fs, "/app/multi", Options{VerifyOrigins: true})
+	assert.NoError(t, err)
+	assert.Empty(t, result.OriginMismatches)
+	assert.Equal(t, map[string]string{
+		"Deployment.v1.apps/web.a": "/app/multi/a.yaml",
+		"Deployment.v1.apps/web.b": "/app/multi/b.yaml",
+	}, result.Origins)
+}
@@ -0,0 +1,288 @@
+package kdiff
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// kindAliases maps kubectl short names to canonical kinds
+var kindAliases = map[string]string{
+	"cm":     "ConfigMap",
+	"cj":     "CronJob",
+	"deploy": "Deployment",
+	"ds":     "DaemonSet",
+	"hpa":    "HorizontalPodAutoscaler",
+	"ing":    "Ingress",
+	"ns":     "Namespace",
+	"pdb":    "PodDisruptionBudget",
+	"po":     "Pod",
+	"pvc":    "PersistentVolumeClaim",
+	"rs":     "ReplicaSet",
+	"sa":     "ServiceAccount",
+	"sts":    "StatefulSet",
+	"svc":    "Service",
+}
+
+// CanonicalKind resolves a kind alias such as deploy to its canonical kind. It
+// reports whether kind was an alias.
+func CanonicalKind(kind string) (string, bool) {
+	if canonical, exists := kindAliases[strings.ToLower(kind)]; exists {
+		return canonical, true
+	}
+	return kind, false
+}
+
+// patchCandidates returns the resources a patch is matched against: those of
+// the run, or of scope if the patch's kustomization has one, as earlier
+// patches left them in patched. Scoped resources keep their identity from
+// before their kustomization's transformers and take on the labels and
+// annotations earlier patches changed.
+func patchCandidates(allResources, patched, scope map[string]*resource.Resource) (map[string]*resource.Resource, error) {
+	candidates := make(map[string]*resource.Resource)
+	for key, res := range allResources {
+		state, isPatched := patched[key]
+		switch {
+		case scope == nil && isPatched:
+			candidates[key] = state
+		case scope == nil:
+			candidates[key] = res
+		case scope[key] == nil:
+			// Outside the patch's kustomization
+		case isPatched:
+			seen := scope[key].DeepCopy()
+			if err := seen.SetLabels(patchedMetadata(seen.GetLabels(), res.GetLabels(), state.GetLabels())); err != nil {
+				return nil, fmt.Errorf("resource %s: %w", key, err)
+			}
+			if err := seen.SetAnnotations(patchedMetadata(seen.GetAnnotations(), res.GetAnnotations(), state.GetAnnotations())); err != nil {
+				return nil, fmt.Errorf("resource %s: %w", key, err)
+			}
+			candidates[key] = seen
+		default:
+			candidates[key] = scope[key]
+		}
+	}
+	return candidates, nil
+}
+
+// patchedMetadata returns seen with the entries that differ between base and
+// patched set as in patched
+func patchedMetadata(seen, base, patched map[string]string) map[string]string {
+	result := types.CopyMap(seen)
+	if result == nil {
+		result = make(map[string]string)
+	}
+	for name, value := range patched {
+		if previous, exists := base[name]; !exists || previous != value {
+			result[name] = value
+		}
+	}
+	for name := range base {
+		if _, kept := patched[name]; !kept {
+			delete(result, name)
+		}
+	}
+	return result
+}
+
+// findPatchTarget returns the keys of the resources a patch target selects
+// among allResources, in key order. Kind aliases are resolved to their
+// canonical kind. As in kustomize, a target without a name selects every
+// resource of its kind, and a target without a namespace matches resources in
+// any namespace, unless strictNamespace requires the namespaces to be equal.
+func findPatchTarget(allResources map[string]*resource.Resource, target *types.Selector, strictNamespace bool) []string {
+	keys := make([]string, 0, len(allResources))
+	for key := range allResources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var matches []string
+	for _, key := range keys {
+		res := allResources[key]
+		if kind, _ := CanonicalKind(target.Kind); target.Kind != "" && res.GetKind() != kind {
+			continue
+		}
+		if target.Name != "" && res.GetName() != target.Name {
+			continue
+		}
+		if (target.Namespace != "" || strictNamespace) && res.GetNamespace() != target.Namespace {
+			continue
+		}
+		// Invalid selectors are rejected by validatePatches
+		if target.LabelSelector != "" {
+			if matches, err := res.MatchesLabelSelector(target.LabelSelector); err != nil || !matches {
+				continue
+			}
+		}
+		if target.AnnotationSelector != "" {
+			if matches, err := res.MatchesAnnotationSelector(target.AnnotationSelector); err != nil || !matches {
+				continue
+			}
+		}
+		matches = append(matches, key)
+	}
+	return matches
+}
+
+// renameResource moves the resource at key to the identity a patch gave it,
+// e.g. with allowNameChange, along with its origin and the changes recorded
+// for it so far, and returns its new key. Its content is left unpatched,
+// like every other base resource's.
+func (r *run) renameResource(allResources map[string]*resource.Resource, key string, patched *resource.Resource) (string, error) {
+	renamed := allResources[key].DeepCopy()
+	renamed.SetKind(patched.GetKind())
+	if err := renamed.SetName(patched.GetName()); err != nil {
+		return "", fmt.Errorf("failed to rename %s: %w", key, err)
+	}
+	newKey := ResourceKey(renamed)
+	delete(allResources, key)
+	allResources[newKey] = renamed
+
+	if origin, ok := r.resourceOrigins[key]; ok {
+		delete(r.resourceOrigins, key)
+		r.resourceOrigins[newKey] = origin
+	}
+	for i := range r.fieldSources {
+		if r.fieldSources[i].Resource == key {
+			r.fieldSources[i].Resource = newKey
+		}
+	}
+	return newKey, nil
+}
+
+// collectPatches appends the patches and JSON patches of the kustomization
+// in dir to allPatches, with file paths resolved against dir under
+// restrictions
+func collectPatches(dir string, kust *types.Kustomization, restrictions types.LoadRestrictions, allPatches *[]types.Patch) error {
+	var err error
+	for _, patch := range kust.Patches {
+		if patch.Path != "" {
+			if patch.Path, err = resolvePatchPath(dir, patch.Path, restrictions); err != nil {
+				return err
+			}
+		}
+		*allPatches = append(*allPatches, patch)
+	}
+
+	for _, patch := range kust.PatchesJson6902 {
+		if patch.Path != "" {
+			if patch.Path, err = resolvePatchPath(dir, patch.Path, restrictions); err != nil {
+				return err
+			}
+		}
+		*allPatches = append(*allPatches, types.Patch{
+			Target: patch.Target,
+			Patch:  string(patch.Patch),
+		})
+	}
+	return nil
+}
+
+// readPatchData returns the body of a patch, from its file or inline
+func readPatchData(fs filesys.FileSystem, patch types.Patch) ([]byte, error) {
+	if patch.Path == "" {
+		return []byte(patch.Patch), nil
+	}
+	data, err := fs.ReadFile(patch.Path)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// patchDocumentTarget returns a target selecting the resource a strategic
+// merge patch document names by kind, name and namespace, or nil if it
+// doesn't name one
+func patchDocumentTarget(data []byte) *types.Selector {
+	var object struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+	}
+	if err := yaml.Unmarshal(data, &object); err != nil || object.Kind == "" || object.Metadata.Name == "" {
+		return nil
+	}
+	return &types.Selector{ResId: resid.ResId{
+		Gvk:       resid.Gvk{Kind: object.Kind},
+		Name:      object.Metadata.Name,
+		Namespace: object.Metadata.Namespace,
+	}}
+}
+
+// generateNameOnly returns the metadata.generateName of a resource document
+// without a metadata.name, or ""
+func generateNameOnly(data []byte) string {
+	var object struct {
+		Metadata struct {
+			Name         string `json:"name"`
+			GenerateName string `json:"generateName"`
+		} `json:"metadata"`
+	}
+	if err := yaml.Unmarshal(data, &object); err != nil || object.Metadata.Name != "" {
+		return ""
+	}
+	return object.Metadata.GenerateName
+}
+
+// resolvePatchPath joins a patch path to the kustomization directory that
+// declares it. Unless restrictions is LoadRestrictionsNone a path escaping
+// dir is rejected, as kustomize's default root-only restrictor would.
+func resolvePatchPath(dir, path string, restrictions types.LoadRestrictions) (string, error) {
+	resolved := filepath.Join(dir, path)
+	if restrictions == types.LoadRestrictionsNone {
+		return resolved, nil
+	}
+	rel, err := filepath.Rel(filepath.Clean(dir), resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("patch %s is outside the kustomization root %s (use -load-restrictor none to allow it)", path, dir)
+	}
+	return resolved, nil
+}
+
+// validatePatches rejects patch entries that set both a file path and an
+// inline patch body, matching kustomize's own validation
+func validatePatches(kust *types.Kustomization, dir string) error {
+	for i, patch := range kust.Patches {
+		if patch.Path != "" && patch.Patch != "" {
+			return fmt.Errorf("patches[%d] in %s: patch and path can't be set at the same time (path: %s)", i, dir, patch.Path)
+		}
+		if patch.Target == nil {
+			continue
+		}
+		if _, err := kyaml.NewMapRNode(nil).MatchesLabelSelector(patch.Target.LabelSelector); err != nil {
+			return fmt.Errorf("patches[%d] in %s: invalid labelSelector %q: %w", i, dir, patch.Target.LabelSelector, err)
+		}
+		if _, err := kyaml.NewMapRNode(nil).MatchesAnnotationSelector(patch.Target.AnnotationSelector); err != nil {
+			return fmt.Errorf("patches[%d] in %s: invalid annotationSelector %q: %w", i, dir, patch.Target.AnnotationSelector, err)
+		}
+	}
+	for i, patch := range kust.PatchesJson6902 {
+		if patch.Path != "" && patch.Patch != "" {
+			return fmt.Errorf("patchesJson6902[%d] in %s: patch and path can't be set at the same time (path: %s)", i, dir, patch.Path)
+		}
+	}
+	return nil
+}
+
+// DescribePatch names a patch for the summary: its file, or its target for
+// inline patches
+func DescribePatch(patch types.Patch) string {
+	if patch.Path != "" {
+		return patch.Path
+	}
+	if patch.Target == nil {
+		return "inline patch"
+	}
+	return fmt.Sprintf("inline patch (%s/%s)", patch.Target.Kind, patch.Target.Name)
+}
@@ -0,0 +1,127 @@
+package kdiff
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/yaml"
+)
+
+// PatchInfo describes a collected patch for -list-patches
+type PatchInfo struct {
+	Path   string          `json:"path,omitempty"` // Absolute patch file, empty for inline patches
+	Inline bool            `json:"inline,omitempty"`
+	Type   string          `json:"type,omitempty"` // SourceTypePatch or SourceTypeJSONPatch, empty if unreadable
+	Target *types.Selector `json:"target,omitempty"`
+}
+
+// ListPatches collects the patches of the kustomization in dir and its bases
+// and components, in application order, without applying them
+func ListPatches(fs filesys.FileSystem, dir string, opts Options) ([]PatchInfo, error) {
+	r := newRun(opts)
+	fs = r.contextFs(fs)
+
+	_, kustData, err := readKustomizationFile(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	var kust types.Kustomization
+	if err := yaml.Unmarshal(kustData, &kust); err != nil {
+		return nil, fmt.Errorf("failed parsing kustomization.yaml: %w", err)
+	}
+	if err := validatePatches(&kust, dir); err != nil {
+		return nil, fmt.Errorf("invalid kustomization.yaml: %w", err)
+	}
+
+	leave, err := r.enterKustomization(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+
+	k := krusty.MakeKustomizer(krustyOptions(opts))
+	allPatches := make([]types.Patch, 0)
+	allResources := make(map[string]*resource.Resource)
+	for _, path := range append(append([]string{}, kust.Resources...), kust.Components...) {
+		resolved, err := r.resolveResource(dir, path)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.processResourceOrKustomization(fs, k, resolved, opts.LoadRestrictions, &allPatches, allResources); err != nil {
+			return nil, err
+		}
+	}
+	if err := collectPatches(dir, &kust, opts.LoadRestrictions, &allPatches); err != nil {
+		return nil, err
+	}
+
+	patches := make([]PatchInfo, 0, len(allPatches))
+	for _, patch := range allPatches {
+		patches = append(patches, PatchInfo{
+			Path:   patch.Path,
+			Inline: patch.Path == "",
+			Type:   patchType(fs, patch),
+			Target: patch.Target,
+		})
+	}
+	return patches, nil
+}
+
+// patchType tells strategic merge patches from JSON patches by their
+// content, as kustomize does, or returns "" if it can't be read or parsed
+func patchType(fs filesys.FileSystem, patch types.Patch) string {
+	data := []byte(patch.Patch)
+	if patch.Path != "" {
+		var err error
+		if data, err = fs.ReadFile(patch.Path); err != nil {
+			return ""
+		}
+	}
+	var content interface{}
+	if err := yaml.Unmarshal(data, &content); err != nil {
+		return ""
+	}
+	switch content.(type) {
+	case []interface{}:
+		return SourceTypeJSONPatch
+	case map[string]interface{}:
+		return SourceTypePatch
+	}
+	return ""
+}
+
+// DescribeTarget summarizes a patch target selector, e.g.
+// apps/v1 Deployment/web in prod, labels app=web
+func DescribeTarget(target *types.Selector) string {
+	if target == nil {
+		return "none (the patch's own kind and name)"
+	}
+	var parts []string
+	if gv := strings.Trim(target.Group+"/"+target.Version, "/"); gv != "" {
+		parts = append(parts, gv)
+	}
+	kind := target.Kind
+	if kind == "" {
+		kind = "*"
+	}
+	name := target.Name
+	if name == "" {
+		name = "*"
+	}
+	parts = append(parts, kind+"/"+name)
+	description := strings.Join(parts, " ")
+	if target.Namespace != "" {
+		description += " in " + target.Namespace
+	}
+	if target.LabelSelector != "" {
+		description += ", labels " + target.LabelSelector
+	}
+	if target.AnnotationSelector != "" {
+		description += ", annotations " + target.AnnotationSelector
+	}
+	return description
+}
@@ -0,0 +1,180 @@
+package kdiff
+
+import (
+	"encoding/base64"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/r3labs/diff/v3"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// FieldSourceProcessor rewrites recorded changes before they're reported,
+// e.g. to redact or rewrite values for display
+type FieldSourceProcessor func([]FieldSource) []FieldSource
+
+// applyProcessors runs each processor over sources in order
+func applyProcessors(processors []FieldSourceProcessor, sources []FieldSource) []FieldSource {
+	for _, process := range processors {
+		sources = process(sources)
+	}
+	return sources
+}
+
+// redactedValue returns the placeholder shown instead of a Secret value. data
+// values are base64 encoded, so their decoded size is reported.
+func redactedValue(value string, encoded bool) string {
+	size := len(value)
+	if encoded {
+		if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+			size = len(decoded)
+		}
+	}
+	return fmt.Sprintf("<redacted: %d bytes>", size)
+}
+
+// RedactSecrets masks the data and stringData values of Secret changes.
+// Changes recorded at the data key itself hold the whole map, so each of its
+// values is masked and the keys are kept.
+func RedactSecrets(sources []FieldSource) []FieldSource {
+	redacted := make([]FieldSource, len(sources))
+	for i, source := range sources {
+		redacted[i] = source
+		if keyKind(source.Resource) != "Secret" || len(source.Path) == 0 {
+			continue
+		}
+		if source.Path[0] != "data" && source.Path[0] != "stringData" {
+			continue
+		}
+		encoded := source.Path[0] == "data"
+		redacted[i].Original = redactValue(source.Original, encoded)
+		redacted[i].New = redactValue(source.New, encoded)
+	}
+	return redacted
+}
+
+// redactChangelog masks the data and stringData values in changelog, the
+// changes a patch made to the resource at key, as RedactSecrets does
+func redactChangelog(key string, changelog diff.Changelog) diff.Changelog {
+	sources := make([]FieldSource, len(changelog))
+	for i, change := range changelog {
+		sources[i] = FieldSource{Resource: key, Path: change.Path, Original: change.From, New: change.To}
+	}
+	redacted := make(diff.Changelog, len(changelog))
+	for i, source := range RedactSecrets(sources) {
+		redacted[i] = changelog[i]
+		redacted[i].From = source.Original
+		redacted[i].To = source.New
+	}
+	return redacted
+}
+
+// redactValue masks a value, keeping the keys of maps and nil for absent
+// values so additions and removals still read as such
+func redactValue(value interface{}, encoded bool) interface{} {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		masked := make(map[string]interface{}, len(value))
+		for key, v := range value {
+			masked[key] = redactValue(v, encoded)
+		}
+		return masked
+	case string:
+		return redactedValue(value, encoded)
+	}
+	return redactedValue(fmt.Sprint(value), false)
+}
+
+// Base64Decoder returns a processor that shows the base64-encoded values of
+// ConfigMap binaryData, and of Secret data with showSecrets, as plain text.
+// Values that aren't valid base64 or don't decode to text are kept as they
+// are. Masked Secrets are left alone, so redaction wins.
+func Base64Decoder(showSecrets bool) FieldSourceProcessor {
+	return func(sources []FieldSource) []FieldSource {
+		decoded := make([]FieldSource, len(sources))
+		for i, source := range sources {
+			decoded[i] = source
+			if len(source.Path) == 0 {
+				continue
+			}
+			configMap := keyKind(source.Resource) == "ConfigMap" && source.Path[0] == "binaryData"
+			secret := showSecrets && keyKind(source.Resource) == "Secret" && source.Path[0] == "data"
+			if !configMap && !secret {
+				continue
+			}
+			decoded[i].Original = decodeBase64Value(source.Original)
+			decoded[i].New = decodeBase64Value(source.New)
+		}
+		return decoded
+	}
+}
+
+// decodeBase64Value decodes a base64 string, or each value of a map of them
+func decodeBase64Value(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		decoded := make(map[string]interface{}, len(value))
+		for key, v := range value {
+			decoded[key] = decodeBase64Value(v)
+		}
+		return decoded
+	case string:
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || !utf8.Valid(data) {
+			return value
+		}
+		return string(data)
+	}
+	return value
+}
+
+// RedactSecretResources returns a copy of resMap with the data and stringData
+// values of Secrets masked
+func RedactSecretResources(resMap resmap.ResMap) (resmap.ResMap, error) {
+	redacted := resMap.DeepCopy()
+	for _, res := range redacted.Resources() {
+		if res.GetKind() != "Secret" {
+			continue
+		}
+		for _, field := range []string{"data", "stringData"} {
+			node, err := res.Pipe(kyaml.Lookup(field))
+			if err != nil {
+				return nil, err
+			}
+			if node == nil {
+				continue
+			}
+			err = node.VisitFields(func(entry *kyaml.MapNode) error {
+				value := entry.Value.YNode()
+				value.Value = redactedValue(value.Value, field == "data")
+				value.Tag = kyaml.NodeTagString
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return redacted, nil
+}
+
+// RedactSecretResource returns res, or a copy with its values masked if it's
+// a Secret
+func RedactSecretResource(res *resource.Resource) (*resource.Resource, error) {
+	if res.GetKind() != "Secret" {
+		return res, nil
+	}
+	resMap := resmap.New()
+	if err := resMap.Append(res.DeepCopy()); err != nil {
+		return nil, err
+	}
+	redacted, err := RedactSecretResources(resMap)
+	if err != nil {
+		return nil, err
+	}
+	return redacted.Resources()[0], nil
+}
@@ -0,0 +1,161 @@
+package kdiff
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	sources := []FieldSource{
+		{Resource: "Secret/creds", Path: []string{"data"}, Original: map[string]interface{}{"password": "b2xk"}, New: map[string]interface{}{"password": "bmV3ZXI=", "token": "dG9r"}},
+		{Resource: "Secret/creds", Path: []string{"stringData", "user"}, New: "admin"},
+		{Resource: "Secret/creds", Path: []string{"metadata", "labels"}, New: map[string]interface{}{"app": "web"}},
+		{Resource: "ConfigMap/settings", Path: []string{"data"}, New: map[string]interface{}{"mode": "debug"}},
+	}
+
+	redacted := RedactSecrets(sources)
+	assert.Equal(t, map[string]interface{}{"password": "<redacted: 3 bytes>"}, redacted[0].Original)
+	assert.Equal(t, map[string]interface{}{"password": "<redacted: 5 bytes>", "token": "<redacted: 3 bytes>"}, redacted[0].New, "Should keep the keys and report decoded sizes")
+	assert.Nil(t, redacted[1].Original, "Additions should stay additions")
+	assert.Equal(t, "<redacted: 5 bytes>", redacted[1].New)
+	assert.Equal(t, sources[2], redacted[2], "Should leave Secret metadata alone")
+	assert.Equal(t, sources[3], redacted[3], "Should leave other kinds alone")
+	assert.Equal(t, "b2xk", sources[0].Original.(map[string]interface{})["password"], "Should not modify the input")
+}
+
+func TestApplyProcessors(t *testing.T) {
+	sources := []FieldSource{{Resource: "Deployment/test", Path: []string{"spec", "replicas"}, New: float64(3)}}
+	double := func(sources []FieldSource) []FieldSource {
+		return append(sources, sources...)
+	}
+	dropFirst := func(sources []FieldSource) []FieldSource {
+		return sources[1:]
+	}
+
+	assert.Equal(t, sources, applyProcessors(nil, sources))
+	assert.Equal(t, 1, len(applyProcessors([]FieldSourceProcessor{double, dropFirst}, sources)), "Should run processors in order")
+	assert.Equal(t, 0, len(applyProcessors([]FieldSourceProcessor{dropFirst, double}, sources)))
+}
+
+func TestDiffMasksSecrets(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - secret.yaml
+patches:
+  - path: password.yaml
+    target:
+      kind: Secret
+      name: creds
+`,
+		"/app/secret.yaml": `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+data:
+  password: b2xk
+`,
+		"/app/password.yaml": `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+data:
+  password: c2VjcmV0
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{BuildFinal: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result.FieldSources))
+	assert.Equal(t, "<redacted: 3 bytes>", result.FieldSources[0].Original)
+	assert.Equal(t, "<redacted: 6 bytes>", result.FieldSources[0].New)
+	if assert.Equal(t, 1, len(result.Changelogs[0])) {
+		assert.Equal(t, "<redacted: 3 bytes>", result.Changelogs[0][0].From, "Changelogs should be masked too")
+		assert.Equal(t, "<redacted: 6 bytes>", result.Changelogs[0][0].To)
+	}
+
+	final, err := RedactSecretResources(result.Final)
+	assert.NoError(t, err)
+	yml, err := final.AsYaml()
+	assert.NoError(t, err)
+	assert.Contains(t, string(yml), "password: '<redacted: 6 bytes>'")
+	assert.False(t, strings.Contains(string(yml), "c2VjcmV0"), "Final output should be masked")
+	original, err := result.Final.AsYaml()
+	assert.NoError(t, err)
+	assert.Contains(t, string(original), "c2VjcmV0", "Masking should copy the build")
+
+	result, err = Diff(fs, "/app", Options{ShowSecrets: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "c2VjcmV0", result.FieldSources[0].New, "ShowSecrets should keep values")
+	assert.Equal(t, "c2VjcmV0", result.Changelogs[0][0].To)
+}
+
+func TestBase64Decoder(t *testing.T) {
+	sources := []FieldSource{
+		{Resource: "Secret/creds", Path: []string{"data", "password"}, Original: "b2xk", New: "bmV3ZXI="},
+		{Resource: "ConfigMap/settings", Path: []string{"binaryData"}, New: map[string]interface{}{"motd": "aGVsbG8=", "raw": "not base64!"}},
+		{Resource: "ConfigMap/settings", Path: []string{"binaryData", "icon"}, New: base64.StdEncoding.EncodeToString([]byte{0xff, 0xfe})},
+	}
+
+	decoded := Base64Decoder(true)(sources)
+	assert.Equal(t, "old", decoded[0].Original)
+	assert.Equal(t, "newer", decoded[0].New)
+	assert.Equal(t, map[string]interface{}{"motd": "hello", "raw": "not base64!"}, decoded[1].New, "Invalid base64 should be kept")
+	assert.Equal(t, sources[2], decoded[2], "Binary values should be kept encoded")
+
+	decoded = Base64Decoder(false)(RedactSecrets(sources))
+	assert.Equal(t, "<redacted: 5 bytes>", decoded[0].New, "Redaction should win for Secrets")
+	assert.Equal(t, map[string]interface{}{"motd": "hello", "raw": "not base64!"}, decoded[1].New)
+}
+
+func TestDiffBase64DecodeBinaryData(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - config.yaml
+patches:
+  - path: motd.yaml
+    target:
+      kind: ConfigMap
+      name: settings
+`,
+		"/app/config.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+binaryData:
+  motd: aGVsbG8=
+`,
+		"/app/motd.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+binaryData:
+  motd: Z29vZGJ5ZQ==
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := Diff(fs, "/app", Options{Processors: []FieldSourceProcessor{Base64Decoder(false)}})
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(result.FieldSources)) {
+		assert.Equal(t, []string{"binaryData", "motd"}, result.FieldSources[0].Path)
+		assert.Equal(t, "hello", result.FieldSources[0].Original)
+		assert.Equal(t, "goodbye", result.FieldSources[0].New)
+	}
+}
@@ -0,0 +1,192 @@
+package kdiff
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// RemoteBase is a remote resource entry of a kustomization, e.g.
+// https://github.com/org/repo//deploy/base?ref=v1.2.0
+type RemoteBase struct {
+	Repo string // Repository to clone
+	Dir  string // Directory inside the repository, "" for its root
+	Ref  string // Branch, tag or commit pinned with ?ref=, "" for the default branch
+}
+
+// RemoteFetcher makes the repository of a remote base available locally and
+// returns the directory it was checked out to. ctx is the context of the run.
+type RemoteFetcher func(ctx context.Context, base RemoteBase) (string, error)
+
+// remotePrefixes start resource entries that can only be remote
+var remotePrefixes = []string{"https://", "http://", "ssh://", "file://", "git::", "git@", "github.com/", "gitlab.com/", "bitbucket.org/"}
+
+// isRemoteResource reports whether a resource entry names a remote base
+func isRemoteResource(entry string) bool {
+	for _, prefix := range remotePrefixes {
+		if strings.HasPrefix(entry, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRemoteBase splits a remote resource entry into its repository,
+// directory and ref. The directory follows a // separator, a .git suffix, or
+// for bare github.com, gitlab.com and bitbucket.org entries the org/repo
+// segments.
+func parseRemoteBase(entry string) (RemoteBase, error) {
+	var base RemoteBase
+	url := strings.TrimPrefix(entry, "git::")
+	if i := strings.Index(url, "?"); i >= 0 {
+		for _, param := range strings.Split(url[i+1:], "&") {
+			if ref, found := strings.CutPrefix(param, "ref="); found {
+				base.Ref = ref
+			} else if ref, found := strings.CutPrefix(param, "version="); found && base.Ref == "" {
+				base.Ref = ref
+			}
+		}
+		url = url[:i]
+	}
+
+	// Split off the scheme so its // isn't taken for the directory separator
+	scheme := ""
+	if i := strings.Index(url, "://"); i >= 0 {
+		scheme, url = url[:i+3], url[i+3:]
+	}
+	switch {
+	case strings.Contains(url, "//"):
+		i := strings.Index(url, "//")
+		base.Repo, base.Dir = url[:i], url[i+2:]
+	case strings.Contains(url, ".git/"):
+		i := strings.Index(url, ".git/")
+		base.Repo, base.Dir = url[:i+4], url[i+5:]
+	case scheme == "" && !strings.HasPrefix(url, "git@"):
+		// host/org/repo/dir...
+		parts := strings.SplitN(url, "/", 4)
+		if len(parts) < 3 {
+			return RemoteBase{}, fmt.Errorf("remote base %s has no org/repo", entry)
+		}
+		base.Repo = strings.Join(parts[:3], "/")
+		if len(parts) == 4 {
+			base.Dir = parts[3]
+		}
+	default:
+		base.Repo = url
+	}
+	if scheme == "" && !strings.HasPrefix(base.Repo, "git@") {
+		scheme = "https://"
+	}
+	base.Repo = scheme + base.Repo
+	base.Dir = strings.Trim(base.Dir, "/")
+	return base, nil
+}
+
+// resolveResource returns the path of a resource entry of the kustomization
+// in dir. Remote entries are fetched with Options.FetchRemote when it's set.
+func (r *run) resolveResource(dir, entry string) (string, error) {
+	if r.opts.FetchRemote == nil || !isRemoteResource(entry) {
+		return filepath.Join(dir, entry), nil
+	}
+	base, err := parseRemoteBase(entry)
+	if err != nil {
+		return "", err
+	}
+	checkout, err := r.opts.FetchRemote(r.opts.Context, base)
+	if err != nil {
+		return "", fmt.Errorf("fetching remote base %s: %w", entry, err)
+	}
+	r.logf("Fetched remote base %s into %s\n", entry, checkout)
+	return filepath.Join(checkout, base.Dir), nil
+}
+
+// localizeEntry returns the resource or component entry of the kustomization
+// in dir that builds should read: for a fetched remote entry its checkout at
+// path, relative to dir as kustomize requires, so builds see the checkout's
+// kustomization as processed rather than fetching their own copy
+func (r *run) localizeEntry(dir, entry, path string) (string, error) {
+	if r.opts.FetchRemote == nil || !isRemoteResource(entry) {
+		return entry, nil
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(absDir, absPath)
+}
+
+// GitFetcher returns a RemoteFetcher that checks remote bases out with git
+// into cacheDir, one directory per repository and ref. Checkouts of a commit
+// SHA or a tag are reused; branches and the default branch can move, so
+// they're fetched again on every run.
+func GitFetcher(cacheDir string) RemoteFetcher {
+	return func(ctx context.Context, base RemoteBase) (string, error) {
+		sum := sha256.Sum256([]byte(base.Repo + "@" + base.Ref))
+		checkout := filepath.Join(cacheDir, hex.EncodeToString(sum[:8]))
+		if base.Ref != "" && pinnedCheckout(ctx, checkout, base.Ref) {
+			return checkout, nil
+		}
+		if err := os.RemoveAll(checkout); err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(checkout, 0755); err != nil {
+			return "", err
+		}
+
+		fail := func(err error) (string, error) {
+			os.RemoveAll(checkout)
+			return "", err
+		}
+		if _, err := runGit(ctx, checkout, "init", "--quiet"); err != nil {
+			return fail(err)
+		}
+		if _, err := runGit(ctx, checkout, "remote", "add", "origin", base.Repo); err != nil {
+			return fail(err)
+		}
+		// Tags are fetched as tags, so later runs know the checkout is pinned
+		fetched := false
+		if base.Ref != "" && !commitSHA.MatchString(base.Ref) {
+			tag := "refs/tags/" + base.Ref
+			_, err := runGit(ctx, checkout, "fetch", "--quiet", "--depth", "1", "origin", tag+":"+tag)
+			fetched = err == nil
+		}
+		if !fetched {
+			ref := base.Ref
+			if ref == "" {
+				ref = "HEAD"
+			}
+			if _, err := runGit(ctx, checkout, "fetch", "--quiet", "--depth", "1", "origin", ref); err != nil {
+				return fail(err)
+			}
+		}
+		if _, err := runGit(ctx, checkout, "checkout", "--quiet", "FETCH_HEAD"); err != nil {
+			return fail(err)
+		}
+		return checkout, nil
+	}
+}
+
+// commitSHA matches refs that are commit SHAs, full or abbreviated
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// pinnedCheckout reports whether checkout holds ref and ref can't move, i.e.
+// it's a commit SHA or a tag
+func pinnedCheckout(ctx context.Context, checkout, ref string) bool {
+	if _, err := os.Stat(filepath.Join(checkout, ".git")); err != nil {
+		return false
+	}
+	if commitSHA.MatchString(ref) {
+		return true
+	}
+	_, err := runGit(ctx, checkout, "rev-parse", "--quiet", "--verify", "refs/tags/"+ref)
+	return err == nil
+}
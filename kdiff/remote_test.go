@@ -0,0 +1,228 @@
+package kdiff
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestParseRemoteBase(t *testing.T) {
+	tests := map[string]RemoteBase{
+		"https://github.com/org/repo//deploy/base?ref=v1.2.0":  {Repo: "https://github.com/org/repo", Dir: "deploy/base", Ref: "v1.2.0"},
+		"github.com/org/repo/deploy/base?ref=main":             {Repo: "https://github.com/org/repo", Dir: "deploy/base", Ref: "main"},
+		"github.com/org/repo":                                  {Repo: "https://github.com/org/repo"},
+		"git@github.com:org/repo//base?ref=abc123":             {Repo: "git@github.com:org/repo", Dir: "base", Ref: "abc123"},
+		"https://git.example.com/org/repo.git/base?version=v2": {Repo: "https://git.example.com/org/repo.git", Dir: "base", Ref: "v2"},
+		"git::https://git.example.com/repo":                    {Repo: "https://git.example.com/repo"},
+	}
+	for entry, expected := range tests {
+		base, err := parseRemoteBase(entry)
+		assert.NoError(t, err, entry)
+		assert.Equal(t, expected, base, entry)
+	}
+
+	_, err := parseRemoteBase("github.com/org")
+	assert.Error(t, err)
+	assert.False(t, isRemoteResource("../base"))
+	assert.True(t, isRemoteResource("https://github.com/org/repo"))
+}
+
+func TestDiffRemoteBase(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - https://github.com/example/platform//deploy/base?ref=v1.2.0
+`,
+		// The checkout the fetcher hands back
+		"/remote/platform/deploy/base/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/remote/platform/deploy/base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+		"/remote/platform/deploy/base/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	var fetched []RemoteBase
+	fetch := func(ctx context.Context, base RemoteBase) (string, error) {
+		fetched = append(fetched, base)
+		return "/remote/platform", nil
+	}
+
+	result, err := Diff(fs, "/app", Options{FetchRemote: fetch})
+	assert.NoError(t, err)
+	assert.Equal(t, []RemoteBase{{Repo: "https://github.com/example/platform", Dir: "deploy/base", Ref: "v1.2.0"}}, fetched, "Should fetch the pinned ref")
+	for _, w := range result.Warnings {
+		assert.NotEqual(t, WarningRootBuildFailed, w.Category, "The root build should read the checkout: %s", w.Reason)
+	}
+	if assert.Equal(t, 1, len(result.FieldSources)) {
+		assert.Equal(t, "Deployment.v1.apps/web.[noNs]", result.FieldSources[0].Resource)
+		assert.Equal(t, "/remote/platform/deploy/base/replicas.yaml", result.FieldSources[0].Source, "Should attribute the remote base's patch")
+		assert.Equal(t, []string{"spec", "replicas"}, result.FieldSources[0].Path)
+	}
+}
+
+// commitRepo writes files into the git repository at repo, creating it on
+// first use, and commits them
+func commitRepo(t *testing.T, repo string, files map[string]string) {
+	t.Helper()
+	if _, err := os.Stat(filepath.Join(repo, ".git")); err != nil {
+		_, err := runGit(context.Background(), filepath.Dir(repo), "init", "--quiet", "-b", "main", repo)
+		assert.NoError(t, err)
+	}
+	for name, content := range files {
+		path := filepath.Join(repo, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	_, err := runGit(context.Background(), repo, "add", "-A")
+	assert.NoError(t, err)
+	_, err = runGit(context.Background(), repo, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "update")
+	assert.NoError(t, err)
+}
+
+func TestGitFetcher(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tmpDir := t.TempDir()
+	repo := filepath.Join(tmpDir, "repo")
+	commitRepo(t, repo, map[string]string{"version": "1"})
+	_, err := runGit(context.Background(), repo, "tag", "v1")
+	assert.NoError(t, err)
+	sha, err := runGit(context.Background(), repo, "rev-parse", "HEAD")
+	assert.NoError(t, err)
+
+	fetch := GitFetcher(filepath.Join(tmpDir, "cache"))
+	read := func(ref string) string {
+		checkout, err := fetch(context.Background(), RemoteBase{Repo: "file://" + repo, Ref: ref})
+		if !assert.NoError(t, err, ref) {
+			return ""
+		}
+		data, err := os.ReadFile(filepath.Join(checkout, "version"))
+		assert.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "1", read("main"))
+	assert.Equal(t, "1", read("v1"))
+	assert.Equal(t, "1", read(strings.TrimSpace(sha)))
+
+	// Branches are fetched again, tags and commits are reused
+	commitRepo(t, repo, map[string]string{"version": "2"})
+	assert.Equal(t, "2", read("main"), "A branch checkout should follow the branch")
+	assert.NoError(t, os.RemoveAll(repo))
+	assert.Equal(t, "1", read("v1"), "A tag checkout should be reused")
+	assert.Equal(t, "1", read(strings.TrimSpace(sha)), "A commit checkout should be reused")
+	_, err = fetch(context.Background(), RemoteBase{Repo: "file://" + repo, Ref: "main"})
+	assert.Error(t, err, "A branch checkout shouldn't be reused")
+}
+
+func TestDiffRemoteGitBase(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tmpDir := t.TempDir()
+	repo := filepath.Join(tmpDir, "platform")
+	commitRepo(t, repo, map[string]string{
+		"base/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: replicas.yaml
+`,
+		"base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: app
+          image: app:1.0
+`,
+		"base/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+`,
+	})
+	_, err := runGit(context.Background(), repo, "tag", "v1")
+	assert.NoError(t, err)
+
+	app := filepath.Join(tmpDir, "app")
+	assert.NoError(t, os.MkdirAll(app, 0755))
+	files := map[string]string{
+		"kustomization.yaml": `
+resources:
+  - file://` + repo + `//base?ref=v1
+namePrefix: prod-
+patches:
+  - path: image.yaml
+`,
+		"image.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: app:2.0
+`,
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(app, name), []byte(content), 0644))
+	}
+
+	result, err := Diff(filesys.MakeFsOnDisk(), app, Options{FetchRemote: GitFetcher(filepath.Join(tmpDir, "cache"))})
+	assert.NoError(t, err)
+	for _, w := range result.Warnings {
+		assert.NotEqual(t, WarningRootBuildFailed, w.Category, "The root build should read the checkout: %s", w.Reason)
+	}
+	sources := make(map[string]FieldSource)
+	for _, change := range result.FieldSources {
+		assert.Equal(t, "Deployment.v1.apps/prod-web.[noNs]", change.Resource)
+		sources[strings.Join(change.Path, ".")] = change
+	}
+	replicas := sources["spec.replicas"]
+	assert.True(t, strings.HasSuffix(replicas.Source, "/base/replicas.yaml"), "Should attribute the remote base's patch, got %s", replicas.Source)
+	assert.Equal(t, int64(1), replicas.Original, "The remote base's patch should apply once")
+	assert.Equal(t, int64(2), replicas.New)
+	assert.Equal(t, filepath.Join(app, "image.yaml"), sources["spec.template.spec.containers.0.image"].Source, "Root patches should match the remote base's resource")
+}
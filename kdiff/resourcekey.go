@@ -0,0 +1,105 @@
+package kdiff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+)
+
+// DefaultResourceKeyFormat identifies resources by Kind/Name in reports
+const DefaultResourceKeyFormat = "{kind}/{name}"
+
+// ResourceKey identifies res by its resid, i.e. its group, version, kind,
+// namespace and name, e.g. Deployment.v1.apps/web.prod. Resources and their
+// changes are keyed by it internally, so resources sharing a name in
+// different namespaces or API groups stay apart.
+func ResourceKey(res *resource.Resource) string {
+	return res.CurId().String()
+}
+
+// ParseResourceKey returns the resid a ResourceKey was made from, or false
+// for other keys
+func ParseResourceKey(key string) (resid.ResId, bool) {
+	if !strings.Contains(key, "/") {
+		return resid.ResId{}, false
+	}
+	id := resid.FromString(key)
+	return id, id.String() == key
+}
+
+// keyKind returns the kind of the resource identified by key
+func keyKind(key string) string {
+	if id, ok := ParseResourceKey(key); ok {
+		return id.Kind
+	}
+	kind, _, _ := strings.Cut(key, "/")
+	return kind
+}
+
+// MatchesResource reports whether key identifies the resource a user named
+// on the command line, as Kind/Name, Kind/Namespace/Name or its full key
+func MatchesResource(key, name string) bool {
+	if key == name {
+		return true
+	}
+	id, ok := ParseResourceKey(key)
+	if !ok {
+		return false
+	}
+	return name == FormatResourceKey(DefaultResourceKeyFormat, id) || name == FormatResourceKey("{kind}/{namespace}/{name}", id)
+}
+
+// FormatResourceKey renders id with format. The core API group is shown as
+// core, and a missing namespace as -.
+func FormatResourceKey(format string, id resid.ResId) string {
+	group := id.Group
+	if group == "" {
+		group = "core"
+	}
+	namespace := id.Namespace
+	if namespace == "" {
+		namespace = "-"
+	}
+	values := map[string]string{
+		"group":     group,
+		"kind":      id.Kind,
+		"namespace": namespace,
+		"name":      id.Name,
+	}
+	return resourceKeyPlaceholder.ReplaceAllStringFunc(format, func(placeholder string) string {
+		return values[placeholder[1:len(placeholder)-1]]
+	})
+}
+
+// resourceKeyPlaceholder matches a {field} in a -resource-key-format template
+var resourceKeyPlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// resourceKeyFields are the placeholders a key format may use
+var resourceKeyFields = map[string]bool{
+	"group":     true,
+	"kind":      true,
+	"namespace": true,
+	"name":      true,
+}
+
+// ValidateResourceKeyFormat checks that format only uses known placeholders
+// and includes {name}, so keys stay distinct
+func ValidateResourceKeyFormat(format string) error {
+	hasName := false
+	for _, match := range resourceKeyPlaceholder.FindAllStringSubmatch(format, -1) {
+		if !resourceKeyFields[match[1]] {
+			return fmt.Errorf("unknown placeholder {%s} in resource key format %q (expected {group}, {kind}, {namespace} or {name})", match[1], format)
+		}
+		hasName = hasName || match[1] == "name"
+	}
+	if strings.ContainsAny(resourceKeyPlaceholder.ReplaceAllString(format, ""), "{}") {
+		return fmt.Errorf("unbalanced brace in resource key format %q", format)
+	}
+	if !hasName {
+		return fmt.Errorf("resource key format %q must include {name}", format)
+	}
+	return nil
+}
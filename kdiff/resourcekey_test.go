@@ -0,0 +1,42 @@
+package kdiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/resource"
+)
+
+func TestValidateResourceKeyFormat(t *testing.T) {
+	assert.NoError(t, ValidateResourceKeyFormat(DefaultResourceKeyFormat))
+	assert.NoError(t, ValidateResourceKeyFormat("{group}/{kind}/{namespace}/{name}"))
+	assert.ErrorContains(t, ValidateResourceKeyFormat("{kind}/{nmae}"), "unknown placeholder {nmae}")
+	assert.ErrorContains(t, ValidateResourceKeyFormat("{kind}/{name"), "unbalanced brace")
+	assert.ErrorContains(t, ValidateResourceKeyFormat("{kind}/{namespace}"), "must include {name}")
+}
+
+func TestResourceKey(t *testing.T) {
+	deployment, err := resource.NewFactory(nil).FromBytes([]byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+`))
+	assert.NoError(t, err)
+	key := ResourceKey(deployment)
+	assert.Equal(t, "Deployment.v1.apps/web.prod", key)
+
+	id, ok := ParseResourceKey(key)
+	assert.True(t, ok)
+	assert.Equal(t, deployment.CurId(), id)
+	_, ok = ParseResourceKey("Deployment/web")
+	assert.False(t, ok, "Kind/Name isn't a resource key")
+	assert.Equal(t, "Deployment", keyKind(key))
+
+	assert.True(t, MatchesResource(key, "Deployment/web"))
+	assert.True(t, MatchesResource(key, "Deployment/prod/web"))
+	assert.True(t, MatchesResource(key, key))
+	assert.False(t, MatchesResource(key, "Deployment/staging/web"))
+	assert.False(t, MatchesResource(key, "Service/web"))
+}
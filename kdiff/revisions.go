@@ -0,0 +1,198 @@
+package kdiff
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+// Statuses of an AttributionDelta
+const (
+	DeltaNew     = "new"     // Changed at the to revision only
+	DeltaGone    = "gone"    // Changed at the from revision only
+	DeltaChanged = "changed" // Changed at both, by other sources or to other values
+)
+
+// AttributionDelta is a field whose attribution differs between two
+// revisions
+type AttributionDelta struct {
+	Resource string
+	Path     []string
+	Status   string        // One of the Delta* statuses
+	From     []FieldSource // Changes to the field at the from revision
+	To       []FieldSource // Changes to the field at the to revision
+}
+
+// diffAttributions compares the changes attributed at two revisions field by
+// field, returning the fields newly changed, no longer changed, or changed
+// differently, sorted by resource and path. Sources must be comparable across
+// revisions, e.g. rebased onto the same checkout.
+func diffAttributions(from, to []FieldSource) []AttributionDelta {
+	key := func(change FieldSource) string {
+		return change.Resource + " " + strings.Join(change.Path, "\x00")
+	}
+	fields := make(map[string]*AttributionDelta)
+	var keys []string
+	field := func(change FieldSource) *AttributionDelta {
+		k := key(change)
+		if fields[k] == nil {
+			fields[k] = &AttributionDelta{Resource: change.Resource, Path: change.Path}
+			keys = append(keys, k)
+		}
+		return fields[k]
+	}
+	for _, change := range from {
+		delta := field(change)
+		delta.From = append(delta.From, change)
+	}
+	for _, change := range to {
+		delta := field(change)
+		delta.To = append(delta.To, change)
+	}
+
+	var deltas []AttributionDelta
+	for _, k := range keys {
+		delta := fields[k]
+		switch {
+		case len(delta.From) == 0:
+			delta.Status = DeltaNew
+		case len(delta.To) == 0:
+			delta.Status = DeltaGone
+		case !reflect.DeepEqual(delta.From, delta.To):
+			delta.Status = DeltaChanged
+		default:
+			continue
+		}
+		deltas = append(deltas, *delta)
+	}
+	sort.SliceStable(deltas, func(i, j int) bool {
+		if deltas[i].Resource != deltas[j].Resource {
+			return deltas[i].Resource < deltas[j].Resource
+		}
+		return strings.Join(deltas[i].Path, ".") < strings.Join(deltas[j].Path, ".")
+	})
+	return deltas
+}
+
+// DiffRevisions attributes the kustomization in dir, inside a git
+// repository, at the from and to revisions, and returns how the attribution
+// changed. An empty to uses the working tree. Each revision is checked out
+// into a temporary worktree.
+func DiffRevisions(dir, from, to string, opts Options) ([]AttributionDelta, error) {
+	top, rel, err := repoPath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	attribute := func(rev string) ([]FieldSource, error) {
+		root := top
+		if rev != "" {
+			worktree, cleanup, err := checkoutRevision(top, rev)
+			if err != nil {
+				return nil, err
+			}
+			defer cleanup()
+			root = worktree
+		}
+		result, err := Diff(filesys.MakeFsOnDisk(), filepath.Join(root, rel), opts)
+		if err != nil {
+			return nil, fmt.Errorf("revision %s: %w", RevisionName(rev), err)
+		}
+		return rebaseSources(result.FieldSources, root, top), nil
+	}
+
+	before, err := attribute(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := attribute(to)
+	if err != nil {
+		return nil, err
+	}
+	return diffAttributions(before, after), nil
+}
+
+// RevisionName names a revision for messages
+func RevisionName(rev string) string {
+	if rev == "" {
+		return "working tree"
+	}
+	return rev
+}
+
+// rebaseSources returns sources with file sources under the checkout root
+// moved to the same place under top, the working tree, so attributions of
+// different checkouts compare equal and display like the working tree's
+func rebaseSources(sources []FieldSource, root, top string) []FieldSource {
+	rebased := make([]FieldSource, len(sources))
+	for i, source := range sources {
+		if rel, err := filepath.Rel(root, source.Source); err == nil && filepath.IsAbs(source.Source) && !strings.HasPrefix(rel, "..") {
+			source.Source = filepath.Join(top, rel)
+		}
+		rebased[i] = source
+	}
+	return rebased
+}
+
+// repoPath returns the root of the git repository containing dir and dir's
+// path relative to it
+func repoPath(dir string) (string, string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	out, err := runGit(context.Background(), abs, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", "", err
+	}
+	top := strings.TrimSpace(out)
+	// git reports the top level with symlinks resolved
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	rel, err := filepath.Rel(top, abs)
+	if err != nil {
+		return "", "", err
+	}
+	return top, rel, nil
+}
+
+// checkoutRevision checks rev out into a temporary worktree of the
+// repository at top, returning the worktree and a func removing it
+func checkoutRevision(top, rev string) (string, func(), error) {
+	tmpDir, err := os.MkdirTemp("", "kustomize-diff-rev-*")
+	if err != nil {
+		return "", nil, err
+	}
+	worktree := filepath.Join(tmpDir, "tree")
+	if _, err := runGit(context.Background(), top, "worktree", "add", "--quiet", "--detach", worktree, rev); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", nil, err
+	}
+	return worktree, func() {
+		runGit(context.Background(), top, "worktree", "remove", "--force", worktree)
+		os.RemoveAll(tmpDir)
+	}, nil
+}
+
+// runGit runs git in dir and returns its output. The command is killed when
+// ctx is done.
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,53 @@
+package kdiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebaseSources(t *testing.T) {
+	sources := []FieldSource{
+		{Source: "/tmp/rev/tree/overlays/prod/patch.yaml"},
+		{Source: "/elsewhere/patch.yaml"},
+		{Source: "inline patch"},
+	}
+	rebased := rebaseSources(sources, "/tmp/rev/tree", "/repo")
+	assert.Equal(t, "/repo/overlays/prod/patch.yaml", rebased[0].Source)
+	assert.Equal(t, "/elsewhere/patch.yaml", rebased[1].Source)
+	assert.Equal(t, "inline patch", rebased[2].Source)
+	assert.Equal(t, "/tmp/rev/tree/overlays/prod/patch.yaml", sources[0].Source)
+}
+
+func TestDiffAttributions(t *testing.T) {
+	replicas := []string{"spec", "replicas"}
+	image := []string{"spec", "template", "spec", "containers", "0", "image"}
+	from := []FieldSource{
+		{Resource: "Deployment/web", Path: replicas, Source: "/app/replicas.yaml", SourceType: SourceTypePatch, Original: float64(1), New: float64(2)},
+		{Resource: "Deployment/web", Path: image, Source: "/app/image.yaml", SourceType: SourceTypePatch, Original: "web:1", New: "web:2"},
+		{Resource: "Service/web", Path: []string{"spec", "type"}, Source: "/app/service.yaml", SourceType: SourceTypePatch, Original: "ClusterIP", New: "NodePort"},
+	}
+	to := []FieldSource{
+		{Resource: "Deployment/web", Path: replicas, Source: "/app/replicas.yaml", SourceType: SourceTypePatch, Original: float64(1), New: float64(3)},
+		{Resource: "Deployment/web", Path: image, Source: "/app/image.yaml", SourceType: SourceTypePatch, Original: "web:1", New: "web:2"},
+		{Resource: "ConfigMap/settings", Path: []string{"data", "mode"}, Source: "/app/mode.yaml", SourceType: SourceTypePatch, New: "fast"},
+	}
+
+	deltas := diffAttributions(from, to)
+	if assert.Equal(t, 3, len(deltas)) {
+		assert.Equal(t, "ConfigMap/settings", deltas[0].Resource)
+		assert.Equal(t, DeltaNew, deltas[0].Status)
+		assert.Empty(t, deltas[0].From)
+
+		assert.Equal(t, replicas, deltas[1].Path)
+		assert.Equal(t, DeltaChanged, deltas[1].Status)
+		assert.Equal(t, float64(2), deltas[1].From[0].New)
+		assert.Equal(t, float64(3), deltas[1].To[0].New)
+
+		assert.Equal(t, "Service/web", deltas[2].Resource)
+		assert.Equal(t, DeltaGone, deltas[2].Status)
+		assert.Empty(t, deltas[2].To)
+	}
+
+	assert.Empty(t, diffAttributions(from, from))
+}
@@ -0,0 +1,110 @@
+package kdiff
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// aborted returns the reason ctx is done, or nil while the run may go on
+func aborted(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	return context.Cause(ctx)
+}
+
+// contextFs fails every file operation once its context is done. kustomize
+// builds can't be cancelled otherwise, so this stops a build at its next
+// file access, and the attribution between builds with it.
+type contextFs struct {
+	filesys.FileSystem
+	ctx context.Context
+}
+
+func (f contextFs) Create(path string) (filesys.File, error) {
+	if err := aborted(f.ctx); err != nil {
+		return nil, err
+	}
+	return f.FileSystem.Create(path)
+}
+
+func (f contextFs) Mkdir(path string) error {
+	if err := aborted(f.ctx); err != nil {
+		return err
+	}
+	return f.FileSystem.Mkdir(path)
+}
+
+func (f contextFs) MkdirAll(path string) error {
+	if err := aborted(f.ctx); err != nil {
+		return err
+	}
+	return f.FileSystem.MkdirAll(path)
+}
+
+func (f contextFs) RemoveAll(path string) error {
+	if err := aborted(f.ctx); err != nil {
+		return err
+	}
+	return f.FileSystem.RemoveAll(path)
+}
+
+func (f contextFs) Open(path string) (filesys.File, error) {
+	if err := aborted(f.ctx); err != nil {
+		return nil, err
+	}
+	return f.FileSystem.Open(path)
+}
+
+func (f contextFs) CleanedAbs(path string) (filesys.ConfirmedDir, string, error) {
+	if err := aborted(f.ctx); err != nil {
+		return "", "", err
+	}
+	return f.FileSystem.CleanedAbs(path)
+}
+
+func (f contextFs) ReadDir(path string) ([]string, error) {
+	if err := aborted(f.ctx); err != nil {
+		return nil, err
+	}
+	return f.FileSystem.ReadDir(path)
+}
+
+func (f contextFs) Glob(pattern string) ([]string, error) {
+	if err := aborted(f.ctx); err != nil {
+		return nil, err
+	}
+	return f.FileSystem.Glob(pattern)
+}
+
+func (f contextFs) ReadFile(path string) ([]byte, error) {
+	if err := aborted(f.ctx); err != nil {
+		return nil, err
+	}
+	return f.FileSystem.ReadFile(path)
+}
+
+func (f contextFs) WriteFile(path string, data []byte) error {
+	if err := aborted(f.ctx); err != nil {
+		return err
+	}
+	return f.FileSystem.WriteFile(path, data)
+}
+
+func (f contextFs) Walk(path string, walkFn filepath.WalkFunc) error {
+	return f.FileSystem.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err := aborted(f.ctx); err != nil {
+			return err
+		}
+		return walkFn(path, info, err)
+	})
+}
+
+// contextFs returns fs failing every file operation once the run's context
+// is done
+func (r *run) contextFs(fs filesys.FileSystem) filesys.FileSystem {
+	return contextFs{FileSystem: fs, ctx: r.opts.Context}
+}
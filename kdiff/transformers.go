@@ -0,0 +1,355 @@
+package kdiff
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/yaml"
+)
+
+// kustomizationOverrideFs serves a modified kustomization.yaml for one
+// directory, so it can be built with a subset of its transformers, and the
+// run's unpatched kustomizations in place of the nested files
+type kustomizationOverrideFs struct {
+	filesys.FileSystem
+	path      string
+	data      []byte
+	unpatched map[string][]byte
+}
+
+func (f kustomizationOverrideFs) ReadFile(path string) ([]byte, error) {
+	if overridePath(path) == f.path {
+		return f.data, nil
+	}
+	if data, ok := f.unpatched[overridePath(path)]; ok {
+		return data, nil
+	}
+	return f.FileSystem.ReadFile(path)
+}
+
+// overridePath normalizes a kustomization file path for overriding, as
+// kustomize reads files by absolute path even when given a relative directory
+func overridePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// enableExecFunctions lets kustomize run exec KRM functions, i.e. transformer
+// and generator configs annotated with config.kubernetes.io/function: exec.
+// This runs arbitrary local binaries named by the kustomization with the
+// user's privileges, so it must only be enabled for trusted overlays.
+func enableExecFunctions(opts *krusty.Options) {
+	opts.PluginConfig.PluginRestrictions = types.PluginRestrictionsNone
+	opts.PluginConfig.FnpLoadingOptions.EnableExec = true
+}
+
+// buildOverride builds dir with kust in place of its kustomization file at
+// kustPath, e.g. to leave out some of its transformers or patches. Nested
+// kustomizations already processed are built without their patches.
+func (r *run) buildOverride(fs filesys.FileSystem, k *krusty.Kustomizer, dir, kustPath string, kust *types.Kustomization) (resmap.ResMap, error) {
+	data, err := yaml.Marshal(kust)
+	if err != nil {
+		return nil, err
+	}
+	overrideFs := kustomizationOverrideFs{
+		FileSystem: fs,
+		path:       overridePath(kustPath),
+		data:       data,
+		unpatched:  r.unpatchedKustomizations,
+	}
+	return k.Run(overrideFs, dir)
+}
+
+// InlinePluginSource is the source of changes made by transformer configs
+// written inline in a kustomization
+const InlinePluginSource = "inline plugin config"
+
+// pluginName describes a transformers:/generators: entry by the kind and name
+// of its config, e.g. PrefixSuffixTransformer/prefixer. Entries are either a
+// path relative to dir or an inline config.
+func pluginName(fs filesys.FileSystem, dir, entry string) (name, source string) {
+	data := []byte(entry)
+	source = InlinePluginSource
+	if !strings.Contains(entry, "\n") {
+		source = filepath.Join(dir, entry)
+		var err error
+		if data, err = fs.ReadFile(source); err != nil {
+			// Directories and remote entries aren't single configs
+			return entry, source
+		}
+	}
+
+	var config struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil || config.Kind == "" {
+		return entry, source
+	}
+	return fmt.Sprintf("%s/%s", config.Kind, config.Metadata.Name), source
+}
+
+// printPlugins lists the transformer and generator plugin configs that are
+// active in a kustomization, with -verbose
+func (r *run) printPlugins(fs filesys.FileSystem, dir string, kust *types.Kustomization) {
+	if len(kust.Transformers) > 0 {
+		r.debugf("Transformers:\n")
+		for _, entry := range kust.Transformers {
+			name, _ := pluginName(fs, dir, entry)
+			r.debugf("  - %s\n", name)
+		}
+	}
+	if len(kust.Generators) > 0 {
+		r.debugf("Generators:\n")
+		for _, entry := range kust.Generators {
+			name, _ := pluginName(fs, dir, entry)
+			r.debugf("  - %s\n", name)
+		}
+	}
+}
+
+// attributeTransformers records the field changes made by each transformers:
+// entry of a kustomization. The kustomization is built with the first i
+// transformers for each i, and the difference between consecutive builds is
+// attributed to transformer i. keys holds the key of each resource of the
+// kustomization's build in declaration order, which the changes are recorded
+// under.
+func (r *run) attributeTransformers(fs filesys.FileSystem, k *krusty.Kustomizer, dir string, kust *types.Kustomization, keys []string) ([]FieldSource, error) {
+	if len(kust.Transformers) == 0 {
+		return nil, nil
+	}
+
+	kustPath, exists := FindKustomizationFile(fs, dir)
+	if !exists {
+		return nil, MissingKustomizationError(fs, dir)
+	}
+
+	build := func(n int) (resmap.ResMap, error) {
+		partial := *kust
+		partial.Transformers = kust.Transformers[:n]
+		return r.buildDeclarationOrder(fs, k, dir, kustPath, &partial)
+	}
+	return r.diffTransformerBuilds(fs, dir, kust.Transformers, keys, build)
+}
+
+// diffTransformerBuilds attributes the difference between build(i) and
+// build(i+1) to entries[i], the transformers: entries of the kustomization in
+// dir. keys is as for attributeTransformers.
+func (r *run) diffTransformerBuilds(fs filesys.FileSystem, dir string, entries, keys []string, build func(n int) (resmap.ResMap, error)) ([]FieldSource, error) {
+	var changes []FieldSource
+	before, err := build(0)
+	if err != nil {
+		return nil, fmt.Errorf("build without transformers: %w", err)
+	}
+	for i, entry := range entries {
+		after, err := build(i + 1)
+		if err != nil {
+			return nil, fmt.Errorf("build with transformer %s: %w", entry, err)
+		}
+
+		name, source := pluginName(fs, dir, entry)
+		kind := strings.SplitN(name, "/", 2)[0]
+		changed, lined, err := r.diffBuilds(before, after, keys, source, SourceTypeTransformer+kind)
+		if err != nil {
+			return nil, err
+		}
+		if !lined {
+			r.warn(source, WarningTransformerSkipped, "Transformer %s changed the number of resources, skipping attribution", entry)
+		}
+		changes = append(changes, changed...)
+		before = after
+	}
+	return changes, nil
+}
+
+// diffBuilds records the differences between two builds of a kustomization
+// in declaration order as changes of source. Transformers keep resource
+// order, but may rename resources, so the builds line up by position and the
+// changes are recorded under keys, or the keys of after if keys doesn't line
+// up. It returns false if the builds don't line up.
+func (r *run) diffBuilds(before, after resmap.ResMap, keys []string, source, sourceType string) ([]FieldSource, bool, error) {
+	beforeRes := before.Resources()
+	afterRes := after.Resources()
+	if len(beforeRes) != len(afterRes) {
+		return nil, false, nil
+	}
+	if len(keys) != len(afterRes) {
+		keys = resourceKeys(after)
+	}
+
+	var changes []FieldSource
+	for j, res := range afterRes {
+		changed, err := r.diffResources(beforeRes[j], res, keys[j], source, sourceType)
+		if err != nil {
+			return nil, false, err
+		}
+		changes = append(changes, changed...)
+	}
+	return changes, true, nil
+}
+
+// diffResources records the differences between two states of the resource
+// at key as changes of source. A nil before records the whole resource as
+// created.
+func (r *run) diffResources(before, after *resource.Resource, key, source, sourceType string) ([]FieldSource, error) {
+	beforeMap := make(map[string]interface{})
+	if before != nil {
+		if err := yaml.Unmarshal([]byte(before.MustYaml()), &beforeMap); err != nil {
+			return nil, err
+		}
+	}
+	var afterMap map[string]interface{}
+	if err := yaml.Unmarshal([]byte(after.MustYaml()), &afterMap); err != nil {
+		return nil, err
+	}
+	normalizeObject(beforeMap, true)
+	normalizeObject(afterMap, true)
+	changelog, err := r.diffObjects(beforeMap, afterMap)
+	if err != nil {
+		return nil, err
+	}
+	var changes []FieldSource
+	for _, change := range changelog {
+		changes = append(changes, FieldSource{
+			Resource:   key,
+			Path:       change.Path,
+			Source:     source,
+			Element:    elementIdentity(beforeMap, change.Path, "replace", nil),
+			SourceType: sourceType,
+			Original:   change.From,
+			New:        change.To,
+		})
+	}
+	return changes, nil
+}
+
+// attributeGenerators records the fields of the resources each generators:
+// entry of kust, the kustomization at kustPath in dir, produces or changes to
+// the entry's config. The kustomization is built with the first i entries for
+// each i, and as generators add resources the consecutive builds are compared
+// by resource key.
+func (r *run) attributeGenerators(fs filesys.FileSystem, k *krusty.Kustomizer, dir, kustPath string, kust *types.Kustomization) ([]FieldSource, error) {
+	if len(kust.Generators) == 0 {
+		return nil, nil
+	}
+
+	build := func(n int) (resmap.ResMap, error) {
+		partial := *kust
+		partial.Generators = kust.Generators[:n]
+		return r.buildDeclarationOrder(fs, k, dir, kustPath, &partial)
+	}
+
+	var changes []FieldSource
+	before, err := build(0)
+	if err != nil {
+		return nil, fmt.Errorf("build without generators: %w", err)
+	}
+	for i, entry := range kust.Generators {
+		after, err := build(i + 1)
+		if err != nil {
+			return nil, fmt.Errorf("build with generator %s: %w", entry, err)
+		}
+
+		name, source := pluginName(fs, dir, entry)
+		kind := strings.SplitN(name, "/", 2)[0]
+		for _, res := range after.Resources() {
+			key := ResourceKey(res)
+			previous, _ := before.GetByCurrentId(res.CurId())
+			changed, err := r.diffResources(previous, res, key, source, SourceTypeGenerator+kind)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, changed...)
+		}
+		before = after
+	}
+	return changes, nil
+}
+
+// imagesField is the kustomization field attributeImages records the changes
+// of
+const imagesField = "images"
+
+// attributeImages records the changes made by the images: entries of a
+// kustomization, by comparing builds with and without them. keys is as for
+// attributeTransformers.
+func (r *run) attributeImages(fs filesys.FileSystem, k *krusty.Kustomizer, dir string, kust *types.Kustomization, keys []string) ([]FieldSource, error) {
+	if len(kust.Images) == 0 {
+		return nil, nil
+	}
+
+	kustPath, exists := FindKustomizationFile(fs, dir)
+	if !exists {
+		return nil, MissingKustomizationError(fs, dir)
+	}
+
+	withoutImages := *kust
+	withoutImages.Images = nil
+	before, err := r.buildDeclarationOrder(fs, k, dir, kustPath, &withoutImages)
+	if err != nil {
+		return nil, fmt.Errorf("build without images: %w", err)
+	}
+	after, err := r.buildDeclarationOrder(fs, k, dir, kustPath, kust)
+	if err != nil {
+		return nil, fmt.Errorf("build with images: %w", err)
+	}
+
+	// The images transformer only rewrites image fields, so resources line up
+	changes, _, err := r.diffBuilds(before, after, keys, kustPath, SourceTypeTransformer+imagesField)
+	return changes, err
+}
+
+// attributeBuiltins records the changes made by the builtin transformer
+// fields of a kustomization, e.g. its namespace, namePrefix and commonLabels,
+// to the kustomization. It builds the kustomization with the fields up to
+// each one in turn and attributes the difference between consecutive builds
+// to the field. keys is as for attributeTransformers.
+func (r *run) attributeBuiltins(fs filesys.FileSystem, k *krusty.Kustomizer, dir string, kust *types.Kustomization, keys []string) ([]FieldSource, error) {
+	kustPath, exists := FindKustomizationFile(fs, dir)
+	if !exists {
+		return nil, MissingKustomizationError(fs, dir)
+	}
+
+	build := func(from int) (resmap.ResMap, error) {
+		partial, _ := withoutTransformers(*kust, from)
+		return r.buildDeclarationOrder(fs, k, dir, kustPath, &partial)
+	}
+
+	var changes []FieldSource
+	var before resmap.ResMap
+	for i, field := range builtinTransformerFields {
+		if probe := *kust; !field.clear(&probe) {
+			continue
+		}
+		if before == nil {
+			var err error
+			if before, err = build(i); err != nil {
+				return nil, fmt.Errorf("build without %s: %w", field.name, err)
+			}
+		}
+		after, err := build(i + 1)
+		if err != nil {
+			return nil, fmt.Errorf("build with %s: %w", field.name, err)
+		}
+		changed, lined, err := r.diffBuilds(before, after, keys, kustPath, SourceTypeTransformer+field.name)
+		if err != nil {
+			return nil, err
+		}
+		if !lined {
+			r.warn(kustPath, WarningTransformerSkipped, "The %s field changed the number of resources, skipping attribution", field.name)
+		}
+		changes = append(changes, changed...)
+		before = after
+	}
+	return changes, nil
+}
@@ -0,0 +1,135 @@
+package kdiff
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/yaml"
+)
+
+func TestAttributeTransformers(t *testing.T) {
+	r := newRun(Options{})
+	// Create a temporary directory for test files
+	tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	kustContent := `
+resources:
+  - deployment.yaml
+transformers:
+  - prefixer.yaml
+`
+	err = os.WriteFile(filepath.Join(tmpDir, "kustomization.yaml"), []byte(kustContent), 0644)
+	assert.NoError(t, err)
+
+	deploymentContent := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+`
+	err = os.WriteFile(filepath.Join(tmpDir, "deployment.yaml"), []byte(deploymentContent), 0644)
+	assert.NoError(t, err)
+
+	prefixerContent := `
+apiVersion: builtin
+kind: PrefixSuffixTransformer
+metadata:
+  name: prefixer
+prefix: dev-
+fieldSpecs:
+  - path: metadata/name
+`
+	err = os.WriteFile(filepath.Join(tmpDir, "prefixer.yaml"), []byte(prefixerContent), 0644)
+	assert.NoError(t, err)
+
+	var kust types.Kustomization
+	err = yaml.Unmarshal([]byte(kustContent), &kust)
+	assert.NoError(t, err)
+
+	fs := filesys.MakeFsOnDisk()
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+
+	name, source := pluginName(fs, tmpDir, "prefixer.yaml")
+	assert.Equal(t, "PrefixSuffixTransformer/prefixer", name)
+	assert.Equal(t, filepath.Join(tmpDir, "prefixer.yaml"), source)
+
+	changes, err := r.attributeTransformers(fs, k, tmpDir, &kust, nil)
+	assert.NoError(t, err)
+
+	foundName := false
+	for _, change := range changes {
+		assert.Equal(t, "Deployment.v1.apps/dev-test.[noNs]", change.Resource, "Changes should be keyed by the transformed resource")
+		assert.Equal(t, filepath.Join(tmpDir, "prefixer.yaml"), change.Source, "Changes should be attributed to the transformer config")
+		assert.Equal(t, SourceTypeTransformer+"PrefixSuffixTransformer", change.SourceType)
+		if strings.Join(change.Path, ".") == "metadata.name" {
+			foundName = true
+			assert.Equal(t, "test", change.Original)
+			assert.Equal(t, "dev-test", change.New)
+		}
+	}
+	assert.True(t, foundName, "Should attribute the name prefix to the transformer")
+}
+
+func TestDiffExecFunctions(t *testing.T) {
+	// Create a temporary directory for test files
+	tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"kustomization.yaml": `
+resources:
+  - deployment.yaml
+transformers:
+  - scaler.yaml
+`,
+		"deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+`,
+		"scaler.yaml": `
+apiVersion: example.com/v1
+kind: Scaler
+metadata:
+  name: scaler
+  annotations:
+    config.kubernetes.io/function: |
+      exec:
+        path: ./scaler.sh
+`,
+		"scaler.sh": "#!/bin/sh\nsed 's/replicas: 1/replicas: 2/'\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0755))
+	}
+
+	fs := filesys.MakeFsOnDisk()
+	_, err = Diff(fs, tmpDir, Options{})
+	assert.Error(t, err, "Exec functions should be disabled by default")
+
+	result, err := Diff(fs, tmpDir, Options{EnableExec: true})
+	assert.NoError(t, err)
+	found := false
+	for _, change := range result.FieldSources {
+		if strings.Join(change.Path, ".") == "spec.replicas" {
+			found = true
+			assert.Equal(t, filepath.Join(tmpDir, "scaler.yaml"), change.Source)
+			assert.Equal(t, int64(2), change.New)
+		}
+	}
+	assert.True(t, found, "Should attribute the exec function's change to its config")
+}
@@ -0,0 +1,318 @@
+package kdiff
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/yaml"
+)
+
+// enterKustomization pushes the kustomization in dir onto
+// kustomizationStack, returning a func popping it, or an error with the
+// cycle path if dir is already being processed
+func (r *run) enterKustomization(fs filesys.FileSystem, dir string) (func(), error) {
+	canonical := r.canonicalPath(fs, dir)
+	for i, entered := range r.kustomizationStack {
+		if entered == canonical {
+			cycle := append(append([]string{}, r.kustomizationStack[i:]...), canonical)
+			return nil, fmt.Errorf("circular reference: %s", strings.Join(cycle, " → "))
+		}
+	}
+	r.kustomizationStack = append(r.kustomizationStack, canonical)
+	return func() {
+		r.kustomizationStack = r.kustomizationStack[:len(r.kustomizationStack)-1]
+	}, nil
+}
+
+// sameFile reports whether paths a and b lead to the same file, following
+// symlinks either way
+func sameFile(fs filesys.FileSystem, a, b string) bool {
+	aDir, aName, aErr := fs.CleanedAbs(a)
+	bDir, bName, bErr := fs.CleanedAbs(b)
+	return aErr == nil && bErr == nil && aDir == bDir && aName == bName
+}
+
+// canonicalPath returns the absolute path identifying a resource path,
+// resolving symlinks if followSymlinks is set
+func (r *run) canonicalPath(fs filesys.FileSystem, path string) string {
+	if !r.opts.NoFollowSymlinks {
+		if dir, name, err := fs.CleanedAbs(path); err == nil {
+			return filepath.Join(string(dir), name)
+		}
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// checkReferenceCycles walks the local kustomizations referenced from dir
+// through resources and components, failing with the cycle path if one
+// references itself. It runs before any build, whose errors would hide the
+// path. checked holds the directories already walked.
+func (r *run) checkReferenceCycles(fs filesys.FileSystem, dir string, checked map[string]bool) error {
+	leave, err := r.enterKustomization(fs, dir)
+	if err != nil {
+		return err
+	}
+	defer leave()
+	canonical := r.canonicalPath(fs, dir)
+	if checked[canonical] {
+		return nil
+	}
+	checked[canonical] = true
+
+	// Unreadable kustomizations are reported by the build
+	_, kustData, err := readKustomizationFile(fs, dir)
+	if err != nil {
+		return nil
+	}
+	var kust types.Kustomization
+	if err := yaml.Unmarshal(kustData, &kust); err != nil {
+		return nil
+	}
+	for _, entry := range append(append([]string{}, kust.Resources...), kust.Components...) {
+		if isRemoteResource(entry) {
+			continue
+		}
+		path := filepath.Join(dir, entry)
+		if _, exists := FindKustomizationFile(fs, path); !exists {
+			continue
+		}
+		if err := r.checkReferenceCycles(fs, path, checked); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *run) processResourceOrKustomization(fs filesys.FileSystem, k *krusty.Kustomizer, path string, restrictions types.LoadRestrictions, allPatches *[]types.Patch, allResources map[string]*resource.Resource) error {
+	if r.loadedPaths == nil {
+		r.loadedPaths = make(map[string]bool)
+	}
+	canonical := r.canonicalPath(fs, path)
+	// Check the stack first, a kustomization referencing one of its
+	// ancestors is already loaded
+	if _, exists := FindKustomizationFile(fs, path); exists {
+		leave, err := r.enterKustomization(fs, path)
+		if err != nil {
+			return err
+		}
+		defer leave()
+	}
+	if r.loadedPaths[canonical] {
+		r.logf("Skipping %s, already loaded as %s\n", path, canonical)
+		return nil
+	}
+	r.loadedPaths[canonical] = true
+
+	// Check if it's a kustomization directory
+	if _, exists := FindKustomizationFile(fs, path); exists {
+		// It's a kustomization directory
+		return r.processKustomization(fs, k, path, restrictions, allPatches, allResources)
+	}
+	if fs.IsDir(path) {
+		return MissingKustomizationError(fs, path)
+	}
+
+	// Try to load as a resource file
+	if data, err := fs.ReadFile(path); err == nil {
+		// Load the resource
+		res, err := resource.NewFactory(nil).FromBytes(data)
+		if err != nil {
+			if generateName := generateNameOnly(data); generateName != "" {
+				return fmt.Errorf("resource %s has metadata.generateName %q but no metadata.name; kustomize requires a fixed name to build and patch it", path, generateName)
+			}
+			return fmt.Errorf("failed to load resource %s: %w", path, err)
+		}
+
+		// Add to resources map. As in kustomize, a resource may only be
+		// declared once, so an overlay can't redefine a base's resource. A
+		// file reached again through a link that isn't followed is loaded
+		// again instead.
+		key := ResourceKey(res)
+		if origin, exists := r.resourceOrigins[key]; exists && !sameFile(fs, origin, path) {
+			return fmt.Errorf("resource %s in %s is already declared in %s; kustomize rejects resources with the same id, patch it instead", key, path, origin)
+		}
+		allResources[key] = res
+		if r.declaredResources == nil {
+			r.declaredResources = make(map[string]*resource.Resource)
+		}
+		r.declaredResources[key] = res
+		if r.resourceOrigins == nil {
+			r.resourceOrigins = make(map[string]string)
+		}
+		r.resourceOrigins[key] = path
+	} else {
+		return fmt.Errorf("path %s is neither a kustomization directory nor a resource file: %w", path, err)
+	}
+	return nil
+}
+
+func (r *run) processKustomization(fs filesys.FileSystem, k *krusty.Kustomizer, dir string, restrictions types.LoadRestrictions, allPatches *[]types.Patch, allResources map[string]*resource.Resource) error {
+	// Load kustomization.yaml
+	kustPath, kustData, err := readKustomizationFile(fs, dir)
+	if err != nil {
+		return err
+	}
+
+	var kust types.Kustomization
+	if err := yaml.Unmarshal(kustData, &kust); err != nil {
+		return fmt.Errorf("failed parsing kustomization.yaml at %s: %w", dir, err)
+	}
+	if err := validatePatches(&kust, dir); err != nil {
+		return fmt.Errorf("invalid kustomization.yaml at %s: %w", dir, err)
+	}
+	r.checkKustomizationVersion(kustPath, &kust)
+
+	mark := r.markKustomization(allResources)
+	firstPatch := len(*allPatches)
+	if err := collectPatches(dir, &kust, restrictions, allPatches); err != nil {
+		return err
+	}
+	lastPatch := len(*allPatches)
+
+	// Below -max-tree-depth nested kustomizations are left to this one's
+	// build, their patches applied but not attributed
+	truncated := r.opts.MaxTreeDepth > 0 && len(r.kustomizationStack) > r.opts.MaxTreeDepth
+	descend := func(path string) error {
+		if _, exists := FindKustomizationFile(fs, path); exists && truncated {
+			r.warn(path, WarningTreeTruncated, "Not descending into %s beyond depth %d, its patches are applied but not attributed", path, r.opts.MaxTreeDepth)
+			return nil
+		}
+		return r.processResourceOrKustomization(fs, k, path, restrictions, allPatches, allResources)
+	}
+
+	// Process resources
+	for i, baseDir := range kust.Resources {
+		absBaseDir, err := r.resolveResource(dir, baseDir)
+		if err != nil {
+			return err
+		}
+		if kust.Resources[i], err = r.localizeEntry(dir, baseDir, absBaseDir); err != nil {
+			return err
+		}
+		if err := descend(absBaseDir); err != nil {
+			return err
+		}
+	}
+
+	// Process components
+	for i, compDir := range kust.Components {
+		absCompDir, err := r.resolveResource(dir, compDir)
+		if err != nil {
+			return err
+		}
+		if kust.Components[i], err = r.localizeEntry(dir, compDir, absCompDir); err != nil {
+			return err
+		}
+		if err := descend(absCompDir); err != nil {
+			return err
+		}
+	}
+	loaded := mark.loaded(allResources)
+
+	// Components can't be built on their own, their resources and
+	// transformations show up in the build of the including kustomization.
+	// That build reads them without their patches, which are attributed
+	// separately.
+	if kust.Kind == types.ComponentKind {
+		r.logf("Skipping build of component %s\n", dir)
+		unpatched := withoutPatches(kust)
+		return r.registerUnpatched(kustPath, &unpatched)
+	}
+
+	// Build resources from this kustomization last, without its patches as
+	// they're applied and attributed later, like the root's
+	unpatched := withoutPatches(kust)
+	resMap, err := r.buildDeclarationOrder(fs, k, dir, kustPath, &unpatched)
+	if err != nil {
+		return fmt.Errorf("base build failed for %s: %w", dir, err)
+	}
+	if err := r.registerUnpatched(kustPath, &unpatched); err != nil {
+		return err
+	}
+	untransformed, err := r.buildUntransformed(fs, k, dir, kustPath, &unpatched, resMap)
+	if err != nil {
+		return fmt.Errorf("base build without transformers failed for %s: %w", dir, err)
+	}
+
+	// Components run before this kustomization's transformers, so their
+	// records are keyed like its patches' until the rekeying below. Below a
+	// truncated tree they're left to the build like its patches.
+	if !truncated {
+		base, built := unpatched, resMap
+		if untransformed != nil {
+			base, _ = withoutTransformers(unpatched, 0)
+			built = untransformed
+		}
+		compChanges, compGenerated, err := r.attributeComponents(fs, k, dir, kustPath, &base, built)
+		if err != nil {
+			return fmt.Errorf("component attribution failed for %s: %w", dir, err)
+		}
+		r.fieldSources = append(r.fieldSources, compChanges...)
+		r.generatedResources = append(r.generatedResources, compGenerated...)
+	}
+
+	// Add resources to our map, after attributing generator merges onto the
+	// resources they replace. What was recorded for them so far follows them
+	// to the keys this kustomization's transformers give them, while its own
+	// patches see them as they were.
+	merges := attributeGeneratorMerges(&kust, kustPath, r.generatedResources, allResources, resMap)
+	if untransformed != nil {
+		r.rekey(mark, renamedKeys(untransformed, resMap))
+		if lastPatch > firstPatch {
+			scope := patchScope{from: firstPatch, to: lastPatch, resources: make(map[string]*resource.Resource)}
+			before := untransformed.Resources()
+			for j, key := range resourceKeys(resMap) {
+				scope.resources[key] = before[j]
+			}
+			r.patchScopes = append(r.patchScopes, scope)
+		}
+	}
+	r.fieldSources = append(r.fieldSources, merges...)
+	replaceLoaded(allResources, loaded, resMap, resMap.Resources())
+
+	r.generatedResources = append(r.generatedResources, collectGenerated(&kust, kustPath, resMap)...)
+
+	// Generated resources are recorded as this kustomization builds them,
+	// as its builtin transformer fields aren't attributed field by field
+	generatorChanges, err := r.attributeGenerators(fs, k, dir, kustPath, &unpatched)
+	if err != nil {
+		return fmt.Errorf("generator attribution failed for %s: %w", dir, err)
+	}
+	r.fieldSources = append(r.fieldSources, generatorChanges...)
+
+	keys := resourceKeys(resMap)
+	transformerChanges, err := r.attributeTransformers(fs, k, dir, &kust, keys)
+	if err != nil {
+		return fmt.Errorf("transformer attribution failed for %s: %w", dir, err)
+	}
+	r.fieldSources = append(r.fieldSources, transformerChanges...)
+
+	imageChanges, err := r.attributeImages(fs, k, dir, &kust, keys)
+	if err != nil {
+		return fmt.Errorf("image attribution failed for %s: %w", dir, err)
+	}
+	r.fieldSources = append(r.fieldSources, imageChanges...)
+	return nil
+}
+
+// registerUnpatched records kust as the unpatched content of the
+// kustomization file at kustPath for later override builds
+func (r *run) registerUnpatched(kustPath string, kust *types.Kustomization) error {
+	data, err := yaml.Marshal(kust)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", kustPath, err)
+	}
+	if r.unpatchedKustomizations == nil {
+		r.unpatchedKustomizations = make(map[string][]byte)
+	}
+	r.unpatchedKustomizations[overridePath(kustPath)] = data
+	return nil
+}
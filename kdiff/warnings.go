@@ -0,0 +1,31 @@
+package kdiff
+
+import "fmt"
+
+// Warning categories
+const (
+	WarningKindAlias            = "kind-alias"
+	WarningUnmatchedTarget      = "unmatched-target"
+	WarningReadFailed           = "read-failed"
+	WarningParseFailed          = "parse-failed"
+	WarningMissingPath          = "missing-path"
+	WarningTransformerSkipped   = "transformer-skipped"
+	WarningKustomizationVersion = "kustomization-version"
+	WarningRootBuildFailed      = "root-build-failed"
+	WarningTreeTruncated        = "tree-truncated"
+)
+
+// Warning is a problem that didn't stop the run but left a patch or
+// transformer unattributed or suspect
+type Warning struct {
+	Patch    string `json:"patch"`    // The patch or transformer config concerned
+	Category string `json:"category"` // One of the Warning* categories
+	Reason   string `json:"reason"`
+}
+
+// warn records a warning and logs it
+func (r *run) warn(patch, category, format string, v ...interface{}) {
+	reason := fmt.Sprintf(format, v...)
+	r.warnings = append(r.warnings, Warning{Patch: patch, Category: category, Reason: reason})
+	r.logf("Warning: %s\n", reason)
+}
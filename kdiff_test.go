@@ -1,363 +1,311 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/malc0lm/kustomize-diff/kdiff"
 	"github.com/stretchr/testify/assert"
 	"sigs.k8s.io/kustomize/api/filesys"
-	"sigs.k8s.io/kustomize/api/krusty"
 	"sigs.k8s.io/kustomize/api/resource"
-	"sigs.k8s.io/kustomize/api/types"
-	"sigs.k8s.io/yaml"
 )
 
-func TestProcessKustomization(t *testing.T) {
-	// Create a temporary directory for test files
-	tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
-	assert.NoError(t, err)
-	defer os.RemoveAll(tmpDir)
+// TestMain runs main instead of the tests when runMain re-executes the test
+// binary
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv("KDIFF_MAIN_ARGS"); ok {
+		os.Args = append([]string{"kdiff"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
 
-	// Create test kustomization structure
-	testDir := filepath.Join(tmpDir, "test")
-	err = os.MkdirAll(testDir, 0755)
-	assert.NoError(t, err)
+func TestBuildFieldChains(t *testing.T) {
+	sources := []kdiff.FieldSource{
+		{Resource: "Deployment/test", Path: []string{"spec", "replicas"}, Source: "patch1.yaml", Original: float64(1), New: float64(3)},
+		{Resource: "Deployment/test", Path: []string{"metadata", "labels"}, Source: "patch1.yaml", Original: nil, New: "app"},
+		{Resource: "Deployment/test", Path: []string{"spec", "replicas"}, Source: "patch2.yaml", Original: float64(3), New: float64(5)},
+		{Resource: "Service/test", Path: []string{"spec", "replicas"}, Source: "patch3.yaml", Original: nil, New: float64(2)},
+	}
 
-	// Create a test kustomization.yaml
-	kustContent := `
+	chains := buildFieldChains(sources)
+
+	// Records sharing resource and path are linked, others stay separate
+	assert.Equal(t, 3, len(chains), "Should build one chain per resource and path")
+	assert.Equal(t, "Deployment/test", chains[0].Resource)
+	assert.Equal(t, []string{"spec", "replicas"}, chains[0].Path)
+	assert.Equal(t, 2, len(chains[0].Changes), "Replicas chain should link both patches")
+	assert.Equal(t, "patch1.yaml", chains[0].Changes[0].Source, "Chain should keep application order")
+	assert.Equal(t, "patch2.yaml", chains[0].Changes[1].Source, "Chain should keep application order")
+	assert.Equal(t, float64(1), chains[0].Original(), "Chain should start at the base value")
+	assert.Equal(t, float64(5), chains[0].Final(), "Chain should end at the final value")
+	assert.Equal(t, "Service/test", chains[2].Resource)
+}
+
+func TestChurnedFields(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
 resources:
-  - base
+  - deployment.yaml
 patches:
-  - path: patches/patch1.yaml
+  - path: pause.yaml
     target:
       kind: Deployment
       name: test
-  - patch: |-
-      apiVersion: apps/v1
-      kind: Deployment
-      metadata:
-        name: test
+  - patch: |
+      - op: remove
+        path: /spec/paused
+      - op: replace
+        path: /spec/replicas
+        value: 5
     target:
       kind: Deployment
       name: test
-`
-	err = os.WriteFile(filepath.Join(testDir, "kustomization.yaml"), []byte(kustContent), 0644)
-	assert.NoError(t, err)
-
-	// Create base directory and resource
-	baseDir := filepath.Join(testDir, "base")
-	err = os.MkdirAll(baseDir, 0755)
-	assert.NoError(t, err)
-
-	// Create base kustomization.yaml
-	baseKustContent := `
-resources:
-  - deployment.yaml
-`
-	err = os.WriteFile(filepath.Join(baseDir, "kustomization.yaml"), []byte(baseKustContent), 0644)
-	assert.NoError(t, err)
-
-	baseContent := `
+`,
+		"/app/deployment.yaml": `
 apiVersion: apps/v1
 kind: Deployment
 metadata:
   name: test
 spec:
   replicas: 1
-`
-	err = os.WriteFile(filepath.Join(baseDir, "deployment.yaml"), []byte(baseContent), 0644)
-	assert.NoError(t, err)
-
-	// Create patches directory and patch file
-	patchesDir := filepath.Join(testDir, "patches")
-	err = os.MkdirAll(patchesDir, 0755)
-	assert.NoError(t, err)
-
-	patchContent := `
+`,
+		"/app/pause.yaml": `
 apiVersion: apps/v1
 kind: Deployment
 metadata:
   name: test
 spec:
+  paused: true
   replicas: 3
-`
-	err = os.WriteFile(filepath.Join(patchesDir, "patch1.yaml"), []byte(patchContent), 0644)
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := kdiff.Diff(fs, "/app", kdiff.Options{})
 	assert.NoError(t, err)
 
-	// Test processKustomization
-	fs := filesys.MakeFsOnDisk()
-	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
-	allPatches := make([]types.Patch, 0)
-	allResources := make(map[string]*resource.Resource)
+	// paused is added then removed; replicas changes twice but ends elsewhere
+	churned := churnedFields(buildFieldChains(result.FieldSources))
+	if assert.Len(t, churned, 1) {
+		assert.Equal(t, "Deployment.v1.apps/test.[noNs]", churned[0].Resource)
+		assert.Equal(t, []string{"spec", "paused"}, churned[0].Path)
+		assert.Len(t, churned[0].Changes, 2)
+		assert.Equal(t, "<none> → [pause.yaml] → true → [inline patch] → <none>", formatChain(churned[0]))
+	}
+}
 
-	processKustomization(fs, k, testDir, &allPatches, allResources)
+func TestUnmodifiedResources(t *testing.T) {
+	factory := resource.NewFactory(nil)
+	newResource := func(kind, name string) *resource.Resource {
+		res, err := factory.FromBytes([]byte(fmt.Sprintf("apiVersion: v1\nkind: %s\nmetadata:\n  name: %s\n", kind, name)))
+		assert.NoError(t, err)
+		return res
+	}
 
-	// Verify patches were collected
-	assert.Equal(t, 2, len(allPatches), "Should collect both patches")
-	assert.Equal(t, filepath.Join("patches", "patch1.yaml"), allPatches[0].Path, "First patch should be file-based")
-	assert.Equal(t, "", allPatches[1].Path, "Second patch should be inline")
+	allResources := map[string]*resource.Resource{
+		"Deployment/test": newResource("Deployment", "test"),
+		"Service/test":    newResource("Service", "test"),
+		"ConfigMap/test":  newResource("ConfigMap", "test"),
+	}
+	sources := []kdiff.FieldSource{
+		{Resource: "Deployment/test", Path: []string{"spec"}, Source: "patch1.yaml"},
+	}
 
-	// Verify resources were collected
-	assert.Equal(t, 1, len(allResources), "Should collect one resource")
-	_, exists := allResources["Deployment/test"]
-	assert.True(t, exists, "Should find Deployment/test resource")
+	assert.Equal(t, []string{"ConfigMap/test", "Service/test"}, unmodifiedResources(allResources, sources),
+		"Should list only resources without changes, sorted")
 }
 
-func TestFieldSourceTracking(t *testing.T) {
-	// Create a temporary directory for test files
-	tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
-	assert.NoError(t, err)
-	defer os.RemoveAll(tmpDir)
-
-	// Create test kustomization structure
-	testDir := filepath.Join(tmpDir, "test")
-	err = os.MkdirAll(testDir, 0755)
-	assert.NoError(t, err)
+func TestRemovedFields(t *testing.T) {
+	limits := kdiff.FieldSource{Resource: "Deployment/test", Path: []string{"spec", "template", "spec", "containers", "0", "resources"}, Original: map[string]interface{}{"cpu": "1"}}
+	replicas := kdiff.FieldSource{Resource: "Deployment/test", Path: []string{"spec", "replicas"}, Original: int64(1), New: int64(3)}
+	label := kdiff.FieldSource{Resource: "Deployment/test", Path: []string{"metadata", "labels", "team"}, New: "web"}
 
-	// Create a test kustomization.yaml with strategic merge patch
-	kustContent := `
-resources:
-  - base
-patches:
-  - path: patches/patch1.yaml
-    target:
-      kind: Deployment
-      name: test
-`
-	err = os.WriteFile(filepath.Join(testDir, "kustomization.yaml"), []byte(kustContent), 0644)
-	assert.NoError(t, err)
+	assert.Equal(t, []kdiff.FieldSource{limits}, removedFields([]kdiff.FieldSource{limits, replicas, label}))
+	assert.Empty(t, removedFields([]kdiff.FieldSource{replicas, label}))
 
-	// Create base resource
-	baseDir := filepath.Join(testDir, "base")
-	err = os.MkdirAll(baseDir, 0755)
-	assert.NoError(t, err)
+	// Ignored paths are dropped before the check
+	kept := kdiff.FilterFieldSources([]kdiff.FieldSource{limits, replicas}, nil, []string{"spec.template.spec.containers.*.resources"})
+	assert.Empty(t, removedFields(kept))
+}
 
-	// Create base kustomization.yaml
-	baseKustContent := `
-resources:
-  - deployment.yaml
-`
-	err = os.WriteFile(filepath.Join(baseDir, "kustomization.yaml"), []byte(baseKustContent), 0644)
+func TestParseMergeKeys(t *testing.T) {
+	keys, err := parseMergeKeys([]string{"spec.template.spec.containers=name", "spec.ports=port"})
 	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"spec.template.spec.containers": "name", "spec.ports": "port"}, keys)
 
-	baseContent := `
-apiVersion: apps/v1
-kind: Deployment
-metadata:
-  name: test
-spec:
-  replicas: 1
-  template:
-    spec:
-      containers:
-      - name: test
-        image: test:1.0
-`
-	err = os.WriteFile(filepath.Join(baseDir, "deployment.yaml"), []byte(baseContent), 0644)
-	assert.NoError(t, err)
+	for _, value := range []string{"spec.ports", "=port", "spec.ports="} {
+		_, err := parseMergeKeys([]string{value})
+		assert.Error(t, err, value)
+	}
+}
 
-	// Create patch file
-	patchesDir := filepath.Join(testDir, "patches")
-	err = os.MkdirAll(patchesDir, 0755)
-	assert.NoError(t, err)
+func TestFormatSourceRelativeTo(t *testing.T) {
+	defer func() { sourceBase = "" }()
 
-	patchContent := `
-apiVersion: apps/v1
-kind: Deployment
-metadata:
-  name: test
-spec:
-  replicas: 3
-  template:
-    spec:
-      containers:
-      - name: test
-        image: test:2.0
-`
-	err = os.WriteFile(filepath.Join(patchesDir, "patch1.yaml"), []byte(patchContent), 0644)
-	assert.NoError(t, err)
+	source := "/repo/overlays/prod/patches/replicas.yaml"
+	assert.Equal(t, "replicas.yaml", formatSource(source), "Should show the file name without a base")
+	assert.Equal(t, "inline patch", formatSource(""))
 
-	// Run the main processing
-	fs := filesys.MakeFsOnDisk()
-	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
-	allPatches := make([]types.Patch, 0)
-	allResources := make(map[string]*resource.Resource)
+	sourceBase = "/repo/overlays/prod"
+	assert.Equal(t, filepath.Join("patches", "replicas.yaml"), formatSource(source))
 
-	processKustomization(fs, k, testDir, &allPatches, allResources)
+	sourceBase = "/repo"
+	assert.Equal(t, filepath.Join("overlays", "prod", "patches", "replicas.yaml"), formatSource(source))
 
-	// Process patches and track changes
-	for _, patch := range allPatches {
-		targetKey := fmt.Sprintf("%s/%s", patch.Target.Kind, patch.Target.Name)
-		targetRes, exists := allResources[targetKey]
-		assert.True(t, exists, "Target resource should exist")
-
-		// Get state before patch
-		var beforeMap map[string]interface{}
-		err := yaml.Unmarshal([]byte(targetRes.MustYaml()), &beforeMap)
-		assert.NoError(t, err)
-
-		// Apply patch
-		var patchData []byte
-		if patch.Path != "" {
-			patchData, err = fs.ReadFile(patch.Path)
-			assert.NoError(t, err)
-		} else {
-			patchData = []byte(patch.Patch)
-		}
-
-		// Parse and apply patch
-		var patchContent interface{}
-		err = yaml.Unmarshal(patchData, &patchContent)
-		assert.NoError(t, err)
+	sourceBase = "/repo/base"
+	assert.Equal(t, filepath.Join("..", "overlays", "prod", "patches", "replicas.yaml"), formatSource(source))
+}
 
-		// Convert resource to map
-		var resourceMap map[string]interface{}
-		err = yaml.Unmarshal([]byte(targetRes.MustYaml()), &resourceMap)
-		assert.NoError(t, err)
+func TestDescribeSource(t *testing.T) {
+	source := "/app/patches/replicas.yaml"
+	assert.Equal(t, "replicas.yaml", describeSource(kdiff.FieldSource{Source: source, SourceType: kdiff.SourceTypePatch}))
+	assert.Equal(t, "JSON patch (replicas.yaml)", describeSource(kdiff.FieldSource{Source: source, SourceType: kdiff.SourceTypeJSONPatch}))
+	assert.Equal(t, "images transformer (kustomization.yaml)",
+		describeSource(kdiff.FieldSource{Source: "/app/kustomization.yaml", SourceType: kdiff.SourceTypeTransformer + "images"}))
+	assert.Equal(t, "transformers entry PrefixSuffixTransformer (prefixer.yaml)",
+		describeSource(kdiff.FieldSource{Source: "/app/prefixer.yaml", SourceType: kdiff.SourceTypeTransformer + "PrefixSuffixTransformer"}))
+	assert.Equal(t, kdiff.LiveSource, describeSource(kdiff.FieldSource{Source: kdiff.LiveSource, SourceType: kdiff.SourceTypeLive}))
+	assert.Equal(t, "inline patch", describeSource(kdiff.FieldSource{}))
+}
 
-		// Apply strategic merge patch
-		mergeMap(resourceMap, patchContent.(map[string]interface{}))
+func TestDumpBase(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	deployment := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - patch: |
+      - op: replace
+        path: /spec/replicas
+        value: 3
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/deployment.yaml": deployment,
 	}
-
-	// Verify field changes were tracked
-	assert.Greater(t, len(fieldSources), 0, "Should track field changes")
-
-	// Check for specific changes
-	foundReplicasChange := false
-	foundImageChange := false
-	for _, source := range fieldSources {
-		if strings.Join(source.Path, " → ") == "spec → replicas" {
-			foundReplicasChange = true
-			assert.Equal(t, float64(1), source.Original, "Original replicas should be 1")
-			assert.Equal(t, float64(3), source.New, "New replicas should be 3")
-		}
-		if strings.Join(source.Path, " → ") == "spec → template → spec → containers → 0 → image" {
-			foundImageChange = true
-			assert.Equal(t, "test:1.0", source.Original, "Original image should be test:1.0")
-			assert.Equal(t, "test:2.0", source.New, "New image should be test:2.0")
-		}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
 	}
-	assert.True(t, foundReplicasChange, "Should track replicas change")
-	assert.True(t, foundImageChange, "Should track image change")
-}
 
-func TestPathResolution(t *testing.T) {
-	// Create a temporary directory for test files
-	tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
+	result, err := kdiff.Diff(fs, "/app", kdiff.Options{})
 	assert.NoError(t, err)
-	defer os.RemoveAll(tmpDir)
 
-	// Create test kustomization structure with nested kustomizations
-	rootDir := filepath.Join(tmpDir, "root")
-	err = os.MkdirAll(rootDir, 0755)
-	assert.NoError(t, err)
+	var out bytes.Buffer
+	assert.NoError(t, dumpBase(&out, "deploy/web", result.Resources, false))
+	assert.YAMLEq(t, deployment, out.String(), "Should dump the resource as loaded, before the patch")
 
-	// Create root kustomization.yaml
-	rootKustContent := `
-resources:
-  - base
-components:
-  - component
-`
-	err = os.WriteFile(filepath.Join(rootDir, "kustomization.yaml"), []byte(rootKustContent), 0644)
-	assert.NoError(t, err)
-
-	// Create base kustomization
-	baseDir := filepath.Join(rootDir, "base")
-	err = os.MkdirAll(baseDir, 0755)
-	assert.NoError(t, err)
+	err = dumpBase(&out, "Service/web", result.Resources, false)
+	assert.ErrorContains(t, err, "known: Deployment/web")
+}
 
-	baseKustContent := `
+func TestPrintExplain(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
 resources:
-  - resource.yaml
+  - deployment.yaml
+  - secret.yaml
 patches:
-  - path: patches/patch1.yaml
+  - path: scale.yaml
     target:
       kind: Deployment
-      name: test
-`
-	err = os.WriteFile(filepath.Join(baseDir, "kustomization.yaml"), []byte(baseKustContent), 0644)
-	assert.NoError(t, err)
-
-	// Create component kustomization
-	compDir := filepath.Join(rootDir, "component")
-	err = os.MkdirAll(compDir, 0755)
-	assert.NoError(t, err)
-
-	// Create component kustomization.yaml with kind: Component
-	compKustContent := `
-kind: Component
-patches:
-  - path: patches/patch2.yaml
+      name: web
+  - patch: |
+      - op: replace
+        path: /spec/replicas
+        value: 5
     target:
       kind: Deployment
-      name: test
-`
-	err = os.WriteFile(filepath.Join(compDir, "kustomization.yaml"), []byte(compKustContent), 0644)
-	assert.NoError(t, err)
+      name: web
+  - path: password.yaml
+    target:
+      kind: Secret
+      name: db
+`,
+		"/app/deployment.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 1\n",
+		"/app/scale.yaml":      "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 3\n",
+		"/app/secret.yaml":     "apiVersion: v1\nkind: Secret\nmetadata:\n  name: db\ndata:\n  password: aHVudGVyMg==\n",
+		"/app/password.yaml":   "apiVersion: v1\nkind: Secret\nmetadata:\n  name: db\ndata:\n  password: c3VwZXJzZWNyZXQ=\n",
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
 
-	// Create test resources and patches
-	resourceContent := `
-apiVersion: apps/v1
-kind: Deployment
-metadata:
-  name: test
-spec:
-  replicas: 1
-`
-	err = os.WriteFile(filepath.Join(baseDir, "resource.yaml"), []byte(resourceContent), 0644)
+	result, err := kdiff.Diff(fs, "/app", kdiff.Options{})
 	assert.NoError(t, err)
 
-	// Create patches
-	basePatchDir := filepath.Join(baseDir, "patches")
-	err = os.MkdirAll(basePatchDir, 0755)
-	assert.NoError(t, err)
+	var out bytes.Buffer
+	printExplain(&out, "Deployment/web", "spec.replicas", result.Resources, result.FieldSources, false)
+	assert.Equal(t, `
+=== Explain Deployment/web spec.replicas ===
+Base: 1
+  1. 1 → 3 (scale.yaml)
+  2. 3 → 5 (JSON patch (inline patch))
+Final: 5
+`, out.String())
+
+	out.Reset()
+	printExplain(&out, "Deployment/web", "spec.paused", result.Resources, result.FieldSources, false)
+	assert.Contains(t, out.String(), "No patch modified this field\n")
+
+	// The base of a Secret is masked like the steps
+	out.Reset()
+	printExplain(&out, "Secret/db", "data.password", result.Resources, result.FieldSources, false)
+	assert.Equal(t, `
+=== Explain Secret/db data.password ===
+Base: <redacted: 7 bytes>
+  1. <redacted: 7 bytes> → <redacted: 11 bytes> (password.yaml)
+Final: <redacted: 11 bytes>
+`, out.String())
+
+	out.Reset()
+	printExplain(&out, "Secret/db", "data.password", result.Resources, result.FieldSources, true)
+	assert.Contains(t, out.String(), "Base: aHVudGVyMg==\n")
+}
 
-	compPatchDir := filepath.Join(compDir, "patches")
-	err = os.MkdirAll(compPatchDir, 0755)
-	assert.NoError(t, err)
+// runMain runs kdiff with args in a new process and returns its stdout
+func runMain(args ...string) (string, error) {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "KDIFF_MAIN_ARGS="+strings.Join(args, "\n"))
+	out, err := cmd.Output()
+	return string(out), err
+}
 
-	patch1Content := `
-apiVersion: apps/v1
-kind: Deployment
-metadata:
-  name: test
-spec:
-  replicas: 2
-`
-	err = os.WriteFile(filepath.Join(basePatchDir, "patch1.yaml"), []byte(patch1Content), 0644)
-	assert.NoError(t, err)
+func TestExplainFlag(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"kustomization.yaml": "resources:\n  - deployment.yaml\npatches:\n  - path: scale.yaml\n",
+		"deployment.yaml":    "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 1\n",
+		"scale.yaml":         "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 3\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644))
+	}
 
-	patch2Content := `
-apiVersion: apps/v1
-kind: Deployment
-metadata:
-  name: test
-spec:
-  replicas: 3
-`
-	err = os.WriteFile(filepath.Join(compPatchDir, "patch2.yaml"), []byte(patch2Content), 0644)
+	out, err := runMain("-explain", "Deployment/web", "spec.replicas", tmpDir)
 	assert.NoError(t, err)
+	assert.Contains(t, out, "=== Explain Deployment/web spec.replicas ===\nBase: 1\n  1. 1 → 3 (scale.yaml)\nFinal: 3\n")
+	assert.NotContains(t, out, "Field Changes", "Explain should replace the full report")
 
-	// Test path resolution
-	fs := filesys.MakeFsOnDisk()
-	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
-	allPatches := make([]types.Patch, 0)
-	allResources := make(map[string]*resource.Resource)
-
-	processKustomization(fs, k, rootDir, &allPatches, allResources)
-
-	// Verify patches were collected with correct paths
-	assert.Equal(t, 2, len(allPatches), "Should collect both patches")
-
-	// Verify base patch path
-	basePatchPath := filepath.Join(baseDir, "patches", "patch1.yaml")
-	assert.Equal(t, basePatchPath, allPatches[0].Path, "Base patch path should be resolved correctly")
-
-	// Verify component patch path
-	compPatchPath := filepath.Join(compDir, "patches", "patch2.yaml")
-	assert.Equal(t, compPatchPath, allPatches[1].Path, "Component patch path should be resolved correctly")
+	_, err = runMain("-explain", "Deployment/web", tmpDir)
+	assert.Error(t, err, "Explain needs the field path")
 }
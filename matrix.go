@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+// formatMatrixKeys returns result with its resources identified by format,
+// for reporting
+func formatMatrixKeys(format string, result *kdiff.MatrixResult) *kdiff.MatrixResult {
+	formatted := &kdiff.MatrixResult{Unchanged: result.Unchanged}
+	for _, row := range result.Rows {
+		row.Resource = reportKey(format, row.Resource)
+		formatted.Rows = append(formatted.Rows, row)
+	}
+	return formatted
+}
+
+// writeMatrix writes the matrix as a table with a column per variant, named
+// after the overlay directories, followed by the count of skipped resources
+func writeMatrix(w io.Writer, dirs []string, result *kdiff.MatrixResult) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	header := []string{"RESOURCE", "FIELD"}
+	for _, dir := range dirs {
+		header = append(header, strings.ToUpper(filepath.Base(filepath.Clean(dir))))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, row := range result.Rows {
+		cells := []string{row.Resource, row.Field}
+		for i, value := range row.Values {
+			switch {
+			case !row.Present[i]:
+				cells = append(cells, "-")
+			case row.Field == kdiff.ResourceField:
+				cells = append(cells, "present")
+			default:
+				cells = append(cells, fmt.Sprintf("%v", value))
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if result.Unchanged > 0 {
+		_, err := fmt.Fprintf(w, "\n%d unchanged resources skipped\n", result.Unchanged)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestMatrix(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/base/kustomization.yaml": `
+resources:
+  - deployment.yaml
+`,
+		"/app/base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: web
+          image: web:1.0
+`,
+		"/app/dev/kustomization.yaml": `
+resources:
+  - ../base
+`,
+		"/app/prod/kustomization.yaml": `
+resources:
+  - ../base
+  - service.yaml
+patches:
+  - patch: |-
+      - op: replace
+        path: /spec/replicas
+        value: 3
+    target:
+      kind: Deployment
+      name: test
+`,
+		"/app/prod/service.yaml": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: test
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	dirs := []string{"/app/base", "/app/dev", "/app/prod"}
+	result, err := kdiff.Matrix(fs, dirs, kdiff.Options{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []kdiff.MatrixRow{
+		{
+			Resource: "Deployment.v1.apps/test.[noNs]",
+			Field:    "spec.replicas",
+			Values:   []interface{}{int64(1), int64(1), int64(3)},
+			Present:  []bool{true, true, true},
+		},
+		{
+			Resource: "Service.v1.[noGrp]/test.[noNs]",
+			Field:    kdiff.ResourceField,
+			Values:   []interface{}{nil, nil, nil},
+			Present:  []bool{false, false, true},
+		},
+	}, result.Rows, "Should only list diverging fields and resources")
+	assert.Equal(t, 0, result.Unchanged)
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeMatrix(&buf, dirs, formatMatrixKeys(kdiff.DefaultResourceKeyFormat, result)))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, []string{"RESOURCE", "FIELD", "BASE", "DEV", "PROD"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"Deployment/test", "spec.replicas", "1", "1", "3"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"Service/test", "(resource)", "-", "-", "present"}, strings.Fields(lines[2]))
+}
+
+func TestMatrixOnlyChangedResources(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	resources := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: %d
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: test
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+stringData:
+  password: %s
+`
+	for dir, values := range map[string][]interface{}{
+		"/app/dev":  {1, "old"},
+		"/app/prod": {3, "newer"},
+	} {
+		assert.NoError(t, fs.WriteFile(dir+"/kustomization.yaml", []byte("resources:\n  - resources.yaml\n")))
+		assert.NoError(t, fs.WriteFile(dir+"/resources.yaml", []byte(fmt.Sprintf(resources, values...))))
+	}
+	dirs := []string{"/app/dev", "/app/prod"}
+
+	result, err := kdiff.Matrix(fs, dirs, kdiff.Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Unchanged, "Should skip the identical Service")
+	assert.Equal(t, 2, len(result.Rows))
+	assert.Equal(t, "spec.replicas", result.Rows[0].Field)
+	assert.Equal(t, "stringData.password", result.Rows[1].Field)
+	assert.Equal(t, []interface{}{"<redacted: 3 bytes>", "<redacted: 5 bytes>"}, result.Rows[1].Values, "Should mask Secret values")
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeMatrix(&buf, dirs, formatMatrixKeys(kdiff.DefaultResourceKeyFormat, result)))
+	assert.Contains(t, buf.String(), "1 unchanged resources skipped")
+
+	// Comparing everything gives the same rows
+	all, err := kdiff.Matrix(fs, dirs, kdiff.Options{CompareAll: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, all.Unchanged)
+	assert.Equal(t, result.Rows, all.Rows)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+// writeOrderChanges lists the resources sortOptions moved, as apply order can
+// matter
+func writeOrderChanges(w io.Writer, changes []kdiff.OrderChange) error {
+	if _, err := fmt.Fprintf(w, "\n=== Resource Order (sortOptions) ===\n"); err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if _, err := fmt.Fprintf(w, "  • %s: position %d → %d\n", change.Resource, change.From, change.To); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestDiffSortOptionsOrdering(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/deployment.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: web\n",
+		"/app/namespace.yaml":  "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: web\n",
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+	resources := "resources:\n  - deployment.yaml\n  - namespace.yaml\n"
+
+	// Legacy ordering puts namespaces first
+	assert.NoError(t, fs.WriteFile("/app/kustomization.yaml", []byte(resources+"sortOptions:\n  order: legacy\n")))
+	result, err := kdiff.Diff(fs, "/app", kdiff.Options{BuildFinal: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []kdiff.OrderChange{
+		{Resource: "Namespace.v1.[noGrp]/web.[noNs]", From: 2, To: 1},
+		{Resource: "Deployment.v1.apps/web.web", From: 1, To: 2},
+	}, result.Ordering)
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeOrderChanges(&buf, result.Ordering))
+	assert.Contains(t, buf.String(), "  • Namespace.v1.[noGrp]/web.[noNs]: position 2 → 1\n")
+
+	// FIFO keeps declaration order
+	assert.NoError(t, fs.WriteFile("/app/kustomization.yaml", []byte(resources+"sortOptions:\n  order: fifo\n")))
+	result, err = kdiff.Diff(fs, "/app", kdiff.Options{BuildFinal: true})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Ordering)
+
+	// Without sortOptions the order isn't reported
+	assert.NoError(t, fs.WriteFile("/app/kustomization.yaml", []byte(resources)))
+	result, err = kdiff.Diff(fs, "/app", kdiff.Options{BuildFinal: true})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Ordering)
+}
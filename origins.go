@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"sigs.k8s.io/yaml"
+)
+
+// fieldOriginsAnnotation lists the changed fields of a resource and their
+// sources in -o origin output
+const fieldOriginsAnnotation = "config.kubernetes.io/field-origins"
+
+// ResourceProvenance is a resource in -o origin output, with annotations in
+// the format of kustomize's origin annotation
+type ResourceProvenance struct {
+	Resource    string            `json:"resource"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// fieldOrigin is an entry of the field-origins annotation. Path is relative
+// to the root kustomization, like the path of an origin annotation, and empty
+// for inline patches.
+type fieldOrigin struct {
+	Field   string `json:"field"`
+	Element string `json:"element,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Type    string `json:"type"`
+}
+
+// buildProvenance returns a ResourceProvenance per resource with an origin or
+// changes, sorted by resource. config.kubernetes.io/origin holds the file the
+// resource was loaded from or the kustomization generating it, and
+// config.kubernetes.io/field-origins each change's dotted path and source, in
+// order.
+func buildProvenance(sources []kdiff.FieldSource, origins map[string]string, generated []kdiff.GeneratedResource) ([]ResourceProvenance, error) {
+	annotations := make(map[string]map[string]string)
+	annotate := func(resource, key string, value interface{}) error {
+		data, err := yaml.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("marshal %s of %s: %w", key, resource, err)
+		}
+		if annotations[resource] == nil {
+			annotations[resource] = make(map[string]string)
+		}
+		annotations[resource][key] = string(data)
+		return nil
+	}
+
+	for resource, path := range origins {
+		if err := annotate(resource, kdiff.OriginAnnotation, kdiff.ResourceOrigin{Path: formatSource(path)}); err != nil {
+			return nil, err
+		}
+	}
+	for _, gen := range generated {
+		if err := annotate(gen.Resource, kdiff.OriginAnnotation, kdiff.ResourceOrigin{ConfiguredIn: formatSource(gen.Source)}); err != nil {
+			return nil, err
+		}
+	}
+
+	fields := make(map[string][]fieldOrigin)
+	var order []string
+	for _, change := range sources {
+		if fields[change.Resource] == nil {
+			order = append(order, change.Resource)
+		}
+		origin := fieldOrigin{
+			Field:   strings.Join(change.Path, "."),
+			Element: change.Element,
+			Type:    change.SourceType,
+		}
+		if change.Source != "" && change.Source != kdiff.InlinePluginSource {
+			origin.Path = formatSource(change.Source)
+		}
+		fields[change.Resource] = append(fields[change.Resource], origin)
+	}
+	for _, resource := range order {
+		if err := annotate(resource, fieldOriginsAnnotation, fields[resource]); err != nil {
+			return nil, err
+		}
+	}
+
+	provenance := make([]ResourceProvenance, 0, len(annotations))
+	for resource, values := range annotations {
+		provenance = append(provenance, ResourceProvenance{Resource: resource, Annotations: values})
+	}
+	sort.Slice(provenance, func(i, j int) bool {
+		return provenance[i].Resource < provenance[j].Resource
+	})
+	return provenance, nil
+}
+
+// writeProvenance writes the provenance of each resource as a YAML list
+func writeProvenance(w io.Writer, provenance []ResourceProvenance) error {
+	data, err := yaml.Marshal(provenance)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildProvenance(t *testing.T) {
+	defer func(base string) { sourceBase = base }(sourceBase)
+	sourceBase = "/app"
+
+	sources := []kdiff.FieldSource{
+		{Resource: "Deployment/web", Path: []string{"spec", "replicas"}, Source: "/app/patches/replicas.yaml", SourceType: kdiff.SourceTypePatch, Original: int64(1), New: int64(3)},
+		{Resource: "Deployment/web", Path: []string{"spec", "template", "spec", "containers", "0", "image"}, Element: "name=web", SourceType: kdiff.SourceTypeJSONPatch, New: "web:2"},
+	}
+	origins := map[string]string{
+		"Deployment/web": "/app/base/deployment.yaml",
+		"Service/web":    "/app/base/service.yaml",
+	}
+	generated := []kdiff.GeneratedResource{{Resource: "ConfigMap/settings-abc123", Source: "/app/kustomization.yaml"}}
+
+	provenance, err := buildProvenance(sources, origins, generated)
+	assert.NoError(t, err)
+	assert.Equal(t, []ResourceProvenance{
+		{Resource: "ConfigMap/settings-abc123", Annotations: map[string]string{
+			"config.kubernetes.io/origin": "configuredIn: kustomization.yaml\n",
+		}},
+		{Resource: "Deployment/web", Annotations: map[string]string{
+			"config.kubernetes.io/origin": "path: base/deployment.yaml\n",
+			"config.kubernetes.io/field-origins": `- field: spec.replicas
+  path: patches/replicas.yaml
+  type: patch
+- element: name=web
+  field: spec.template.spec.containers.0.image
+  type: jsonPatch
+`,
+		}},
+		{Resource: "Service/web", Annotations: map[string]string{
+			"config.kubernetes.io/origin": "path: base/service.yaml\n",
+		}},
+	}, provenance)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+// writePatchList prints the collected patches as text or, with format json,
+// as a JSON array
+func writePatchList(w io.Writer, format string, patches []kdiff.PatchInfo) error {
+	if format == "json" {
+		data, err := json.MarshalIndent(patches, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "=== Patches ===\n"); err != nil {
+		return err
+	}
+	for i, patch := range patches {
+		source := "Inline patch"
+		if !patch.Inline {
+			source = patch.Path
+		}
+		kind := "unreadable"
+		switch patch.Type {
+		case kdiff.SourceTypePatch:
+			kind = "strategic merge"
+		case kdiff.SourceTypeJSONPatch:
+			kind = "JSON 6902"
+		}
+		if _, err := fmt.Fprintf(w, "  %d. %s (%s)\n     Target: %s\n", i+1, source, kind, kdiff.DescribeTarget(patch.Target)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/types"
+)
+
+func TestListPatches(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/base/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+		"/app/base/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+`,
+		"/app/overlay/kustomization.yaml": `
+resources:
+  - ../base
+patches:
+  - patch: |-
+      - op: replace
+        path: /spec/replicas
+        value: 3
+    target:
+      group: apps
+      version: v1
+      kind: Deployment
+      labelSelector: app=web
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	patches, err := kdiff.ListPatches(fs, "/app/overlay", kdiff.Options{LoadRestrictions: types.LoadRestrictionsNone})
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(patches)) {
+		assert.Equal(t, "/app/base/replicas.yaml", patches[0].Path)
+		assert.Equal(t, kdiff.SourceTypePatch, patches[0].Type)
+		assert.False(t, patches[0].Inline)
+		assert.True(t, patches[1].Inline)
+		assert.Equal(t, kdiff.SourceTypeJSONPatch, patches[1].Type)
+		assert.Equal(t, "apps/v1 Deployment/*, labels app=web", kdiff.DescribeTarget(patches[1].Target))
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, writePatchList(&out, "text", patches))
+	assert.Equal(t, `=== Patches ===
+  1. /app/base/replicas.yaml (strategic merge)
+     Target: Deployment/web
+  2. Inline patch (JSON 6902)
+     Target: apps/v1 Deployment/*, labels app=web
+`, out.String())
+
+	out.Reset()
+	assert.NoError(t, writePatchList(&out, "json", patches))
+	var decoded []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	if assert.Equal(t, 2, len(decoded)) {
+		assert.Equal(t, map[string]interface{}{"kind": "Deployment", "name": "web"}, decoded[0]["target"])
+		assert.Equal(t, "jsonPatch", decoded[1]["type"])
+		assert.Equal(t, true, decoded[1]["inline"])
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/yaml"
+)
+
+// formatPath renders the path of change for the text report, naming list
+// elements by their merge key, e.g. containers[name=web] → image instead of
+// containers → 0 → image. Elements are resolved in object, the after-state of
+// the resource; the innermost element is named by change.Element when it was
+// recorded, as indexes may have shifted since. Lists are keyed as in the run
+// with opts. Indexes that can't be resolved are kept.
+func formatPath(change kdiff.FieldSource, object interface{}, opts kdiff.Options) string {
+	path := change.Path
+	innermost := -1
+	for i := len(path) - 1; i > 0; i-- {
+		if _, err := strconv.Atoi(path[i]); err == nil {
+			innermost = i
+			break
+		}
+	}
+	// A removed element is no longer in the after-state
+	removed := innermost == len(path)-1 && change.New == nil
+
+	var segments []string
+	for i, segment := range path {
+		if i == 0 {
+			segments = append(segments, segment)
+			continue
+		}
+		if _, err := strconv.Atoi(segment); err != nil {
+			segments = append(segments, segment)
+			continue
+		}
+
+		name := ""
+		if i == innermost && change.Element != "" {
+			name = change.Element
+		} else if !(i == innermost && removed) {
+			name = kdiff.ListElementName(object, path[:i+1], opts)
+		}
+		if name == "" {
+			segments = append(segments, segment)
+			continue
+		}
+		segments[len(segments)-1] += "[" + name + "]"
+	}
+	return strings.Join(segments, " → ")
+}
+
+// afterStates returns the objects of the final build by report key, to
+// resolve list elements in the text report. Root patches and transformers
+// record changes under the final names; changes to resources renamed later
+// fall back to their recorded element.
+func afterStates(format string, final resmap.ResMap) (map[string]interface{}, error) {
+	objects := make(map[string]interface{})
+	if final == nil {
+		return objects, nil
+	}
+	for _, res := range final.Resources() {
+		var object map[string]interface{}
+		if err := yaml.Unmarshal([]byte(res.MustYaml()), &object); err != nil {
+			return nil, fmt.Errorf("unmarshal %s/%s: %w", res.GetKind(), res.GetName(), err)
+		}
+		objects[reportKey(format, kdiff.ResourceKey(res))] = object
+	}
+	return objects, nil
+}
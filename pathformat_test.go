@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestFormatPath(t *testing.T) {
+	object := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{
+					"name":  "web",
+					"image": "web:2.0",
+					"ports": []interface{}{map[string]interface{}{"containerPort": int64(8080)}},
+					"env": []interface{}{
+						map[string]interface{}{"name": "A", "value": "1"},
+						map[string]interface{}{"name": "B", "value": "2"},
+					},
+					"args": []interface{}{"--verbose"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		change kdiff.FieldSource
+		want   string
+	}{
+		{
+			name:   "container field",
+			change: kdiff.FieldSource{Path: []string{"spec", "containers", "0", "image"}, New: "web:2.0"},
+			want:   "spec → containers[name=web] → image",
+		},
+		{
+			name:   "port keyed by containerPort",
+			change: kdiff.FieldSource{Path: []string{"spec", "containers", "0", "ports", "0", "containerPort"}, New: int64(8080)},
+			want:   "spec → containers[name=web] → ports[containerPort=8080] → containerPort",
+		},
+		{
+			name:   "recorded element wins",
+			change: kdiff.FieldSource{Path: []string{"spec", "containers", "0", "env", "0", "value"}, Element: "name=B", New: "2"},
+			want:   "spec → containers[name=web] → env[name=B] → value",
+		},
+		{
+			name:   "removed element keeps its index",
+			change: kdiff.FieldSource{Path: []string{"spec", "containers", "0", "env", "1"}},
+			want:   "spec → containers[name=web] → env → 1",
+		},
+		{
+			name:   "unkeyed list",
+			change: kdiff.FieldSource{Path: []string{"spec", "containers", "0", "args", "0"}, New: "--verbose"},
+			want:   "spec → containers[name=web] → args → 0",
+		},
+		{
+			name:   "no after-state",
+			change: kdiff.FieldSource{Path: []string{"spec", "containers", "0", "image"}, New: "web:2.0"},
+			want:   "spec → containers → 0 → image",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var obj interface{} = object
+			if tt.name == "no after-state" {
+				obj = nil
+			}
+			assert.Equal(t, tt.want, formatPath(tt.change, obj, kdiff.Options{}))
+		})
+	}
+}
+
+func TestAfterStates(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	assert.NoError(t, fs.WriteFile("/app/kustomization.yaml", []byte(`
+namePrefix: prod-
+resources:
+  - deployment.yaml
+`)))
+	assert.NoError(t, fs.WriteFile("/app/deployment.yaml", []byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: web:1.0
+`)))
+	final, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fs, "/app")
+	assert.NoError(t, err)
+
+	objects, err := afterStates(kdiff.DefaultResourceKeyFormat, final)
+	assert.NoError(t, err)
+	assert.Contains(t, objects, "Deployment/prod-web", "Should be keyed by the final name")
+
+	var buf bytes.Buffer
+	writeFieldChanges(&buf, "Field Changes", []kdiff.FieldSource{{
+		Resource: "Deployment/prod-web",
+		Path:     []string{"spec", "template", "spec", "containers", "0", "image"},
+		Source:   "patch.yaml",
+		Original: "web:0.9",
+		New:      "web:1.0",
+	}}, textStyle{Objects: objects})
+	assert.Contains(t, buf.String(), "Field: spec → template → spec → containers[name=web] → image")
+	assert.NotContains(t, buf.String(), "containers → 0", "Structured paths keep the index, the report doesn't")
+}
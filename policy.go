@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/yaml"
+)
+
+// FieldPolicy is a -fail-if-field-set assertion: the field at Path must not
+// be set, or must not hold Value if HasValue. Path segments are globs, e.g.
+// spec.template.spec.containers.*.securityContext.privileged.
+type FieldPolicy struct {
+	Flag     string // The flag value, for messages
+	Path     []string
+	Value    string
+	HasValue bool
+}
+
+// PolicyViolation is a field of the final build violating a FieldPolicy
+type PolicyViolation struct {
+	Resource string
+	Path     []string
+	Value    interface{}
+	Policy   string
+}
+
+// parseFieldPolicies parses -fail-if-field-set values of the form path or
+// path=value
+func parseFieldPolicies(values []string) ([]FieldPolicy, error) {
+	var policies []FieldPolicy
+	for _, value := range values {
+		fieldPath, want, hasValue := strings.Cut(value, "=")
+		if fieldPath == "" {
+			return nil, fmt.Errorf("invalid field policy %q (expected path or path=value, e.g. spec.template.spec.hostNetwork=true)", value)
+		}
+		policies = append(policies, FieldPolicy{
+			Flag:     value,
+			Path:     strings.Split(fieldPath, "."),
+			Value:    want,
+			HasValue: hasValue,
+		})
+	}
+	return policies, nil
+}
+
+// checkFieldPolicies returns the fields of the final build that violate a
+// policy, sorted by resource and path. Values compare by their string form,
+// so true matches the boolean and the string alike.
+func checkFieldPolicies(final resmap.ResMap, policies []FieldPolicy) ([]PolicyViolation, error) {
+	var violations []PolicyViolation
+	for _, res := range final.Resources() {
+		key := kdiff.ResourceKey(res)
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(res.MustYaml()), &obj); err != nil {
+			return nil, fmt.Errorf("unmarshal %s: %w", key, err)
+		}
+		normalized := kdiff.NormalizeNumbers(obj)
+		for _, policy := range policies {
+			for _, field := range fieldsAtPath(normalized, policy.Path, nil) {
+				if policy.HasValue && formatPolicyValue(field.Value) != policy.Value {
+					continue
+				}
+				violations = append(violations, PolicyViolation{
+					Resource: key,
+					Path:     field.Path,
+					Value:    field.Value,
+					Policy:   policy.Flag,
+				})
+			}
+		}
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		if violations[i].Resource != violations[j].Resource {
+			return violations[i].Resource < violations[j].Resource
+		}
+		return strings.Join(violations[i].Path, ".") < strings.Join(violations[j].Path, ".")
+	})
+	return violations, nil
+}
+
+// redactViolations masks the data and stringData values of Secret
+// violations, as redactSecrets does for changes
+func redactViolations(violations []PolicyViolation) []PolicyViolation {
+	sources := make([]kdiff.FieldSource, len(violations))
+	for i, violation := range violations {
+		sources[i] = kdiff.FieldSource{Resource: violation.Resource, Path: violation.Path, New: violation.Value}
+	}
+	redacted := make([]PolicyViolation, len(violations))
+	for i, source := range kdiff.RedactSecrets(sources) {
+		redacted[i] = violations[i]
+		redacted[i].Value = source.New
+	}
+	return redacted
+}
+
+// policyField is a field matched by a policy path
+type policyField struct {
+	Path  []string
+	Value interface{}
+}
+
+// fieldsAtPath returns the fields of obj matching the glob segments of
+// pattern, with their concrete paths under prefix
+func fieldsAtPath(obj interface{}, pattern []string, prefix []string) []policyField {
+	if len(pattern) == 0 {
+		return []policyField{{Path: prefix, Value: obj}}
+	}
+	child := func(key string) []string {
+		return append(append([]string{}, prefix...), key)
+	}
+
+	var fields []policyField
+	switch obj := obj.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if ok, _ := path.Match(pattern[0], key); ok {
+				fields = append(fields, fieldsAtPath(obj[key], pattern[1:], child(key))...)
+			}
+		}
+	case []interface{}:
+		for i, elem := range obj {
+			if ok, _ := path.Match(pattern[0], strconv.Itoa(i)); ok {
+				fields = append(fields, fieldsAtPath(elem, pattern[1:], child(strconv.Itoa(i)))...)
+			}
+		}
+	}
+	return fields
+}
+
+// formatPolicyValue is the string form a field value is compared by
+func formatPolicyValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return value
+	case map[string]interface{}, []interface{}:
+		data, err := yaml.Marshal(value)
+		if err != nil {
+			return fmt.Sprintf("%v", value)
+		}
+		return strings.TrimSpace(string(data))
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// writePolicyViolations lists the fields violating -fail-if-field-set
+// policies
+func writePolicyViolations(w io.Writer, violations []PolicyViolation) {
+	fmt.Fprintf(w, "\n=== Field Policy Violations ===\n")
+	for _, violation := range violations {
+		fmt.Fprintf(w, "  • %s: %s is %s (fail-if-field-set %s)\n",
+			violation.Resource, strings.Join(violation.Path, "."), formatPolicyValue(violation.Value), violation.Policy)
+	}
+	fmt.Fprintf(w, "\n%d fields violate a field policy\n", len(violations))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestCheckFieldPolicies(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: host-network.yaml
+    target:
+      kind: Deployment
+      name: web
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1.0
+      - name: sidecar
+        image: proxy:1.0
+        securityContext:
+          privileged: false
+`,
+		"/app/host-network.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      hostNetwork: true
+      containers:
+      - name: app
+        securityContext:
+          privileged: true
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := kdiff.Diff(fs, "/app", kdiff.Options{BuildFinal: true})
+	assert.NoError(t, err)
+
+	policies, err := parseFieldPolicies([]string{
+		"spec.template.spec.hostNetwork=true",
+		"spec.template.spec.containers.*.securityContext.privileged=true",
+		"spec.template.spec.hostPID",
+		"spec.replicas=1",
+	})
+	assert.NoError(t, err)
+	violations, err := checkFieldPolicies(result.Final, policies)
+	assert.NoError(t, err)
+	assert.Equal(t, []PolicyViolation{
+		{Resource: "Deployment.v1.apps/web.[noNs]", Path: []string{"spec", "replicas"}, Value: int64(1), Policy: "spec.replicas=1"},
+		{Resource: "Deployment.v1.apps/web.[noNs]", Path: []string{"spec", "template", "spec", "containers", "0", "securityContext", "privileged"}, Value: true,
+			Policy: "spec.template.spec.containers.*.securityContext.privileged=true"},
+		{Resource: "Deployment.v1.apps/web.[noNs]", Path: []string{"spec", "template", "spec", "hostNetwork"}, Value: true, Policy: "spec.template.spec.hostNetwork=true"},
+	}, violations)
+
+	// A compliant build passes, whether the field is unset or set otherwise
+	policies, err = parseFieldPolicies([]string{
+		"spec.template.spec.hostNetwork=false",
+		"spec.template.spec.containers.*.securityContext.runAsUser",
+		"spec.template.spec.hostPID",
+	})
+	assert.NoError(t, err)
+	violations, err = checkFieldPolicies(result.Final, policies)
+	assert.NoError(t, err)
+	assert.Empty(t, violations)
+
+	_, err = parseFieldPolicies([]string{"=true"})
+	assert.Error(t, err)
+}
+
+func TestRedactViolations(t *testing.T) {
+	violations := []PolicyViolation{
+		{Resource: "Secret.v1.[noGrp]/creds.[noNs]", Path: []string{"data", "password"}, Value: "c2VjcmV0", Policy: "data.password"},
+		{Resource: "Secret.v1.[noGrp]/creds.[noNs]", Path: []string{"type"}, Value: "Opaque", Policy: "type"},
+		{Resource: "ConfigMap.v1.[noGrp]/app.[noNs]", Path: []string{"data", "password"}, Value: "plain", Policy: "data.password"},
+	}
+	redacted := redactViolations(violations)
+	assert.Equal(t, "<redacted: 6 bytes>", redacted[0].Value, "Secret values should be masked")
+	assert.Equal(t, violations[0].Policy, redacted[0].Policy)
+	assert.Equal(t, violations[1], redacted[1], "Should leave Secret metadata alone")
+	assert.Equal(t, violations[2], redacted[2], "Should leave other kinds alone")
+	assert.Equal(t, "c2VjcmV0", violations[0].Value, "Should copy the violations")
+}
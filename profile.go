@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// hiddenFlags are accepted but left out of -help, as they are only useful
+// when investigating kdiff itself
+var hiddenFlags = map[string]bool{
+	"cpuprofile": true,
+	"memprofile": true,
+}
+
+// printUsage prints the usage message of flags like the flag package,
+// leaving out hiddenFlags
+func printUsage(flags *flag.FlagSet) {
+	out := flags.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", flags.Name())
+
+	visible := flag.NewFlagSet(flags.Name(), flag.ContinueOnError)
+	visible.SetOutput(out)
+	flags.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	visible.PrintDefaults()
+}
+
+// startProfiling starts a CPU profile written to cpuPath, if set. The
+// returned function stops it and writes a heap profile to memPath, if set;
+// it must be called before exiting.
+func startProfiling(cpuPath, memPath string) (func() error, error) {
+	var cpuFile *os.File
+	if cpuPath != "" {
+		var err error
+		if cpuFile, err = os.Create(cpuPath); err != nil {
+			return nil, fmt.Errorf("creating CPU profile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(cpuFile); err != nil {
+			cpuFile.Close()
+			return nil, fmt.Errorf("starting CPU profile: %w", err)
+		}
+	}
+
+	return func() error {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			if err := cpuFile.Close(); err != nil {
+				return fmt.Errorf("writing CPU profile: %w", err)
+			}
+		}
+		if memPath == "" {
+			return nil
+		}
+		memFile, err := os.Create(memPath)
+		if err != nil {
+			return fmt.Errorf("creating memory profile: %w", err)
+		}
+		defer memFile.Close()
+		// Collect garbage so the profile shows live allocations
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(memFile); err != nil {
+			return fmt.Errorf("writing memory profile: %w", err)
+		}
+		return nil
+	}, nil
+}
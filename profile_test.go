@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintUsageHidesFlags(t *testing.T) {
+	flags := flag.NewFlagSet("kdiff", flag.ContinueOnError)
+	flags.Bool("verbose", false, "Log more")
+	flags.String("cpuprofile", "", "Write a CPU profile to this file")
+	var buf bytes.Buffer
+	flags.SetOutput(&buf)
+
+	printUsage(flags)
+	assert.Contains(t, buf.String(), "-verbose")
+	assert.NotContains(t, buf.String(), "cpuprofile", "Hidden flags should be left out of the usage")
+	assert.NoError(t, flags.Parse([]string{"-cpuprofile", "cpu.out"}), "Hidden flags should still be accepted")
+}
+
+func TestStartProfiling(t *testing.T) {
+	dir, err := os.MkdirTemp("", "fieldtrace-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cpuPath := filepath.Join(dir, "cpu.out")
+	memPath := filepath.Join(dir, "mem.out")
+	stop, err := startProfiling(cpuPath, memPath)
+	assert.NoError(t, err)
+	assert.NoError(t, stop())
+
+	for _, path := range []string{cpuPath, memPath} {
+		info, err := os.Stat(path)
+		if assert.NoError(t, err) {
+			assert.NotZero(t, info.Size(), "%s should hold a profile", path)
+		}
+	}
+
+	_, err = startProfiling(filepath.Join(dir, "missing", "cpu.out"), "")
+	assert.Error(t, err)
+}
+
+func TestProfileWrittenOnFatalError(t *testing.T) {
+	dir, err := os.MkdirTemp("", "fieldtrace-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// -to-revision without -from-revision fails after profiling starts
+	memPath := filepath.Join(dir, "mem.out")
+	_, err = runMain("-memprofile", memPath, "-to-revision", "HEAD", dir)
+	assert.Error(t, err)
+	info, err := os.Stat(memPath)
+	if assert.NoError(t, err, "The profile should be written before exiting") {
+		assert.NotZero(t, info.Size())
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+// unsafeFilenameChars matches characters replaced when turning a resource key
+// into a file name
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// reportExtensions maps output formats to report file extensions
+var reportExtensions = map[string]string{
+	"text":  ".txt",
+	"junit": ".xml",
+}
+
+// resourceReportName returns the report file name for a resource key, e.g.
+// Deployment_test.txt for Deployment/test
+func resourceReportName(key, format string) string {
+	return unsafeFilenameChars.ReplaceAllString(key, "_") + reportExtensions[format]
+}
+
+// writeResourceReports writes one report per changed resource into dir using
+// the reporter for format, creating dir if needed. The context lines and
+// objects of style are used by the text reporter. failed is passed to the
+// JUnit reporter and is indexed like sources.
+func writeResourceReports(dir, format string, sources []kdiff.FieldSource, style textStyle, failed func(int) string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// Group changes by resource, keeping each change's index in sources
+	var keys []string
+	groups := make(map[string][]int)
+	for i, source := range sources {
+		if _, exists := groups[source.Resource]; !exists {
+			keys = append(keys, source.Resource)
+		}
+		groups[source.Resource] = append(groups[source.Resource], i)
+	}
+
+	for _, key := range keys {
+		indices := groups[key]
+		changes := make([]kdiff.FieldSource, len(indices))
+		for j, i := range indices {
+			changes[j] = sources[i]
+		}
+
+		var buf bytes.Buffer
+		switch format {
+		case "junit":
+			groupFailed := func(j int) string {
+				if failed == nil {
+					return ""
+				}
+				return failed(indices[j])
+			}
+			if err := writeJUnitReport(&buf, changes, groupFailed); err != nil {
+				return err
+			}
+		default:
+			// Files are never colored or laid out for a terminal
+			writeFieldChanges(&buf, "Field Changes", changes, textStyle{Context: style.Context, Objects: style.Objects})
+		}
+
+		path := filepath.Join(dir, resourceReportName(key, format))
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("writing report for %s: %w", key, err)
+		}
+	}
+	return nil
+}
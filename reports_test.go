@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteResourceReports(t *testing.T) {
+	// Create a temporary directory for test files
+	tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	sources := []kdiff.FieldSource{
+		{Resource: "Deployment/test", Path: []string{"spec", "replicas"}, Source: "patch1.yaml", Original: float64(1), New: float64(3)},
+		{Resource: "Service/test", Path: []string{"spec", "type"}, Source: "patch2.yaml", Original: "ClusterIP", New: "NodePort"},
+		{Resource: "Deployment/test", Path: []string{"metadata", "labels"}, Source: "patch2.yaml", New: "app"},
+	}
+
+	// The output directory is created if missing
+	outputDir := filepath.Join(tmpDir, "reports")
+	err = writeResourceReports(outputDir, "text", sources, textStyle{Context: defaultContextLines}, nil)
+	assert.NoError(t, err)
+
+	entries, err := os.ReadDir(outputDir)
+	assert.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"Deployment_test.txt", "Service_test.txt"}, names, "Should write one file per resource")
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "Deployment_test.txt"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "Field: spec → replicas")
+	assert.Contains(t, string(data), "Field: metadata → labels")
+	assert.NotContains(t, string(data), "Service/test", "Each file should only hold its resource's changes")
+
+	err = writeResourceReports(outputDir, "junit", sources, textStyle{Context: defaultContextLines}, nil)
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(outputDir, "Service_test.xml"))
+	assert.NoError(t, err, "Should use the reporter's file extension")
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+// reportKey renders an internal resourceKey with format. The key itself is
+// rendered, not the resource stored under it, so e.g. {namespace} is the
+// namespace the resource is tracked in. Other keys are kept as they are.
+func reportKey(format, key string) string {
+	if id, ok := kdiff.ParseResourceKey(key); ok {
+		return kdiff.FormatResourceKey(format, id)
+	}
+	return key
+}
+
+// applyResourceKeyFormat returns sources with their resources identified by
+// format, for reporting. Filtering and redaction rely on internal keys, so
+// this runs last.
+func applyResourceKeyFormat(format string, sources []kdiff.FieldSource) []kdiff.FieldSource {
+	formatted := make([]kdiff.FieldSource, len(sources))
+	for i, source := range sources {
+		source.Resource = reportKey(format, source.Resource)
+		formatted[i] = source
+	}
+	return formatted
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/resource"
+)
+
+func TestResourceKeyFormat(t *testing.T) {
+	factory := resource.NewFactory(nil)
+	deployment, err := factory.FromBytes([]byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+`))
+	assert.NoError(t, err)
+	service, err := factory.FromBytes([]byte(`
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`))
+	assert.NoError(t, err)
+
+	format := "{group}/{kind}/{namespace}/{name}"
+	assert.Equal(t, "apps/Deployment/prod/web", kdiff.FormatResourceKey(format, deployment.CurId()))
+	assert.Equal(t, "core/Service/-/web", kdiff.FormatResourceKey(format, service.CurId()))
+
+	sources := []kdiff.FieldSource{
+		{Resource: "Deployment.v1.apps/web.prod", Path: []string{"spec", "replicas"}},
+		{Resource: "Deployment.v1.apps/web.staging", Path: []string{"spec", "replicas"}},
+		{Resource: "ConfigMap/gone", Path: []string{"data"}},
+	}
+	formatted := applyResourceKeyFormat(format, sources)
+	assert.Equal(t, "apps/Deployment/prod/web", formatted[0].Resource)
+	assert.Equal(t, "apps/Deployment/staging/web", formatted[1].Resource, "Should render the namespace of each key")
+	assert.Equal(t, "ConfigMap/gone", formatted[2].Resource, "Other keys are kept")
+	assert.Equal(t, "Deployment.v1.apps/web.prod", sources[0].Resource, "Should not modify its argument")
+
+	assert.Equal(t, "Deployment/web", applyResourceKeyFormat(kdiff.DefaultResourceKeyFormat, sources)[0].Resource)
+	assert.Equal(t, "core/Service/-/web", reportKey(format, kdiff.ResourceKey(service)))
+}
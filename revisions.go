@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+// writeAttributionDeltas prints how the attribution changed between two
+// revisions, grouped by resource
+func writeAttributionDeltas(w io.Writer, from, to string, deltas []kdiff.AttributionDelta) {
+	fmt.Fprintf(w, "\n=== Attribution Delta (%s → %s) ===\n", kdiff.RevisionName(from), kdiff.RevisionName(to))
+	if len(deltas) == 0 {
+		fmt.Fprintln(w, "No attribution changes")
+		return
+	}
+	resource := ""
+	for _, delta := range deltas {
+		if delta.Resource != resource {
+			resource = delta.Resource
+			fmt.Fprintf(w, "\nResource: %s\n", resource)
+		}
+		fmt.Fprintf(w, "  • Field: %s\n", strings.Join(delta.Path, " → "))
+		switch delta.Status {
+		case kdiff.DeltaNew:
+			fmt.Fprintf(w, "    Newly changed: %s\n", describeChanges(delta.To))
+		case kdiff.DeltaGone:
+			fmt.Fprintf(w, "    No longer changed, was: %s\n", describeChanges(delta.From))
+		case kdiff.DeltaChanged:
+			fmt.Fprintf(w, "    Before: %s\n", describeChanges(delta.From))
+			fmt.Fprintf(w, "    After: %s\n", describeChanges(delta.To))
+		}
+	}
+}
+
+// describeChanges summarizes the changes to a field, e.g.
+// 3 by replicas.yaml
+func describeChanges(changes []kdiff.FieldSource) string {
+	parts := make([]string, len(changes))
+	for i, change := range changes {
+		value := "removed"
+		if change.New != nil {
+			value = fmt.Sprintf("%v", change.New)
+		}
+		parts[i] = fmt.Sprintf("%s by %s", value, describeSource(change))
+	}
+	return strings.Join(parts, ", then ")
+}
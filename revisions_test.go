@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteAttributionDeltas(t *testing.T) {
+	deltas := []kdiff.AttributionDelta{
+		{
+			Resource: "ConfigMap/settings",
+			Path:     []string{"data", "mode"},
+			Status:   kdiff.DeltaNew,
+			To:       []kdiff.FieldSource{{Resource: "ConfigMap/settings", Path: []string{"data", "mode"}, Source: "/app/mode.yaml", SourceType: kdiff.SourceTypePatch, New: "fast"}},
+		},
+		{
+			Resource: "Service/web",
+			Path:     []string{"spec", "type"},
+			Status:   kdiff.DeltaGone,
+			From:     []kdiff.FieldSource{{Resource: "Service/web", Path: []string{"spec", "type"}, Source: "/app/service.yaml", SourceType: kdiff.SourceTypePatch, Original: "ClusterIP", New: "NodePort"}},
+		},
+	}
+
+	var out bytes.Buffer
+	writeAttributionDeltas(&out, "main", "", deltas)
+	assert.Contains(t, out.String(), "=== Attribution Delta (main → working tree) ===")
+	assert.Contains(t, out.String(), "Newly changed: fast by")
+	assert.Contains(t, out.String(), "No longer changed, was: NodePort by")
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+	"sigs.k8s.io/yaml"
+)
+
+// defaultTerminalWidth is used when the terminal width can't be determined
+const defaultTerminalWidth = 80
+
+// columnSeparator divides the original and new columns
+const columnSeparator = " │ "
+
+// isTerminal reports whether f is a terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// terminalWidth returns the width of the terminal on stdout, or when stdout
+// isn't a terminal the width from $COLUMNS, falling back to
+// defaultTerminalWidth
+func terminalWidth() int {
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return defaultTerminalWidth
+}
+
+// renderSideBySide lays out the original and new values of a change in two
+// aligned columns within width, like diff -y. Multi-line values are aligned
+// line by line; lines too long for their column are truncated.
+func renderSideBySide(original, newValue interface{}, width int) []string {
+	columnWidth := (width - utf8.RuneCountInString(columnSeparator)) / 2
+	if columnWidth < 8 {
+		columnWidth = 8
+	}
+
+	left := append([]string{"Original"}, valueLines(original, "")...)
+	right := append([]string{"New"}, valueLines(newValue, "<removed>")...)
+
+	rows := len(left)
+	if len(right) > rows {
+		rows = len(right)
+	}
+	lines := make([]string, rows)
+	for i := range lines {
+		var l, r string
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		lines[i] = strings.TrimRight(padColumn(l, columnWidth)+columnSeparator+truncateColumn(r, columnWidth), " ")
+	}
+	return lines
+}
+
+// valueLines formats a value for a column: scalars on one line, maps and
+// lists as YAML. absent is shown for nil values.
+func valueLines(v interface{}, absent string) []string {
+	switch v.(type) {
+	case nil:
+		if absent == "" {
+			return nil
+		}
+		return []string{absent}
+	case map[string]interface{}, []interface{}:
+		data, err := yaml.Marshal(v)
+		if err == nil {
+			return strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+		}
+	}
+	return strings.Split(fmt.Sprintf("%v", v), "\n")
+}
+
+// truncateColumn shortens s to at most width runes
+func truncateColumn(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
+
+// padColumn truncates or pads s to exactly width runes
+func padColumn(s string, width int) string {
+	s = truncateColumn(s, width)
+	return s + strings.Repeat(" ", width-utf8.RuneCountInString(s))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/term"
+)
+
+func TestRenderSideBySide(t *testing.T) {
+	// Scalars line up on one row
+	lines := renderSideBySide(float64(1), float64(3), 23)
+	assert.Equal(t, []string{
+		"Original   │ New",
+		"1          │ 3",
+	}, lines)
+
+	// Multi-line values are aligned line by line
+	lines = renderSideBySide(
+		map[string]interface{}{"cpu": "100m"},
+		map[string]interface{}{"cpu": "200m", "memory": "1Gi"},
+		35,
+	)
+	assert.Equal(t, []string{
+		"Original         │ New",
+		"cpu: 100m        │ cpu: 200m",
+		"                 │ memory: 1Gi",
+	}, lines)
+
+	// Removed values and long lines
+	lines = renderSideBySide("a-very-long-image-name:1.0", nil, 23)
+	assert.Equal(t, []string{
+		"Original   │ New",
+		"a-very-lo… │ <removed>",
+	}, lines)
+}
+
+func TestTerminalWidth(t *testing.T) {
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		t.Skip("stdout is a terminal, whose width wins")
+	}
+	t.Setenv("COLUMNS", "120")
+	assert.Equal(t, 120, terminalWidth(), "Should fall back to $COLUMNS when stdout isn't a terminal")
+	t.Setenv("COLUMNS", "wide")
+	assert.Equal(t, defaultTerminalWidth, terminalWidth())
+}
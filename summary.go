@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+// Summary is the compact machine-readable outcome of a run, written by
+// -summary-json for CI gating
+type Summary struct {
+	Changes          int                 `json:"changes"`
+	Resources        map[string]int      `json:"resources"`
+	ChangeTypes      map[string]int      `json:"changeTypes"`
+	SourceTypes      map[string]int      `json:"sourceTypes"`
+	UnmatchedPatches []string            `json:"unmatchedPatches"`
+	NoOpPatches      []string            `json:"noOpPatches"`
+	Warnings         []kdiff.Warning     `json:"warnings"`
+	PathPrefixes     map[string]int      `json:"pathPrefixes,omitempty"`  // Set with -count-by-type
+	ResourceOrder    []kdiff.OrderChange `json:"resourceOrder,omitempty"` // Resources sortOptions moved
+}
+
+// changeType classifies a recorded change as added, removed or modified
+func changeType(change kdiff.FieldSource) string {
+	switch {
+	case change.Original == nil:
+		return "added"
+	case change.New == nil:
+		return "removed"
+	default:
+		return "modified"
+	}
+}
+
+// buildSummary counts the reported changes per resource, change type and
+// source type, and lists the patches that didn't match or didn't change
+// anything, along with the run's warnings
+func buildSummary(result *kdiff.Result, sources []kdiff.FieldSource) Summary {
+	summary := Summary{
+		Changes:          len(sources),
+		Resources:        make(map[string]int),
+		ChangeTypes:      make(map[string]int),
+		SourceTypes:      make(map[string]int),
+		UnmatchedPatches: []string{},
+		NoOpPatches:      []string{},
+		Warnings:         []kdiff.Warning{},
+	}
+	for _, change := range sources {
+		summary.Resources[change.Resource]++
+		summary.ChangeTypes[changeType(change)]++
+		if change.SourceType != "" {
+			summary.SourceTypes[change.SourceType]++
+		}
+	}
+	for _, i := range result.Unmatched {
+		summary.UnmatchedPatches = append(summary.UnmatchedPatches, kdiff.DescribePatch(result.Patches[i]))
+	}
+	for _, i := range result.NoOp {
+		summary.NoOpPatches = append(summary.NoOpPatches, kdiff.DescribePatch(result.Patches[i]))
+	}
+	summary.Warnings = append(summary.Warnings, result.Warnings...)
+	summary.ResourceOrder = result.Ordering
+	return summary
+}
+
+// writeSummaryJSON writes the run summary as indented JSON to path
+func writeSummaryJSON(path string, summary Summary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// summaryLine is the run summary in one line, e.g.
+// 3 resources changed, 12 fields (5 add / 4 replace / 3 remove)
+func summaryLine(summary Summary) string {
+	plural := func(n int, word string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, word)
+		}
+		return fmt.Sprintf("%d %ss", n, word)
+	}
+	return fmt.Sprintf("%s changed, %s (%d add / %d replace / %d remove)",
+		plural(len(summary.Resources), "resource"), plural(summary.Changes, "field"),
+		summary.ChangeTypes["added"], summary.ChangeTypes["modified"], summary.ChangeTypes["removed"])
+}
+
+// writeSummaryOnly writes the summary as the only output of -summary-only:
+// the summary line, or the summary's counts as JSON with -o json
+func writeSummaryOnly(w io.Writer, format string, summary Summary) error {
+	if format == "json" {
+		data, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+	_, err := fmt.Fprintln(w, summaryLine(summary))
+	return err
+}
+
+// podTemplatePaths lead to a pod spec, whose fields are grouped one level
+// deeper than other paths
+var podTemplatePaths = [][]string{
+	{"spec", "template", "spec"},
+	{"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// pathPrefix is the dotted prefix a change is counted under: the first two
+// path segments, or the pod spec field for paths into a pod template, e.g.
+// spec.template.spec.containers
+func pathPrefix(path []string) string {
+	n := 2
+	for _, template := range podTemplatePaths {
+		if len(path) > len(template) && strings.Join(path[:len(template)], ".") == strings.Join(template, ".") {
+			n = len(template) + 1
+			break
+		}
+	}
+	if n > len(path) {
+		n = len(path)
+	}
+	return strings.Join(path[:n], ".")
+}
+
+// countByPathPrefix counts the changes under each path prefix
+func countByPathPrefix(sources []kdiff.FieldSource) map[string]int {
+	counts := make(map[string]int)
+	for _, change := range sources {
+		counts[pathPrefix(change.Path)]++
+	}
+	return counts
+}
+
+// writePathHistogram writes the change counts per path prefix as a table,
+// most changed first
+func writePathHistogram(w io.Writer, counts map[string]int) error {
+	prefixes := make([]string, 0, len(counts))
+	for prefix := range counts {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		if counts[prefixes[i]] != counts[prefixes[j]] {
+			return counts[prefixes[i]] > counts[prefixes[j]]
+		}
+		return prefixes[i] < prefixes[j]
+	})
+
+	fmt.Fprintf(w, "\n=== Changes by Path ===\n")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, prefix := range prefixes {
+		fmt.Fprintf(tw, "  %s\t%d\n", prefix, counts[prefix])
+	}
+	return tw.Flush()
+}
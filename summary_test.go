@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestBuildSummary(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      name: test
+  - path: same.yaml
+    target:
+      kind: Deployment
+      name: test
+  - path: missing.yaml
+    target:
+      kind: Deployment
+      name: other
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+`,
+		"/app/replicas.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 3
+  paused: true
+`,
+		"/app/same.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 3
+`,
+		"/app/missing.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: other
+spec:
+  replicas: 2
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := kdiff.Diff(fs, "/app", kdiff.Options{})
+	assert.NoError(t, err)
+
+	sources := []kdiff.FieldSource{
+		{Resource: "Deployment/test", Path: []string{"spec", "replicas"}, SourceType: kdiff.SourceTypePatch, Original: float64(1), New: float64(3)},
+		{Resource: "Deployment/test", Path: []string{"spec", "paused"}, SourceType: kdiff.SourceTypeJSONPatch, New: true},
+		{Resource: "Service/test", Path: []string{"spec", "type"}, Original: "ClusterIP"},
+	}
+	summary := buildSummary(result, sources)
+	assert.Equal(t, 3, summary.Changes)
+	assert.Equal(t, map[string]int{"Deployment/test": 2, "Service/test": 1}, summary.Resources)
+	assert.Equal(t, map[string]int{"added": 1, "modified": 1, "removed": 1}, summary.ChangeTypes)
+	assert.Equal(t, map[string]int{kdiff.SourceTypePatch: 1, kdiff.SourceTypeJSONPatch: 1}, summary.SourceTypes)
+	assert.Equal(t, []string{"/app/missing.yaml"}, summary.UnmatchedPatches)
+	assert.Equal(t, []string{"/app/same.yaml"}, summary.NoOpPatches)
+	assert.Equal(t, []kdiff.Warning{{
+		Patch:    "/app/missing.yaml",
+		Category: kdiff.WarningUnmatchedTarget,
+		Reason:   "No matching resource found for patch target",
+	}}, summary.Warnings, "Should carry the run's warnings")
+
+	// Create a temporary directory for the sidecar file
+	tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "summary.json")
+	assert.NoError(t, writeSummaryJSON(path, summary))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var decoded Summary
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, summary, decoded)
+}
+
+func TestCountByPathPrefix(t *testing.T) {
+	assert.Equal(t, "spec.template.spec.containers", pathPrefix([]string{"spec", "template", "spec", "containers", "0", "image"}))
+	assert.Equal(t, "spec.jobTemplate.spec.template.spec.volumes", pathPrefix([]string{"spec", "jobTemplate", "spec", "template", "spec", "volumes", "0"}))
+	assert.Equal(t, "metadata.labels", pathPrefix([]string{"metadata", "labels", "app"}))
+	assert.Equal(t, "spec.template", pathPrefix([]string{"spec", "template", "spec"}))
+	assert.Equal(t, "spec", pathPrefix([]string{"spec"}))
+
+	sources := []kdiff.FieldSource{
+		{Path: []string{"spec", "template", "spec", "containers", "0", "image"}},
+		{Path: []string{"spec", "template", "spec", "containers", "1", "image"}},
+		{Path: []string{"metadata", "labels", "app"}},
+		{Path: []string{"spec", "replicas"}},
+	}
+	counts := countByPathPrefix(sources)
+	assert.Equal(t, map[string]int{
+		"spec.template.spec.containers": 2,
+		"metadata.labels":               1,
+		"spec.replicas":                 1,
+	}, counts)
+
+	var buf bytes.Buffer
+	assert.NoError(t, writePathHistogram(&buf, counts))
+	assert.Equal(t, `
+=== Changes by Path ===
+  spec.template.spec.containers  2
+  metadata.labels                1
+  spec.replicas                  1
+`, buf.String())
+}
+
+func TestWriteSummaryOnly(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - deployment.yaml
+patches:
+  - path: patch.yaml
+    target:
+      kind: Deployment
+      name: test
+`,
+		"/app/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test
+spec:
+  replicas: 1
+  paused: true
+`,
+		"/app/patch.yaml": `
+- op: replace
+  path: /spec/replicas
+  value: 3
+- op: add
+  path: /spec/minReadySeconds
+  value: 10
+- op: remove
+  path: /spec/paused
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	result, err := kdiff.Diff(fs, "/app", kdiff.Options{})
+	assert.NoError(t, err)
+	summary := buildSummary(result, result.FieldSources)
+
+	var out bytes.Buffer
+	assert.NoError(t, writeSummaryOnly(&out, "text", summary))
+	assert.Equal(t, "1 resource changed, 3 fields (1 add / 1 replace / 1 remove)\n", out.String())
+	assert.NotContains(t, out.String(), "Field:")
+
+	out.Reset()
+	assert.NoError(t, writeSummaryOnly(&out, "json", summary))
+	var decoded Summary
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, 3, decoded.Changes)
+	assert.Equal(t, map[string]int{"Deployment.v1.apps/test.[noNs]": 3}, decoded.Resources)
+}
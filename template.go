@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+)
+
+// ReportData is what a -report-template renders
+type ReportData struct {
+	Changes      int              // Number of reported changes
+	Resources    []ReportResource // Changed resources, sorted by key
+	Unattributed []ReportResource // Final changes no patch or transformer explains
+}
+
+// ReportResource is a changed resource and its changes
+type ReportResource struct {
+	Resource string // Report key, e.g. Deployment/web
+	Changes  []ReportChange
+}
+
+// ReportChange is a single field change for report templates
+type ReportChange struct {
+	Path        string      // Display path, e.g. spec → containers[name=web] → image
+	DottedPath  string      // Path with indexes, e.g. spec.containers.0.image
+	Element     string      // Identity of the innermost list element, e.g. name=web
+	Type        string      // added, removed or modified
+	Source      string      // Source file as displayed
+	SourceType  string      // One of the SourceType* values
+	Description string      // Source with its type, as in the text report
+	Original    interface{} // nil when added
+	New         interface{} // nil when removed
+}
+
+// reportTemplateFuncs are available to report templates in addition to the
+// text/template builtins
+var reportTemplateFuncs = template.FuncMap{
+	// value formats a value as the text report does, and nil as ""
+	"value": func(v interface{}) string {
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprintf("%v", v)
+	},
+	// json encodes a value as compact JSON
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// csv joins fields into a CSV record, quoting as needed
+	"csv": func(fields ...string) (string, error) {
+		var b strings.Builder
+		w := csv.NewWriter(&b)
+		if err := w.Write(fields); err != nil {
+			return "", err
+		}
+		w.Flush()
+		return strings.TrimSuffix(b.String(), "\n"), w.Error()
+	},
+}
+
+// loadReportTemplate parses the Go text/template at path
+func loadReportTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading report template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(reportTemplateFuncs).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing report template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// reportResources groups changes by resource, sorted by resource key, for
+// report templates. objects and opts resolve list element names as in the text
+// report.
+func reportResources(sources []kdiff.FieldSource, objects map[string]interface{}, opts kdiff.Options) []ReportResource {
+	byResource := make(map[string][]ReportChange)
+	for _, change := range sources {
+		byResource[change.Resource] = append(byResource[change.Resource], ReportChange{
+			Path:        formatPath(change, objects[change.Resource], opts),
+			DottedPath:  strings.Join(change.Path, "."),
+			Element:     change.Element,
+			Type:        changeType(change),
+			Source:      formatSource(change.Source),
+			SourceType:  change.SourceType,
+			Description: describeSource(change),
+			Original:    change.Original,
+			New:         change.New,
+		})
+	}
+
+	resources := make([]ReportResource, 0, len(byResource))
+	for resource, changes := range byResource {
+		resources = append(resources, ReportResource{Resource: resource, Changes: changes})
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Resource < resources[j].Resource
+	})
+	return resources
+}
+
+// writeTemplateReport renders the changes through tmpl to w
+func writeTemplateReport(w io.Writer, tmpl *template.Template, sources, unattributed []kdiff.FieldSource, objects map[string]interface{}, opts kdiff.Options) error {
+	return tmpl.Execute(w, ReportData{
+		Changes:      len(sources),
+		Resources:    reportResources(sources, objects, opts),
+		Unattributed: reportResources(unattributed, objects, opts),
+	})
+}
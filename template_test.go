@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportTemplates(t *testing.T) {
+	defer func(base string) { sourceBase = base }(sourceBase)
+	sourceBase = "/app"
+
+	sources := []kdiff.FieldSource{
+		{Resource: "Deployment/web", Path: []string{"spec", "replicas"}, Source: "/app/replicas.yaml", SourceType: kdiff.SourceTypePatch, Original: float64(1), New: float64(3)},
+		{Resource: "Deployment/web", Path: []string{"spec", "template", "spec", "containers", "0", "args"}, Source: "/app/args.yaml", SourceType: kdiff.SourceTypeJSONPatch, Element: "name=web", New: "--debug, --verbose"},
+		{Resource: "ConfigMap/settings", Path: []string{"data", "mode"}, Source: "/app/mode.yaml", SourceType: kdiff.SourceTypePatch, Original: "fast"},
+	}
+	unattributed := []kdiff.FieldSource{
+		{Resource: "Deployment/web", Path: []string{"metadata", "labels", "team"}, Source: kdiff.UnattributedSource, SourceType: kdiff.SourceTypeUnattributed, New: "web"},
+	}
+
+	tmpl, err := loadReportTemplate(filepath.Join("examples", "templates", "changes.csv.tmpl"))
+	assert.NoError(t, err)
+	var out bytes.Buffer
+	assert.NoError(t, writeTemplateReport(&out, tmpl, sources, unattributed, nil, kdiff.Options{}))
+	assert.Equal(t, `resource,field,type,source,original,new
+ConfigMap/settings,data.mode,removed,mode.yaml,fast,
+Deployment/web,spec.replicas,modified,replicas.yaml,1,3
+Deployment/web,spec.template.spec.containers.0.args,added,args.yaml,,"--debug, --verbose"
+`, out.String())
+
+	tmpl, err = loadReportTemplate(filepath.Join("examples", "templates", "changes.md.tmpl"))
+	assert.NoError(t, err)
+	out.Reset()
+	assert.NoError(t, writeTemplateReport(&out, tmpl, sources, unattributed, nil, kdiff.Options{}))
+	assert.Contains(t, out.String(), "3 field change(s) in 2 resource(s).")
+	assert.Contains(t, out.String(), "| `spec → replicas` | replicas.yaml | `1` | `3` |")
+	assert.Contains(t, out.String(), "| `spec → template → spec → containers[name=web] → args` | JSON patch (args.yaml) | _added_ | `--debug, --verbose` |")
+	assert.Contains(t, out.String(), "| `data → mode` | mode.yaml | `fast` | _removed_ |")
+	assert.Contains(t, out.String(), "- `Deployment/web` `metadata → labels → team`")
+}
+
+func TestLoadReportTemplateErrors(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "fieldtrace-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "broken.tmpl")
+	assert.NoError(t, os.WriteFile(path, []byte("{{range .Resources}}"), 0644))
+	_, err = loadReportTemplate(path)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "parsing report template")
+	}
+
+	_, err = loadReportTemplate(filepath.Join(tmpDir, "missing.tmpl"))
+	assert.Error(t, err)
+}
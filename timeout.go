@@ -0,0 +1,14 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// withTimeout returns a context whose deadline is timeout from now, and whose
+// cause names the timeout for the error the run aborts with
+func withTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeoutCause(context.Background(), timeout,
+		fmt.Errorf("timed out after %s: %w", timeout, context.DeadlineExceeded))
+}
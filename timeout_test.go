@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestDiffTimeout(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	kustomization := "resources:\n"
+	for i := 0; i < 20; i++ {
+		kustomization += fmt.Sprintf("  - cm%d.yaml\n", i)
+		assert.NoError(t, fs.WriteFile(fmt.Sprintf("/app/cm%d.yaml", i),
+			[]byte(fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm%d\n", i))))
+	}
+	assert.NoError(t, fs.WriteFile("/app/kustomization.yaml", []byte(kustomization)))
+	slow := slowFs{FileSystem: fs, delay: 10 * time.Millisecond}
+
+	ctx, cancel := withTimeout(30 * time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := kdiff.Diff(slow, "/app", kdiff.Options{BuildFinal: true, Context: ctx})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualError(t, err, "timed out after 30ms: context deadline exceeded")
+	assert.Less(t, time.Since(start), time.Second, "Should stop at the next file read after the deadline")
+
+	// Without a deadline the same tree builds
+	_, err = kdiff.Diff(slow, "/app", kdiff.Options{BuildFinal: true})
+	assert.NoError(t, err)
+}
+
+// slowFs delays every file read, like a filesystem over a slow network
+type slowFs struct {
+	filesys.FileSystem
+	delay time.Duration
+}
+
+func (f slowFs) ReadFile(path string) ([]byte, error) {
+	time.Sleep(f.delay)
+	return f.FileSystem.ReadFile(path)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestDiffGenerators(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/kustomization.yaml": `
+resources:
+  - base
+`,
+		"/app/base/kustomization.yaml": `
+namePrefix: app-
+resources:
+  - deployment.yaml
+generators:
+  - extra.yaml
+`,
+		"/app/base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+		"/app/base/extra.yaml": `
+apiVersion: builtin
+kind: ConfigMapGenerator
+metadata:
+  name: extra
+literals:
+  - owner=web
+options:
+  disableNameSuffixHash: true
+`,
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	// As the root's and a nested kustomization's generators
+	for _, dir := range []string{"/app/base", "/app"} {
+		result, err := kdiff.Diff(fs, dir, kdiff.Options{BuildFinal: true})
+		if !assert.NoError(t, err, dir) {
+			continue
+		}
+		var data *kdiff.FieldSource
+		for i, change := range result.FieldSources {
+			if change.SourceType == kdiff.SourceTypeGenerator+"ConfigMapGenerator" && strings.Join(change.Path, ".") == "data" {
+				data = &result.FieldSources[i]
+			}
+		}
+		if assert.NotNil(t, data, "%s: the generated fields should be attributed to the generator", dir) {
+			assert.Equal(t, "ConfigMap.v1.[noGrp]/app-extra.[noNs]", data.Resource, "Generated resources are keyed as built")
+			assert.Equal(t, "/app/base/extra.yaml", data.Source)
+			assert.Nil(t, data.Original)
+			assert.Equal(t, map[string]interface{}{"owner": "web"}, data.New)
+			assert.Equal(t, "generators entry ConfigMapGenerator (extra.yaml)", describeSource(*data))
+		}
+		assert.Empty(t, result.Unattributed, dir)
+	}
+}
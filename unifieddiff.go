@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultContextLines is how many unchanged lines surround each change in a
+// value diff
+const defaultContextLines = 3
+
+// maxDiffLines bounds the line diff, which takes time and memory proportional
+// to the product of both values' line counts
+const maxDiffLines = 5000
+
+// multilineStrings returns the lines of original and newValue if both are
+// strings with more than one line
+func multilineStrings(original, newValue interface{}) ([]string, []string, bool) {
+	before, ok := original.(string)
+	if !ok || !strings.Contains(strings.TrimSuffix(before, "\n"), "\n") {
+		return nil, nil, false
+	}
+	after, ok := newValue.(string)
+	if !ok || !strings.Contains(strings.TrimSuffix(after, "\n"), "\n") {
+		return nil, nil, false
+	}
+	beforeLines := strings.Split(strings.TrimSuffix(before, "\n"), "\n")
+	afterLines := strings.Split(strings.TrimSuffix(after, "\n"), "\n")
+	if len(beforeLines) > maxDiffLines || len(afterLines) > maxDiffLines {
+		return nil, nil, false
+	}
+	return beforeLines, afterLines, true
+}
+
+// diffOp is one line of a line diff: ' ' kept, '-' removed or '+' added
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines computes a line diff of a and b from their longest common
+// subsequence
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// unifiedDiff renders the line diff of a and b as unified diff hunks with
+// context unchanged lines around each change
+func unifiedDiff(a, b []string, context int) []string {
+	context = max(context, 0)
+	ops := diffLines(a, b)
+
+	// Keep the lines within context of a change
+	keep := make([]bool, len(ops))
+	for k, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		for n := max(0, k-context); n <= min(len(ops)-1, k+context); n++ {
+			keep[n] = true
+		}
+	}
+
+	var out []string
+	line := [2]int{1, 1} // Next line number in a and b
+	for k := 0; k < len(ops); {
+		if !keep[k] {
+			line = advance(line, ops[k].kind)
+			k++
+			continue
+		}
+		start := line
+		var hunk []string
+		for ; k < len(ops) && keep[k]; k++ {
+			hunk = append(hunk, string(ops[k].kind)+ops[k].line)
+			line = advance(line, ops[k].kind)
+		}
+		out = append(out, fmt.Sprintf("@@ -%s +%s @@", hunkRange(start[0], line[0]-start[0]), hunkRange(start[1], line[1]-start[1])))
+		out = append(out, hunk...)
+	}
+	return out
+}
+
+// advance moves the line numbers of both sides past one diff op
+func advance(line [2]int, kind byte) [2]int {
+	if kind != '+' {
+		line[0]++
+	}
+	if kind != '-' {
+		line[1]++
+	}
+	return line
+}
+
+// hunkRange formats a hunk header range; an empty range names the line
+// before it, as diff -u does
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
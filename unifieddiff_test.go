@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	before := strings.Split("a\nb\nc\nd\ne\nf\ng\nh", "\n")
+	after := strings.Split("a\nb\nc\nD\ne\nf\ng\nh\ni", "\n")
+
+	assert.Equal(t, []string{
+		"@@ -3,3 +3,3 @@",
+		" c",
+		"-d",
+		"+D",
+		" e",
+		"@@ -8 +8,2 @@",
+		" h",
+		"+i",
+	}, unifiedDiff(before, after, 1))
+
+	// Overlapping context merges the hunks
+	assert.Equal(t, []string{
+		"@@ -1,8 +1,9 @@",
+		" a", " b", " c", "-d", "+D", " e", " f", " g", " h", "+i",
+	}, unifiedDiff(before, after, 3))
+
+	assert.Equal(t, []string{"@@ -4 +4 @@", "-d", "+D", "@@ -8,0 +9 @@", "+i"}, unifiedDiff(before, after, 0))
+	assert.Empty(t, unifiedDiff(before, before, 3))
+}
+
+func TestMultilineStrings(t *testing.T) {
+	_, _, ok := multilineStrings("one line\n", "two\nlines\n")
+	assert.False(t, ok, "Both values must be multi-line")
+	_, _, ok = multilineStrings("a\nb", map[string]interface{}{"a": "b"})
+	assert.False(t, ok)
+
+	before, after, ok := multilineStrings("a\nb\n", "a\nc\n")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "b"}, before, "A trailing newline isn't an extra line")
+	assert.Equal(t, []string{"a", "c"}, after)
+}
+
+func TestWriteFieldChangesMultiline(t *testing.T) {
+	sources := []kdiff.FieldSource{{
+		Resource: "ConfigMap/scripts",
+		Path:     []string{"data", "run.sh"},
+		Source:   "patch.yaml",
+		Original: "#!/bin/sh\nset -e\necho start\nexit 0\n",
+		New:      "#!/bin/sh\nset -e\necho started\nexit 0\n",
+	}}
+
+	var buf bytes.Buffer
+	writeFieldChanges(&buf, "Field Changes", sources, textStyle{Context: 1})
+	assert.Contains(t, buf.String(), `    Diff:
+      @@ -2,3 +2,3 @@
+       set -e
+      -echo start
+      +echo started
+       exit 0
+`)
+	assert.NotContains(t, buf.String(), "Original:", "Multi-line values should be shown as a diff")
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/malc0lm/kustomize-diff/kdiff"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/yaml"
+)
+
+// watchDebounce is how long the tree must be quiet before a re-run, so an
+// editor saving several files triggers a single run
+const watchDebounce = 300 * time.Millisecond
+
+// clearScreen clears the terminal and moves the cursor to the top left
+func clearScreen() {
+	fmt.Print("\033[H\033[2J")
+}
+
+// watchDirs returns dir and every directory below it, plus the same for each
+// kustomization it references through resources or components (bases often
+// live outside dir)
+func watchDirs(fs filesys.FileSystem, dir string) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	var visit func(dir string)
+	visit = func(dir string) {
+		dir = filepath.Clean(dir)
+		if seen[dir] || !fs.IsDir(dir) {
+			return
+		}
+		seen[dir] = true
+
+		_ = fs.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.IsDir() {
+				dirs = append(dirs, path)
+			}
+			return nil
+		})
+
+		kustPath, exists := kdiff.FindKustomizationFile(fs, dir)
+		if !exists {
+			return
+		}
+		data, err := fs.ReadFile(kustPath)
+		if err != nil {
+			return
+		}
+		var kust types.Kustomization
+		if err := yaml.Unmarshal(data, &kust); err != nil {
+			return
+		}
+		for _, entry := range append(kust.Resources, kust.Components...) {
+			visit(filepath.Join(dir, entry))
+		}
+	}
+	visit(dir)
+	return dirs
+}
+
+// watchTree calls run once, then again whenever files in the kustomization
+// tree are created, modified, removed or renamed. Events are debounced, and
+// the set of watched directories is refreshed after each run so added bases
+// and directories are picked up.
+func watchTree(fs filesys.FileSystem, dir string, debounce time.Duration, run func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	watched := make(map[string]bool)
+	refresh := func() {
+		for _, d := range watchDirs(fs, dir) {
+			if watched[d] {
+				continue
+			}
+			if err := watcher.Add(d); err != nil {
+				logf("Warning: Watching %s failed: %v\n", d, err)
+				continue
+			}
+			watched[d] = true
+		}
+	}
+
+	run()
+	refresh()
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				// fsnotify drops removed directories itself
+				delete(watched, event.Name)
+			}
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logf("Warning: Watch error: %v\n", err)
+		case <-timer.C:
+			run()
+			refresh()
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/filesys"
+)
+
+func TestWatchDirs(t *testing.T) {
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/app/overlay/kustomization.yaml":      "resources:\n  - ../base\ncomponents:\n  - ../component\n",
+		"/app/overlay/patches/patch.yaml":      "kind: Deployment\n",
+		"/app/base/kustomization.yaml":         "resources:\n  - deployment.yaml\n",
+		"/app/base/deployment.yaml":            "kind: Deployment\n",
+		"/app/component/kustomization.yaml":    "kind: Component\n",
+		"/app/unrelated/kustomization.yaml":    "resources: []\n",
+		"/app/overlay/patches/nested/x.yaml":   "kind: Service\n",
+		"/app/component/patches/replicas.yaml": "kind: Deployment\n",
+	}
+	for path, content := range files {
+		assert.NoError(t, fs.WriteFile(path, []byte(content)))
+	}
+
+	dirs := watchDirs(fs, "/app/overlay")
+	assert.ElementsMatch(t, []string{
+		"/app/overlay",
+		"/app/overlay/patches",
+		"/app/overlay/patches/nested",
+		"/app/base",
+		"/app/component",
+		"/app/component/patches",
+	}, dirs, "Should watch the overlay tree and referenced bases and components only")
+}